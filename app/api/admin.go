@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/apierror"
+)
+
+// poolSizeRequest is the body of PUT /admin/pool/size
+type poolSizeRequest struct {
+	Size int `json:"size"`
+}
+
+// poolFor returns the pool of the pipeline named in the path, the pool of
+// WithPool on the /admin/pool routes, writing 404 for an unknown pipeline
+func (s *Server) poolFor(w http.ResponseWriter, r *http.Request) (*processor.Pool, string, bool) {
+	name, ok := mux.Vars(r)["pipeline"]
+	if !ok {
+		return s.pool, "", true
+	}
+	pool, ok := s.pipelines[name]
+	if !ok {
+		apierror.WriteDetails(w, http.StatusNotFound, apierror.CodeNotFound, "Pipeline not found",
+			map[string]string{"pipeline": name})
+		return nil, "", false
+	}
+	return pool, name, true
+}
+
+// handleGetPipelines returns the pool status of every pipeline
+func (s *Server) handleGetPipelines(w http.ResponseWriter, r *http.Request) {
+	statuses := make(map[string]processor.PoolStatus, len(s.pipelines))
+	for name, pool := range s.pipelines {
+		statuses[name] = pool.Status()
+	}
+	s.write(w, r, http.StatusOK, statuses)
+}
+
+// handleGetPool returns the pool size and recent scaling decisions
+func (s *Server) handleGetPool(w http.ResponseWriter, r *http.Request) {
+	pool, _, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	s.write(w, r, http.StatusOK, pool.Status())
+}
+
+// handlePinPoolSize fixes the pool size and disables autoscaling
+func (s *Server) handlePinPoolSize(w http.ResponseWriter, r *http.Request) {
+	pool, name, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	var req poolSizeRequest
+	if err := s.decodeBody(w, r, &req); err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+
+	if err := pool.Pin(req.Size); err != nil {
+		if err == processor.ErrInvalidPoolSize {
+			apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidPoolSize, err.Error(),
+				map[string]int{"min": pool.Status().MinWorkers, "max": pool.Status().MaxWorkers})
+		} else {
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to resize pool")
+		}
+		return
+	}
+
+	s.logger.Printf("Pool size%s pinned to %d", pipelineSuffix(name), req.Size)
+	s.write(w, r, http.StatusOK, pool.Status())
+}
+
+// handleUnpinPoolSize hands the pool size back to the autoscaler
+func (s *Server) handleUnpinPoolSize(w http.ResponseWriter, r *http.Request) {
+	pool, name, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	pool.Unpin()
+	s.logger.Printf("Pool size%s unpinned", pipelineSuffix(name))
+	s.write(w, r, http.StatusOK, pool.Status())
+}
+
+// handlePausePool stops the workers while ingestion continues
+func (s *Server) handlePausePool(w http.ResponseWriter, r *http.Request) {
+	pool, _, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	pool.Pause()
+	s.write(w, r, http.StatusOK, pool.Status())
+}
+
+// handleResumePool restarts a paused or draining pool
+func (s *Server) handleResumePool(w http.ResponseWriter, r *http.Request) {
+	pool, _, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	pool.Resume()
+	s.write(w, r, http.StatusOK, pool.Status())
+}
+
+// handleDrainPool processes the current backlog and then pauses
+func (s *Server) handleDrainPool(w http.ResponseWriter, r *http.Request) {
+	pool, _, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	pool.Drain()
+	s.write(w, r, http.StatusAccepted, pool.Status())
+}
+
+// handleGetWorkers returns the state of every worker
+func (s *Server) handleGetWorkers(w http.ResponseWriter, r *http.Request) {
+	pool, _, ok := s.poolFor(w, r)
+	if !ok {
+		return
+	}
+	s.write(w, r, http.StatusOK, pool.WorkerStatuses())
+}
+
+// pipelineSuffix names a pipeline in a log message, nothing for /admin/pool
+func pipelineSuffix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " of pipeline " + name
+}
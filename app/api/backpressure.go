@@ -0,0 +1,130 @@
+package api
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"coding_challenge/internal/metrics"
+)
+
+// Load is a snapshot of the processing pipeline behind ingestion
+type Load struct {
+	// Depth counts events accepted but not yet processed
+	Depth   int
+	Workers int
+	// Latency is the smoothed processing time of one event
+	Latency time.Duration
+}
+
+// Lag estimates how long a newly accepted event waits to be processed
+func (l Load) Lag() time.Duration {
+	if l.Workers <= 0 {
+		return 0
+	}
+	return l.Latency * time.Duration(l.Depth) / time.Duration(l.Workers)
+}
+
+// BackpressureConfig sets when ingestion is refused. A zero threshold
+// disables that signal.
+type BackpressureConfig struct {
+	MaxQueueDepth int
+	MaxLag        time.Duration
+	// ResumeRatio is the fraction of each threshold the load must fall
+	// below before ingestion resumes, so the limit does not flap
+	ResumeRatio float64
+	// MaxRetryAfter caps the back-off suggested to clients
+	MaxRetryAfter time.Duration
+}
+
+// Backpressure refuses new events while the workers are too far behind
+type Backpressure struct {
+	cfg      BackpressureConfig
+	load     func() Load
+	mu       sync.Mutex
+	active   bool
+	gauge    *metrics.Gauge
+	rejected *metrics.Counter
+}
+
+// NewBackpressure creates a limiter reading the pipeline state from load
+func NewBackpressure(cfg BackpressureConfig, load func() Load, registry *metrics.Registry) *Backpressure {
+	b := &Backpressure{
+		cfg:      cfg,
+		load:     load,
+		gauge:    registry.Gauge("ingest_backpressure_active", "1 while publish requests are refused for backpressure"),
+		rejected: registry.Counter("ingest_rejected_total", "Publish requests rejected before storage by reason", "reason", "backpressure"),
+	}
+	registry.GaugeFunc("ingest_backpressure_queue_depth", "Events accepted but not yet processed", func() float64 {
+		return float64(load().Depth)
+	})
+	registry.GaugeFunc("ingest_backpressure_lag_seconds", "Estimated wait before a new event is processed", func() float64 {
+		return load().Lag().Seconds()
+	})
+	registry.GaugeFunc("ingest_backpressure_max_queue_depth", "Queue depth at which backpressure engages", func() float64 {
+		return float64(cfg.MaxQueueDepth)
+	})
+	registry.GaugeFunc("ingest_backpressure_max_lag_seconds", "Processing lag at which backpressure engages", func() float64 {
+		return cfg.MaxLag.Seconds()
+	})
+	return b
+}
+
+// Check reports whether a publish must be refused and, if so, how long
+// until the backlog is expected to clear
+func (b *Backpressure) Check() (bool, time.Duration) {
+	load := b.load()
+	lag := load.Lag()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	depthOver := b.cfg.MaxQueueDepth > 0 && load.Depth >= b.cfg.MaxQueueDepth
+	lagOver := b.cfg.MaxLag > 0 && lag >= b.cfg.MaxLag
+	switch {
+	case depthOver || lagOver:
+		b.active = true
+	case b.active && load.Depth < b.resumeDepth() && (b.cfg.MaxLag <= 0 || lag < b.resumeLag()):
+		b.active = false
+	}
+	if b.active {
+		b.gauge.Set(1)
+	} else {
+		b.gauge.Set(0)
+		return false, 0
+	}
+
+	b.rejected.Inc()
+	return true, b.retryAfter(load, lag)
+}
+
+// resumeDepth is the depth below which ingestion resumes
+func (b *Backpressure) resumeDepth() int {
+	if b.cfg.MaxQueueDepth <= 0 {
+		return math.MaxInt
+	}
+	return int(float64(b.cfg.MaxQueueDepth) * b.cfg.ResumeRatio)
+}
+
+// resumeLag is the lag below which ingestion resumes
+func (b *Backpressure) resumeLag() time.Duration {
+	return time.Duration(float64(b.cfg.MaxLag) * b.cfg.ResumeRatio)
+}
+
+// retryAfter estimates the time for the workers to bring the load back
+// under the resume thresholds
+func (b *Backpressure) retryAfter(load Load, lag time.Duration) time.Duration {
+	var wait time.Duration
+	if excess := load.Depth - b.resumeDepth(); excess > 0 && load.Workers > 0 {
+		wait = load.Latency * time.Duration(excess) / time.Duration(load.Workers)
+	}
+	if b.cfg.MaxLag > 0 {
+		if excess := lag - b.resumeLag(); excess > wait {
+			wait = excess
+		}
+	}
+	if b.cfg.MaxRetryAfter > 0 && wait > b.cfg.MaxRetryAfter {
+		wait = b.cfg.MaxRetryAfter
+	}
+	return wait
+}
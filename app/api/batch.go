@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/models"
+)
+
+// handlePostBatch stores a batch of events. Each event is validated and
+// stored on its own, so one bad event does not reject the rest; the
+// response reports the outcome of every event in order.
+func (s *Server) handlePostBatch(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	// Checked before decoding, as admitting the batch needs its size
+	if !s.acceptable(w, r) {
+		return
+	}
+
+	var batch models.Batch
+	if err := s.decodeBody(w, r, &batch); err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+	if s.limits.MaxBatchEvents > 0 && len(batch.Events) > s.limits.MaxBatchEvents {
+		apierror.WriteDetails(w, http.StatusRequestEntityTooLarge, apierror.CodeBatchTooLarge, ErrBatchTooLarge.Error(),
+			map[string]int{"max_events": s.limits.MaxBatchEvents, "events": len(batch.Events)})
+		return
+	}
+	if !s.admit(w, r, len(batch.Events)) {
+		return
+	}
+
+	result := &models.BatchResult{Results: make([]models.ItemResult, len(batch.Events))}
+	for i := range batch.Events {
+		event := &batch.Events[i]
+		item := s.storeBatchEvent(tenant, event)
+		if item.Status == http.StatusCreated {
+			result.Accepted++
+		} else {
+			result.Rejected++
+		}
+		result.Results[i] = item
+	}
+
+	s.logger.Printf("Received batch of %d events, %d accepted", len(batch.Events), result.Accepted)
+	s.write(w, r, http.StatusOK, result)
+}
+
+// storeBatchEvent validates and stores one event of a batch
+func (s *Server) storeBatchEvent(tenant string, event *models.Event) models.ItemResult {
+	item := models.ItemResult{ID: event.ID, Status: http.StatusCreated}
+	if err := s.checkPayload(event); err != nil {
+		item.Status, item.Code, item.Message = http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, err.Error()
+		return item
+	}
+	if err := models.ValidateEventAt(event, s.clock.Now()); err != nil {
+		item.Status, item.Code, item.Message = http.StatusBadRequest, apierror.CodeInvalidEvent, err.Error()
+		return item
+	}
+	event.Tenant = tenant
+	_, err := s.admitToPipeline(event)
+	if err == nil {
+		err = s.eventStore.Add(event)
+	}
+	if err != nil {
+		item.Status, item.Code, item.Message = storeFailure(err)
+	}
+	return item
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"coding_challenge/internal/models"
+)
+
+// Compression controls response compression. Request bodies are always
+// decompressed.
+type Compression struct {
+	Enabled bool
+	// MinBytes leaves smaller responses uncompressed, unless they are
+	// flushed early as streams are
+	MinBytes int
+}
+
+// DefaultCompression is used unless WithCompression is given
+var DefaultCompression = Compression{Enabled: true, MinBytes: 1024}
+
+// WithCompression sets how responses are compressed
+func WithCompression(compression Compression) Option {
+	return func(s *Server) {
+		s.compression = compression
+	}
+}
+
+// Compression errors
+var (
+	ErrUnsupportedEncoding = models.Error("unsupported content encoding")
+	ErrInvalidEncoding     = models.Error("request body is not validly encoded")
+)
+
+// Content codings in order of preference
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+// maxZstdWindow bounds the memory a zstd stream may ask the decoder for
+const maxZstdWindow = 8 << 20
+
+// readBody reads the request body, decoding its Content-Encoding. The size
+// limit applies to both the encoded and the decoded body, so a small
+// compressed request cannot expand past it.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	limit := s.limits.MaxBodyBytes
+	var reader io.Reader = r.Body
+	if limit > 0 {
+		reader = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case encodingGzip, "x-gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, s.bodyError(err)
+		}
+		defer gz.Close()
+		reader = gz
+	case encodingZstd:
+		decoder := s.zstdDecoders.Get().(*zstd.Decoder)
+		if err := decoder.Reset(reader); err != nil {
+			return nil, s.bodyError(err)
+		}
+		defer s.zstdDecoders.Put(decoder)
+		reader = decoder
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+
+	if limit > 0 {
+		reader = io.LimitReader(reader, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, s.bodyError(err)
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// bodyError maps an error reading the body to a decoding error
+func (s *Server) bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge), errors.Is(err, zstd.ErrDecoderSizeExceeded), errors.Is(err, zstd.ErrWindowSizeExceeded):
+		return ErrBodyTooLarge
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, zstd.ErrMagicMismatch), errors.Is(err, zstd.ErrCRCMismatch):
+		return ErrInvalidEncoding
+	}
+	return err
+}
+
+// newZstdDecoder creates a decoder bounded by the body size limit
+func (s *Server) newZstdDecoder() interface{} {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow)}
+	if s.limits.MaxBodyBytes > 0 {
+		opts = append(opts, zstd.WithDecoderMaxMemory(uint64(s.limits.MaxBodyBytes)))
+	}
+	decoder, _ := zstd.NewReader(nil, opts...)
+	return decoder
+}
+
+// negotiateEncoding picks the content coding best matching an
+// Accept-Encoding header, or "" for none. As in RFC 9110, "*" only covers
+// the codings the header does not list.
+func negotiateEncoding(header string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	// zstd wins ties as it is cheaper to produce
+	for _, name := range []string{encodingZstd, encodingGzip} {
+		q, listed := weights[name]
+		if !listed {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// encoder is a compressing writer that can flush partial output
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return w
+	}}
+)
+
+// compressResponses wraps next so responses are compressed with the
+// coding negotiated from Accept-Encoding
+func (s *Server) compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: s.compression.MinBytes}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter buffers the start of a response to decide whether it is
+// worth compressing, then streams it through the encoder
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+	status   int
+	buf      []byte
+	started  bool
+	enc      encoder
+}
+
+// WriteHeader records the status until the body decides the encoding
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.started || cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if !bodyAllowed(status) {
+		cw.start(false)
+	}
+}
+
+// Write implements http.ResponseWriter
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.started {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= cw.minBytes {
+			if err := cw.start(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends buffered output to the client, committing to compression so
+// streams are compressed event by event
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets protocol upgrades bypass compression
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close finishes the response, sending short bodies uncompressed
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		cw.start(len(cw.buf) >= cw.minBytes && len(cw.buf) > 0)
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *zstd.Encoder:
+		zstdWriters.Put(enc)
+	}
+	cw.enc = nil
+	return err
+}
+
+// start writes the header, choosing whether to compress, then the buffer
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	header := cw.Header()
+	if compress && compressible(header) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		switch cw.encoding {
+		case encodingZstd:
+			enc := zstdWriters.Get().(*zstd.Encoder)
+			enc.Reset(cw.ResponseWriter)
+			cw.enc = enc
+		default:
+			enc := gzipWriters.Get().(*gzip.Writer)
+			enc.Reset(cw.ResponseWriter)
+			cw.enc = enc
+		}
+	}
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.Write(buf)
+	return err
+}
+
+// bodyAllowed reports whether a status may carry a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressible skips responses that are already encoded or compressed
+func compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zstd", "application/gzip", "application/zip"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
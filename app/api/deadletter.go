@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/apierror"
+)
+
+// RedriveResult is the body of POST /admin/dlq/redrive
+type RedriveResult struct {
+	Redriven  int `json:"redriven"`
+	Remaining int `json:"remaining"`
+}
+
+// deadLetterID reads the dead letter ID of the path, writing 404 when it
+// cannot name one
+func deadLetterID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	value := mux.Vars(r)["id"]
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		apierror.WriteDetails(w, http.StatusNotFound, apierror.CodeNotFound, "Dead letter not found", map[string]string{"id": value})
+		return 0, false
+	}
+	return id, true
+}
+
+// handleListDeadLetters returns the dead letters, oldest first, of the
+// pipeline in ?pipeline= or of every pipeline
+func (s *Server) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	s.write(w, r, http.StatusOK, s.deadLetters.List(r.URL.Query().Get("pipeline")))
+}
+
+// handleGetDeadLetter returns a dead letter
+func (s *Server) handleGetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok {
+		return
+	}
+	letter, err := s.deadLetters.Get(id)
+	if err != nil {
+		s.writeDeadLetterError(w, id, err)
+		return
+	}
+	s.write(w, r, http.StatusOK, letter)
+}
+
+// handleDiscardDeadLetter removes a dead letter without processing it and
+// returns it
+func (s *Server) handleDiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok || !s.acceptable(w, r) {
+		return
+	}
+	letter, err := s.deadLetters.Discard(id)
+	if err != nil {
+		s.writeDeadLetterError(w, id, err)
+		return
+	}
+	s.logger.Printf("Discarded dead letter %d of event %s", id, letter.Event.ID)
+	s.write(w, r, http.StatusOK, letter)
+}
+
+// handleRedriveDeadLetter hands a dead letter back to its pipeline
+func (s *Server) handleRedriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok || !s.acceptable(w, r) {
+		return
+	}
+	letter, err := s.deadLetters.Redrive(id, s.pipelines)
+	if err != nil {
+		s.writeDeadLetterError(w, id, err)
+		return
+	}
+	s.logger.Printf("Redrove dead letter %d of event %s to pipeline %s", id, letter.Event.ID, letter.Pipeline)
+	s.write(w, r, http.StatusAccepted, letter)
+}
+
+// handleRedriveDeadLetters hands the dead letters of the pipeline in
+// ?pipeline=, or of every pipeline, back to their pipelines
+func (s *Server) handleRedriveDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !s.acceptable(w, r) {
+		return
+	}
+	pipeline := r.URL.Query().Get("pipeline")
+	n, err := s.deadLetters.RedriveAll(pipeline, s.pipelines)
+	if n > 0 {
+		s.logger.Printf("Redrove %d dead letters", n)
+	}
+	if err != nil {
+		s.writeDeadLetterError(w, 0, err)
+		return
+	}
+	s.write(w, r, http.StatusAccepted, RedriveResult{Redriven: n, Remaining: len(s.deadLetters.List(pipeline))})
+}
+
+// writeDeadLetterError maps a dead letter queue error to a response
+func (s *Server) writeDeadLetterError(w http.ResponseWriter, id uint64, err error) {
+	switch err {
+	case processor.ErrDeadLetterNotFound:
+		apierror.WriteDetails(w, http.StatusNotFound, apierror.CodeNotFound, "Dead letter not found",
+			map[string]string{"id": strconv.FormatUint(id, 10)})
+	case processor.ErrPoolFull:
+		w.Header().Set("Retry-After", "1")
+		apierror.Write(w, http.StatusTooManyRequests, apierror.CodeBackpressure, "Pipeline is backed up, retry later")
+	case processor.ErrPoolStopped:
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Service is shutting down")
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to redrive dead letter")
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/models"
+)
+
+// Limits bounds the size of request bodies. Zero values are unlimited.
+type Limits struct {
+	MaxBodyBytes    int64
+	MaxPayloadBytes int
+	MaxBatchEvents  int
+}
+
+// DefaultLimits are used unless WithLimits is given
+var DefaultLimits = Limits{
+	MaxBodyBytes:    1 << 20,
+	MaxPayloadBytes: 256 << 10,
+	MaxBatchEvents:  500,
+}
+
+// WithLimits sets the request body and event payload size limits
+func WithLimits(limits Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithCodecs sets the formats accepted in request bodies and offered in
+// responses, codec.Default() unless given
+func WithCodecs(registry *codec.Registry) Option {
+	return func(s *Server) {
+		s.codecs = registry
+	}
+}
+
+// Request decoding errors
+var (
+	ErrBodyTooLarge         = models.Error("request body too large")
+	ErrPayloadTooLarge      = models.Error("event payload too large")
+	ErrBatchTooLarge        = models.Error("too many events in batch")
+	ErrInvalidUTF8          = models.Error("request body is not valid UTF-8")
+	ErrUnsupportedMediaType = models.Error("unsupported content type")
+)
+
+// decodeBody strictly decodes the request body into v with the codec
+// selected by Content-Type. The decompressed body must fit the size limit
+// and hold exactly one value whose fields are all known to v; text formats
+// must also be valid UTF-8.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	c, ok := s.codecs.ForContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		return ErrUnsupportedMediaType
+	}
+
+	body, err := s.readBody(w, r)
+	if err != nil {
+		return err
+	}
+	// encoding/json silently replaces invalid sequences, so check first
+	if !c.Binary() && !utf8.Valid(body) {
+		return ErrInvalidUTF8
+	}
+	return c.Unmarshal(body, v)
+}
+
+// writeDecodeError maps a decodeBody error to a response
+func (s *Server) writeDecodeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrBodyTooLarge:
+		apierror.WriteDetails(w, http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge, err.Error(),
+			map[string]int64{"max_bytes": s.limits.MaxBodyBytes})
+	case ErrUnsupportedEncoding:
+		apierror.WriteDetails(w, http.StatusUnsupportedMediaType, apierror.CodeUnsupportedEncoding, err.Error(),
+			map[string][]string{"supported": {encodingZstd, encodingGzip}})
+	case ErrUnsupportedMediaType:
+		apierror.WriteDetails(w, http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, err.Error(),
+			map[string][]string{"supported": s.codecs.ContentTypes()})
+	default:
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body",
+			map[string]string{"reason": err.Error()})
+	}
+}
+
+// acceptable writes a 406 and returns false when no codec satisfies the
+// Accept header. Handlers changing state call it first, so a request
+// refused for its Accept header has no effect.
+func (s *Server) acceptable(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := s.codecs.Negotiate(r.Header.Get("Accept")); !ok {
+		w.Header().Add("Vary", "Accept")
+		s.writeNotAcceptable(w)
+		return false
+	}
+	return true
+}
+
+func (s *Server) writeNotAcceptable(w http.ResponseWriter) {
+	apierror.WriteDetails(w, http.StatusNotAcceptable, apierror.CodeNotAcceptable, "No acceptable content type",
+		map[string][]string{"supported": s.codecs.ContentTypes()})
+}
+
+// write encodes v with the codec negotiated from the Accept header. Values
+// the negotiated codec cannot represent are sent with the default codec.
+func (s *Server) write(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	c, ok := s.codecs.Negotiate(r.Header.Get("Accept"))
+	if !ok {
+		s.writeNotAcceptable(w)
+		return
+	}
+
+	data, err := c.Marshal(v)
+	if err == codec.ErrUnsupportedType {
+		c = s.codecs.Default()
+		data, err = c.Marshal(v)
+	}
+	if err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", c.ContentType())
+	w.WriteHeader(status)
+	if !c.Binary() {
+		data = append(data, '\n')
+	}
+	w.Write(data)
+}
+
+// checkPayload enforces the payload size limit on a decoded event
+func (s *Server) checkPayload(event *models.Event) error {
+	if s.limits.MaxPayloadBytes > 0 && len(event.Payload) > s.limits.MaxPayloadBytes {
+		return ErrPayloadTooLarge
+	}
+	return nil
+}
+
+// writePayloadTooLarge answers a single event over the payload limit
+func (s *Server) writePayloadTooLarge(w http.ResponseWriter, event *models.Event) {
+	apierror.WriteDetails(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, ErrPayloadTooLarge.Error(),
+		map[string]int{"max_bytes": s.limits.MaxPayloadBytes, "bytes": len(event.Payload)})
+}
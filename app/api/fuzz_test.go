@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/models"
+)
+
+// FuzzHandlePostEvent posts arbitrary bodies under every content type. Any
+// body must get a known status; an event is stored exactly when the
+// response is 201, and every other response is the error envelope.
+func FuzzHandlePostEvent(f *testing.F) {
+	seeds := []string{
+		`{"id":"a","timestamp":1625097600,"payload":"hello","partition_key":"k"}`,
+		`{"id":"a","payload":"x","extra":true}`,
+		`{"id":"a"}{"id":"b"}`,
+		`{"id":"a"} nope`,
+		"{\"id\":\"a\",\"payload\":\"\xff\xfe\"}",
+		`{"payload":"x"}`,
+		`{"id":"","payload":"x"}`,
+		`{"id":"a","timestamp":"yesterday"}`,
+		`{"id":"a","timestamp":1e400}`,
+		`{"id":"a","payload":"` + strings.Repeat("x", 100) + `"}`,
+		`{"id":"\u0000","tenant":"other"}`,
+		`[]`, `null`, `""`, ``, `{`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed), "application/json")
+	}
+	f.Add([]byte{0x81, 0xa2, 'i', 'd', 0xa1, 'a'}, codec.MessagePackType)
+	f.Add([]byte{0xa1, 0x62, 'i', 'd', 0x61, 'a'}, codec.CBORType)
+	f.Add([]byte{0x0a, 0x01, 'a'}, codec.ProtobufType)
+	f.Add([]byte("id=a"), "text/plain")
+
+	logger := log.New(io.Discard, "", 0)
+	f.Fuzz(func(t *testing.T, body []byte, contentType string) {
+		eventStore := models.NewEventStore(10)
+		server := NewServer(":8080", eventStore, logger, WithLimits(Limits{MaxBodyBytes: 256, MaxPayloadBytes: 64}))
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+
+		stored := eventStore.GetAll()
+		switch rec.Code {
+		case http.StatusCreated:
+			var result models.PublishResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Expected a JSON result, got %q: %v", rec.Body.String(), err)
+			}
+			if len(stored) != 1 || stored[0].ID != result.ID {
+				t.Fatalf("Expected only %q stored, got %v", result.ID, stored)
+			}
+			event := stored[0]
+			if event.ID == "" || !utf8.ValidString(event.Payload) || len(event.Payload) > 64 || event.Timestamp == 0 {
+				t.Fatalf("Stored an invalid event %+v", event)
+			}
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+			if len(stored) != 0 {
+				t.Fatalf("Expected nothing stored for status %d, got %v", rec.Code, stored)
+			}
+			var envelope apierror.Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || envelope.Code == "" || envelope.Message == "" {
+				t.Fatalf("Expected the error envelope, got %q", rec.Body.String())
+			}
+		default:
+			t.Fatalf("Unexpected status %d for %q as %q: %s", rec.Code, body, contentType, rec.Body.String())
+		}
+	})
+}
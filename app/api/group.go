@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/models"
+)
+
+// groupRequest is the body of POST /consumer-groups
+type groupRequest struct {
+	Name string `json:"name"`
+	// Cursor positions the group after that event, Latest after the
+	// latest one. The group starts at the beginning without either.
+	Cursor uint64 `json:"cursor"`
+	Latest bool   `json:"latest"`
+}
+
+// groupCursorRequest is the body of PUT /consumer-groups/{group}/cursor
+type groupCursorRequest struct {
+	Cursor uint64 `json:"cursor"`
+	Latest bool   `json:"latest"`
+}
+
+// groupCursor returns the cursor a request positions a group at, writing
+// 400 when it sets both a cursor and latest
+func groupCursor(w http.ResponseWriter, cursor uint64, latest bool) (uint64, bool) {
+	if latest && cursor != 0 {
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body",
+			map[string]string{"reason": "set cursor or latest, not both"})
+		return 0, false
+	}
+	if latest {
+		return models.CursorLatest, true
+	}
+	return cursor, true
+}
+
+// handleListGroups returns the tenant's consumer groups, by name
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	s.write(w, r, http.StatusOK, s.eventStore.Groups(tenant))
+}
+
+// handleCreateGroup creates a consumer group in the tenant's event stream
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	if !s.acceptable(w, r) {
+		return
+	}
+	var req groupRequest
+	if err := s.decodeBody(w, r, &req); err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+	cursor, ok := groupCursor(w, req.Cursor, req.Latest)
+	if !ok {
+		return
+	}
+
+	group, err := s.eventStore.CreateGroup(tenant, req.Name, cursor)
+	if err != nil {
+		writeGroupError(w, req.Name, err)
+		return
+	}
+	s.logger.Printf("Created consumer group %s of tenant %s at %d", group.Name, tenant, group.Cursor)
+	s.write(w, r, http.StatusCreated, group)
+}
+
+// handleGetGroup returns a consumer group and its lag
+func (s *Server) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	name := mux.Vars(r)["group"]
+	group, err := s.eventStore.Group(tenant, name)
+	if err != nil {
+		writeGroupError(w, name, err)
+		return
+	}
+	s.write(w, r, http.StatusOK, group)
+}
+
+// handleSeekGroup moves a consumer group, to replay or skip events
+func (s *Server) handleSeekGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	if !s.acceptable(w, r) {
+		return
+	}
+	var req groupCursorRequest
+	if err := s.decodeBody(w, r, &req); err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+	cursor, ok := groupCursor(w, req.Cursor, req.Latest)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["group"]
+	group, err := s.eventStore.SeekGroup(tenant, name, cursor)
+	if err != nil {
+		writeGroupError(w, name, err)
+		return
+	}
+	s.logger.Printf("Moved consumer group %s of tenant %s to %d", name, tenant, group.Cursor)
+	s.write(w, r, http.StatusOK, group)
+}
+
+// handleDeleteGroup removes a consumer group and returns it
+func (s *Server) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	if !s.acceptable(w, r) {
+		return
+	}
+	name := mux.Vars(r)["group"]
+	group, err := s.eventStore.DeleteGroup(tenant, name)
+	if err != nil {
+		writeGroupError(w, name, err)
+		return
+	}
+	s.logger.Printf("Deleted consumer group %s of tenant %s", name, tenant)
+	s.write(w, r, http.StatusOK, group)
+}
+
+// writeGroupError maps a consumer group error to a response
+func writeGroupError(w http.ResponseWriter, name string, err error) {
+	details := map[string]string{"group": name}
+	switch err {
+	case models.ErrGroupNotFound:
+		apierror.WriteDetails(w, http.StatusNotFound, apierror.CodeNotFound, "Consumer group not found", details)
+	case models.ErrGroupExists:
+		apierror.WriteDetails(w, http.StatusConflict, apierror.CodeGroupExists, "Consumer group already exists", details)
+	case models.ErrInvalidGroup:
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidGroup, err.Error(), details)
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update consumer group")
+	}
+}
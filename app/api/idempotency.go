@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/metrics"
+)
+
+const (
+	// IdempotencyHeader makes a POST safe to retry: repeating it with the
+	// same key replays the first response instead of running it again
+	IdempotencyHeader = "Idempotency-Key"
+	// ReplayedHeader marks responses replayed for an idempotency key
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// idempotentEntry is the outcome of the first request sent with a key
+type idempotentEntry struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	elem        *list.Element
+}
+
+// Idempotency remembers the responses of requests sent with an
+// Idempotency-Key for a TTL, keeping at most maxKeys of them
+type Idempotency struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxKeys int
+	entries map[string]*idempotentEntry
+	// order holds entries oldest first, which is also expiry order
+	order    *list.List
+	replayed *metrics.Counter
+}
+
+// NewIdempotency creates a cache keeping responses for ttl
+func NewIdempotency(ttl time.Duration, maxKeys int, registry *metrics.Registry) *Idempotency {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	c := &Idempotency{
+		ttl:      ttl,
+		maxKeys:  maxKeys,
+		entries:  make(map[string]*idempotentEntry),
+		order:    list.New(),
+		replayed: registry.Counter("idempotency_replays_total", "Responses replayed for a repeated Idempotency-Key"),
+	}
+	registry.GaugeFunc("idempotency_keys", "Idempotency keys currently remembered", func() float64 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return float64(len(c.entries))
+	})
+	return c
+}
+
+// WithIdempotency lets clients retry publishes safely with an
+// Idempotency-Key header
+func WithIdempotency(cache *Idempotency) Option {
+	return func(s *Server) {
+		s.idempotency = cache
+	}
+}
+
+// begin returns the entry for key, creating an in-flight one when the key
+// is new. created reports whether the caller now owns the request.
+func (c *Idempotency) begin(key string, fingerprint [sha256.Size]byte, now time.Time) (entry idempotentEntry, created bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	if existing, ok := c.entries[key]; ok {
+		return *existing, false
+	}
+	for len(c.entries) >= c.maxKeys {
+		c.remove(c.order.Front().Value.(*idempotentEntry))
+	}
+	e := &idempotentEntry{key: key, fingerprint: fingerprint, created: now}
+	e.elem = c.order.PushBack(e)
+	c.entries[key] = e
+	return *e, true
+}
+
+// finish stores the response of the request owning key. Responses asking
+// the client to retry, and 406s refused before any change, are forgotten
+// so the retry runs again.
+func (c *Idempotency) finish(key string, status int, contentType string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusNotAcceptable || status >= http.StatusInternalServerError {
+		c.remove(e)
+		return
+	}
+	e.done, e.status, e.contentType, e.body = true, status, contentType, body
+}
+
+// expire drops entries older than the TTL. Callers must hold c.mu.
+func (c *Idempotency) expire(now time.Time) {
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		e := front.Value.(*idempotentEntry)
+		if now.Sub(e.created) < c.ttl {
+			return
+		}
+		c.remove(e)
+	}
+}
+
+// remove forgets an entry. Callers must hold c.mu.
+func (c *Idempotency) remove(e *idempotentEntry) {
+	c.order.Remove(e.elem)
+	delete(c.entries, e.key)
+}
+
+// idempotent wraps a POST handler so requests repeating an Idempotency-Key
+// get the first response replayed
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	if s.idempotency == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidIdempotencyKey, "Idempotency key too long",
+				map[string]int{"max_length": maxIdempotencyKeyLen})
+			return
+		}
+
+		// The raw body identifies the request, it is decoded later as usual
+		var reader io.Reader = r.Body
+		if s.limits.MaxBodyBytes > 0 {
+			reader = http.MaxBytesReader(w, r.Body, s.limits.MaxBodyBytes)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			s.writeDecodeError(w, s.bodyError(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(append([]byte(r.Header.Get("Content-Type")+"\n"+r.Header.Get("Content-Encoding")+"\n"), body...))
+
+		scoped := clientKey(r) + " " + r.Method + " " + r.URL.Path + " " + key
+		entry, created := s.idempotency.begin(scoped, fingerprint, s.clock.Now())
+		switch {
+		case !created && entry.fingerprint != fingerprint:
+			apierror.Write(w, http.StatusUnprocessableEntity, apierror.CodeIdempotencyKeyReused, "Idempotency key was used with a different request")
+			return
+		case !created && !entry.done:
+			w.Header().Set("Retry-After", "1")
+			apierror.Write(w, http.StatusConflict, apierror.CodeIdempotencyKeyInProgress, "A request with this idempotency key is in progress")
+			return
+		case !created:
+			s.idempotency.replayed.Inc()
+			w.Header().Set("Content-Type", entry.contentType)
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w}
+		defer func() {
+			// A handler that panicked wrote nothing, let the retry run again
+			status := rec.status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			s.idempotency.finish(scoped, status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		}()
+		next(rec, r)
+	}
+}
+
+// recordingWriter copies a response as it is written
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader implements http.ResponseWriter
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
@@ -0,0 +1,571 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"coding_challenge/app/auth"
+	"coding_challenge/app/health"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// openAPI is the subset of an OpenAPI 3 document the contract tests read
+type openAPI struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+// schema is the subset of JSON Schema used by openapi.json
+type schema struct {
+	Ref                  string            `json:"$ref"`
+	Type                 string            `json:"type"`
+	Format               string            `json:"format"`
+	Nullable             bool              `json:"nullable"`
+	Required             []string          `json:"required"`
+	Properties           map[string]schema `json:"properties"`
+	AdditionalProperties json.RawMessage   `json:"additionalProperties"`
+	Items                *schema           `json:"items"`
+	Enum                 []interface{}     `json:"enum"`
+	MinLength            *int              `json:"minLength"`
+	Minimum              *float64          `json:"minimum"`
+	Pattern              string            `json:"pattern"`
+}
+
+func loadSpec(t *testing.T) *openAPI {
+	t.Helper()
+	var spec openAPI
+	if err := json.Unmarshal(OpenAPISpec(), &spec); err != nil {
+		t.Fatalf("Failed to parse openapi.json: %v", err)
+	}
+	return &spec
+}
+
+// operation returns the operation documented for method on a path template
+func (spec *openAPI) operation(method, path string) (*operation, bool) {
+	raw, ok := spec.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return nil, false
+	}
+	var op operation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return nil, false
+	}
+	return &op, true
+}
+
+// validate checks v, decoded with UseNumber, against s
+func (spec *openAPI) validate(s schema, v interface{}, at string) []error {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := spec.Components.Schemas[name]
+		if !ok {
+			return []error{fmt.Errorf("%s: unknown schema %s", at, s.Ref)}
+		}
+		return spec.validate(resolved, v, at)
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return []error{fmt.Errorf("%s: null is not nullable", at)}
+	}
+
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(at+": "+format, args...))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", v, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			fail("expected object, got %T", v)
+			return errs
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		var extra *schema
+		closed := string(s.AdditionalProperties) == "false"
+		if len(s.AdditionalProperties) > 0 && !closed && string(s.AdditionalProperties) != "true" {
+			extra = new(schema)
+			json.Unmarshal(s.AdditionalProperties, extra)
+		}
+		for name, value := range obj {
+			if prop, ok := s.Properties[name]; ok {
+				errs = append(errs, spec.validate(prop, value, at+"."+name)...)
+			} else if extra != nil {
+				errs = append(errs, spec.validate(*extra, value, at+"."+name)...)
+			} else if closed {
+				fail("unexpected property %q", name)
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			fail("expected array, got %T", v)
+			return errs
+		}
+		for i, item := range items {
+			errs = append(errs, spec.validate(*s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("expected string, got %T", v)
+			return errs
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			fail("shorter than %d", *s.MinLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				fail("invalid date-time %q", str)
+			}
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			fail("%q does not match %s", str, s.Pattern)
+		}
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			fail("expected %s, got %T", s.Type, v)
+			return errs
+		}
+		f, err := n.Float64()
+		if err != nil {
+			fail("invalid number %s", n)
+		}
+		if _, err := n.Int64(); s.Type == "integer" && err != nil {
+			fail("expected integer, got %s", n)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("%s is below %v", n, *s.Minimum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("expected boolean, got %T", v)
+		}
+	}
+	return errs
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// specRoute turns a mux path template into an OpenAPI path template
+var muxVariable = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+func specRoute(template string) string {
+	return muxVariable.ReplaceAllString(template, "{$1}")
+}
+
+// contractServer builds a server with every optional route registered
+func contractServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	pool := processor.NewPool(eventStore, processor.PoolConfig{
+		Workers: 2, MinWorkers: 1, MaxWorkers: 4, Partitions: 4, MaxPending: 10,
+	}, metrics.NewRegistry(), logger)
+	registry := health.NewRegistry()
+	registry.SetState(health.StateReady)
+	opts = append([]Option{
+		WithHealth(registry),
+		WithPool(pool),
+		WithPipelines(map[string]*processor.Pool{"default": pool}),
+		WithDeadLetters(processor.NewDeadLetters(10, nil, metrics.NewRegistry())),
+		WithPublished(processor.NewBroadcaster(processor.NewLogPublisher(logger))),
+		WithMetrics(metrics.NewRegistry()),
+		WithLimits(Limits{MaxBodyBytes: 1024, MaxPayloadBytes: 64, MaxBatchEvents: 2}),
+		WithIdempotency(NewIdempotency(time.Minute, 10, metrics.NewRegistry())),
+		// Keep the router reachable for Walk
+		WithCompression(Compression{}),
+	}, opts...)
+	return NewServer(":8080", eventStore, logger, opts...)
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	spec := loadSpec(t)
+	server := contractServer(t)
+	router, ok := server.server.Handler.(*mux.Router)
+	if !ok {
+		t.Fatalf("Expected the handler to be the router, got %T", server.server.Handler)
+	}
+
+	routed := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routed[method+" "+specRoute(template)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for route := range routed {
+		if !documented[route] {
+			t.Errorf("Route %s is not documented in openapi.json", route)
+		}
+	}
+	for route := range documented {
+		if !routed[route] {
+			t.Errorf("openapi.json documents %s, which is not routed", route)
+		}
+	}
+}
+
+// contractCase is one request checked against the document
+type contractCase struct {
+	name        string
+	method      string
+	route       string
+	path        string
+	body        string
+	contentType string
+	accept      string
+	apiKey      string
+	headers     map[string]string
+	// timeout ends streaming requests
+	timeout    time.Duration
+	wantStatus int
+}
+
+// check sends the request and validates both bodies against the operation
+func (c contractCase) check(t *testing.T, spec *openAPI, server *Server) {
+	t.Helper()
+	op, ok := spec.operation(c.method, c.route)
+	if !ok {
+		t.Fatalf("%s %s is not documented", c.method, c.route)
+	}
+
+	contentType := c.contentType
+	if contentType == "" && c.body != "" {
+		contentType = codec.JSONType
+	}
+	// Only requests the server accepts have to match the request schema
+	if c.body != "" && c.wantStatus < 400 {
+		if op.RequestBody == nil {
+			t.Fatalf("%s %s documents no request body", c.method, c.route)
+		}
+		media, ok := op.RequestBody.Content[contentType]
+		if !ok {
+			t.Fatalf("%s %s does not document request type %s", c.method, c.route, contentType)
+		}
+		v, err := decodeJSON([]byte(c.body))
+		if err != nil {
+			t.Fatalf("Invalid request body: %v", err)
+		}
+		for _, err := range spec.validate(media.Schema, v, "request") {
+			t.Error(err)
+		}
+	}
+
+	req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.accept != "" {
+		req.Header.Set("Accept", c.accept)
+	}
+	if c.apiKey != "" {
+		req.Header.Set(auth.APIKeyHeader, c.apiKey)
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	if c.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != c.wantStatus {
+		t.Fatalf("Expected status %d, got %d: %s", c.wantStatus, rec.Code, rec.Body.String())
+	}
+	response, ok := op.Responses[strconv.Itoa(rec.Code)]
+	if !ok {
+		t.Fatalf("%s %s does not document status %d", c.method, c.route, rec.Code)
+	}
+	if len(response.Content) == 0 {
+		if rec.Body.Len() > 0 {
+			t.Errorf("Status %d documents no body, got %q", rec.Code, rec.Body.String())
+		}
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Invalid Content-Type %q: %v", rec.Header().Get("Content-Type"), err)
+	}
+	media, ok := response.Content[mediaType]
+	if !ok {
+		t.Fatalf("Status %d does not document type %s", rec.Code, mediaType)
+	}
+	var v interface{}
+	switch mediaType {
+	case codec.JSONType:
+		if v, err = decodeJSON(rec.Body.Bytes()); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+	case "text/plain", "text/event-stream":
+		v = rec.Body.String()
+	default:
+		// Binary codecs carry the same fields, their schema is checked in JSON
+		return
+	}
+	for _, err := range spec.validate(media.Schema, v, "response") {
+		t.Error(err)
+	}
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	spec := loadSpec(t)
+	deadLetters := processor.NewDeadLetters(10, nil, metrics.NewRegistry())
+	for _, id := range []string{"failed-1", "failed-2", "failed-3"} {
+		deadLetters.Add("default", &models.Event{ID: id}, errors.New("sink unavailable"))
+	}
+	server := contractServer(t, WithDeadLetters(deadLetters))
+
+	event := `{"id":"contract-1","timestamp":1625097600,"payload":"test payload","partition_key":"p"}`
+	cases := []contractCase{
+		{name: "publish", method: "POST", route: "/events", path: "/events", body: event, wantStatus: http.StatusCreated},
+		{name: "publish duplicate", method: "POST", route: "/events", path: "/events", body: event, wantStatus: http.StatusConflict},
+		{name: "publish invalid", method: "POST", route: "/events", path: "/events", body: `{"payload":"x"}`, wantStatus: http.StatusBadRequest},
+		{name: "publish unknown field", method: "POST", route: "/events", path: "/events", body: `{"id":"x","extra":1}`, wantStatus: http.StatusBadRequest},
+		{name: "publish large payload", method: "POST", route: "/events", path: "/events",
+			body: `{"id":"big","payload":"` + strings.Repeat("x", 65) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "publish unsupported type", method: "POST", route: "/events", path: "/events", body: "id=x", contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "publish batch", method: "POST", route: "/events/batch", path: "/events/batch",
+			body: `{"events":[{"id":"contract-2","payload":"a"},{"id":"contract-1","payload":"b"}]}`, wantStatus: http.StatusOK},
+		{name: "publish oversized batch", method: "POST", route: "/events/batch", path: "/events/batch",
+			body: `{"events":[{"id":"a"},{"id":"b"},{"id":"c"}]}`, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "publish idempotent", method: "POST", route: "/events", path: "/events", body: `{"id":"contract-4"}`,
+			headers: map[string]string{IdempotencyHeader: "key-1"}, wantStatus: http.StatusCreated},
+		{name: "publish idempotent replay", method: "POST", route: "/events", path: "/events", body: `{"id":"contract-4"}`,
+			headers: map[string]string{IdempotencyHeader: "key-1"}, wantStatus: http.StatusCreated},
+		{name: "publish idempotent reused", method: "POST", route: "/events", path: "/events", body: `{"id":"contract-5"}`,
+			headers: map[string]string{IdempotencyHeader: "key-1"}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "list", method: "GET", route: "/events", path: "/events", wantStatus: http.StatusOK},
+		{name: "list page", method: "GET", route: "/events", path: "/events?limit=1", wantStatus: http.StatusOK},
+		{name: "list next page", method: "GET", route: "/events", path: "/events?limit=1&cursor=1", wantStatus: http.StatusOK},
+		{name: "list invalid limit", method: "GET", route: "/events", path: "/events?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "stream", method: "GET", route: "/events/stream", path: "/events/stream?cursor=0",
+			timeout: 20 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "stream invalid cursor", method: "GET", route: "/events/stream", path: "/events/stream",
+			headers: map[string]string{"Last-Event-ID": "x"}, wantStatus: http.StatusBadRequest},
+		{name: "published stream", method: "GET", route: "/events/published/stream", path: "/events/published/stream",
+			timeout: 20 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "create group", method: "POST", route: "/consumer-groups", path: "/consumer-groups", body: `{"name":"billing"}`, wantStatus: http.StatusCreated},
+		{name: "create group at latest", method: "POST", route: "/consumer-groups", path: "/consumer-groups", body: `{"name":"audit","latest":true}`, wantStatus: http.StatusCreated},
+		{name: "create existing group", method: "POST", route: "/consumer-groups", path: "/consumer-groups", body: `{"name":"billing"}`, wantStatus: http.StatusConflict},
+		{name: "create invalid group", method: "POST", route: "/consumer-groups", path: "/consumer-groups", body: `{"name":"bad name"}`, wantStatus: http.StatusBadRequest},
+		{name: "list groups", method: "GET", route: "/consumer-groups", path: "/consumer-groups", wantStatus: http.StatusOK},
+		{name: "stream group", method: "GET", route: "/events/stream", path: "/events/stream?group=billing",
+			timeout: 20 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "stream unknown group", method: "GET", route: "/events/stream", path: "/events/stream?group=missing", wantStatus: http.StatusNotFound},
+		{name: "get group", method: "GET", route: "/consumer-groups/{group}", path: "/consumer-groups/billing", wantStatus: http.StatusOK},
+		{name: "get missing group", method: "GET", route: "/consumer-groups/{group}", path: "/consumer-groups/missing", wantStatus: http.StatusNotFound},
+		{name: "seek group", method: "PUT", route: "/consumer-groups/{group}/cursor", path: "/consumer-groups/billing/cursor", body: `{"cursor":0}`, wantStatus: http.StatusOK},
+		{name: "seek group conflicting", method: "PUT", route: "/consumer-groups/{group}/cursor", path: "/consumer-groups/billing/cursor", body: `{"cursor":1,"latest":true}`, wantStatus: http.StatusBadRequest},
+		{name: "seek missing group", method: "PUT", route: "/consumer-groups/{group}/cursor", path: "/consumer-groups/missing/cursor", body: `{"latest":true}`, wantStatus: http.StatusNotFound},
+		{name: "delete group", method: "DELETE", route: "/consumer-groups/{group}", path: "/consumer-groups/audit", wantStatus: http.StatusOK},
+		{name: "delete missing group", method: "DELETE", route: "/consumer-groups/{group}", path: "/consumer-groups/audit", wantStatus: http.StatusNotFound},
+		{name: "list not acceptable", method: "GET", route: "/events", path: "/events", accept: "text/csv", wantStatus: http.StatusNotAcceptable},
+		{name: "list msgpack", method: "GET", route: "/events", path: "/events", accept: codec.MessagePackType, wantStatus: http.StatusOK},
+		{name: "get", method: "GET", route: "/events/{id}", path: "/events/contract-1", wantStatus: http.StatusOK},
+		{name: "get protobuf", method: "GET", route: "/events/{id}", path: "/events/contract-1", accept: codec.ProtobufType, wantStatus: http.StatusOK},
+		{name: "get missing", method: "GET", route: "/events/{id}", path: "/events/missing", wantStatus: http.StatusNotFound},
+		{name: "publish scheduled", method: "POST", route: "/events", path: "/events", body: `{"id":"contract-6","deliver_at":4102444800}`, wantStatus: http.StatusCreated},
+		{name: "publish conflicting schedule", method: "POST", route: "/events", path: "/events", body: `{"id":"x","deliver_at":1,"delay":1}`, wantStatus: http.StatusBadRequest},
+		{name: "publish priority", method: "POST", route: "/events", path: "/events", body: `{"id":"contract-8","priority":"high"}`, wantStatus: http.StatusCreated},
+		{name: "publish unknown priority", method: "POST", route: "/events", path: "/events", body: `{"id":"x","priority":"urgent"}`, wantStatus: http.StatusBadRequest},
+		{name: "publish type and attributes", method: "POST", route: "/events", path: "/events", body: `{"id":"contract-9","type":"order.created","attributes":{"region":"eu"}}`, wantStatus: http.StatusCreated},
+		{name: "publish empty attribute key", method: "POST", route: "/events", path: "/events", body: `{"id":"x","attributes":{"":"eu"}}`, wantStatus: http.StatusBadRequest},
+		{name: "list scheduled", method: "GET", route: "/events/scheduled", path: "/events/scheduled", wantStatus: http.StatusOK},
+		{name: "cancel scheduled", method: "DELETE", route: "/events/scheduled/{id}", path: "/events/scheduled/contract-6", wantStatus: http.StatusOK},
+		{name: "cancel missing", method: "DELETE", route: "/events/scheduled/{id}", path: "/events/scheduled/contract-6", wantStatus: http.StatusNotFound},
+		{name: "cancel delivered", method: "DELETE", route: "/events/scheduled/{id}", path: "/events/scheduled/contract-1", wantStatus: http.StatusConflict},
+
+		{name: "tenant publish", method: "POST", route: "/tenants/{tenant}/events", path: "/tenants/acme/events", body: event, wantStatus: http.StatusCreated},
+		{name: "tenant batch", method: "POST", route: "/tenants/{tenant}/events/batch", path: "/tenants/acme/events/batch",
+			body: `{"events":[{"id":"contract-3"}]}`, wantStatus: http.StatusOK},
+		{name: "tenant list", method: "GET", route: "/tenants/{tenant}/events", path: "/tenants/acme/events", wantStatus: http.StatusOK},
+		{name: "tenant stream", method: "GET", route: "/tenants/{tenant}/events/stream", path: "/tenants/acme/events/stream",
+			timeout: 20 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "tenant published stream", method: "GET", route: "/tenants/{tenant}/events/published/stream", path: "/tenants/acme/events/published/stream",
+			timeout: 20 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "tenant create group", method: "POST", route: "/tenants/{tenant}/consumer-groups", path: "/tenants/acme/consumer-groups", body: `{"name":"billing","cursor":1}`, wantStatus: http.StatusCreated},
+		{name: "tenant list groups", method: "GET", route: "/tenants/{tenant}/consumer-groups", path: "/tenants/acme/consumer-groups", wantStatus: http.StatusOK},
+		{name: "tenant stream group", method: "GET", route: "/tenants/{tenant}/events/stream", path: "/tenants/acme/events/stream?group=billing",
+			timeout: 20 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "tenant get group", method: "GET", route: "/tenants/{tenant}/consumer-groups/{group}", path: "/tenants/acme/consumer-groups/billing", wantStatus: http.StatusOK},
+		{name: "tenant get missing group", method: "GET", route: "/tenants/{tenant}/consumer-groups/{group}", path: "/tenants/other/consumer-groups/billing", wantStatus: http.StatusNotFound},
+		{name: "tenant seek group", method: "PUT", route: "/tenants/{tenant}/consumer-groups/{group}/cursor", path: "/tenants/acme/consumer-groups/billing/cursor", body: `{"latest":true}`, wantStatus: http.StatusOK},
+		{name: "tenant delete group", method: "DELETE", route: "/tenants/{tenant}/consumer-groups/{group}", path: "/tenants/acme/consumer-groups/billing", wantStatus: http.StatusOK},
+		{name: "tenant get", method: "GET", route: "/tenants/{tenant}/events/{id}", path: "/tenants/acme/events/contract-3", wantStatus: http.StatusOK},
+		{name: "tenant get missing", method: "GET", route: "/tenants/{tenant}/events/{id}", path: "/tenants/other/events/contract-3", wantStatus: http.StatusNotFound},
+		{name: "tenant publish scheduled", method: "POST", route: "/tenants/{tenant}/events", path: "/tenants/acme/events", body: `{"id":"contract-7","delay":3600}`, wantStatus: http.StatusCreated},
+		{name: "tenant list scheduled", method: "GET", route: "/tenants/{tenant}/events/scheduled", path: "/tenants/acme/events/scheduled", wantStatus: http.StatusOK},
+		{name: "tenant cancel scheduled", method: "DELETE", route: "/tenants/{tenant}/events/scheduled/{id}", path: "/tenants/acme/events/scheduled/contract-7", wantStatus: http.StatusOK},
+
+		{name: "health", method: "GET", route: "/health", path: "/health", wantStatus: http.StatusOK},
+		{name: "livez", method: "GET", route: "/livez", path: "/livez", wantStatus: http.StatusOK},
+		{name: "readyz", method: "GET", route: "/readyz", path: "/readyz", wantStatus: http.StatusOK},
+		{name: "readyz msgpack", method: "GET", route: "/readyz", path: "/readyz", accept: codec.MessagePackType, wantStatus: http.StatusOK},
+		{name: "metrics", method: "GET", route: "/metrics", path: "/metrics", wantStatus: http.StatusOK},
+		{name: "openapi", method: "GET", route: "/openapi.json", path: "/openapi.json", wantStatus: http.StatusOK},
+
+		{name: "pool", method: "GET", route: "/admin/pool", path: "/admin/pool", wantStatus: http.StatusOK},
+		{name: "pin pool", method: "PUT", route: "/admin/pool/size", path: "/admin/pool/size", body: `{"size":3}`, wantStatus: http.StatusOK},
+		{name: "pin pool out of range", method: "PUT", route: "/admin/pool/size", path: "/admin/pool/size", body: `{"size":9}`, wantStatus: http.StatusBadRequest},
+		{name: "unpin pool", method: "DELETE", route: "/admin/pool/size", path: "/admin/pool/size", wantStatus: http.StatusOK},
+		{name: "pause", method: "POST", route: "/admin/pool/pause", path: "/admin/pool/pause", wantStatus: http.StatusOK},
+		{name: "drain", method: "POST", route: "/admin/pool/drain", path: "/admin/pool/drain", wantStatus: http.StatusAccepted},
+		{name: "resume", method: "POST", route: "/admin/pool/resume", path: "/admin/pool/resume", wantStatus: http.StatusOK},
+		{name: "workers", method: "GET", route: "/admin/workers", path: "/admin/workers", wantStatus: http.StatusOK},
+		{name: "workers cbor", method: "GET", route: "/admin/workers", path: "/admin/workers", accept: codec.CBORType, wantStatus: http.StatusOK},
+		{name: "pipelines", method: "GET", route: "/admin/pipelines", path: "/admin/pipelines", wantStatus: http.StatusOK},
+		{name: "pipeline pool", method: "GET", route: "/admin/pipelines/{pipeline}/pool", path: "/admin/pipelines/default/pool", wantStatus: http.StatusOK},
+		{name: "unknown pipeline pool", method: "GET", route: "/admin/pipelines/{pipeline}/pool", path: "/admin/pipelines/missing/pool", wantStatus: http.StatusNotFound},
+		{name: "pin pipeline pool", method: "PUT", route: "/admin/pipelines/{pipeline}/pool/size", path: "/admin/pipelines/default/pool/size", body: `{"size":2}`, wantStatus: http.StatusOK},
+		{name: "pin pipeline pool out of range", method: "PUT", route: "/admin/pipelines/{pipeline}/pool/size", path: "/admin/pipelines/default/pool/size", body: `{"size":0}`, wantStatus: http.StatusBadRequest},
+		{name: "unpin pipeline pool", method: "DELETE", route: "/admin/pipelines/{pipeline}/pool/size", path: "/admin/pipelines/default/pool/size", wantStatus: http.StatusOK},
+		{name: "pause pipeline", method: "POST", route: "/admin/pipelines/{pipeline}/pool/pause", path: "/admin/pipelines/default/pool/pause", wantStatus: http.StatusOK},
+		{name: "drain pipeline", method: "POST", route: "/admin/pipelines/{pipeline}/pool/drain", path: "/admin/pipelines/default/pool/drain", wantStatus: http.StatusAccepted},
+		{name: "resume pipeline", method: "POST", route: "/admin/pipelines/{pipeline}/pool/resume", path: "/admin/pipelines/default/pool/resume", wantStatus: http.StatusOK},
+		{name: "pipeline workers", method: "GET", route: "/admin/pipelines/{pipeline}/workers", path: "/admin/pipelines/default/workers", wantStatus: http.StatusOK},
+		{name: "dead letters", method: "GET", route: "/admin/dlq", path: "/admin/dlq", wantStatus: http.StatusOK},
+		{name: "dead letters of pipeline", method: "GET", route: "/admin/dlq", path: "/admin/dlq?pipeline=default", wantStatus: http.StatusOK},
+		{name: "dead letter", method: "GET", route: "/admin/dlq/{id}", path: "/admin/dlq/1", wantStatus: http.StatusOK},
+		{name: "missing dead letter", method: "GET", route: "/admin/dlq/{id}", path: "/admin/dlq/99", wantStatus: http.StatusNotFound},
+		{name: "invalid dead letter", method: "GET", route: "/admin/dlq/{id}", path: "/admin/dlq/x", wantStatus: http.StatusNotFound},
+		{name: "redrive dead letter", method: "POST", route: "/admin/dlq/{id}/redrive", path: "/admin/dlq/1/redrive", wantStatus: http.StatusAccepted},
+		{name: "redrive missing dead letter", method: "POST", route: "/admin/dlq/{id}/redrive", path: "/admin/dlq/1/redrive", wantStatus: http.StatusNotFound},
+		{name: "discard dead letter", method: "DELETE", route: "/admin/dlq/{id}", path: "/admin/dlq/2", wantStatus: http.StatusOK},
+		{name: "discard missing dead letter", method: "DELETE", route: "/admin/dlq/{id}", path: "/admin/dlq/2", wantStatus: http.StatusNotFound},
+		{name: "redrive dead letters", method: "POST", route: "/admin/dlq/redrive", path: "/admin/dlq/redrive?pipeline=default", wantStatus: http.StatusAccepted},
+	}
+
+	exercised := make(map[string]bool)
+	for _, c := range cases {
+		exercised[c.method+" "+c.route] = true
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, spec, server)
+		})
+	}
+
+	// Every documented operation needs at least one case above
+	var missing []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method != "parameters" && !exercised[strings.ToUpper(method)+" "+path] {
+				missing = append(missing, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(missing)
+	for _, route := range missing {
+		t.Errorf("No contract case exercises %s", route)
+	}
+}
+
+func TestOpenAPIAuthContract(t *testing.T) {
+	spec := loadSpec(t)
+	logger := log.New(io.Discard, "", 0)
+	authenticator, err := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "producer", Hash: auth.HashAPIKey("producer-key"), Scopes: []auth.Scope{auth.ScopePublish}, Tenant: "acme"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	server := contractServer(t, WithAuth(auth.NewMiddleware(authenticator, metrics.NewRegistry(), logger)))
+
+	cases := []contractCase{
+		{name: "missing credentials", method: "POST", route: "/events", path: "/events", body: `{"id":"a"}`, wantStatus: http.StatusUnauthorized},
+		{name: "missing scope", method: "GET", route: "/events", path: "/events", apiKey: "producer-key", wantStatus: http.StatusForbidden},
+		{name: "wrong tenant", method: "POST", route: "/tenants/{tenant}/events", path: "/tenants/other/events",
+			body: `{"id":"a"}`, apiKey: "producer-key", wantStatus: http.StatusForbidden},
+		{name: "admin forbidden", method: "GET", route: "/admin/pool", path: "/admin/pool", apiKey: "producer-key", wantStatus: http.StatusForbidden},
+		{name: "groups forbidden", method: "POST", route: "/consumer-groups", path: "/consumer-groups", body: `{"name":"billing"}`, apiKey: "producer-key", wantStatus: http.StatusForbidden},
+		{name: "bound tenant", method: "POST", route: "/events", path: "/events", body: `{"id":"a"}`, apiKey: "producer-key", wantStatus: http.StatusCreated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, spec, server)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"coding_challenge/app/auth"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/ratelimit"
+)
+
+// clientIdle is how long a client is remembered after its last request
+const clientIdle = 10 * time.Minute
+
+// ClientLimiter limits the publish rate of each API key, token subject or,
+// for anonymous callers, client IP
+type ClientLimiter struct {
+	buckets  *ratelimit.Keyed
+	rejected *metrics.Counter
+}
+
+// NewClientLimiter allows each client rate events per second with bursts
+// up to burst
+func NewClientLimiter(rate float64, burst int, registry *metrics.Registry) *ClientLimiter {
+	l := &ClientLimiter{
+		buckets:  ratelimit.NewKeyed(rate, burst, clientIdle),
+		rejected: registry.Counter("ingest_rejected_total", "Publish requests rejected before storage by reason", "reason", "client_rate_limit"),
+	}
+	registry.GaugeFunc("ingest_client_rate_limit_events_per_second", "Publish rate allowed per client", func() float64 {
+		return rate
+	})
+	registry.GaugeFunc("ingest_client_rate_limit_burst", "Publish burst allowed per client", func() float64 {
+		return float64(burst)
+	})
+	registry.GaugeFunc("ingest_rate_limited_clients", "Clients currently tracked by the rate limiter", func() float64 {
+		return float64(l.buckets.Len())
+	})
+	return l
+}
+
+// Allow takes a token per event for the client of r at now, returning how
+// long to wait when the client is over its rate
+func (l *ClientLimiter) Allow(r *http.Request, now time.Time, events int) (bool, time.Duration) {
+	ok, wait := l.buckets.Take(clientKey(r), now, float64(events))
+	if !ok {
+		l.rejected.Inc()
+	}
+	return ok, wait
+}
+
+// clientKey identifies the caller, preferring the authenticated principal
+func clientKey(r *http.Request) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		return principal.Method + ":" + principal.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
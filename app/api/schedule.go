@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/models"
+)
+
+// handleGetScheduled returns the tenant's events waiting for their
+// delivery time, soonest first
+func (s *Server) handleGetScheduled(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	s.write(w, r, http.StatusOK, s.eventStore.ScheduledInTenant(tenant))
+}
+
+// handleCancelScheduled cancels an event waiting for its delivery time and
+// returns it
+func (s *Server) handleCancelScheduled(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	if !s.acceptable(w, r) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	event, err := s.eventStore.GetInTenant(tenant, id)
+	if err == nil {
+		err = s.eventStore.CancelScheduled(tenant, id)
+	}
+	switch err {
+	case nil:
+		s.logger.Printf("Canceled scheduled event: %s", id)
+		s.write(w, r, http.StatusOK, event)
+	case models.ErrEventNotFound:
+		apierror.WriteDetails(w, http.StatusNotFound, apierror.CodeNotFound, "Event not found", map[string]string{"id": id})
+	case models.ErrNotScheduled:
+		apierror.WriteDetails(w, http.StatusConflict, apierror.CodeNotScheduled, "Event was already delivered", map[string]string{"id": id})
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to cancel event")
+	}
+}
@@ -2,25 +2,178 @@ package api
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"coding_challenge/app/auth"
+	"coding_challenge/app/health"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/metrics"
 	"coding_challenge/internal/models"
 )
 
 // Server represents the HTTP API server
 type Server struct {
-	server     *http.Server
-	eventStore *models.EventStore
-	logger     *log.Logger
+	server      *http.Server
+	eventStore  *models.EventStore
+	health      *health.Registry
+	metrics     *metrics.Registry
+	pool        *processor.Pool
+	pipelines   map[string]*processor.Pool
+	deadLetters *processor.DeadLetters
+	router      *processor.Router
+	published   *processor.Broadcaster
+	auth        *auth.Middleware
+	limiter     *ClientLimiter
+	pressure    *Backpressure
+	limits      Limits
+	codecs      *codec.Registry
+	// Request and response compression
+	compression  Compression
+	zstdDecoders sync.Pool
+	idempotency  *Idempotency
+	// tenants lists the tenants requests may use besides the default,
+	// any tenant when nil
+	tenants map[string]bool
+	// clock validates timestamps and expires idempotency keys and rate
+	// limits
+	clock clock.Clock
+	// shutdown is closed by Stop to end open streams
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	logger       *log.Logger
+}
+
+// Option customises a Server
+type Option func(*Server)
+
+// WithHealth sets the registry used by the health endpoints
+func WithHealth(registry *health.Registry) Option {
+	return func(s *Server) {
+		s.health = registry
+	}
+}
+
+// WithMetrics exposes the registry on /metrics
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(s *Server) {
+		s.metrics = registry
+	}
+}
+
+// WithPool enables the admin endpoints controlling the worker pool
+func WithPool(pool *processor.Pool) Option {
+	return func(s *Server) {
+		s.pool = pool
+	}
+}
+
+// WithPipelines enables the admin endpoints controlling the pool of each
+// pipeline, under /admin/pipelines/{pipeline}
+func WithPipelines(pools map[string]*processor.Pool) Option {
+	return func(s *Server) {
+		s.pipelines = pools
+	}
+}
+
+// WithDeadLetters enables the admin endpoints inspecting, redriving and
+// discarding dead letters, redriven to the pools of WithPipelines
+func WithDeadLetters(deadLetters *processor.DeadLetters) Option {
+	return func(s *Server) {
+		s.deadLetters = deadLetters
+	}
+}
+
+// WithRouter refuses events whose pipeline queue is full before storing
+// them
+func WithRouter(router *processor.Router) Option {
+	return func(s *Server) {
+		s.router = router
+	}
+}
+
+// WithPublished streams the events the pool publishes on
+// /events/published/stream
+func WithPublished(broadcaster *processor.Broadcaster) Option {
+	return func(s *Server) {
+		s.published = broadcaster
+	}
+}
+
+// WithAuth requires callers to authenticate with the scope of each route
+func WithAuth(middleware *auth.Middleware) Option {
+	return func(s *Server) {
+		s.auth = middleware
+	}
+}
+
+// WithTenants only serves the tenants listed and the default tenant, so
+// callers cannot create namespaces by naming them
+func WithTenants(names []string) Option {
+	return func(s *Server) {
+		s.tenants = make(map[string]bool, len(names))
+		for _, name := range names {
+			s.tenants[name] = true
+		}
+	}
+}
+
+// WithClientRateLimit limits the publish rate of each client
+func WithClientRateLimit(limiter *ClientLimiter) Option {
+	return func(s *Server) {
+		s.limiter = limiter
+	}
+}
+
+// WithBackpressure refuses new events while processing falls behind
+func WithBackpressure(backpressure *Backpressure) Option {
+	return func(s *Server) {
+		s.pressure = backpressure
+	}
+}
+
+// WithClock sets the clock validating timestamps and timing idempotency
+// keys, rate limits and stream heartbeats, the system clock by default
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = clock.OrReal(c)
+	}
+}
+
+// WithTLS serves HTTPS with config. HTTP/2 is offered when config lists
+// "h2" in NextProtos.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.server.TLSConfig = config
+		if !containsProto(config.NextProtos, "h2") {
+			// A non-nil map stops net/http from enabling HTTP/2
+			s.server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+	}
+}
+
+// containsProto reports whether protos lists proto
+func containsProto(protos []string, proto string) bool {
+	for _, p := range protos {
+		if p == proto {
+			return true
+		}
+	}
+	return false
 }
 
 // NewServer creates a new API server
-func NewServer(addr string, eventStore *models.EventStore, logger *log.Logger) *Server {
+func NewServer(addr string, eventStore *models.EventStore, logger *log.Logger, opts ...Option) *Server {
 	router := mux.NewRouter()
 	server := &Server{
 		server: &http.Server{
@@ -30,86 +183,307 @@ func NewServer(addr string, eventStore *models.EventStore, logger *log.Logger) *
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  120 * time.Second,
 		},
-		eventStore: eventStore,
-		logger:     logger,
+		eventStore:  eventStore,
+		health:      health.NewRegistry(),
+		limits:      DefaultLimits,
+		codecs:      codec.Default(),
+		compression: DefaultCompression,
+		clock:       clock.Real,
+		shutdown:    make(chan struct{}),
+		logger:      logger,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
+	server.zstdDecoders.New = server.newZstdDecoder
+	if server.compression.Enabled {
+		server.server.Handler = server.compressResponses(router)
+	}
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Route not found")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "Method not allowed")
+	})
 
-	// Set up routes
-	router.HandleFunc("/events", server.handlePostEvent).Methods(http.MethodPost)
-	router.HandleFunc("/events", server.handleGetEvents).Methods(http.MethodGet)
-	router.HandleFunc("/events/{id}", server.handleGetEvent).Methods(http.MethodGet)
+	// Set up routes, event routes are also served per tenant
+	for _, prefix := range []string{"", "/tenants/{tenant}"} {
+		router.HandleFunc(prefix+"/events", server.protect(auth.ScopePublish, server.idempotent(server.handlePostEvent))).Methods(http.MethodPost)
+		router.HandleFunc(prefix+"/events/batch", server.protect(auth.ScopePublish, server.idempotent(server.handlePostBatch))).Methods(http.MethodPost)
+		router.HandleFunc(prefix+"/events", server.protect(auth.ScopeReadEvents, server.handleGetEvents)).Methods(http.MethodGet)
+		// Registered before /events/{id} so it is not taken for an ID
+		router.HandleFunc(prefix+"/events/stream", server.protect(auth.ScopeReadStream, server.handleStreamEvents)).Methods(http.MethodGet)
+		if server.published != nil {
+			router.HandleFunc(prefix+"/events/published/stream", server.protect(auth.ScopeReadStream, server.handleStreamPublished)).Methods(http.MethodGet)
+		}
+		router.HandleFunc(prefix+"/events/scheduled", server.protect(auth.ScopeReadEvents, server.handleGetScheduled)).Methods(http.MethodGet)
+		router.HandleFunc(prefix+"/events/scheduled/{id}", server.protect(auth.ScopePublish, server.handleCancelScheduled)).Methods(http.MethodDelete)
+		router.HandleFunc(prefix+"/events/{id}", server.protect(auth.ScopeReadEvents, server.handleGetEvent)).Methods(http.MethodGet)
+		router.HandleFunc(prefix+"/consumer-groups", server.protect(auth.ScopeReadStream, server.handleListGroups)).Methods(http.MethodGet)
+		router.HandleFunc(prefix+"/consumer-groups", server.protect(auth.ScopeWriteGroups, server.handleCreateGroup)).Methods(http.MethodPost)
+		router.HandleFunc(prefix+"/consumer-groups/{group}", server.protect(auth.ScopeReadStream, server.handleGetGroup)).Methods(http.MethodGet)
+		router.HandleFunc(prefix+"/consumer-groups/{group}", server.protect(auth.ScopeWriteGroups, server.handleDeleteGroup)).Methods(http.MethodDelete)
+		router.HandleFunc(prefix+"/consumer-groups/{group}/cursor", server.protect(auth.ScopeWriteGroups, server.handleSeekGroup)).Methods(http.MethodPut)
+	}
 	router.HandleFunc("/health", server.handleHealth).Methods(http.MethodGet)
+	router.HandleFunc("/livez", server.handleLivez).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", server.handleReadyz).Methods(http.MethodGet)
+	router.HandleFunc("/openapi.json", server.handleOpenAPI).Methods(http.MethodGet)
+	if server.metrics != nil {
+		router.Handle("/metrics", server.metrics.Handler()).Methods(http.MethodGet)
+	}
+	if server.pool != nil {
+		router.HandleFunc("/admin/pool", server.protect(auth.ScopeAdmin, server.handleGetPool)).Methods(http.MethodGet)
+		router.HandleFunc("/admin/pool/size", server.protect(auth.ScopeAdmin, server.handlePinPoolSize)).Methods(http.MethodPut)
+		router.HandleFunc("/admin/pool/size", server.protect(auth.ScopeAdmin, server.handleUnpinPoolSize)).Methods(http.MethodDelete)
+		router.HandleFunc("/admin/pool/pause", server.protect(auth.ScopeAdmin, server.handlePausePool)).Methods(http.MethodPost)
+		router.HandleFunc("/admin/pool/resume", server.protect(auth.ScopeAdmin, server.handleResumePool)).Methods(http.MethodPost)
+		router.HandleFunc("/admin/pool/drain", server.protect(auth.ScopeAdmin, server.handleDrainPool)).Methods(http.MethodPost)
+		router.HandleFunc("/admin/workers", server.protect(auth.ScopeAdmin, server.handleGetWorkers)).Methods(http.MethodGet)
+	}
+	if server.pipelines != nil {
+		router.HandleFunc("/admin/pipelines", server.protect(auth.ScopeAdmin, server.handleGetPipelines)).Methods(http.MethodGet)
+		prefix := "/admin/pipelines/{pipeline}"
+		router.HandleFunc(prefix+"/pool", server.protect(auth.ScopeAdmin, server.handleGetPool)).Methods(http.MethodGet)
+		router.HandleFunc(prefix+"/pool/size", server.protect(auth.ScopeAdmin, server.handlePinPoolSize)).Methods(http.MethodPut)
+		router.HandleFunc(prefix+"/pool/size", server.protect(auth.ScopeAdmin, server.handleUnpinPoolSize)).Methods(http.MethodDelete)
+		router.HandleFunc(prefix+"/pool/pause", server.protect(auth.ScopeAdmin, server.handlePausePool)).Methods(http.MethodPost)
+		router.HandleFunc(prefix+"/pool/resume", server.protect(auth.ScopeAdmin, server.handleResumePool)).Methods(http.MethodPost)
+		router.HandleFunc(prefix+"/pool/drain", server.protect(auth.ScopeAdmin, server.handleDrainPool)).Methods(http.MethodPost)
+		router.HandleFunc(prefix+"/workers", server.protect(auth.ScopeAdmin, server.handleGetWorkers)).Methods(http.MethodGet)
+	}
+	if server.deadLetters != nil {
+		router.HandleFunc("/admin/dlq", server.protect(auth.ScopeAdmin, server.handleListDeadLetters)).Methods(http.MethodGet)
+		// Registered before /admin/dlq/{id} so it is not taken for an ID
+		router.HandleFunc("/admin/dlq/redrive", server.protect(auth.ScopeAdmin, server.handleRedriveDeadLetters)).Methods(http.MethodPost)
+		router.HandleFunc("/admin/dlq/{id}", server.protect(auth.ScopeAdmin, server.handleGetDeadLetter)).Methods(http.MethodGet)
+		router.HandleFunc("/admin/dlq/{id}", server.protect(auth.ScopeAdmin, server.handleDiscardDeadLetter)).Methods(http.MethodDelete)
+		router.HandleFunc("/admin/dlq/{id}/redrive", server.protect(auth.ScopeAdmin, server.handleRedriveDeadLetter)).Methods(http.MethodPost)
+	}
 
 	return server
 }
 
+// protect enforces scope on a handler when authentication is enabled
+func (s *Server) protect(scope auth.Scope, handler http.HandlerFunc) http.HandlerFunc {
+	if s.auth == nil {
+		return handler
+	}
+	return s.auth.Require(scope, handler)
+}
+
+// Handler returns the HTTP handler serving every route, for embedding the
+// API in another server or a test
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
+	if s.server.TLSConfig != nil {
+		s.logger.Printf("Starting HTTPS server on %s", s.server.Addr)
+		// Certificates come from the TLS config
+		return s.server.ListenAndServeTLS("", "")
+	}
 	s.logger.Printf("Starting HTTP server on %s", s.server.Addr)
 	return s.server.ListenAndServe()
 }
 
+// Serve serves on an existing listener, such as one on a random port
+func (s *Server) Serve(listener net.Listener) error {
+	if s.server.TLSConfig != nil {
+		s.logger.Printf("Starting HTTPS server on %s", listener.Addr())
+		return s.server.ServeTLS(listener, "", "")
+	}
+	s.logger.Printf("Starting HTTP server on %s", listener.Addr())
+	return s.server.Serve(listener)
+}
+
 // Stop gracefully shuts down the server
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Println("Shutting down HTTP server...")
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
 	return s.server.Shutdown(ctx)
 }
 
 // handlePostEvent processes POST requests to create a new event
 func (s *Server) handlePostEvent(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	if !s.admit(w, r, 1) || !s.acceptable(w, r) {
+		return
+	}
+
 	var event models.Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := s.decodeBody(w, r, &event); err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+	if err := s.checkPayload(&event); err != nil {
+		s.writePayloadTooLarge(w, &event)
 		return
 	}
 
-	if err := models.ValidateEvent(&event); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := models.ValidateEventAt(&event, s.clock.Now()); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidEvent, err.Error())
 		return
 	}
+	// The tenant always comes from the request, never from the body
+	event.Tenant = tenant
 
-	if err := s.eventStore.Add(&event); err != nil {
-		if err == models.ErrDuplicateEventID {
-			http.Error(w, "Event with this ID already exists", http.StatusConflict)
-		} else {
-			http.Error(w, "Failed to store event", http.StatusInternalServerError)
+	pipeline, err := s.admitToPipeline(&event)
+	if err == nil {
+		err = s.eventStore.Add(&event)
+	}
+	if err != nil {
+		status, code, message := storeFailure(err)
+		var details interface{}
+		switch err {
+		case processor.ErrPipelineFull:
+			w.Header().Set("Retry-After", "1")
+			details = map[string]string{"pipeline": pipeline}
+		case models.ErrDuplicateEventID:
+			details = map[string]string{"id": event.ID}
+		case models.ErrRateQuotaExceeded:
+			w.Header().Set("Retry-After", retryAfterSeconds(s.eventStore.RateRetryAfter(tenant)))
+			details = map[string]string{"tenant": tenant}
+		case models.ErrQueueFull:
+			w.Header().Set("Retry-After", "1")
+		case models.ErrStorageQuotaExceeded:
+			details = map[string]string{"tenant": tenant}
 		}
+		apierror.WriteDetails(w, status, code, message, details)
 		return
 	}
 
 	s.logger.Printf("Received event: %s", event.ID)
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": event.ID})
+	s.write(w, r, http.StatusCreated, &models.PublishResult{ID: event.ID})
+}
+
+// admitToPipeline returns the pipeline of an event due now and
+// processor.ErrPipelineFull when that pipeline cannot queue it. Scheduled
+// events are queued when they fall due.
+func (s *Server) admitToPipeline(event *models.Event) (string, error) {
+	if s.router == nil || event.DueAt().After(s.clock.Now()) {
+		return "", nil
+	}
+	return s.router.Admit(event)
+}
+
+// storeFailure maps an EventStore.Add or admitToPipeline error to a
+// status, error code and message
+func storeFailure(err error) (int, string, string) {
+	switch err {
+	case processor.ErrPipelineFull:
+		return http.StatusTooManyRequests, apierror.CodeBackpressure, "Pipeline is backed up, retry later"
+	case models.ErrDuplicateEventID:
+		return http.StatusConflict, apierror.CodeDuplicateEvent, "Event with this ID already exists"
+	case models.ErrStoreClosed:
+		return http.StatusServiceUnavailable, apierror.CodeUnavailable, "Service is shutting down"
+	case models.ErrRateQuotaExceeded:
+		return http.StatusTooManyRequests, apierror.CodeRateLimited, err.Error()
+	case models.ErrQueueFull:
+		return http.StatusTooManyRequests, apierror.CodeBackpressure, "Ingestion is backed up, retry later"
+	case models.ErrStorageQuotaExceeded:
+		return http.StatusInsufficientStorage, apierror.CodeStorageQuotaExceeded, err.Error()
+	}
+	return http.StatusInternalServerError, apierror.CodeInternal, "Failed to store event"
 }
 
-// handleGetEvents returns all events
+// admit applies global backpressure, then the client's rate limit for n
+// events. It writes a 429 with Retry-After and returns false when the
+// request is refused.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, n int) bool {
+	if s.pressure != nil {
+		if refused, wait := s.pressure.Check(); refused {
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			apierror.Write(w, http.StatusTooManyRequests, apierror.CodeBackpressure, "Ingestion is backed up, retry later")
+			return false
+		}
+	}
+	if s.limiter != nil {
+		if ok, wait := s.limiter.Allow(r, s.clock.Now(), n); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			apierror.Write(w, http.StatusTooManyRequests, apierror.CodeRateLimited, "Client rate limit exceeded")
+			return false
+		}
+	}
+	return true
+}
+
+// handleGetEvents returns all events of the tenant, or a page of them in
+// insertion order when limit or cursor is given
 func (s *Server) handleGetEvents(w http.ResponseWriter, r *http.Request) {
-	events := s.eventStore.GetAll()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("limit") || query.Has("cursor") {
+		s.handleListEvents(w, r, tenant)
+		return
+	}
+	s.write(w, r, http.StatusOK, s.eventStore.GetAllInTenant(tenant))
 }
 
 // handleGetEvent returns a specific event by ID
 func (s *Server) handleGetEvent(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	event, err := s.eventStore.Get(id)
+	event, err := s.eventStore.GetInTenant(tenant, id)
 	if err != nil {
 		if err == models.ErrEventNotFound {
-			http.Error(w, "Event not found", http.StatusNotFound)
+			apierror.WriteDetails(w, http.StatusNotFound, apierror.CodeNotFound, "Event not found", map[string]string{"id": id})
 		} else {
-			http.Error(w, "Failed to retrieve event", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve event")
 		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(event)
+	s.write(w, r, http.StatusOK, event)
 }
 
-// handleHealth provides a basic health check
+// retryAfterSeconds formats a wait as a Retry-After value, rounding up
+func retryAfterSeconds(wait time.Duration) string {
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+// handleHealth returns a detailed breakdown of every component
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	s.writeHealthReport(w, r, s.health.Report())
+}
+
+// handleLivez reports whether the process should be restarted
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	s.writeHealthReport(w, r, s.health.Liveness())
+}
+
+// handleReadyz reports whether the instance should receive traffic
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealthReport(w, r, s.health.Readiness())
+}
+
+// writeHealthReport encodes a report, using 503 when it is down
+func (s *Server) writeHealthReport(w http.ResponseWriter, r *http.Request, report health.Report) {
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	s.write(w, r, status, report)
 }
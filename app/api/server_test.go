@@ -1,16 +1,42 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"io"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
+
+	"coding_challenge/app/auth"
+	"coding_challenge/app/health"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/certs"
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/metrics"
 	"coding_challenge/internal/models"
 )
 
@@ -135,3 +161,1221 @@ func TestHandleHealth(t *testing.T) {
 		t.Error("Response body does not contain status field")
 	}
 }
+
+func TestHealthProbes(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	registry := health.NewRegistry()
+	registry.Register("storage", health.Readiness, func() health.Result {
+		return health.Result{Status: health.StatusOK}
+	})
+	server := NewServer(":8080", eventStore, logger, WithHealth(registry))
+
+	probe := func(handler http.HandlerFunc) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	// Readiness fails during startup while liveness passes
+	if code := probe(server.handleReadyz); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readyz status %d while starting, got %d", http.StatusServiceUnavailable, code)
+	}
+	if code := probe(server.handleLivez); code != http.StatusOK {
+		t.Errorf("Expected livez status %d while starting, got %d", http.StatusOK, code)
+	}
+
+	registry.SetState(health.StateReady)
+	if code := probe(server.handleReadyz); code != http.StatusOK {
+		t.Errorf("Expected readyz status %d when ready, got %d", http.StatusOK, code)
+	}
+
+	// Health returns the component breakdown
+	rec := httptest.NewRecorder()
+	server.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if _, ok := report.Components["storage"]; !ok {
+		t.Error("Expected storage component in health report")
+	}
+
+	registry.SetState(health.StateDraining)
+	if code := probe(server.handleReadyz); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readyz status %d while draining, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestAdminPoolSize(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	pool := processor.NewPool(eventStore, processor.PoolConfig{
+		Workers: 2, MinWorkers: 1, MaxWorkers: 4, Partitions: 4, MaxPending: 10,
+	}, metrics.NewRegistry(), logger)
+	server := NewServer(":8080", eventStore, logger, WithPool(pool))
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/pool/size", bytes.NewBufferString(body))
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(http.MethodPut, `{"size":9}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for oversized pool, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec := send(http.MethodPut, `{"size":3}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var status processor.PoolStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if status.Size != 3 || !status.Pinned {
+		t.Errorf("Expected pinned pool of 3 workers, got %+v", status)
+	}
+
+	if rec := send(http.MethodDelete, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if pool.Status().Pinned {
+		t.Error("Expected pool to be unpinned")
+	}
+}
+
+func TestAdminPauseResumeAndWorkers(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	pool := processor.NewPool(eventStore, processor.PoolConfig{
+		Workers: 2, Partitions: 4, MaxPending: 10,
+	}, metrics.NewRegistry(), logger)
+	server := NewServer(":8080", eventStore, logger, WithPool(pool))
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	if rec := send(http.MethodPost, "/admin/pool/pause"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if pool.State() != processor.PoolPaused {
+		t.Errorf("Expected pool to be paused, got %s", pool.State())
+	}
+
+	// An empty pool drains straight to paused
+	if rec := send(http.MethodPost, "/admin/pool/drain"); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+
+	if rec := send(http.MethodPost, "/admin/pool/resume"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if pool.State() != processor.PoolRunning {
+		t.Errorf("Expected pool to be running, got %s", pool.State())
+	}
+
+	rec := send(http.MethodGet, "/admin/workers")
+	var workers []processor.WorkerStatus
+	if err := json.NewDecoder(rec.Body).Decode(&workers); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(workers) != 2 {
+		t.Errorf("Expected 2 workers, got %d", len(workers))
+	}
+}
+
+func TestAdminPipelines(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	newPool := func(workers int) *processor.Pool {
+		return processor.NewPool(eventStore, processor.PoolConfig{
+			Workers: workers, MinWorkers: 1, MaxWorkers: 4, Partitions: 4, MaxPending: 10,
+		}, metrics.NewRegistry(), logger)
+	}
+	pools := map[string]*processor.Pool{"default": newPool(2), "audit": newPool(1)}
+	server := NewServer(":8080", eventStore, logger, WithPool(pools["default"]), WithPipelines(pools))
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rec
+	}
+
+	// Each route acts on the pool of its pipeline only
+	if rec := send(http.MethodPost, "/admin/pipelines/audit/pool/pause", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if pools["audit"].State() != processor.PoolPaused || pools["default"].State() != processor.PoolRunning {
+		t.Errorf("Expected only audit paused, got audit %s and default %s", pools["audit"].State(), pools["default"].State())
+	}
+	if rec := send(http.MethodPut, "/admin/pipelines/audit/pool/size", `{"size":3}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if pools["audit"].Size() != 3 || pools["default"].Status().Pinned {
+		t.Errorf("Expected only audit pinned to 3, got %+v and %+v", pools["audit"].Status(), pools["default"].Status())
+	}
+	rec := send(http.MethodGet, "/admin/pipelines/audit/workers", "")
+	var workers []processor.WorkerStatus
+	if err := json.NewDecoder(rec.Body).Decode(&workers); err != nil || len(workers) != 3 {
+		t.Errorf("Expected the 3 audit workers, got %d: %v", len(workers), err)
+	}
+
+	rec = send(http.MethodGet, "/admin/pipelines", "")
+	var statuses map[string]processor.PoolStatus
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if statuses["audit"].State != processor.PoolPaused || statuses["default"].Size != 2 {
+		t.Errorf("Unexpected pipeline statuses %+v", statuses)
+	}
+
+	if rec := send(http.MethodPost, "/admin/pipelines/missing/pool/resume", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown pipeline, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestAdminDeadLetters(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	pool := processor.NewPool(eventStore, processor.PoolConfig{
+		Name: "default", Workers: 1, MinWorkers: 1, MaxWorkers: 1, Partitions: 1, MaxPending: 1,
+	}, metrics.NewRegistry(), logger)
+	deadLetters := processor.NewDeadLetters(10, nil, metrics.NewRegistry())
+	for _, id := range []string{"a", "b", "c"} {
+		deadLetters.Add("default", &models.Event{ID: id}, errors.New("sink unavailable"))
+	}
+	server := NewServer(":8080", eventStore, logger, WithPool(pool),
+		WithPipelines(map[string]*processor.Pool{"default": pool}), WithDeadLetters(deadLetters))
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := send(http.MethodGet, "/admin/dlq?pipeline=default")
+	var letters []processor.DeadLetter
+	if err := json.NewDecoder(rec.Body).Decode(&letters); err != nil || len(letters) != 3 {
+		t.Fatalf("Expected 3 dead letters, got %d: %v", len(letters), err)
+	}
+	if letters[0].Event.ID != "a" || letters[0].Error != "sink unavailable" {
+		t.Errorf("Unexpected dead letter %+v", letters[0])
+	}
+
+	if rec := send(http.MethodDelete, "/admin/dlq/2"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec := send(http.MethodPost, "/admin/dlq/1/redrive"); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+
+	// The pool is not started, so its only pending slot is taken and the
+	// last dead letter stays queued
+	rec = send(http.MethodPost, "/admin/dlq/redrive")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status %d with Retry-After, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := deadLetters.List(""); len(got) != 1 || got[0].Event.ID != "c" {
+		t.Errorf("Expected only c left, got %+v", got)
+	}
+}
+
+func TestRoutesRequireScopes(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	authenticator, err := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "producer", Hash: auth.HashAPIKey("producer-key"), Scopes: []auth.Scope{auth.ScopePublish}},
+		{Name: "reader", Hash: auth.HashAPIKey("reader-key"), Scopes: []auth.Scope{auth.ScopeReadStream}},
+		{Name: "operator", Hash: auth.HashAPIKey("operator-key"), Scopes: []auth.Scope{auth.ScopeWriteGroups}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	middleware := auth.NewMiddleware(authenticator, metrics.NewRegistry(), logger)
+	server := NewServer(":8080", eventStore, logger, WithAuth(middleware))
+
+	send := func(method, path, key, body string) int {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	event := `{"id":"auth-1","payload":"test payload"}`
+	if code := send(http.MethodPost, "/events", "", event); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := send(http.MethodPost, "/events", "producer-key", event); code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	if code := send(http.MethodGet, "/events", "producer-key", ""); code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, code)
+	}
+
+	// Stream readers see consumer groups but cannot move other consumers'
+	if code := send(http.MethodPost, "/consumer-groups", "operator-key", `{"name":"billing"}`); code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	if code := send(http.MethodGet, "/consumer-groups/billing", "reader-key", ""); code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/consumer-groups", `{"name":"audit"}`},
+		{http.MethodPut, "/consumer-groups/billing/cursor", `{"latest":true}`},
+		{http.MethodDelete, "/consumer-groups/billing", ""},
+	} {
+		if code := send(req.method, req.path, "reader-key", req.body); code != http.StatusForbidden {
+			t.Errorf("Expected %s %s to be forbidden to a stream reader, got %d", req.method, req.path, code)
+		}
+	}
+
+	// Probes stay open for orchestrators
+	if code := send(http.MethodGet, "/livez", "", ""); code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestTenantRoutes(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	eventStore.SetQuotas(map[string]models.TenantQuota{
+		"limited": {EventsPerSecond: 1, Burst: 1},
+	}, models.TenantQuota{})
+	logger := log.New(io.Discard, "", 0)
+	authenticator, err := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "team-a", Hash: auth.HashAPIKey("a-key"), Scopes: []auth.Scope{auth.ScopePublish, auth.ScopeReadEvents}, Tenant: "team-a"},
+		{Name: "operator", Hash: auth.HashAPIKey("op-key"), Scopes: []auth.Scope{auth.ScopeAll}},
+		{Name: "unbound", Hash: auth.HashAPIKey("u-key"), Scopes: []auth.Scope{auth.ScopePublish, auth.ScopeReadEvents}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	middleware := auth.NewMiddleware(authenticator, metrics.NewRegistry(), logger)
+	server := NewServer(":8080", eventStore, logger, WithAuth(middleware))
+
+	send := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(auth.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A bound key publishes into its own tenant without naming it
+	if rec := send(http.MethodPost, "/events", "a-key", `{"id":"t-1","payload":"a"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if _, err := eventStore.GetInTenant("team-a", "t-1"); err != nil {
+		t.Errorf("Expected event in team-a, got: %v", err)
+	}
+
+	// ...and cannot reach another tenant
+	if rec := send(http.MethodGet, "/tenants/team-b/events", "a-key", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// An unbound key without every scope is confined to the default tenant
+	if rec := send(http.MethodPost, "/tenants/team-c/events", "u-key", `{"id":"u-1","payload":"a"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec := send(http.MethodPost, "/tenants/default/events", "u-key", `{"id":"u-1","payload":"a"}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	// An operator holding every scope can address any tenant explicitly
+	if rec := send(http.MethodGet, "/tenants/team-a/events/t-1", "op-key", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec := send(http.MethodGet, "/events/t-1", "op-key", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected default tenant not to see team-a events, got %d", rec.Code)
+	}
+	if rec := send(http.MethodGet, "/tenants/bad%20name/events", "op-key", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// Quotas answer with 429 and a retry hint
+	send(http.MethodPost, "/tenants/limited/events", "op-key", `{"id":"q-1","payload":"x"}`)
+	rec := send(http.MethodPost, "/tenants/limited/events", "op-key", `{"id":"q-2","payload":"x"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+}
+
+func TestConfiguredTenantsOnly(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0), WithTenants([]string{"team-a"}))
+
+	post := func(path, id string) int {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"id":"`+id+`","payload":"x"}`))
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("/tenants/team-a/events", "a"); code != http.StatusCreated {
+		t.Errorf("Expected status %d for a configured tenant, got %d", http.StatusCreated, code)
+	}
+	if code := post("/events", "b"); code != http.StatusCreated {
+		t.Errorf("Expected status %d for the default tenant, got %d", http.StatusCreated, code)
+	}
+	if code := post("/tenants/team-z/events", "c"); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown tenant, got %d", http.StatusNotFound, code)
+	}
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tenants/team-z/events", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected reads of an unknown tenant refused, got %d", rec.Code)
+	}
+	if events := eventStore.GetAllInTenant("team-z"); len(events) != 0 {
+		t.Errorf("Expected nothing stored for team-z, got %d", len(events))
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	registry := metrics.NewRegistry()
+	server := NewServer(":8080", eventStore, logger, WithClientRateLimit(NewClientLimiter(0.001, 1, registry)))
+
+	post := func(id, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"id":"`+id+`","payload":"x"}`))
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("rl-1", "10.0.0.1:1234"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	rec := post("rl-2", "10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+
+	// Other clients have their own budget
+	if rec := post("rl-3", "10.0.0.2:1234"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	var out bytes.Buffer
+	registry.WriteText(&out)
+	if !strings.Contains(out.String(), `ingest_rejected_total{reason="client_rate_limit"} 1`) {
+		t.Errorf("Expected rejection to be counted, got:\n%s", out.String())
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	registry := metrics.NewRegistry()
+
+	load := Load{Workers: 2, Latency: 100 * time.Millisecond}
+	backpressure := NewBackpressure(BackpressureConfig{
+		MaxQueueDepth: 100,
+		MaxLag:        10 * time.Second,
+		ResumeRatio:   0.5,
+		MaxRetryAfter: 30 * time.Second,
+	}, func() Load { return load }, registry)
+	server := NewServer(":8080", eventStore, logger, WithBackpressure(backpressure))
+
+	post := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"id":"`+id+`","payload":"x"}`))
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	load.Depth = 10
+	if rec := post("bp-1"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	// 120 queued events over 2 workers at 100ms each drain to the resume
+	// depth of 50 in 3.5s
+	load.Depth = 120
+	rec := post("bp-2")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "4" {
+		t.Errorf("Expected Retry-After 4, got %q", got)
+	}
+
+	// Still refused between the resume and engage thresholds
+	load.Depth = 80
+	if rec := post("bp-3"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+
+	load.Depth = 40
+	if rec := post("bp-4"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	// Lag alone also engages backpressure
+	load = Load{Depth: 90, Workers: 1, Latency: 200 * time.Millisecond}
+	if rec := post("bp-5"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for lag, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+}
+
+// testCA issues certificates signed by a generated self-signed CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key for subject
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestQueueFullRefusesEvents(t *testing.T) {
+	eventStore := models.NewEventStore(1)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0))
+	post := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(`{"id":"`+id+`"}`))
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("q-1"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	// Nothing consumes the queue, so the next event would never be processed
+	rec := post("q-2")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Expected 429 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if _, err := eventStore.Get("q-2"); err != models.ErrEventNotFound {
+		t.Errorf("Expected the refused event not to be stored, got %v", err)
+	}
+	<-eventStore.Lane(models.PriorityNormal)
+	if rec := post("q-2"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected the retry to succeed, got %d", rec.Code)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	serverCert, serverKey := ca.issue(t, pkix.Name{CommonName: "events"}, x509.ExtKeyUsageServerAuth)
+	files := map[string][]byte{"server.crt": serverCert, "server.key": serverKey, "ca.pem": ca.pem}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	reloader, err := certs.NewReloader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem"), logger)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	authenticator := auth.NewCertAuthenticator([]auth.ClientCert{
+		{Subject: "ingest", Scopes: []auth.Scope{auth.ScopePublish}},
+	})
+	server := NewServer("127.0.0.1:0", models.NewEventStore(10), logger,
+		WithAuth(auth.NewMiddleware(authenticator, metrics.NewRegistry(), logger)),
+		WithTLS(reloader.ServerConfig(false, true)))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.server.ServeTLS(listener, "", "")
+	defer server.server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+	}
+	url := "https://" + listener.Addr().String() + "/events"
+	body := `{"id":"mtls-1","payload":"x"}`
+
+	clientCert, clientKey := ca.issue(t, pkix.Name{CommonName: "ingest", Organization: []string{"Example"}}, x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	resp, err := newClient(pair).Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+	}
+
+	// Without a certificate the handshake succeeds but no principal is found
+	resp, err = newClient().Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	// Certificates from another CA fail the handshake
+	otherCert, otherKey := newTestCA(t).issue(t, pkix.Name{CommonName: "ingest"}, x509.ExtKeyUsageClientAuth)
+	otherPair, _ := tls.X509KeyPair(otherCert, otherKey)
+	if _, err := newClient(otherPair).Post(url, "application/json", strings.NewReader(body)); err == nil {
+		t.Error("Expected handshake with an untrusted client certificate to fail")
+	}
+}
+
+func TestPostEventRejectsMalformedBodies(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	logger := log.New(io.Discard, "", 0)
+	server := NewServer(":8080", eventStore, logger, WithLimits(Limits{MaxBodyBytes: 128, MaxPayloadBytes: 16}))
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"unknown field", `{"id":"m-1","payload":"x","extra":true}`, http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"multiple values", `{"id":"m-2","payload":"x"}{"id":"m-3"}`, http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"trailing garbage", `{"id":"m-4","payload":"x"} nope`, http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"invalid UTF-8", "{\"id\":\"m-5\",\"payload\":\"\xff\xfe\"}", http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"body too large", `{"id":"m-6","payload":"` + strings.Repeat("x", 200) + `"}`, http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge},
+		{"payload too large", `{"id":"m-7","payload":"` + strings.Repeat("x", 17) + `"}`, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge},
+		{"missing ID", `{"payload":"x"}`, http.StatusBadRequest, apierror.CodeInvalidEvent},
+		{"unknown priority", `{"id":"m-9","priority":"urgent"}`, http.StatusBadRequest, apierror.CodeInvalidEvent},
+		{"trailing whitespace", "{\"id\":\"m-8\",\"payload\":\"x\"}\n", http.StatusCreated, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantCode == "" {
+				return
+			}
+			var envelope apierror.Response
+			if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+				t.Fatalf("Expected JSON error envelope: %v", err)
+			}
+			if envelope.Code != tc.wantCode || envelope.Message == "" {
+				t.Errorf("Expected code %q with a message, got %+v", tc.wantCode, envelope)
+			}
+		})
+	}
+}
+
+func TestUnknownRoutesUseErrorEnvelope(t *testing.T) {
+	server := NewServer(":8080", models.NewEventStore(10), log.New(io.Discard, "", 0))
+
+	for path, want := range map[string]string{"/missing": apierror.CodeNotFound, "/events/x": apierror.CodeMethodNotAllowed} {
+		method := http.MethodGet
+		if want == apierror.CodeMethodNotAllowed {
+			method = http.MethodDelete
+		}
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+		var envelope apierror.Response
+		if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil || envelope.Code != want {
+			t.Errorf("%s %s: expected code %q, got %+v (%v)", method, path, want, envelope, err)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0))
+	codecs := codec.Default()
+
+	send := func(method, path, contentType, accept string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Publish in each binary format and read the acknowledgement back in it
+	for _, name := range []string{"msgpack", "cbor", "protobuf"} {
+		c, _ := codecs.ByName(name)
+		body, err := c.Marshal(&models.Event{ID: "neg-" + name, Payload: "payload"})
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", name, err)
+		}
+		rec := send(http.MethodPost, "/events", c.ContentType(), c.ContentType(), body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%s: expected status %d, got %d: %s", name, http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got != c.ContentType() {
+			t.Errorf("%s: expected Content-Type %s, got %s", name, c.ContentType(), got)
+		}
+		var ack models.PublishResult
+		if err := c.Unmarshal(rec.Body.Bytes(), &ack); err != nil || ack.ID != "neg-"+name {
+			t.Errorf("%s: unexpected acknowledgement %+v (%v)", name, ack, err)
+		}
+	}
+
+	// List events as protobuf
+	rec := send(http.MethodGet, "/events", "", codec.ProtobufType, nil)
+	var events []models.Event
+	if err := (codec.Protobuf{}).Unmarshal(rec.Body.Bytes(), &events); err != nil || len(events) != 3 {
+		t.Errorf("Expected 3 protobuf events, got %d (%v)", len(events), err)
+	}
+
+	// Types without a protobuf message fall back to JSON
+	rec = send(http.MethodGet, "/health", "", codec.ProtobufType, nil)
+	if got := rec.Header().Get("Content-Type"); got != codec.JSONType {
+		t.Errorf("Expected JSON fallback, got %s", got)
+	}
+
+	if rec := send(http.MethodPost, "/events", "text/plain", "", []byte("hello")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status %d, got %d", http.StatusUnsupportedMediaType, rec.Code)
+	}
+	if rec := send(http.MethodGet, "/events", "", "text/html", nil); rec.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status %d, got %d", http.StatusNotAcceptable, rec.Code)
+	}
+}
+
+func TestNotAcceptableStoresNothing(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0),
+		WithIdempotency(NewIdempotency(time.Minute, 10, metrics.NewRegistry())))
+
+	send := func(path, body, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", codec.JSONType)
+		req.Header.Set("Accept", accept)
+		req.Header.Set(IdempotencyHeader, "key-"+path)
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	bodies := map[string]string{
+		"/events":       `{"id": "single", "payload": "p"}`,
+		"/events/batch": `{"events": [{"id": "batched", "payload": "p"}]}`,
+	}
+	for path, body := range bodies {
+		if rec := send(path, body, "text/html"); rec.Code != http.StatusNotAcceptable {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusNotAcceptable, rec.Code)
+		}
+	}
+	if events := eventStore.GetAll(); len(events) != 0 {
+		t.Errorf("Expected no events stored after a 406, got %d", len(events))
+	}
+
+	// Retrying with the same key and an acceptable type stores the events
+	for path, body := range bodies {
+		rec := send(path, body, codec.JSONType)
+		if rec.Code/100 != 2 || rec.Header().Get(ReplayedHeader) != "" {
+			t.Errorf("%s: expected a fresh success, got %d", path, rec.Code)
+		}
+	}
+	if events := eventStore.GetAll(); len(events) != 2 {
+		t.Errorf("Expected 2 events stored after the retries, got %d", len(events))
+	}
+}
+
+func TestPostBatch(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0),
+		WithLimits(Limits{MaxBodyBytes: 1 << 20, MaxPayloadBytes: 8, MaxBatchEvents: 4}))
+	_ = eventStore.Add(&models.Event{ID: "existing"})
+
+	body, _ := (codec.Protobuf{}).Marshal(&models.Batch{Events: []models.Event{
+		{ID: "b-1", Payload: "ok"},
+		{ID: "existing", Payload: "dup"},
+		{Payload: "no id"},
+		{ID: "b-2", Payload: "far too large"},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/events/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", codec.ProtobufType)
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var result models.BatchResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Accepted != 1 || result.Rejected != 3 {
+		t.Errorf("Expected 1 accepted and 3 rejected, got %+v", result)
+	}
+	wantStatus := []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest, http.StatusRequestEntityTooLarge}
+	for i, want := range wantStatus {
+		if result.Results[i].Status != want {
+			t.Errorf("Event %d: expected status %d, got %+v", i, want, result.Results[i])
+		}
+	}
+
+	// Oversized batches are refused as a whole
+	tooMany := `{"events":[{"id":"1"},{"id":"2"},{"id":"3"},{"id":"4"},{"id":"5"}]}`
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/events/batch", strings.NewReader(tooMany)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
+
+func TestCompressedRequests(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0), WithLimits(Limits{MaxBodyBytes: 1024}))
+
+	gzipBody := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+	zstdBody := func(data []byte) []byte {
+		enc, _ := zstd.NewWriter(nil)
+		defer enc.Close()
+		return enc.EncodeAll(data, nil)
+	}
+	// A tiny compressed body that expands far past the limit
+	bomb := []byte(`{"id":"bomb","payload":"` + strings.Repeat("a", 1<<20) + `"}`)
+
+	testCases := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+	}{
+		{"gzip", "gzip", gzipBody([]byte(`{"id":"gz-1","payload":"x"}`)), http.StatusCreated},
+		{"zstd", "zstd", zstdBody([]byte(`{"id":"zs-1","payload":"x"}`)), http.StatusCreated},
+		{"gzip bomb", "gzip", gzipBody(bomb), http.StatusRequestEntityTooLarge},
+		{"zstd bomb", "zstd", zstdBody(bomb), http.StatusRequestEntityTooLarge},
+		{"corrupt gzip", "gzip", []byte("not gzip at all"), http.StatusBadRequest},
+		{"unsupported", "br", []byte("whatever"), http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Encoding", tc.encoding)
+			rec := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressedResponses(t *testing.T) {
+	eventStore := models.NewEventStore(100)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0))
+	for i := 0; i < 50; i++ {
+		_ = eventStore.Add(&models.Event{ID: "c-" + strconv.Itoa(i), Payload: strings.Repeat("payload ", 10)})
+	}
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/events", "gzip;q=0.5, zstd")
+	if rec.Header().Get("Content-Encoding") != "zstd" {
+		t.Fatalf("Expected zstd response, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	decoder, _ := zstd.NewReader(rec.Body)
+	var events []models.Event
+	if err := json.NewDecoder(decoder).Decode(&events); err != nil || len(events) != 50 {
+		t.Errorf("Expected 50 decoded events, got %d (%v)", len(events), err)
+	}
+	decoder.Close()
+
+	rec = get("/events", "gzip")
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip response: %v", err)
+	}
+	if err := json.NewDecoder(reader).Decode(&events); err != nil || len(events) != 50 {
+		t.Errorf("Expected 50 decoded events, got %d (%v)", len(events), err)
+	}
+
+	// Small responses are not worth compressing
+	if rec := get("/events/c-1", "gzip"); rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected small response to stay uncompressed, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec := get("/events", "identity"); rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected identity response, got %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "identity", want: ""},
+		{header: "gzip", want: "gzip"},
+		{header: "gzip, zstd", want: "zstd"},
+		{header: "gzip;q=0.5, zstd", want: "zstd"},
+		{header: "gzip, zstd;q=0.5", want: "gzip"},
+		{header: "GZIP;q=0.8", want: "gzip"},
+		{header: "*", want: "zstd"},
+		{header: "zstd;q=0, *", want: "gzip"},
+		{header: "gzip;q=0, zstd;q=0, *", want: ""},
+		{header: "*;q=0.5, gzip", want: "gzip"},
+		{header: "br, *;q=0", want: ""},
+	}
+	for _, tc := range tests {
+		if got := negotiateEncoding(tc.header); got != tc.want {
+			t.Errorf("Expected %q for %q, got %q", tc.want, tc.header, got)
+		}
+	}
+}
+
+func TestCompressedStreamFlushes(t *testing.T) {
+	server := NewServer(":8080", models.NewEventStore(10), log.New(io.Discard, "", 0))
+	handler := server.compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a flushed gzip stream, got flushed=%v encoding=%q", rec.Flushed, rec.Header().Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	event := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(reader, event); err != nil || string(event) != "data: first\n\n" {
+		t.Errorf("Expected first event, got %q (%v)", event, err)
+	}
+}
+
+func TestListEventsPagination(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0))
+	for _, id := range []string{"a", "b", "c"} {
+		_ = eventStore.Add(&models.Event{ID: id})
+	}
+
+	var ids []string
+	path := "/events?limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("Expected pagination to end")
+		}
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		var page []models.Event
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode page: %v", err)
+		}
+		for _, event := range page {
+			ids = append(ids, event.ID)
+		}
+
+		path = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			if !strings.Contains(path, "cursor="+rec.Header().Get(NextCursorHeader)) {
+				t.Errorf("Expected Link %q to carry the next cursor", link)
+			}
+		}
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Errorf("Expected events a,b,c in insertion order, got %v", ids)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0))
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+	_ = eventStore.Add(&models.Event{ID: "before"})
+
+	open := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events/stream", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %q", ct)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	next := func(reader *bufio.Reader) (id string, event models.Event) {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read stream: %v", err)
+			}
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimSpace(strings.TrimPrefix(line, "id: "))
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+			case line == "\n" && event.ID != "":
+				return id, event
+			}
+		}
+	}
+
+	// Without a cursor only new events are sent
+	resp, reader := open("")
+	_ = eventStore.Add(&models.Event{ID: "live"})
+	id, event := next(reader)
+	resp.Body.Close()
+	if event.ID != "live" || id != "2" {
+		t.Fatalf("Expected live event with id 2, got %q with id %q", event.ID, id)
+	}
+
+	// Resuming replays what was stored after the last event seen
+	_ = eventStore.Add(&models.Event{ID: "missed"})
+	resp, reader = open("1")
+	defer resp.Body.Close()
+	for _, want := range []string{"live", "missed"} {
+		if _, event := next(reader); event.ID != want {
+			t.Errorf("Expected replayed event %q, got %q", want, event.ID)
+		}
+	}
+
+	// Stop ends open streams so shutdown is not held up
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server.Stop(ctx)
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected stream to end cleanly, got %v", err)
+	}
+}
+
+func TestStreamConsumerGroup(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0))
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+	for _, id := range []string{"first", "second"} {
+		_ = eventStore.Add(&models.Event{ID: id})
+	}
+	if _, err := eventStore.CreateGroup(models.DefaultTenant, "billing", 1); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/events/stream?group=billing")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, `"second"`) {
+				t.Errorf("Expected the stream to resume after the group cursor, got %q", line)
+			}
+			break
+		}
+	}
+
+	// The cursor is committed once the event is written
+	deadline := time.Now().Add(time.Second)
+	for {
+		group, err := eventStore.Group(models.DefaultTenant, "billing")
+		if err != nil {
+			t.Fatalf("Failed to get group: %v", err)
+		}
+		if group.Cursor == 2 && group.Lag == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the group committed to 2, got %+v", group)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	resp, err = ts.Client().Get(ts.URL + "/events/stream?group=missing")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown group, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0),
+		WithIdempotency(NewIdempotency(time.Minute, 10, metrics.NewRegistry())))
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		req.Header.Set(IdempotencyHeader, key)
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("key-1", `{"id":"idem-1"}`)
+	if first.Code != http.StatusCreated || first.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("Expected a fresh 201, got %d", first.Code)
+	}
+	// A retry gets the first response instead of a duplicate error
+	retry := send("key-1", `{"id":"idem-1"}`)
+	if retry.Code != http.StatusCreated || retry.Header().Get(ReplayedHeader) != "true" || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected replayed 201, got %d %q", retry.Code, retry.Body.String())
+	}
+	if rec := send("key-1", `{"id":"idem-2"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for a reused key, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+	if rec := send("key-2", `{"id":"idem-1"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a new key, got %d", http.StatusConflict, rec.Code)
+	}
+
+	// Retryable failures are not remembered
+	eventStore.Close()
+	if rec := send("key-3", `{"id":"idem-3"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec := send("key-3", `{"id":"idem-3"}`); rec.Header().Get(ReplayedHeader) != "" {
+		t.Error("Expected a 503 not to be replayed")
+	}
+}
+
+func TestServerUsesClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	eventStore := models.NewEventStore(10)
+	server := NewServer(":8080", eventStore, log.New(io.Discard, "", 0),
+		WithClock(fake),
+		WithIdempotency(NewIdempotency(time.Minute, 10, metrics.NewRegistry())),
+		WithClientRateLimit(NewClientLimiter(1, 1, metrics.NewRegistry())))
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A missing timestamp is set from the clock
+	if rec := send("key-1", `{"id":"clock-1"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	event, err := eventStore.Get("clock-1")
+	if err != nil || event.Timestamp != fake.Now().Unix() {
+		t.Fatalf("Expected timestamp %d, got %+v, %v", fake.Now().Unix(), event, err)
+	}
+
+	// The client's rate refills as the clock advances
+	if rec := send("", `{"id":"clock-2"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	fake.Advance(time.Second)
+	if rec := send("key-1", `{"id":"clock-1"}`); rec.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("Expected a replay within the idempotency TTL, got %d", rec.Code)
+	}
+
+	// Idempotency keys expire after their TTL
+	fake.Advance(time.Minute)
+	if rec := send("key-1", `{"id":"clock-3"}`); rec.Code != http.StatusCreated || rec.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("Expected the expired key to be accepted afresh, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/models"
+)
+
+const (
+	// Page sizes of GET /events when paginating
+	defaultPageSize = 100
+	maxPageSize     = 1000
+
+	// streamBuffer is how far a subscriber may fall behind before it is
+	// disconnected and has to resume from its last event ID
+	streamBuffer = 256
+	// streamHeartbeat keeps idle streams open through proxies
+	streamHeartbeat = 15 * time.Second
+
+	// NextCursorHeader carries the cursor of the next page
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+// parseCursor reads a cursor, the sequence number of the last event seen
+func parseCursor(value string) (uint64, bool) {
+	if value == "" {
+		return 0, true
+	}
+	seq, err := strconv.ParseUint(value, 10, 64)
+	return seq, err == nil
+}
+
+// handleListEvents returns a page of a tenant's events, oldest first, with
+// the cursor of the next page in X-Next-Cursor and a Link header
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request, tenant string) {
+	query := r.URL.Query()
+	after, ok := parseCursor(query.Get("cursor"))
+	if !ok {
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidQuery, "Invalid cursor", map[string]string{"parameter": "cursor"})
+		return
+	}
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidQuery, "Invalid limit",
+				map[string]interface{}{"parameter": "limit", "min": 1, "max": maxPageSize})
+			return
+		}
+		limit = n
+	}
+
+	// One extra record tells whether another page follows
+	records := s.eventStore.ListInTenant(tenant, after, limit+1)
+	events := make([]*models.Event, 0, limit)
+	for i, record := range records {
+		if i == limit {
+			next := strconv.FormatUint(records[limit-1].Seq, 10)
+			w.Header().Set(NextCursorHeader, next)
+			link := url.URL{Path: r.URL.Path, RawQuery: url.Values{"cursor": {next}, "limit": {strconv.Itoa(limit)}}.Encode()}
+			w.Header().Set("Link", "<"+link.String()+`>; rel="next"`)
+			break
+		}
+		events = append(events, record.Event)
+	}
+	s.write(w, r, http.StatusOK, events)
+}
+
+// handleStreamEvents streams a tenant's events as server-sent events. Each
+// event carries its cursor as the SSE id, so a client reconnecting with
+// Last-Event-ID (or ?cursor=) first receives what it missed. With
+// ?group= and no cursor the stream resumes after the consumer group's
+// cursor, and each event delivered is committed to the group.
+func (s *Server) handleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+	after, ok := parseCursor(cursor)
+	if !ok {
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeInvalidQuery, "Invalid cursor", map[string]string{"parameter": "cursor"})
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group != "" {
+		g, err := s.eventStore.Group(tenant, group)
+		if err != nil {
+			writeGroupError(w, group, err)
+			return
+		}
+		// An explicit cursor is a reconnect, resuming after what it received
+		if cursor == "" {
+			after, cursor = g.Cursor, strconv.FormatUint(g.Cursor, 10)
+		}
+	}
+	// deliver writes a record and commits it to the group, false once the
+	// stream has to end
+	deliver := func(record models.Record) bool {
+		if writeSSE(w, record) != nil {
+			return false
+		}
+		return group == "" || s.eventStore.CommitGroup(tenant, group, record.Seq) == nil
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Streaming unsupported")
+		return
+	}
+
+	// Subscribe before replaying so nothing stored in between is missed
+	sub, err := s.eventStore.Subscribe(tenant, streamBuffer)
+	if err != nil {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Service is shutting down")
+		return
+	}
+	defer sub.Close()
+
+	// Streams outlive the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	last := after
+	if cursor != "" {
+		for _, record := range s.eventStore.ListInTenant(tenant, after, 0) {
+			if !deliver(record) {
+				return
+			}
+			last = record.Seq
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := s.clock.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		case record, ok := <-sub.C:
+			// Closed when lagging or shutting down, the client resumes
+			if !ok {
+				return
+			}
+			if record.Seq <= last {
+				continue
+			}
+			if !deliver(record) {
+				return
+			}
+			last = record.Seq
+			flusher.Flush()
+		case <-heartbeat.C():
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes a record as a server-sent event with a JSON data line
+func writeSSE(w http.ResponseWriter, record models.Record) error {
+	data, err := json.Marshal(record.Event)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("id: " + strconv.FormatUint(record.Seq, 10) + "\ndata: " + string(data) + "\n\n"))
+	return err
+}
+
+// handleStreamPublished streams the events a tenant's workers publish as
+// server-sent events, from the moment of the request. Published events are
+// not stored, so a client that disconnects or falls behind misses events.
+func (s *Server) handleStreamPublished(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenantFor(r)
+	if err != nil {
+		writeTenantError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Streaming unsupported")
+		return
+	}
+	sub, err := s.published.Subscribe(tenant, streamBuffer)
+	if err != nil {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Service is shutting down")
+		return
+	}
+	defer sub.Close()
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := s.clock.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		case event, ok := <-sub.C:
+			// Closed when lagging or shutting down
+			if !ok {
+				if sub.Lagged() {
+					w.Write([]byte("event: lagged\ndata: {}\n\n"))
+					flusher.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C():
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"coding_challenge/app/auth"
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/models"
+)
+
+// Tenant resolution errors
+var (
+	ErrInvalidTenant   = models.Error("invalid tenant name")
+	ErrTenantForbidden = models.Error("principal may not access this tenant")
+	ErrUnknownTenant   = models.Error("unknown tenant")
+)
+
+// tenantFor resolves the tenant of a request. A /tenants/{tenant} path
+// prefix wins, then the tenant bound to the authenticated principal, then
+// the default tenant. With authentication on, a path may only name the
+// principal's own tenant unless it holds every scope. With WithTenants,
+// only the tenants listed and the default tenant are served.
+func (s *Server) tenantFor(r *http.Request) (string, error) {
+	tenant, err := s.resolveTenant(r)
+	if err != nil {
+		return "", err
+	}
+	if s.tenants != nil && tenant != models.DefaultTenant && !s.tenants[tenant] {
+		return "", ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+// resolveTenant picks the tenant of a request and checks the principal
+// may use it
+func (s *Server) resolveTenant(r *http.Request) (string, error) {
+	pathTenant, hasPath := mux.Vars(r)["tenant"]
+	if hasPath && !models.ValidTenant(pathTenant) {
+		return "", ErrInvalidTenant
+	}
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	own := models.DefaultTenant
+	if principal != nil && principal.Tenant != "" {
+		own = principal.Tenant
+	}
+	if !hasPath {
+		return own, nil
+	}
+	if s.auth != nil && pathTenant != own && (principal == nil || !principal.HasScope(auth.ScopeAll)) {
+		return "", ErrTenantForbidden
+	}
+	return pathTenant, nil
+}
+
+// writeTenantError maps a tenant resolution error to a response
+func writeTenantError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrTenantForbidden:
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, err.Error())
+		return
+	case ErrUnknownTenant:
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, err.Error())
+		return
+	}
+	apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidTenant, err.Error())
+}
@@ -0,0 +1,558 @@
+// Package app wires the event store, worker pool and API server into the
+// event processor application.
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"coding_challenge/app/api"
+	"coding_challenge/app/auth"
+	"coding_challenge/app/health"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/certs"
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+const (
+	// Queue utilization ratios at which readiness degrades and fails
+	queueWarnRatio = 0.75
+	queueFailRatio = 0.95
+)
+
+// Errors returned by Run
+var (
+	ErrAlreadyRunning = models.Error("app already running")
+	ErrShutdown       = models.Error("app shut down")
+)
+
+// App is the event processor: an event store, the worker pool processing
+// its events and the API server in front of it
+type App struct {
+	cfg         config.Config
+	logger      *log.Logger
+	auditLogger *log.Logger
+	sink        processor.Publisher
+	clock       clock.Clock
+
+	// sinks set by WithNamedSink, replacing those of the config, then
+	// every sink by name once the pipelines are built
+	sinks map[string]processor.Publisher
+	// pipelineSinks names the sinks each pipeline fans out to
+	pipelineSinks map[string][]string
+
+	listener   net.Listener
+	eventStore *models.EventStore
+	router     *processor.Router
+	pipelines  map[string]*processor.Pool
+	// deadLetters keeps the events the pipelines failed, nil when disabled
+	deadLetters *processor.DeadLetters
+	// pool is the default pipeline's, operated by the admin API
+	pool      *processor.Pool
+	published *processor.Broadcaster
+	health    *health.Registry
+	metrics   *metrics.Registry
+	server    *api.Server
+	reloader  *certs.Reloader
+
+	// ctx runs the components until Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	// poolDone is closed when the pool has stopped
+	poolDone chan struct{}
+	wg       sync.WaitGroup
+	// serveErr receives the error that stopped the server
+	serveErr chan error
+	ready    chan struct{}
+
+	mu       sync.Mutex
+	running  bool
+	shutdown bool
+}
+
+// Option customises an App
+type Option func(*App)
+
+// WithLogger sets the application log, stdout by default
+func WithLogger(logger *log.Logger) Option {
+	return func(a *App) {
+		a.logger = logger
+	}
+}
+
+// WithAuditLogger sets the log of authentication decisions, stdout by default
+func WithAuditLogger(logger *log.Logger) Option {
+	return func(a *App) {
+		a.auditLogger = logger
+	}
+}
+
+// WithSink publishes processed events to sink instead of the output set in
+// the config, such as an in-memory sink in tests
+func WithSink(sink processor.Publisher) Option {
+	return func(a *App) {
+		a.sink = sink
+	}
+}
+
+// WithNamedSink publishes the events of pipelines using the sink name to
+// sink instead of the output set in the config
+func WithNamedSink(name string, sink processor.Publisher) Option {
+	return func(a *App) {
+		if a.sinks == nil {
+			a.sinks = make(map[string]processor.Publisher)
+		}
+		a.sinks[name] = sink
+	}
+}
+
+// WithClock drives every time-dependent part of the application from c:
+// timestamp validation, quotas, retention, processing and the API's
+// expiries. Tests pass a clock.Fake to simulate time.
+func WithClock(c clock.Clock) Option {
+	return func(a *App) {
+		a.clock = c
+	}
+}
+
+// New builds the application from cfg and listens on its server address,
+// which may use port 0 for a random port
+func New(cfg config.Config, opts ...Option) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	a := &App{
+		cfg:      cfg,
+		logger:   log.New(os.Stdout, "[EVENT-PROCESSOR] ", log.LstdFlags),
+		metrics:  metrics.NewRegistry(),
+		poolDone: make(chan struct{}),
+		serveErr: make(chan error, 1),
+		ready:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.auditLogger == nil {
+		a.auditLogger = log.New(os.Stdout, "[AUDIT] ", log.LstdFlags)
+	}
+	a.clock = clock.OrReal(a.clock)
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+
+	// Initialize event store
+	capacities := make(map[models.Priority]int, len(cfg.Lanes))
+	weights := make(map[models.Priority]int, len(cfg.Lanes))
+	for name, lane := range cfg.Lanes {
+		capacities[models.Priority(name)] = lane.Capacity
+		weights[models.Priority(name)] = lane.Weight
+	}
+	a.eventStore = models.NewEventStoreWithLanes(cfg.EventBufferSize, capacities)
+	a.eventStore.SetClock(a.clock)
+	quotas := make(map[string]models.TenantQuota, len(cfg.Tenancy.Tenants))
+	for tenant, quota := range cfg.Tenancy.Tenants {
+		quotas[tenant] = toTenantQuota(quota)
+	}
+	a.eventStore.SetQuotas(quotas, toTenantQuota(cfg.Tenancy.DefaultQuota))
+	a.metrics.GaugeFunc("events_scheduled", "Events waiting for their delivery time", func() float64 {
+		return float64(a.eventStore.ScheduledLen())
+	})
+	for _, lane := range models.Priorities {
+		lane := lane
+		a.metrics.GaugeFunc("events_lane_queue_depth", "Events waiting in a priority lane of the store",
+			func() float64 { return float64(a.eventStore.LaneLen(lane)) }, "lane", string(lane))
+		a.metrics.GaugeFunc("events_lane_capacity", "Events a priority lane of the store can hold",
+			func() float64 { return float64(a.eventStore.LaneCap(lane)) }, "lane", string(lane))
+	}
+
+	// One codec registry serves both the API and the publishers
+	codecs := codec.Default()
+	if a.sink == nil {
+		a.sink = a.newSink(cfg.Publish, codecs)
+	}
+	// Published events are also streamed to API subscribers
+	a.published = processor.NewBroadcaster(a.sink)
+
+	// Create the worker pool of every pipeline and the router feeding them
+	a.newPipelines(codecs, weights)
+
+	a.health = a.newHealth()
+	serverOpts, err := a.serverOptions(codecs)
+	if err != nil {
+		return nil, err
+	}
+	a.server = api.NewServer(cfg.ServerAddress, a.eventStore, a.logger, serverOpts...)
+
+	if a.listener, err = net.Listen("tcp", cfg.ServerAddress); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newHealth registers the component health checks
+func (a *App) newHealth() *health.Registry {
+	registry := health.NewRegistry()
+	// The store is in memory: it accepts events until closed
+	registry.Register("store", health.Readiness, func() health.Result {
+		if a.eventStore.Closed() {
+			return health.Result{Status: health.StatusDown, Message: "event store closed"}
+		}
+		return health.Result{Status: health.StatusOK, Message: "event store open"}
+	})
+	registry.Register("sinks", health.Readiness, a.checkSinks)
+	registry.Register("queue", health.Readiness, health.Threshold(func() (int, int) {
+		return a.eventStore.QueueLen(), a.eventStore.QueueCap()
+	}, queueWarnRatio, queueFailRatio))
+	registry.Register("workers", health.Liveness, func() health.Result {
+		if registry.State() == health.StateStarting {
+			return health.Result{Status: health.StatusOK, Message: "starting"}
+		}
+		running, total := 0, 0
+		var paused []string
+		for _, name := range a.pipelineNames() {
+			pool := a.pipelines[name]
+			running += pool.RunningWorkers()
+			total += pool.Size()
+			if state := pool.State(); state != processor.PoolRunning {
+				paused = append(paused, fmt.Sprintf("%s %s", name, state))
+			}
+		}
+		message := fmt.Sprintf("%d/%d running", running, total)
+		switch {
+		case running == 0:
+			return health.Result{Status: health.StatusDown, Message: message}
+		case running < total:
+			return health.Result{Status: health.StatusDegraded, Message: message}
+		case len(paused) > 0:
+			// Paused on purpose: still ingesting, so degrade without failing readiness
+			return health.Result{Status: health.StatusDegraded, Message: fmt.Sprintf("%s, %s", strings.Join(paused, ", "), message)}
+		}
+		return health.Result{Status: health.StatusOK, Message: message}
+	})
+	return registry
+}
+
+// checkSinks reports the sinks of every pipeline by name. A pipeline with
+// a failing sink degrades readiness, and one whose every sink fails can
+// deliver nothing, so readiness goes down.
+func (a *App) checkSinks() health.Result {
+	status := health.StatusOK
+	pipelines := make([]string, 0, len(a.pipelineSinks))
+	for _, name := range a.pipelineNames() {
+		sinks := a.pipelineSinks[name]
+		states := make([]string, len(sinks))
+		failed := 0
+		for i, sink := range sinks {
+			states[i] = sink
+			if err := processor.Check(a.sinks[sink]); err != nil {
+				states[i] = fmt.Sprintf("%s: %v", sink, err)
+				failed++
+			}
+		}
+		switch {
+		case failed == len(sinks):
+			status = health.StatusDown
+		case failed > 0 && status == health.StatusOK:
+			status = health.StatusDegraded
+		}
+		pipelines = append(pipelines, fmt.Sprintf("%s -> %s", name, strings.Join(states, ", ")))
+	}
+	return health.Result{Status: status, Message: strings.Join(pipelines, "; ")}
+}
+
+// serverOptions configures the API server from the config
+func (a *App) serverOptions(codecs *codec.Registry) ([]api.Option, error) {
+	cfg := a.cfg
+	opts := []api.Option{
+		api.WithHealth(a.health),
+		api.WithMetrics(a.metrics),
+		api.WithPool(a.pool),
+		api.WithPipelines(a.pipelines),
+		api.WithDeadLetters(a.deadLetters),
+		api.WithRouter(a.router),
+		api.WithPublished(a.published),
+		api.WithClock(a.clock),
+		api.WithLimits(api.Limits{
+			MaxBodyBytes:    cfg.Limits.MaxBodyBytes,
+			MaxPayloadBytes: cfg.Limits.MaxPayloadBytes,
+			MaxBatchEvents:  cfg.Limits.MaxBatchEvents,
+		}),
+		api.WithCodecs(codecs),
+		api.WithCompression(api.Compression{
+			Enabled:  cfg.Compression.Enabled,
+			MinBytes: cfg.Compression.MinBytes,
+		}),
+		api.WithBackpressure(api.NewBackpressure(api.BackpressureConfig{
+			MaxQueueDepth: cfg.Ingest.Backpressure.MaxQueueDepth,
+			MaxLag:        time.Duration(cfg.Ingest.Backpressure.MaxLag),
+			ResumeRatio:   cfg.Ingest.Backpressure.ResumeRatio,
+			MaxRetryAfter: time.Duration(cfg.Ingest.Backpressure.MaxRetryAfter),
+		}, a.load, a.metrics)),
+	}
+	if len(cfg.Tenancy.Tenants) > 0 {
+		tenants := make([]string, 0, len(cfg.Tenancy.Tenants))
+		for name := range cfg.Tenancy.Tenants {
+			tenants = append(tenants, name)
+		}
+		opts = append(opts, api.WithTenants(tenants))
+	}
+	if cfg.Idempotency.MaxKeys > 0 {
+		opts = append(opts, api.WithIdempotency(api.NewIdempotency(time.Duration(cfg.Idempotency.TTL), cfg.Idempotency.MaxKeys, a.metrics)))
+	}
+	if limit := cfg.Ingest.ClientRateLimit; limit.EventsPerSecond > 0 {
+		opts = append(opts, api.WithClientRateLimit(api.NewClientLimiter(limit.EventsPerSecond, limit.Burst, a.metrics)))
+	}
+	if cfg.Auth.Enabled {
+		authenticator, err := newAuthenticator(cfg.Auth, a.clock)
+		if err != nil {
+			return nil, fmt.Errorf("configuring authentication: %w", err)
+		}
+		middleware := auth.NewMiddleware(authenticator, a.metrics, a.auditLogger)
+		middleware.SetClock(a.clock)
+		opts = append(opts, api.WithAuth(middleware))
+	}
+	if cfg.TLS.Enabled() {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, a.logger)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificates: %w", err)
+		}
+		a.reloader = reloader
+		opts = append(opts, api.WithTLS(reloader.ServerConfig(cfg.TLS.RequireClientCert, !cfg.TLS.DisableHTTP2)))
+	}
+	return opts, nil
+}
+
+// Addr returns the address the API listens on
+func (a *App) Addr() net.Addr {
+	return a.listener.Addr()
+}
+
+// Ready is closed once every component is started and the API reports
+// ready
+func (a *App) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// Run starts every component and blocks until ctx ends, Shutdown is called
+// or the server fails. Run does not stop the components, call Shutdown.
+func (a *App) Run(ctx context.Context) error {
+	a.mu.Lock()
+	switch {
+	case a.shutdown:
+		a.mu.Unlock()
+		return ErrShutdown
+	case a.running:
+		a.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	a.running = true
+	a.mu.Unlock()
+
+	if a.reloader != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.reloader.Watch(a.ctx, time.Duration(a.cfg.TLS.ReloadInterval))
+		}()
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.server.Serve(a.listener); err != nil && err != http.ErrServerClosed {
+			a.logger.Printf("HTTP server error: %v", err)
+			a.serveErr <- err
+		}
+	}()
+
+	// Remove events past their tenant's retention
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := a.clock.NewTicker(time.Duration(a.cfg.Tenancy.PurgeInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C():
+				// The clock rather than the tick, which may be stale when
+				// ticks were dropped
+				if removed := a.eventStore.Purge(a.clock.Now()); removed > 0 {
+					a.logger.Printf("Purged %d events past retention", removed)
+				}
+			}
+		}
+	}()
+
+	// Release scheduled events as they fall due
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.eventStore.RunScheduler(a.ctx)
+	}()
+
+	// Start the router and the worker pool of every pipeline
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.router.Run(a.ctx)
+	}()
+	go func() {
+		defer close(a.poolDone)
+		var pools sync.WaitGroup
+		for _, pool := range a.pipelines {
+			pools.Add(1)
+			go func(pool *processor.Pool) {
+				defer pools.Done()
+				pool.Start(a.ctx)
+			}(pool)
+		}
+		pools.Wait()
+	}()
+
+	// All components are started, begin accepting traffic
+	a.health.SetState(health.StateReady)
+	close(a.ready)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-a.ctx.Done():
+		return nil
+	case err := <-a.serveErr:
+		return err
+	}
+}
+
+// Shutdown stops the application gracefully: it fails readiness, stops
+// the API server, lets the workers process the events already accepted,
+// resuming paused pipelines to do so, then stops the other components. When ctx ends first the workers are
+// stopped with events left unprocessed and ctx's error is returned.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.logger.Println("Initiating graceful shutdown...")
+	// Fail readiness so load balancers stop routing new traffic
+	a.health.SetState(health.StateDraining)
+
+	var err error
+	if serverErr := a.server.Stop(ctx); serverErr != nil {
+		a.logger.Printf("Error during server shutdown: %v", serverErr)
+		err = serverErr
+	}
+	a.mu.Lock()
+	running := a.running
+	a.shutdown = true
+	a.mu.Unlock()
+	if !running {
+		// Never run, so nothing else was started
+		a.listener.Close()
+	}
+
+	// Paused and draining pipelines resume, so their dispatchers are not
+	// held waiting for room and the events already accepted are processed
+	for _, name := range a.pipelineNames() {
+		a.pipelines[name].Resume()
+	}
+	// Closing the store ends the router's input and then the pools', whose
+	// workers exit once drained
+	a.eventStore.Close()
+	if running {
+		select {
+		case <-a.poolDone:
+		case <-ctx.Done():
+			a.logger.Printf("Shutdown timed out with %d events pending", a.load().Depth)
+			err = ctx.Err()
+		}
+	}
+	a.cancel()
+	a.published.Close()
+
+	// Wait for all components to shut down or timeout
+	stopped := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		if running {
+			<-a.poolDone
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		a.logger.Println("All components shut down successfully")
+	case <-ctx.Done():
+		a.logger.Println("Shutdown timed out, forcing exit")
+		err = ctx.Err()
+	}
+	return err
+}
+
+// newAuthenticator builds the API key and JWT authenticators from config,
+// validating token lifetimes on c
+func newAuthenticator(cfg config.AuthConfig, c clock.Clock) (auth.Authenticator, error) {
+	var chain auth.Chain
+
+	if len(cfg.APIKeys) > 0 {
+		keys := make([]auth.APIKey, len(cfg.APIKeys))
+		for i, key := range cfg.APIKeys {
+			keys[i] = auth.APIKey{Name: key.Name, Hash: key.SHA256, Scopes: toScopes(key.Scopes), Tenant: key.Tenant}
+		}
+		authenticator, err := auth.NewAPIKeyAuthenticator(keys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+
+	if len(cfg.ClientCerts) > 0 {
+		subjects := make([]auth.ClientCert, len(cfg.ClientCerts))
+		for i, cert := range cfg.ClientCerts {
+			subjects[i] = auth.ClientCert{Subject: cert.Subject, Scopes: toScopes(cert.Scopes), Tenant: cert.Tenant}
+		}
+		chain = append(chain, auth.NewCertAuthenticator(subjects))
+	}
+
+	if cfg.JWT.HMACSecret != "" || cfg.JWT.JWKSFile != "" {
+		authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			HMACSecret:  []byte(cfg.JWT.HMACSecret),
+			JWKSFile:    cfg.JWT.JWKSFile,
+			Issuer:      cfg.JWT.Issuer,
+			Audience:    cfg.JWT.Audience,
+			Leeway:      time.Duration(cfg.JWT.Leeway),
+			RequireExp:  cfg.JWT.RequireExp,
+			MaxLifetime: time.Duration(cfg.JWT.MaxLifetime),
+			Clock:       c,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+
+	return chain, nil
+}
+
+func toScopes(names []string) []auth.Scope {
+	scopes := make([]auth.Scope, len(names))
+	for i, name := range names {
+		scopes[i] = auth.Scope(name)
+	}
+	return scopes
+}
+
+func toTenantQuota(cfg config.QuotaConfig) models.TenantQuota {
+	return models.TenantQuota{
+		EventsPerSecond: cfg.EventsPerSecond,
+		Burst:           cfg.Burst,
+		MaxStoredBytes:  cfg.MaxStoredBytes,
+		Retention:       time.Duration(cfg.Retention),
+	}
+}
@@ -0,0 +1,498 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"coding_challenge/app"
+	"coding_challenge/app/apptest"
+	"coding_challenge/client"
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/routing"
+)
+
+// gatedSink holds every publish until released
+type gatedSink struct {
+	*apptest.Sink
+	gate chan struct{}
+}
+
+func (s *gatedSink) Publish(event *models.TransformedEvent) error {
+	<-s.gate
+	return s.Sink.Publish(event)
+}
+
+// failingSink fails every publish until healed
+type failingSink struct {
+	*apptest.Sink
+	healed atomic.Bool
+}
+
+func (s *failingSink) Publish(event *models.TransformedEvent) error {
+	if !s.healed.Load() {
+		return errors.New("sink unavailable")
+	}
+	return s.Sink.Publish(event)
+}
+
+func (s *failingSink) Check() error {
+	if !s.healed.Load() {
+		return errors.New("sink unavailable")
+	}
+	return nil
+}
+
+func TestIngestTransformPublish(t *testing.T) {
+	h := apptest.Start(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.Client.Publish(ctx, client.Event{ID: "single", Timestamp: 1625097600, Payload: "hello"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	tenant, _ := client.New(h.URL, client.WithTenant("acme"))
+	batch, err := tenant.PublishBatch(ctx, []client.Event{{ID: "b1", Payload: "one"}, {ID: "b2", Payload: "two"}})
+	if err != nil || batch.Accepted != 2 {
+		t.Fatalf("Failed to publish the batch: %+v, %v", batch, err)
+	}
+
+	events, err := h.Sink.WaitFor(ctx, 3)
+	if err != nil {
+		t.Fatalf("Expected 3 published events, got %d: %v", len(events), err)
+	}
+	byID := make(map[string]*models.TransformedEvent)
+	for _, event := range events {
+		byID[event.ID] = event
+	}
+	if e := byID["single"]; e == nil || e.Payload != "HELLO" || e.OriginalTime != 1625097600 ||
+		e.Tenant != models.DefaultTenant || e.ProcessorID == "" {
+		t.Errorf("Unexpected transformed event %+v", e)
+	}
+	if e := byID["b2"]; e == nil || e.Payload != "TWO" || e.Tenant != "acme" {
+		t.Errorf("Unexpected transformed batch event %+v", e)
+	}
+	if _, err := tenant.Get(ctx, "b1"); err != nil {
+		t.Errorf("Expected the event to be stored: %v", err)
+	}
+}
+
+func TestPublishedStream(t *testing.T) {
+	h := apptest.Start(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := h.Client.SubscribePublished(ctx, 10)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+	if _, err := h.Client.Publish(ctx, client.Event{ID: "streamed", Payload: "abc"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	select {
+	case event := <-sub.Events():
+		if event.ID != "streamed" || event.Payload != "ABC" {
+			t.Errorf("Unexpected published event %+v", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the published event")
+	}
+}
+
+func TestShutdownDrainsAcceptedEvents(t *testing.T) {
+	sink := &gatedSink{Sink: apptest.NewSink(), gate: make(chan struct{})}
+	h := apptest.Start(t, func(cfg *config.Config) { cfg.Pool.Workers = 2 }, app.WithSink(sink))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sent []string
+	for i := 0; i < 20; i++ {
+		id := "drain-" + string(rune('a'+i))
+		if _, err := h.Client.Publish(ctx, client.Event{ID: id, Payload: "x"}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		sent = append(sent, id)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- h.Shutdown(ctx) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected shutdown to wait for the workers, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The API stops accepting events as soon as shutdown starts
+	noRetry, _ := client.New(h.URL, client.WithRetry(client.RetryPolicy{MaxAttempts: 1}))
+	if _, err := noRetry.Publish(ctx, client.Event{ID: "late"}); err == nil {
+		t.Error("Expected events to be refused during shutdown")
+	}
+
+	close(sink.gate)
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+	var published []string
+	for _, event := range sink.Events() {
+		published = append(published, event.ID)
+	}
+	sort.Strings(published)
+	if strings.Join(published, ",") != strings.Join(sent, ",") {
+		t.Errorf("Expected every accepted event published, got %v", published)
+	}
+	if err := h.App.Run(ctx); err != app.ErrShutdown {
+		t.Errorf("Expected %v running again, got %v", app.ErrShutdown, err)
+	}
+}
+
+func TestFailedEventsAreDeadLettered(t *testing.T) {
+	sink := &failingSink{Sink: apptest.NewSink()}
+	h := apptest.Start(t, nil, app.WithSink(sink))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.Client.Publish(ctx, client.Event{ID: "broken", Payload: "x"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	var letters []client.DeadLetter
+	for len(letters) == 0 {
+		var err error
+		if letters, err = h.Client.DeadLetters(ctx, ""); err != nil {
+			t.Fatalf("Failed to list dead letters: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if l := letters[0]; l.Event.ID != "broken" || l.Pipeline != config.DefaultPipeline || !strings.Contains(l.Error, "sink unavailable") {
+		t.Errorf("Unexpected dead letter %+v", l)
+	}
+
+	sink.healed.Store(true)
+	result, err := h.Client.RedriveDeadLetters(ctx, "")
+	if err != nil || result.Redriven != 1 || result.Remaining != 0 {
+		t.Fatalf("Expected the dead letter redriven, got %+v: %v", result, err)
+	}
+	events, err := sink.WaitFor(ctx, 1)
+	if err != nil || events[0].ID != "broken" || events[0].Payload != "X" {
+		t.Errorf("Expected the redriven event published, got %+v: %v", events, err)
+	}
+}
+
+func TestReadinessReportsFailingSinks(t *testing.T) {
+	archive := &failingSink{Sink: apptest.NewSink()}
+	h := apptest.Start(t, func(cfg *config.Config) {
+		cfg.Sinks = map[string]config.PublishConfig{"archive": {Output: "log", Format: "json"}}
+		cfg.Pipelines = map[string]config.PipelineConfig{"audit": {Sinks: []string{config.DefaultSink, "archive"}}}
+	}, app.WithNamedSink("archive", archive))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The audit pipeline still delivers to the default sink
+	report, err := h.Client.Health(ctx, client.ProbeReadiness)
+	if err != nil {
+		t.Fatalf("Failed to probe readiness: %v", err)
+	}
+	sinks := report.Components["sinks"]
+	if report.Status != "degraded" || sinks.Status != "degraded" ||
+		sinks.Message != "audit -> default, archive: sink unavailable; default -> default" {
+		t.Errorf("Expected readiness degraded by the archive sink, got %s %+v", report.Status, sinks)
+	}
+
+	archive.healed.Store(true)
+	if report, err = h.Client.Health(ctx, client.ProbeReadiness); err != nil || report.Components["sinks"].Status != "ok" {
+		t.Errorf("Expected the sinks ok once healed, got %+v: %v", report, err)
+	}
+}
+
+func TestReadinessFailsWhenEverySinkFails(t *testing.T) {
+	h := apptest.Start(t, nil, app.WithSink(&failingSink{Sink: apptest.NewSink()}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report, err := h.Client.Health(ctx, client.ProbeReadiness)
+	if err != nil {
+		t.Fatalf("Failed to probe readiness: %v", err)
+	}
+	if sinks := report.Components["sinks"]; report.Status != "down" || sinks.Status != "down" {
+		t.Errorf("Expected readiness down with the only sink failing, got %s %+v", report.Status, sinks)
+	}
+	// Liveness does not depend on the sinks
+	if report, err = h.Client.Health(ctx, client.ProbeLiveness); err != nil || report.Status != "ok" {
+		t.Errorf("Expected liveness ok, got %+v: %v", report, err)
+	}
+}
+
+func TestShutdownProcessesEventsHeldByAPausedPool(t *testing.T) {
+	// More events than the pool holds, so some wait in the store
+	h := apptest.Start(t, func(cfg *config.Config) { cfg.Pool.MaxPending = 2 })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.Client.PausePool(ctx); err != nil {
+		t.Fatalf("Failed to pause the pool: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := h.Client.Publish(ctx, client.Event{ID: fmt.Sprintf("held-%d", i), Payload: "x"}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+	if got := len(h.Sink.Events()); got != 10 {
+		t.Errorf("Expected every accepted event published on shutdown, got %d", got)
+	}
+}
+
+func TestShutdownTimesOut(t *testing.T) {
+	sink := &gatedSink{Sink: apptest.NewSink(), gate: make(chan struct{})}
+	h := apptest.Start(t, nil, app.WithSink(sink))
+	// Release the workers once the test is over
+	t.Cleanup(func() { close(sink.gate) })
+
+	ctx := context.Background()
+	if _, err := h.Client.Publish(ctx, client.Event{ID: "stuck"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(shutdownCtx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the shutdown to time out, got %v", err)
+	}
+}
+
+func TestSimulatedRetention(t *testing.T) {
+	h := apptest.Simulate(t, func(cfg *config.Config) {
+		cfg.Tenancy.PurgeInterval = config.Duration(time.Minute)
+		cfg.Tenancy.Tenants = map[string]config.QuotaConfig{"acme": {Retention: config.Duration(time.Hour)}}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tenant, _ := client.New(h.URL, client.WithTenant("acme"))
+
+	if _, err := tenant.Publish(ctx, client.Event{ID: "old", Payload: "one"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	events, err := h.Sink.WaitFor(ctx, 1)
+	if err != nil {
+		t.Fatalf("Expected the event published: %v", err)
+	}
+	if e := events[0]; e.OriginalTime != apptest.Epoch.Unix() || !e.ProcessedAt.Equal(apptest.Epoch) {
+		t.Errorf("Expected the event stamped and processed at %v, got %+v", apptest.Epoch, e)
+	}
+
+	// Wait for the purge ticker before moving time
+	h.Clock.BlockUntil(1)
+	h.Clock.Advance(30 * time.Minute)
+	if _, err := tenant.Publish(ctx, client.Event{ID: "recent", Payload: "two"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	h.Clock.Advance(31 * time.Minute)
+
+	var apiErr *client.APIError
+	for {
+		_, err := tenant.Get(ctx, "old")
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Expected the event purged after its retention, got %v", err)
+		}
+	}
+	if _, err := tenant.Get(ctx, "recent"); err != nil {
+		t.Errorf("Expected the event within retention kept: %v", err)
+	}
+}
+
+func TestSimulatedScheduledDelivery(t *testing.T) {
+	h := apptest.Simulate(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, event := range []client.Event{{ID: "delayed", Delay: 60}, {ID: "canceled", Delay: 30}} {
+		if _, err := h.Client.Publish(ctx, event); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	if _, err := h.Client.CancelScheduled(ctx, "canceled"); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+	if _, err := h.Client.Publish(ctx, client.Event{ID: "immediate"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if events, err := h.Sink.WaitFor(ctx, 1); err != nil || events[0].ID != "immediate" {
+		t.Fatalf("Expected only the immediate event published, got %v", err)
+	}
+
+	// The scheduler and the purge ticker wait on the clock
+	h.Clock.BlockUntil(2)
+	h.Clock.Advance(time.Minute)
+	events, err := h.Sink.WaitFor(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected the delayed event published: %v", err)
+	}
+	if e := events[1]; e.ID != "delayed" || !e.ProcessedAt.Equal(apptest.Epoch.Add(time.Minute)) {
+		t.Errorf("Expected the delayed event processed after a minute, got %+v", e)
+	}
+	if len(h.Sink.Events()) != 2 {
+		t.Errorf("Expected the canceled event never published, got %d events", len(h.Sink.Events()))
+	}
+}
+
+func TestRoutesEventsToPipelines(t *testing.T) {
+	audit := apptest.NewSink()
+	h := apptest.Start(t, func(cfg *config.Config) {
+		cfg.Sinks = map[string]config.PublishConfig{"audit": {Output: "log", Format: "json"}}
+		cfg.Pipelines = map[string]config.PipelineConfig{
+			"audit": {Transforms: []config.TransformConfig{{Type: "trim"}, {Type: "lowercase"}}, Sinks: []string{"audit"}},
+		}
+		cfg.Routing.Routes = []config.RouteConfig{{Pipeline: "audit", Match: routing.Conditions{
+			Type: "user.login", Attributes: map[string]string{"region": "eu"},
+		}}}
+	}, app.WithNamedSink("audit", audit))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, event := range []client.Event{
+		{ID: "login", Payload: "  Alice ", Type: "user.login", Attributes: map[string]string{"region": "eu"}},
+		{ID: "login-us", Payload: "Bob", Type: "user.login", Attributes: map[string]string{"region": "us"}},
+		{ID: "untyped", Payload: "carol"},
+	} {
+		if _, err := h.Client.Publish(ctx, event); err != nil {
+			t.Fatalf("Failed to publish %s: %v", event.ID, err)
+		}
+	}
+
+	audited, err := audit.WaitFor(ctx, 1)
+	if err != nil {
+		t.Fatalf("Expected the audit sink to receive an event: %v", err)
+	}
+	if e := audited[0]; e.ID != "login" || e.Payload != "alice" || e.Type != "user.login" || e.Attributes["region"] != "eu" {
+		t.Errorf("Unexpected audited event %+v", e)
+	}
+	events, err := h.Sink.WaitFor(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected 2 events on the default sink, got %d: %v", len(events), err)
+	}
+	payloads := []string{events[0].Payload, events[1].Payload}
+	sort.Strings(payloads)
+	if strings.Join(payloads, ",") != "BOB,CAROL" {
+		t.Errorf("Expected the unrouted events uppercased, got %v", payloads)
+	}
+	if got := len(audit.Events()); got != 1 {
+		t.Errorf("Expected only the matching event audited, got %d", got)
+	}
+}
+
+func TestSlowPipelineOnlyRefusesItsOwnEvents(t *testing.T) {
+	audit := &gatedSink{Sink: apptest.NewSink(), gate: make(chan struct{})}
+	h := apptest.Start(t, func(cfg *config.Config) {
+		cfg.Pool.MaxPending = 1
+		cfg.Sinks = map[string]config.PublishConfig{"audit": {Output: "log", Format: "json"}}
+		cfg.Pipelines = map[string]config.PipelineConfig{
+			"audit": {Transforms: []config.TransformConfig{}, Sinks: []string{"audit"}, Workers: 1, QueueSize: 2},
+		}
+		cfg.Routing.Routes = []config.RouteConfig{{Pipeline: "audit", Match: routing.Conditions{Type: "user.login"}}}
+	}, app.WithNamedSink("audit", audit))
+	defer close(audit.gate)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	noRetry, _ := client.New(h.URL, client.WithRetry(client.RetryPolicy{MaxAttempts: 1}))
+
+	// The audit sink holds its worker, so its pool and then its queue fill up
+	var apiErr *client.APIError
+	for i := 0; ; i++ {
+		if i == 50 {
+			t.Fatal("Expected the stalled audit pipeline to refuse events")
+		}
+		_, err := noRetry.Publish(ctx, client.Event{ID: fmt.Sprintf("login-%d", i), Type: "user.login"})
+		if errors.As(err, &apiErr) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || !strings.Contains(string(apiErr.Details), `"audit"`) {
+		t.Errorf("Expected 429 naming the audit pipeline, got %v %s", apiErr, apiErr.Details)
+	}
+
+	// The default pipeline still admits and publishes its events
+	if _, err := noRetry.Publish(ctx, client.Event{ID: "other", Payload: "hello"}); err != nil {
+		t.Fatalf("Failed to publish to the default pipeline: %v", err)
+	}
+	if events, err := h.Sink.WaitFor(ctx, 1); err != nil || events[0].ID != "other" {
+		t.Errorf("Expected other published while audit is stalled, got %v: %v", events, err)
+	}
+}
+
+func TestExpressionPipeline(t *testing.T) {
+	h := apptest.Start(t, func(cfg *config.Config) {
+		cfg.Pipelines = map[string]config.PipelineConfig{
+			"orders": {Transforms: []config.TransformConfig{
+				{Type: "filter", Expr: `json(payload).total > 0`},
+				{Type: "map", Fields: map[string]string{
+					"payload":         `string(json(payload).total * 2)`,
+					"attributes.size": `json(payload).total >= 100 ? "large" : "small"`,
+				}},
+			}},
+		}
+		cfg.Routing.Routes = []config.RouteConfig{{Pipeline: "orders", Match: routing.Conditions{
+			Expr: `startsWith(type, "order.") && attributes.channel != "test"`,
+		}}}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, event := range []client.Event{
+		{ID: "empty", Type: "order.created", Payload: `{"total": 0}`},
+		{ID: "test", Type: "order.created", Payload: "test order", Attributes: map[string]string{"channel": "test"}},
+		{ID: "big", Type: "order.created", Payload: `{"total": 150}`},
+	} {
+		if _, err := h.Client.Publish(ctx, event); err != nil {
+			t.Fatalf("Failed to publish %s: %v", event.ID, err)
+		}
+	}
+
+	events, err := h.Sink.WaitFor(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected 2 published events, got %d: %v", len(events), err)
+	}
+	byID := make(map[string]*models.TransformedEvent)
+	for _, event := range events {
+		byID[event.ID] = event
+	}
+	if e := byID["big"]; e == nil || e.Payload != "300" || e.Attributes["size"] != "large" {
+		t.Errorf("Expected big mapped by the orders pipeline, got %+v", e)
+	}
+	if e := byID["test"]; e == nil || e.Payload != "TEST ORDER" {
+		t.Errorf("Expected test uppercased by the default pipeline, got %+v", e)
+	}
+	// The filtered event is counted rather than published
+	for !strings.Contains(metricsText(ctx, t, h), `processor_events_filtered_total{pipeline="orders"} 1`) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the filtered event to be counted")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if got := len(h.Sink.Events()); got != 2 {
+		t.Errorf("Expected empty to be filtered out, got %d published events", got)
+	}
+}
+
+func metricsText(ctx context.Context, t *testing.T, h *apptest.Harness) string {
+	t.Helper()
+	text, err := h.Client.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read the metrics: %v", err)
+	}
+	return text
+}
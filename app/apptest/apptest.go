@@ -0,0 +1,154 @@
+// Package apptest boots the whole event processor in process for end-to-end
+// tests, on a random port and publishing to an in-memory sink. Simulate
+// boots it on a fake clock, so tests drive time instead of sleeping.
+package apptest
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"coding_challenge/app"
+	"coding_challenge/client"
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/models"
+)
+
+// stopTimeout bounds the shutdown at the end of a test
+const stopTimeout = 5 * time.Second
+
+// Epoch is the time a simulation starts at
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Sink is an in-memory publisher recording the events published
+type Sink struct {
+	mu     sync.Mutex
+	events []*models.TransformedEvent
+	// changed is closed and replaced on every publish
+	changed chan struct{}
+}
+
+// NewSink creates an empty sink
+func NewSink() *Sink {
+	return &Sink{changed: make(chan struct{})}
+}
+
+// Publish implements processor.Publisher
+func (s *Sink) Publish(event *models.TransformedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return nil
+}
+
+// Events returns the events published so far, in order
+func (s *Sink) Events() []*models.TransformedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.TransformedEvent(nil), s.events...)
+}
+
+// WaitFor waits until at least n events were published and returns them
+func (s *Sink) WaitFor(ctx context.Context, n int) ([]*models.TransformedEvent, error) {
+	for {
+		s.mu.Lock()
+		if len(s.events) >= n {
+			events := append([]*models.TransformedEvent(nil), s.events...)
+			s.mu.Unlock()
+			return events, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return s.Events(), ctx.Err()
+		}
+	}
+}
+
+// Harness is a running application with a client for its API
+type Harness struct {
+	App    *app.App
+	URL    string
+	Client *client.Client
+	Sink   *Sink
+	// Clock drives the application in a simulation, nil otherwise
+	Clock *clock.Fake
+
+	runErr       chan error
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// Start boots the application on a random port with the default config,
+// changed by configure when not nil, and shuts it down when the test ends.
+// Events are published to the harness's Sink unless opts set another one.
+func Start(t testing.TB, configure func(*config.Config), opts ...app.Option) *Harness {
+	t.Helper()
+	cfg := config.Default()
+	cfg.ServerAddress = "127.0.0.1:0"
+	// Keep the pool at its size unless a test asks for autoscaling
+	cfg.Pool.Autoscale.Interval = 0
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	sink := NewSink()
+	discard := log.New(io.Discard, "", 0)
+	opts = append([]app.Option{app.WithSink(sink), app.WithLogger(discard), app.WithAuditLogger(discard)}, opts...)
+	application, err := app.New(cfg, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create the app: %v", err)
+	}
+	h := &Harness{App: application, URL: "http://" + application.Addr().String(), Sink: sink, runErr: make(chan error, 1)}
+	go func() {
+		h.runErr <- application.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+		h.Shutdown(ctx)
+	})
+
+	select {
+	case <-application.Ready():
+	case err := <-h.runErr:
+		t.Fatalf("Failed to run the app: %v", err)
+	}
+	if h.Client, err = client.New(h.URL); err != nil {
+		t.Fatalf("Failed to create the client: %v", err)
+	}
+	return h
+}
+
+// Simulate boots the application like Start but on a fake clock set to
+// Epoch. Time only passes when the test advances Harness.Clock, firing
+// the purges, autoscaling checks and expiries due on the way. Network
+// timeouts and the harness's Client still use real time.
+func Simulate(t testing.TB, configure func(*config.Config), opts ...app.Option) *Harness {
+	t.Helper()
+	fake := clock.NewFake(Epoch)
+	h := Start(t, configure, append([]app.Option{app.WithClock(fake)}, opts...)...)
+	h.Clock = fake
+	return h
+}
+
+// Shutdown shuts the application down gracefully, once, and waits for Run
+// to return
+func (h *Harness) Shutdown(ctx context.Context) error {
+	h.shutdownOnce.Do(func() {
+		h.shutdownErr = h.App.Shutdown(ctx)
+		if err := <-h.runErr; err != nil && h.shutdownErr == nil {
+			h.shutdownErr = err
+		}
+	})
+	return h.shutdownErr
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"coding_challenge/internal/models"
+)
+
+// APIKeyHeader carries a static API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a configured key, stored as the hex SHA-256 of its value
+type APIKey struct {
+	Name   string
+	Hash   string
+	Scopes []Scope
+	Tenant string
+}
+
+// ErrInvalidKeyHash is returned for configured hashes that are not SHA-256 hex
+var ErrInvalidKeyHash = models.Error("api key hash must be hex encoded SHA-256")
+
+// APIKeyAuthenticator checks static API keys against their hashes
+type APIKeyAuthenticator struct {
+	keys []APIKey
+}
+
+// NewAPIKeyAuthenticator creates an authenticator for the given keys
+func NewAPIKeyAuthenticator(keys []APIKey) (*APIKeyAuthenticator, error) {
+	normalized := make([]APIKey, len(keys))
+	for i, key := range keys {
+		hash, err := hex.DecodeString(key.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, ErrInvalidKeyHash
+		}
+		key.Hash = strings.ToLower(key.Hash)
+		normalized[i] = key
+	}
+	return &APIKeyAuthenticator{keys: normalized}, nil
+}
+
+// HashAPIKey returns the hex SHA-256 of a key, as stored in the config
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	hash := []byte(HashAPIKey(key))
+	var match *APIKey
+	// Compare against every key so timing does not reveal the match position
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(a.keys[i].Hash)) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Name: match.Name, Method: "api_key", Scopes: match.Scopes, Tenant: match.Tenant}, nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"coding_challenge/internal/apierror"
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// Scope grants access to a group of routes
+type Scope string
+
+const (
+	ScopePublish     Scope = "events:publish"
+	ScopeReadEvents  Scope = "events:read"
+	ScopeReadStream  Scope = "streams:read"
+	ScopeWriteGroups Scope = "groups:write"
+	ScopeAdmin       Scope = "admin"
+	// ScopeAll grants every scope
+	ScopeAll Scope = "*"
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	Name   string
+	Method string
+	Scopes []Scope
+	// Tenant binds the caller to a namespace, empty for unbound callers
+	Tenant string
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// Authentication errors
+var (
+	ErrNoCredentials      = models.Error("no credentials")
+	ErrInvalidCredentials = models.Error("invalid credentials")
+)
+
+// Authenticator extracts and verifies the credentials of a request. It
+// returns ErrNoCredentials when the request carries none it understands.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in turn until one finds credentials
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		principal, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal stored by the middleware, if any
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Middleware enforces authentication and scopes on HTTP handlers
+type Middleware struct {
+	authenticator Authenticator
+	audit         *log.Logger
+	registry      *metrics.Registry
+	clock         clock.Clock
+}
+
+// NewMiddleware creates a middleware that counts failures in registry and
+// writes audit records to audit
+func NewMiddleware(authenticator Authenticator, registry *metrics.Registry, audit *log.Logger) *Middleware {
+	return &Middleware{
+		authenticator: authenticator,
+		audit:         audit,
+		registry:      registry,
+		clock:         clock.Real,
+	}
+}
+
+// SetClock sets the clock timestamping audit records
+func (m *Middleware) SetClock(c clock.Clock) {
+	m.clock = clock.OrReal(c)
+}
+
+// Require wraps next so it only runs for principals holding scope
+func (m *Middleware) Require(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticator.Authenticate(r)
+		if err != nil {
+			reason := "invalid"
+			if err == ErrNoCredentials {
+				reason = "missing"
+			}
+			m.fail(r, nil, scope, reason)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="events"`)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			m.fail(r, principal, scope, "forbidden")
+			apierror.WriteDetails(w, http.StatusForbidden, apierror.CodeForbidden, "Missing required scope", map[string]string{"scope": string(scope)})
+			return
+		}
+
+		if scope == ScopeAdmin {
+			m.record(r, principal, scope, "allowed", "")
+		}
+		next(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// fail counts and audits a rejected request
+func (m *Middleware) fail(r *http.Request, principal *Principal, scope Scope, reason string) {
+	m.registry.Counter("auth_failures_total", "Rejected requests by reason", "reason", reason).Inc()
+	m.record(r, principal, scope, "denied", reason)
+}
+
+// auditRecord is a single line of the audit log
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Scope     Scope     `json:"scope"`
+	Remote    string    `json:"remote"`
+}
+
+// record writes an audit log line as JSON
+func (m *Middleware) record(r *http.Request, principal *Principal, scope Scope, outcome, reason string) {
+	rec := auditRecord{
+		Time:    m.clock.Now().UTC(),
+		Outcome: outcome,
+		Reason:  reason,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Scope:   scope,
+		Remote:  r.RemoteAddr,
+	}
+	if principal != nil {
+		rec.Principal = principal.Name
+	}
+	line, _ := json.Marshal(rec)
+	m.audit.Println(string(line))
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/metrics"
+)
+
+// signHS256 builds an HS256 token for claims
+func signHS256(t *testing.T, secret []byte, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodeSegments(t, map[string]string{"alg": "HS256", "typ": "JWT", "kid": kid}, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signRS256 builds an RS256 token for claims
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodeSegments(t, map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeSegments(t *testing.T, header map[string]string, claims map[string]interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	authenticator, err := NewAPIKeyAuthenticator([]APIKey{
+		{Name: "ingest", Hash: HashAPIKey("secret-key"), Scopes: []Scope{ScopePublish}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/events", nil)
+	if _, err := authenticator.Authenticate(req); err != ErrNoCredentials {
+		t.Errorf("Expected no credentials error, got: %v", err)
+	}
+
+	req.Header.Set(APIKeyHeader, "wrong-key")
+	if _, err := authenticator.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials error, got: %v", err)
+	}
+
+	req.Header.Set(APIKeyHeader, "secret-key")
+	principal, err := authenticator.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if principal.Name != "ingest" || !principal.HasScope(ScopePublish) || principal.HasScope(ScopeAdmin) {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	if _, err := NewAPIKeyAuthenticator([]APIKey{{Name: "bad", Hash: "not-hex"}}); err != ErrInvalidKeyHash {
+		t.Errorf("Expected invalid hash error, got: %v", err)
+	}
+}
+
+func TestJWTAuthenticatorHMAC(t *testing.T) {
+	secret := []byte("shared-secret")
+	authenticator, err := NewJWTAuthenticator(JWTConfig{HMACSecret: secret, Issuer: "events-idp", Audience: "events", RequireExp: true})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	valid := map[string]interface{}{
+		"sub": "analyst", "iss": "events-idp", "aud": []string{"events"},
+		"exp": time.Now().Add(time.Hour).Unix(), "scope": "events:read streams:read",
+	}
+	principal, err := authenticator.Authenticate(bearerRequest(signHS256(t, secret, "", valid)))
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if principal.Name != "analyst" || !principal.HasScope(ScopeReadStream) || principal.HasScope(ScopePublish) {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	testCases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "wrong secret", token: signHS256(t, []byte("other"), "", valid), want: ErrInvalidSignature},
+		{name: "expired", token: signHS256(t, secret, "", withClaim(valid, "exp", time.Now().Add(-time.Hour).Unix())), want: ErrTokenExpired},
+		{name: "no expiry", token: signHS256(t, secret, "", withClaim(valid, "exp", 0)), want: ErrMissingExpiry},
+		{name: "not yet valid", token: signHS256(t, secret, "", withClaim(valid, "nbf", time.Now().Add(time.Hour).Unix())), want: ErrTokenNotYetValid},
+		{name: "wrong issuer", token: signHS256(t, secret, "", withClaim(valid, "iss", "other")), want: ErrInvalidClaims},
+		{name: "wrong audience", token: signHS256(t, secret, "", withClaim(valid, "aud", "other")), want: ErrInvalidClaims},
+		{name: "alg none", token: encodeSegments(t, map[string]string{"alg": "none"}, valid) + ".", want: ErrUnsupportedAlg},
+		{name: "malformed", token: "not-a-token", want: ErrMalformedToken},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := authenticator.Validate(tc.token); err != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorUsesClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	secret := []byte("shared-secret")
+	authenticator, err := NewJWTAuthenticator(JWTConfig{HMACSecret: secret, Leeway: time.Minute, Clock: fake})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	token := signHS256(t, secret, "", map[string]interface{}{
+		"sub": "analyst", "nbf": fake.Now().Add(time.Hour).Unix(), "exp": fake.Now().Add(2 * time.Hour).Unix(),
+	})
+
+	if _, err := authenticator.Validate(token); err != ErrTokenNotYetValid {
+		t.Errorf("Expected %v before nbf, got %v", ErrTokenNotYetValid, err)
+	}
+	fake.Advance(time.Hour)
+	if _, err := authenticator.Validate(token); err != nil {
+		t.Errorf("Expected the token valid at nbf, got %v", err)
+	}
+	// Expiry is judged by the fake clock, with the leeway
+	fake.Advance(time.Hour + time.Minute)
+	if _, err := authenticator.Validate(token); err != nil {
+		t.Errorf("Expected the token valid within the leeway, got %v", err)
+	}
+	fake.Advance(time.Second)
+	if _, err := authenticator.Validate(token); err != ErrTokenExpired {
+		t.Errorf("Expected %v, got %v", ErrTokenExpired, err)
+	}
+}
+
+func TestJWTAuthenticatorMaxLifetime(t *testing.T) {
+	secret := []byte("shared-secret")
+	authenticator, err := NewJWTAuthenticator(JWTConfig{HMACSecret: secret, MaxLifetime: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	claims := map[string]interface{}{"sub": "analyst", "exp": time.Now().Add(30 * time.Minute).Unix()}
+	if _, err := authenticator.Validate(signHS256(t, secret, "", claims)); err != nil {
+		t.Errorf("Expected a short-lived token accepted, got %v", err)
+	}
+	if _, err := authenticator.Validate(signHS256(t, secret, "", withClaim(claims, "exp", time.Now().Add(48*time.Hour).Unix()))); err != ErrLifetimeTooLong {
+		t.Errorf("Expected %v, got %v", ErrLifetimeTooLong, err)
+	}
+	// A bounded lifetime needs an expiry even without RequireExp
+	delete(claims, "exp")
+	if _, err := authenticator.Validate(signHS256(t, secret, "", claims)); err != ErrMissingExpiry {
+		t.Errorf("Expected %v, got %v", ErrMissingExpiry, err)
+	}
+}
+
+func withClaim(claims map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+func TestJWTAuthenticatorJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	octSecret := []byte("jwks-secret")
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa-1",
+				"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{"kty": "oct", "kid": "oct-1", "k": base64.RawURLEncoding.EncodeToString(octSecret)},
+		},
+	}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+
+	authenticator, err := NewJWTAuthenticator(JWTConfig{JWKSFile: path})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	claims := map[string]interface{}{"sub": "svc", "scopes": []string{"admin"}}
+	if _, err := authenticator.Validate(signRS256(t, rsaKey, "rsa-1", claims)); err != nil {
+		t.Errorf("Failed to validate RS256 token: %v", err)
+	}
+	if _, err := authenticator.Validate(signHS256(t, octSecret, "oct-1", claims)); err != nil {
+		t.Errorf("Failed to validate HS256 JWKS token: %v", err)
+	}
+	if _, err := authenticator.Validate(signRS256(t, rsaKey, "unknown", claims)); err != ErrUnknownKey {
+		t.Errorf("Expected unknown key error, got: %v", err)
+	}
+}
+
+func TestCertAuthenticator(t *testing.T) {
+	authenticator := NewCertAuthenticator([]ClientCert{
+		{Subject: "CN=ingest,O=Example", Scopes: []Scope{ScopePublish}, Tenant: "team-a"},
+		{Subject: "reader", Scopes: []Scope{ScopeReadEvents}},
+	})
+	withCert := func(subject pkix.Name) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: subject}}}}
+		return req
+	}
+
+	principal, err := authenticator.Authenticate(withCert(pkix.Name{CommonName: "ingest", Organization: []string{"Example"}}))
+	if err != nil {
+		t.Fatalf("Expected full subject to match, got: %v", err)
+	}
+	if principal.Method != "mtls" || principal.Tenant != "team-a" || !principal.HasScope(ScopePublish) {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+
+	if _, err := authenticator.Authenticate(withCert(pkix.Name{CommonName: "reader"})); err != nil {
+		t.Errorf("Expected common name to match, got: %v", err)
+	}
+	if _, err := authenticator.Authenticate(withCert(pkix.Name{CommonName: "stranger"})); err != ErrNoCredentials {
+		t.Errorf("Expected ErrNoCredentials for unmapped subject, got: %v", err)
+	}
+	if _, err := authenticator.Authenticate(httptest.NewRequest(http.MethodGet, "/events", nil)); err != ErrNoCredentials {
+		t.Errorf("Expected ErrNoCredentials without TLS, got: %v", err)
+	}
+}
+
+func TestMiddlewareRequire(t *testing.T) {
+	authenticator, _ := NewAPIKeyAuthenticator([]APIKey{
+		{Name: "reader", Hash: HashAPIKey("reader-key"), Scopes: []Scope{ScopeReadEvents}},
+	})
+	registry := metrics.NewRegistry()
+	var audit bytes.Buffer
+	middleware := NewMiddleware(authenticator, registry, log.New(&audit, "", 0))
+	middleware.SetClock(clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)))
+
+	handler := middleware.Require(ScopeReadEvents, func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok || principal.Name != "reader" {
+			t.Error("Expected principal in request context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	admin := middleware.Require(ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func(h http.HandlerFunc, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	if code := call(handler, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without credentials, got %d", http.StatusUnauthorized, code)
+	}
+	if code := call(handler, "bad-key"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with a bad key, got %d", http.StatusUnauthorized, code)
+	}
+	if code := call(handler, "reader-key"); code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := call(admin, "reader-key"); code != http.StatusForbidden {
+		t.Errorf("Expected status %d without admin scope, got %d", http.StatusForbidden, code)
+	}
+
+	for reason, want := range map[string]uint64{"missing": 1, "invalid": 1, "forbidden": 1} {
+		got := registry.Counter("auth_failures_total", "", "reason", reason).Value()
+		if got != want {
+			t.Errorf("Expected %d %s failures, got %d", want, reason, got)
+		}
+	}
+	if lines := strings.Count(audit.String(), `"outcome":"denied"`); lines != 3 {
+		t.Errorf("Expected 3 denied audit records, got %d", lines)
+	}
+	if lines := strings.Count(audit.String(), `"time":"2024-01-01T00:00:00Z"`); lines != 3 {
+		t.Errorf("Expected audit records timestamped by the clock, got %s", audit.String())
+	}
+}
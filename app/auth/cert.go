@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// ClientCert maps a client certificate subject to a principal. Subject is
+// matched against the certificate's common name or its full distinguished
+// name, such as "CN=ingest,O=Example".
+type ClientCert struct {
+	Subject string
+	Scopes  []Scope
+	Tenant  string
+}
+
+// CertAuthenticator identifies callers by the client certificate verified
+// during the TLS handshake
+type CertAuthenticator struct {
+	subjects []ClientCert
+}
+
+// NewCertAuthenticator creates an authenticator for the given subjects
+func NewCertAuthenticator(subjects []ClientCert) *CertAuthenticator {
+	return &CertAuthenticator{subjects: append([]ClientCert(nil), subjects...)}
+}
+
+// Authenticate implements Authenticator. Certificates with an unmapped
+// subject carry no credentials, so other authenticators in a chain still apply.
+func (a *CertAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	for _, subject := range a.subjects {
+		if matchesSubject(cert, subject.Subject) {
+			return &Principal{Name: subject.Subject, Method: "mtls", Scopes: subject.Scopes, Tenant: subject.Tenant}, nil
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// matchesSubject compares a configured subject to a certificate
+func matchesSubject(cert *x509.Certificate, subject string) bool {
+	return subject != "" && (cert.Subject.CommonName == subject || cert.Subject.String() == subject)
+}
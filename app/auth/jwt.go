@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/models"
+)
+
+// JWT validation errors
+var (
+	ErrMalformedToken   = models.Error("malformed token")
+	ErrUnsupportedAlg   = models.Error("unsupported token algorithm")
+	ErrUnknownKey       = models.Error("unknown signing key")
+	ErrInvalidSignature = models.Error("invalid token signature")
+	ErrTokenExpired     = models.Error("token expired")
+	ErrTokenNotYetValid = models.Error("token not yet valid")
+	ErrMissingExpiry    = models.Error("token has no expiry")
+	ErrLifetimeTooLong  = models.Error("token lifetime too long")
+	ErrInvalidClaims    = models.Error("invalid token claims")
+)
+
+// JWTConfig controls bearer token validation
+type JWTConfig struct {
+	// HMACSecret verifies HS256 tokens without a matching JWKS key
+	HMACSecret []byte
+	// JWKSFile is a local JSON Web Key Set with "oct" and "RSA" keys
+	JWKSFile string
+	// Issuer and Audience are checked when set
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew on exp and nbf
+	Leeway time.Duration
+	// RequireExp rejects tokens without an exp claim, which would
+	// otherwise never expire
+	RequireExp bool
+	// MaxLifetime rejects tokens expiring further than this in the future
+	// when positive
+	MaxLifetime time.Duration
+	// Clock checks exp and nbf, the system clock when nil
+	Clock clock.Clock
+}
+
+// JWTAuthenticator validates HMAC or RSA signed bearer tokens
+type JWTAuthenticator struct {
+	cfg        JWTConfig
+	hmacKeys   map[string][]byte
+	rsaKeys    map[string]*rsa.PublicKey
+	defaultKey []byte
+}
+
+// NewJWTAuthenticator creates an authenticator, loading the JWKS file if set
+func NewJWTAuthenticator(cfg JWTConfig) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		cfg:        cfg,
+		hmacKeys:   make(map[string][]byte),
+		rsaKeys:    make(map[string]*rsa.PublicKey),
+		defaultKey: cfg.HMACSecret,
+	}
+	a.cfg.Clock = clock.OrReal(cfg.Clock)
+	if cfg.JWKSFile != "" {
+		if err := a.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// jwk is the subset of RFC 7517 fields used for verification
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJWKS reads symmetric and RSA public keys from a JWKS file
+func (a *JWTAuthenticator) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+
+	for _, key := range set.Keys {
+		switch key.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return err
+			}
+			a.hmacKeys[key.Kid] = secret
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return err
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return err
+			}
+			a.rsaKeys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		}
+	}
+	return nil
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.Validate(token)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Name: claims.Subject, Method: "jwt", Scopes: claims.scopes(), Tenant: claims.Tenant}, nil
+}
+
+// Claims are the registered and scope claims read from a token
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Scopes    []string `json:"scopes"`
+	Tenant    string   `json:"tenant"`
+}
+
+// scopes merges the space separated "scope" claim and the "scopes" array
+func (c *Claims) scopes() []Scope {
+	var scopes []Scope
+	for _, s := range strings.Fields(c.Scope) {
+		scopes = append(scopes, Scope(s))
+	}
+	for _, s := range c.Scopes {
+		scopes = append(scopes, Scope(s))
+	}
+	return scopes
+}
+
+// audience accepts both the string and array forms of "aud"
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Validate verifies the token signature and registered claims
+func (a *JWTAuthenticator) Validate(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	if err := a.verify(header.Alg, header.Kid, signed, signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := a.checkClaims(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verify checks the signature with the key selected by alg and kid
+func (a *JWTAuthenticator) verify(alg, kid string, signed, signature []byte) error {
+	switch alg {
+	case "HS256":
+		secret, ok := a.hmacKeys[kid]
+		if !ok {
+			secret = a.defaultKey
+		}
+		if len(secret) == 0 {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "RS256":
+		key, ok := a.rsaKeys[kid]
+		if !ok {
+			return ErrUnknownKey
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	// Rejects "none" and algorithms we cannot verify
+	return ErrUnsupportedAlg
+}
+
+// checkClaims validates expiry, lifetime, not-before, issuer and audience
+func (a *JWTAuthenticator) checkClaims(c *Claims) error {
+	now := a.cfg.Clock.Now()
+	if c.ExpiresAt == 0 {
+		if a.cfg.RequireExp || a.cfg.MaxLifetime > 0 {
+			return ErrMissingExpiry
+		}
+	} else {
+		expires := time.Unix(c.ExpiresAt, 0)
+		if now.After(expires.Add(a.cfg.Leeway)) {
+			return ErrTokenExpired
+		}
+		if a.cfg.MaxLifetime > 0 && expires.After(now.Add(a.cfg.MaxLifetime+a.cfg.Leeway)) {
+			return ErrLifetimeTooLong
+		}
+	}
+	if c.NotBefore != 0 && now.Before(time.Unix(c.NotBefore, 0).Add(-a.cfg.Leeway)) {
+		return ErrTokenNotYetValid
+	}
+	if a.cfg.Issuer != "" && c.Issuer != a.cfg.Issuer {
+		return ErrInvalidClaims
+	}
+	if a.cfg.Audience != "" {
+		found := false
+		for _, aud := range c.Audience {
+			if aud == a.cfg.Audience {
+				found = true
+			}
+		}
+		if !found {
+			return ErrInvalidClaims
+		}
+	}
+	if c.Subject == "" {
+		return ErrInvalidClaims
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
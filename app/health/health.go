@@ -0,0 +1,164 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Status is the outcome of a single component check
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// State is the lifecycle phase of the application
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateReady    State = "ready"
+	StateDraining State = "draining"
+)
+
+// Kind controls which probes a check contributes to
+type Kind int
+
+const (
+	// Liveness checks fail /livez, /readyz and /health
+	Liveness Kind = iota
+	// Readiness checks fail /readyz and /health only
+	Readiness
+)
+
+// Result is the outcome of a component check
+type Result struct {
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Check reports the current health of a component
+type Check func() Result
+
+// Report is the aggregated view returned by the health endpoints
+type Report struct {
+	Status     Status            `json:"status"`
+	State      State             `json:"state"`
+	Components map[string]Result `json:"components"`
+}
+
+type component struct {
+	name  string
+	kind  Kind
+	check Check
+}
+
+// Registry keeps track of component health checks and the application state
+type Registry struct {
+	mu         sync.RWMutex
+	state      State
+	components []component
+}
+
+// NewRegistry creates a registry in the starting state
+func NewRegistry() *Registry {
+	return &Registry{state: StateStarting}
+}
+
+// Register adds a named component check
+func (r *Registry) Register(name string, kind Kind, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components = append(r.components, component{name: name, kind: kind, check: check})
+}
+
+// SetState moves the application to a new lifecycle phase
+func (r *Registry) SetState(state State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = state
+}
+
+// State returns the current lifecycle phase
+func (r *Registry) State() State {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state
+}
+
+// Liveness runs the liveness checks only
+func (r *Registry) Liveness() Report {
+	return r.run(func(k Kind) bool { return k == Liveness })
+}
+
+// Readiness runs every check and reports down unless the application is ready
+func (r *Registry) Readiness() Report {
+	report := r.run(func(Kind) bool { return true })
+	if report.State != StateReady {
+		report.Status = StatusDown
+	}
+	return report
+}
+
+// Report runs every check without taking the lifecycle state into account
+func (r *Registry) Report() Report {
+	return r.run(func(Kind) bool { return true })
+}
+
+// run evaluates the matching checks and aggregates them to the worst status
+func (r *Registry) run(include func(Kind) bool) Report {
+	r.mu.RLock()
+	state := r.state
+	components := make([]component, len(r.components))
+	copy(components, r.components)
+	r.mu.RUnlock()
+
+	sort.Slice(components, func(i, j int) bool { return components[i].name < components[j].name })
+
+	report := Report{
+		Status:     StatusOK,
+		State:      state,
+		Components: make(map[string]Result, len(components)),
+	}
+	for _, c := range components {
+		if !include(c.kind) {
+			continue
+		}
+		result := c.check()
+		report.Components[c.name] = result
+		report.Status = worst(report.Status, result.Status)
+	}
+	return report
+}
+
+// worst returns the more severe of two statuses
+func worst(a, b Status) Status {
+	rank := map[Status]int{StatusOK: 0, StatusDegraded: 1, StatusDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// Threshold builds a check that degrades when usage reaches the warn ratio
+// and goes down when it reaches the fail ratio
+func Threshold(usage func() (used, capacity int), warn, fail float64) Check {
+	return func() Result {
+		used, capacity := usage()
+		if capacity <= 0 {
+			return Result{Status: StatusOK}
+		}
+		ratio := float64(used) / float64(capacity)
+		message := fmt.Sprintf("%d/%d in use", used, capacity)
+		switch {
+		case ratio >= fail:
+			return Result{Status: StatusDown, Message: message}
+		case ratio >= warn:
+			return Result{Status: StatusDegraded, Message: message}
+		}
+		return Result{Status: StatusOK, Message: message}
+	}
+}
@@ -0,0 +1,68 @@
+package health
+
+import "testing"
+
+func TestRegistryReadinessFollowsState(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("store", Readiness, func() Result { return Result{Status: StatusOK} })
+
+	// Not ready while starting
+	if got := registry.Readiness().Status; got != StatusDown {
+		t.Errorf("Expected readiness %s while starting, got %s", StatusDown, got)
+	}
+
+	registry.SetState(StateReady)
+	if got := registry.Readiness().Status; got != StatusOK {
+		t.Errorf("Expected readiness %s when ready, got %s", StatusOK, got)
+	}
+
+	registry.SetState(StateDraining)
+	if got := registry.Readiness().Status; got != StatusDown {
+		t.Errorf("Expected readiness %s while draining, got %s", StatusDown, got)
+	}
+
+	// Liveness is not affected by the lifecycle state
+	if got := registry.Liveness().Status; got != StatusOK {
+		t.Errorf("Expected liveness %s while draining, got %s", StatusOK, got)
+	}
+}
+
+func TestRegistryAggregatesWorstStatus(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetState(StateReady)
+	registry.Register("workers", Liveness, func() Result { return Result{Status: StatusDegraded} })
+	registry.Register("queue", Readiness, func() Result { return Result{Status: StatusDown} })
+
+	if got := registry.Liveness().Status; got != StatusDegraded {
+		t.Errorf("Expected liveness %s, got %s", StatusDegraded, got)
+	}
+
+	report := registry.Report()
+	if report.Status != StatusDown {
+		t.Errorf("Expected report %s, got %s", StatusDown, report.Status)
+	}
+	if len(report.Components) != 2 {
+		t.Errorf("Expected 2 components, got %d", len(report.Components))
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	testCases := []struct {
+		name string
+		used int
+		want Status
+	}{
+		{name: "low", used: 10, want: StatusOK},
+		{name: "warn", used: 80, want: StatusDegraded},
+		{name: "fail", used: 95, want: StatusDown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			check := Threshold(func() (int, int) { return tc.used, 100 }, 0.75, 0.95)
+			if got := check().Status; got != tc.want {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"coding_challenge/app/api"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/routing"
+	"coding_challenge/internal/transform"
+)
+
+// newSink creates the publisher of a sink from the config
+func (a *App) newSink(cfg config.PublishConfig, codecs *codec.Registry) processor.Publisher {
+	if cfg.Output == "stdout" {
+		format, _ := codecs.ByName(cfg.Format)
+		return processor.NewStreamPublisher(os.Stdout, format)
+	}
+	return processor.NewLogPublisher(a.logger)
+}
+
+// newPipelines creates the router and a worker pool per pipeline. The
+// config was validated, so routes compile and name known pipelines and
+// sinks.
+func (a *App) newPipelines(codecs *codec.Registry, weights map[models.Priority]int) {
+	cfg := a.cfg
+	sinks := map[string]processor.Publisher{config.DefaultSink: a.sink}
+	for name, sink := range cfg.Sinks {
+		sinks[name] = a.newSink(sink, codecs)
+	}
+	for name, sink := range a.sinks {
+		sinks[name] = sink
+	}
+	a.sinks = sinks
+
+	pipelines := map[string]config.PipelineConfig{config.DefaultPipeline: {}}
+	for name, pipeline := range cfg.Pipelines {
+		pipelines[name] = pipeline
+	}
+	names := make([]string, 0, len(pipelines))
+	queueSizes := make(map[string]int, len(pipelines))
+	for name, pipeline := range pipelines {
+		names = append(names, name)
+		queueSizes[name] = cfg.Routing.QueueSize
+		if pipeline.QueueSize > 0 {
+			queueSizes[name] = pipeline.QueueSize
+		}
+	}
+	sort.Strings(names)
+
+	rules := make([]routing.Rule, len(cfg.Routing.Routes))
+	for i, route := range cfg.Routing.Routes {
+		match, _ := routing.Compile(route.Match, cfg.Expressions.Limits())
+		rules[i] = routing.Rule{Pipeline: route.Pipeline, Match: match}
+	}
+	a.router = processor.NewRouter(a.eventStore, routing.NewTable(rules, cfg.Routing.Default), queueSizes, a.metrics, a.logger)
+
+	if cfg.DeadLetter.MaxEntries > 0 {
+		a.deadLetters = processor.NewDeadLetters(cfg.DeadLetter.MaxEntries, a.clock, a.metrics)
+	}
+	a.pipelines = make(map[string]*processor.Pool, len(pipelines))
+	a.pipelineSinks = make(map[string][]string, len(pipelines))
+	for _, name := range names {
+		pipeline := pipelines[name]
+		poolCfg := processor.PoolConfig{
+			Name:        name,
+			Workers:     cfg.Pool.Workers,
+			MinWorkers:  cfg.Pool.MinWorkers,
+			MaxWorkers:  cfg.Pool.MaxWorkers,
+			Partitions:  cfg.Pool.Partitions,
+			MaxPending:  cfg.Pool.MaxPending,
+			LaneWeights: weights,
+			Autoscale: processor.AutoscaleConfig{
+				Interval:               time.Duration(cfg.Pool.Autoscale.Interval),
+				Cooldown:               time.Duration(cfg.Pool.Autoscale.Cooldown),
+				TargetPendingPerWorker: cfg.Pool.Autoscale.TargetPendingPerWorker,
+				TargetLatency:          time.Duration(cfg.Pool.Autoscale.TargetLatency),
+			},
+			Clock:       a.clock,
+			DeadLetters: a.deadLetters,
+		}
+		if pipeline.Workers > 0 {
+			poolCfg.Workers = pipeline.Workers
+			if poolCfg.MinWorkers > pipeline.Workers {
+				poolCfg.MinWorkers = pipeline.Workers
+			}
+			if poolCfg.MaxWorkers < pipeline.Workers {
+				poolCfg.MaxWorkers = pipeline.Workers
+			}
+		}
+		// Unset transforms keep the pool's uppercase default
+		if pipeline.Transforms != nil {
+			chain := make(transform.Chain, len(pipeline.Transforms))
+			for i, t := range pipeline.Transforms {
+				chain[i], _ = t.New(cfg.Expressions.Limits())
+			}
+			poolCfg.Transform = chain
+		}
+		sinkNames := pipeline.Sinks
+		if len(sinkNames) == 0 {
+			sinkNames = []string{config.DefaultSink}
+		}
+		a.pipelineSinks[name] = sinkNames
+		fanout := make(processor.Fanout, len(sinkNames))
+		for i, sink := range sinkNames {
+			fanout[i] = sinks[sink]
+		}
+		poolCfg.Publisher = a.published.Via(fanout)
+
+		a.pipelines[name] = processor.NewPool(a.router.Pipeline(name), poolCfg, a.metrics, a.logger)
+	}
+	a.pool = a.pipelines[config.DefaultPipeline]
+}
+
+// load sums the backlog and workers of every pipeline, with the latency
+// of the slowest
+func (a *App) load() api.Load {
+	load := api.Load{Depth: a.eventStore.QueueLen()}
+	for name, pool := range a.pipelines {
+		load.Depth += a.router.Depth(name) + pool.Pending()
+		load.Workers += pool.Size()
+		if latency := pool.Latency(); latency > load.Latency {
+			load.Latency = latency
+		}
+	}
+	return load
+}
+
+// pipelineNames returns the names of the pipelines in sorted order
+func (a *App) pipelineNames() []string {
+	names := make([]string, 0, len(a.pipelines))
+	for name := range a.pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
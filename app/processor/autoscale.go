@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"coding_challenge/internal/metrics"
+)
+
+// maxScalingHistory is the number of scaling decisions kept for inspection
+const maxScalingHistory = 20
+
+// AutoscaleConfig controls how the pool size follows the load
+type AutoscaleConfig struct {
+	// Interval between scaling evaluations, zero disables autoscaling
+	Interval time.Duration
+	// Cooldown is the minimum time between two scaling decisions
+	Cooldown time.Duration
+	// TargetPendingPerWorker is the backlog each worker is expected to absorb
+	TargetPendingPerWorker int
+	// TargetLatency is the processing time above which the pool grows
+	TargetLatency time.Duration
+}
+
+// ScalingDecision records a change of the pool size
+type ScalingDecision struct {
+	Time    time.Time     `json:"time"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Reason  string        `json:"reason"`
+	Pending int           `json:"pending"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// PoolStatus describes the current size and scaling state of a pool
+type PoolStatus struct {
+	State      PoolState         `json:"state"`
+	Size       int               `json:"size"`
+	MinWorkers int               `json:"min_workers"`
+	MaxWorkers int               `json:"max_workers"`
+	Pinned     bool              `json:"pinned"`
+	Pending    int               `json:"pending"`
+	Latency    time.Duration     `json:"latency_ns"`
+	Decisions  []ScalingDecision `json:"decisions"`
+}
+
+// autoscaler adjusts the pool size between its min and max bounds
+type autoscaler struct {
+	pool *Pool
+	cfg  AutoscaleConfig
+
+	mu        sync.Mutex
+	pinned    bool
+	lastScale time.Time
+	history   []ScalingDecision
+
+	scaleUp     *metrics.Counter
+	scaleDown   *metrics.Counter
+	pinnedCount *metrics.Counter
+}
+
+func newAutoscaler(pool *Pool, cfg AutoscaleConfig, registry *metrics.Registry) *autoscaler {
+	const name, help = "processor_pool_scaling_decisions_total", "Pool scaling decisions by direction"
+	return &autoscaler{
+		pool:        pool,
+		cfg:         cfg,
+		scaleUp:     registry.Counter(name, help, pool.labels("direction", "up")...),
+		scaleDown:   registry.Counter(name, help, pool.labels("direction", "down")...),
+		pinnedCount: registry.Counter(name, help, pool.labels("direction", "pinned")...),
+	}
+}
+
+// run evaluates the pool on every interval until ctx is canceled or done closes
+func (a *autoscaler) run(ctx context.Context, done <-chan struct{}) {
+	if a.cfg.Interval <= 0 || a.pool.cfg.MinWorkers == a.pool.cfg.MaxWorkers {
+		return
+	}
+
+	ticker := a.pool.cfg.Clock.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case now := <-ticker.C():
+			a.evaluate(now)
+		}
+	}
+}
+
+// evaluate decides whether the pool should grow or shrink
+func (a *autoscaler) evaluate(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// A paused pool builds a backlog on purpose, so leave its size alone
+	if a.pinned || a.pool.State() != PoolRunning || now.Sub(a.lastScale) < a.cfg.Cooldown {
+		return
+	}
+
+	size := a.pool.Size()
+	pending := a.pool.Pending()
+	latency := a.pool.Latency()
+	minWorkers, maxWorkers := a.pool.cfg.MinWorkers, a.pool.cfg.MaxWorkers
+
+	target := a.cfg.TargetPendingPerWorker
+	if target <= 0 {
+		target = 1
+	}
+	slow := a.cfg.TargetLatency > 0 && latency > a.cfg.TargetLatency
+
+	var to int
+	var reason string
+	switch {
+	case size < maxWorkers && (pending > size*target || (slow && pending > 0)):
+		// Grow straight to the size needed for the backlog
+		to = (pending + target - 1) / target
+		if to <= size {
+			to = size + 1
+		}
+		if to > maxWorkers {
+			to = maxWorkers
+		}
+		reason = "backlog above target"
+		if slow {
+			reason = "latency above target"
+		}
+	case size > minWorkers && pending < (size-1)*target && !slow:
+		// Shrink one worker at a time to avoid flapping
+		to = size - 1
+		reason = "backlog below target"
+	default:
+		return
+	}
+
+	a.apply(now, size, to, reason, pending, latency)
+}
+
+// pin fixes the pool size and disables autoscaling
+func (a *autoscaler) pin(size int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pinned = true
+	a.apply(a.pool.cfg.Clock.Now(), a.pool.Size(), size, "pinned", a.pool.Pending(), a.pool.Latency())
+}
+
+// unpin re-enables autoscaling
+func (a *autoscaler) unpin() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pinned = false
+}
+
+// apply resizes the pool and records the decision. Callers must hold a.mu.
+func (a *autoscaler) apply(now time.Time, from, to int, reason string, pending int, latency time.Duration) {
+	a.pool.Resize(to)
+	a.lastScale = now
+
+	switch {
+	case reason == "pinned":
+		a.pinnedCount.Inc()
+	case to > from:
+		a.scaleUp.Inc()
+	default:
+		a.scaleDown.Inc()
+	}
+
+	a.history = append(a.history, ScalingDecision{
+		Time: now, From: from, To: to, Reason: reason, Pending: pending, Latency: latency,
+	})
+	if len(a.history) > maxScalingHistory {
+		a.history = a.history[len(a.history)-maxScalingHistory:]
+	}
+	a.pool.logger.Printf("Pool resized from %d to %d workers: %s", from, to, reason)
+}
+
+// status returns a snapshot of the scaling state
+func (a *autoscaler) status() PoolStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	decisions := make([]ScalingDecision, len(a.history))
+	copy(decisions, a.history)
+	return PoolStatus{
+		State:      a.pool.State(),
+		Size:       a.pool.Size(),
+		MinWorkers: a.pool.cfg.MinWorkers,
+		MaxWorkers: a.pool.cfg.MaxWorkers,
+		Pinned:     a.pinned,
+		Pending:    a.pool.Pending(),
+		Latency:    a.pool.Latency(),
+		Decisions:  decisions,
+	}
+}
+
+// Pin fixes the pool at size workers, between its minimum and maximum,
+// until Unpin is called
+func (p *Pool) Pin(size int) error {
+	if size < p.cfg.MinWorkers || size > p.cfg.MaxWorkers {
+		return ErrInvalidPoolSize
+	}
+	p.scaler.pin(size)
+	return nil
+}
+
+// Unpin hands the pool size back to the autoscaler
+func (p *Pool) Unpin() {
+	p.scaler.unpin()
+}
+
+// Status returns the current size and recent scaling decisions
+func (p *Pool) Status() PoolStatus {
+	return p.scaler.status()
+}
@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+func newScalingPool(t *testing.T) *Pool {
+	t.Helper()
+	return newScalingPoolOn(t, nil)
+}
+
+// newScalingPoolOn creates the scaling pool on a clock
+func newScalingPoolOn(t *testing.T, c clock.Clock) *Pool {
+	t.Helper()
+	return NewPool(models.NewEventStore(1), PoolConfig{
+		Workers:    2,
+		MinWorkers: 1,
+		MaxWorkers: 6,
+		Partitions: 8,
+		MaxPending: 1000,
+		Autoscale: AutoscaleConfig{
+			Interval:               time.Second,
+			Cooldown:               10 * time.Second,
+			TargetPendingPerWorker: 10,
+		},
+		Clock: c,
+	}, metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+}
+
+func fillPool(t *testing.T, pool *Pool, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if !pool.enqueue(&models.Event{ID: fmt.Sprintf("event-%d", i)}) {
+			t.Fatal("Failed to enqueue event")
+		}
+	}
+}
+
+func TestAutoscalerScalesUpWithBacklog(t *testing.T) {
+	pool := newScalingPool(t)
+	fillPool(t, pool, 45)
+
+	now := time.Now()
+	pool.scaler.evaluate(now)
+	if pool.Size() != 5 {
+		t.Errorf("Expected 5 workers for the backlog, got %d", pool.Size())
+	}
+
+	// The cooldown prevents another decision straight away
+	pool.scaler.evaluate(now.Add(time.Second))
+	if len(pool.Status().Decisions) != 1 {
+		t.Errorf("Expected 1 decision during cooldown, got %d", len(pool.Status().Decisions))
+	}
+}
+
+func TestAutoscalerRunsOnClock(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	pool := newScalingPoolOn(t, fake)
+	fillPool(t, pool, 45)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.scaler.run(ctx, nil)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Nothing is evaluated until the first interval passes
+	fake.BlockUntil(1)
+	if pool.Size() != 2 {
+		t.Fatalf("Expected 2 workers before the first evaluation, got %d", pool.Size())
+	}
+	fake.Advance(time.Second)
+	waitFor(t, "the pool to scale up", func() bool { return pool.Size() == 5 })
+	if decisions := pool.Status().Decisions; !decisions[0].Time.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected the decision at %v, got %v", start.Add(time.Second), decisions[0].Time)
+	}
+}
+
+func TestAutoscalerCapsAtMaxWorkers(t *testing.T) {
+	pool := newScalingPool(t)
+	fillPool(t, pool, 500)
+
+	pool.scaler.evaluate(time.Now())
+	if pool.Size() != 6 {
+		t.Errorf("Expected max of 6 workers, got %d", pool.Size())
+	}
+}
+
+func TestAutoscalerScalesDownOneAtATime(t *testing.T) {
+	pool := newScalingPool(t)
+	pool.Resize(4)
+
+	now := time.Now()
+	pool.scaler.evaluate(now)
+	if pool.Size() != 3 {
+		t.Errorf("Expected 3 workers after scale down, got %d", pool.Size())
+	}
+
+	pool.scaler.evaluate(now.Add(11 * time.Second))
+	pool.scaler.evaluate(now.Add(22 * time.Second))
+	pool.scaler.evaluate(now.Add(33 * time.Second))
+	if pool.Size() != 1 {
+		t.Errorf("Expected min of 1 worker, got %d", pool.Size())
+	}
+}
+
+func TestPoolPinBounds(t *testing.T) {
+	pool := NewPool(models.NewEventStore(1), PoolConfig{Workers: 3, MinWorkers: 2, MaxWorkers: 4, Partitions: 4, MaxPending: 10},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+
+	for size, want := range map[int]error{1: ErrInvalidPoolSize, 2: nil, 4: nil, 5: ErrInvalidPoolSize} {
+		if err := pool.Pin(size); err != want {
+			t.Errorf("Expected pinning to %d to return %v, got %v", size, want, err)
+		}
+	}
+}
+
+func TestPoolPin(t *testing.T) {
+	pool := newScalingPool(t)
+
+	if err := pool.Pin(0); err != ErrInvalidPoolSize {
+		t.Errorf("Expected invalid size error, got: %v", err)
+	}
+	if err := pool.Pin(7); err != ErrInvalidPoolSize {
+		t.Errorf("Expected invalid size error, got: %v", err)
+	}
+
+	if err := pool.Pin(4); err != nil {
+		t.Fatalf("Failed to pin pool: %v", err)
+	}
+	if pool.Size() != 4 {
+		t.Errorf("Expected 4 workers, got %d", pool.Size())
+	}
+
+	// Pinned pools ignore the autoscaler
+	pool.scaler.evaluate(time.Now().Add(time.Minute))
+	if pool.Size() != 4 {
+		t.Errorf("Expected pinned size of 4, got %d", pool.Size())
+	}
+
+	pool.Unpin()
+	pool.scaler.evaluate(time.Now().Add(time.Minute))
+	if pool.Size() != 3 {
+		t.Errorf("Expected 3 workers after unpin, got %d", pool.Size())
+	}
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"sync"
+
+	"coding_challenge/internal/models"
+)
+
+// ErrBroadcasterClosed is returned by Subscribe after Close
+var ErrBroadcasterClosed = models.Error("broadcaster closed")
+
+// Broadcaster is a Publisher handing each event to another publisher, then
+// to subscribers, so published events can be followed over the API
+type Broadcaster struct {
+	next Publisher
+
+	mu          sync.Mutex
+	subscribers map[string]map[*PublishedSubscription]struct{}
+	closed      bool
+}
+
+// NewBroadcaster creates a broadcaster publishing to next
+func NewBroadcaster(next Publisher) *Broadcaster {
+	return &Broadcaster{next: next, subscribers: make(map[string]map[*PublishedSubscription]struct{})}
+}
+
+// Publish implements Publisher. Subscribers only receive events next
+// published successfully.
+func (b *Broadcaster) Publish(event *models.TransformedEvent) error {
+	return b.publish(b.next, event)
+}
+
+// Check implements Checker for the publisher events are handed to
+func (b *Broadcaster) Check() error {
+	return Check(b.next)
+}
+
+// Via returns a Publisher handing each event to next instead, then to the
+// broadcaster's subscribers, so pipelines publishing to different sinks
+// share the subscribers
+func (b *Broadcaster) Via(next Publisher) Publisher {
+	return &viaPublisher{broadcaster: b, next: next}
+}
+
+// viaPublisher publishes through a broadcaster to another publisher
+type viaPublisher struct {
+	broadcaster *Broadcaster
+	next        Publisher
+}
+
+// Publish implements Publisher
+func (v *viaPublisher) Publish(event *models.TransformedEvent) error {
+	return v.broadcaster.publish(v.next, event)
+}
+
+// Check implements Checker for the publisher events are handed to
+func (v *viaPublisher) Check() error {
+	return Check(v.next)
+}
+
+// publish hands an event to next, then to the subscribers of its tenant
+func (b *Broadcaster) publish(next Publisher, event *models.TransformedEvent) error {
+	if err := next.Publish(event); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers[event.Tenant] {
+		select {
+		case sub.ch <- event:
+		default:
+			b.remove(sub)
+			sub.close(true)
+		}
+	}
+	return nil
+}
+
+// PublishedSubscription receives the events published for a tenant
+type PublishedSubscription struct {
+	// C is closed when the subscription ends
+	C           <-chan *models.TransformedEvent
+	ch          chan *models.TransformedEvent
+	broadcaster *Broadcaster
+	tenant      string
+	lagged      bool
+	done        bool
+}
+
+// Subscribe delivers the events published for a tenant from now on. A
+// subscriber that falls more than buffer events behind is dropped and
+// reports Lagged; published events cannot be replayed.
+func (b *Broadcaster) Subscribe(tenant string, buffer int) (*PublishedSubscription, error) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan *models.TransformedEvent, buffer)
+	sub := &PublishedSubscription{C: ch, ch: ch, broadcaster: b, tenant: tenant}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBroadcasterClosed
+	}
+	subs, ok := b.subscribers[tenant]
+	if !ok {
+		subs = make(map[*PublishedSubscription]struct{})
+		b.subscribers[tenant] = subs
+	}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close ends every subscription
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			sub.close(false)
+		}
+	}
+	b.subscribers = make(map[string]map[*PublishedSubscription]struct{})
+}
+
+// remove forgets a subscription. Callers must hold b.mu.
+func (b *Broadcaster) remove(sub *PublishedSubscription) {
+	if subs, ok := b.subscribers[sub.tenant]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(b.subscribers, sub.tenant)
+		}
+	}
+}
+
+// Close stops the subscription and closes C
+func (sub *PublishedSubscription) Close() {
+	sub.broadcaster.mu.Lock()
+	defer sub.broadcaster.mu.Unlock()
+	sub.broadcaster.remove(sub)
+	sub.close(false)
+}
+
+// Lagged reports whether the subscription was dropped for falling behind
+func (sub *PublishedSubscription) Lagged() bool {
+	sub.broadcaster.mu.Lock()
+	defer sub.broadcaster.mu.Unlock()
+	return sub.lagged
+}
+
+// close ends the subscription. Callers must hold the broadcaster's lock.
+func (sub *PublishedSubscription) close(lagged bool) {
+	if sub.done {
+		return
+	}
+	sub.done = true
+	sub.lagged = lagged
+	close(sub.ch)
+}
@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"coding_challenge/internal/models"
+)
+
+// failingPublisher fails every publish
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(*models.TransformedEvent) error {
+	return errors.New("sink unavailable")
+}
+
+func TestBroadcasterDeliversByTenant(t *testing.T) {
+	b := NewBroadcaster(NewLogPublisher(log.New(io.Discard, "", 0)))
+	acme, err := b.Subscribe("acme", 4)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	other, _ := b.Subscribe("other", 4)
+
+	for _, id := range []string{"a", "b"} {
+		if err := b.Publish(&models.TransformedEvent{ID: id, Tenant: "acme"}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	if got := (<-acme.C).ID + (<-acme.C).ID; got != "ab" {
+		t.Errorf("Expected a then b, got %q", got)
+	}
+	if len(other.C) != 0 {
+		t.Errorf("Expected no events for another tenant, got %d", len(other.C))
+	}
+
+	// Events the sink refused are not broadcast
+	failing := NewBroadcaster(failingPublisher{})
+	sub, _ := failing.Subscribe("acme", 4)
+	if failing.Publish(&models.TransformedEvent{ID: "c", Tenant: "acme"}) == nil || len(sub.C) != 0 {
+		t.Error("Expected a failed publish not to be broadcast")
+	}
+}
+
+func TestBroadcasterDropsLaggingSubscribers(t *testing.T) {
+	b := NewBroadcaster(NewLogPublisher(log.New(io.Discard, "", 0)))
+	slow, _ := b.Subscribe("acme", 1)
+	for _, id := range []string{"a", "b"} {
+		b.Publish(&models.TransformedEvent{ID: id, Tenant: "acme"})
+	}
+	if event := <-slow.C; event.ID != "a" {
+		t.Errorf("Expected the buffered event, got %s", event.ID)
+	}
+	if _, ok := <-slow.C; ok || !slow.Lagged() {
+		t.Error("Expected the lagging subscriber to be dropped")
+	}
+
+	sub, _ := b.Subscribe("acme", 1)
+	b.Close()
+	if _, ok := <-sub.C; ok || sub.Lagged() {
+		t.Error("Expected Close to end subscriptions")
+	}
+	if _, err := b.Subscribe("acme", 1); err != ErrBroadcasterClosed {
+		t.Errorf("Expected ErrBroadcasterClosed, got %v", err)
+	}
+	sub.Close()
+}
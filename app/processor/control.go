@@ -0,0 +1,96 @@
+package processor
+
+import "coding_challenge/internal/models"
+
+// PoolState describes whether the pool is processing events
+type PoolState string
+
+const (
+	PoolRunning  PoolState = "running"
+	PoolPaused   PoolState = "paused"
+	PoolDraining PoolState = "draining"
+)
+
+// State returns whether the pool is running, paused or draining
+func (p *Pool) State() PoolState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Pause stops workers from claiming new events once their current event is
+// done. Ingestion continues and events accumulate in the store. When the
+// source closes the workers process the events the pool holds regardless.
+func (p *Pool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state != PoolPaused {
+		p.logger.Println("Pool paused")
+	}
+	p.state = PoolPaused
+	p.cond.Broadcast()
+}
+
+// Resume lets workers claim events again, cancelling any drain in progress
+func (p *Pool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state != PoolRunning {
+		p.logger.Println("Pool resumed")
+	}
+	p.state = PoolRunning
+	p.cond.Broadcast()
+}
+
+// Drain processes the backlog, the events held by the pool and those
+// queued in its source when called, and then pauses. Events arriving later
+// wait for a resume. It also works from the paused state and returns
+// immediately; State reports PoolPaused once the backlog is processed.
+func (p *Pool) Drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	source, counted := p.source.(backlogSource)
+	p.drainBacklog = make(map[models.Priority]int, len(models.Priorities))
+	queued := 0
+	for _, lane := range models.Priorities {
+		n := p.waiting[lane]
+		if counted {
+			n += source.LaneLen(lane)
+		}
+		p.drainBacklog[lane] = n
+		queued += n
+	}
+	p.logger.Printf("Pool draining %d pending and %d queued events", p.pending+p.inFlight, queued)
+	p.state = PoolDraining
+	p.cond.Broadcast()
+	p.finishDrain()
+}
+
+// WorkerStatuses returns a snapshot of every worker
+func (p *Pool) WorkerStatuses() []WorkerStatus {
+	workers := p.Workers()
+	statuses := make([]WorkerStatus, len(workers))
+	for i, w := range workers {
+		statuses[i] = w.Status()
+	}
+	return statuses
+}
+
+// finishDrain pauses a draining pool once its backlog is processed.
+// Callers must hold p.mu.
+func (p *Pool) finishDrain() {
+	if p.state != PoolDraining || p.pending > 0 || p.inFlight > 0 {
+		return
+	}
+	for _, n := range p.drainBacklog {
+		if n > 0 {
+			return
+		}
+	}
+	p.state = PoolPaused
+	p.logger.Println("Pool drained and paused")
+	p.cond.Broadcast()
+}
@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func startPool(t *testing.T, store *models.EventStore, out *syncBuffer) *Pool {
+	t.Helper()
+	pool := NewPool(store, PoolConfig{Workers: 2, Partitions: 4, MaxPending: 100},
+		metrics.NewRegistry(), log.New(out, "", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return pool
+}
+
+func addEvents(t *testing.T, store *models.EventStore, prefix string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := store.Add(&models.Event{ID: fmt.Sprintf("%s-%d", prefix, i), Payload: "payload"}); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+}
+
+func TestPoolPauseAndResume(t *testing.T) {
+	store := models.NewEventStore(100)
+	out := &syncBuffer{}
+	pool := startPool(t, store, out)
+
+	pool.Pause()
+	waitFor(t, "workers to pause", func() bool {
+		for _, status := range pool.WorkerStatuses() {
+			if status.State != WorkerPaused {
+				return false
+			}
+		}
+		return true
+	})
+
+	// Ingestion continues while paused
+	addEvents(t, store, "paused", 10)
+	time.Sleep(20 * time.Millisecond)
+	if got := len(publishedIDs(out.String())); got != 0 {
+		t.Fatalf("Expected no events processed while paused, got %d", got)
+	}
+
+	pool.Resume()
+	waitFor(t, "backlog to be processed", func() bool {
+		return len(publishedIDs(out.String())) == 10
+	})
+
+	var processed uint64
+	for _, status := range pool.WorkerStatuses() {
+		processed += status.Processed
+	}
+	if processed != 10 {
+		t.Errorf("Expected workers to report 10 processed events, got %d", processed)
+	}
+}
+
+func TestPausedPoolProcessesHeldEventsWhenInputEnds(t *testing.T) {
+	store := models.NewEventStore(100)
+	out := &syncBuffer{}
+	pool := NewPool(store, PoolConfig{Workers: 2, Partitions: 4, MaxPending: 100},
+		metrics.NewRegistry(), log.New(out, "", 0))
+	pool.Pause()
+	done := make(chan struct{})
+	go func() {
+		pool.Start(context.Background())
+		close(done)
+	}()
+
+	addEvents(t, store, "paused", 10)
+	waitFor(t, "events to reach the pool", func() bool { return pool.Pending() == 10 })
+	store.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the paused pool to stop")
+	}
+	if got := len(publishedIDs(out.String())); got != 10 {
+		t.Errorf("Expected the held events processed before stopping, got %d", got)
+	}
+}
+
+func TestPoolDrainPausesWhenEmpty(t *testing.T) {
+	store := models.NewEventStore(100)
+	out := &syncBuffer{}
+	pool := startPool(t, store, out)
+
+	pool.Pause()
+	addEvents(t, store, "backlog", 10)
+	waitFor(t, "backlog to reach the pool", func() bool { return pool.Pending() == 10 })
+
+	pool.Drain()
+	waitFor(t, "pool to drain", func() bool { return pool.State() == PoolPaused })
+	if got := len(publishedIDs(out.String())); got != 10 {
+		t.Errorf("Expected 10 events processed by the drain, got %d", got)
+	}
+
+	// Events arriving after the drain wait for a resume
+	addEvents(t, store, "later", 5)
+	time.Sleep(20 * time.Millisecond)
+	if got := len(publishedIDs(out.String())); got != 10 {
+		t.Errorf("Expected no new events processed after drain, got %d", got)
+	}
+}
+
+func TestPoolDrainTakesQueuedBacklog(t *testing.T) {
+	store := models.NewEventStore(100)
+	out := &syncBuffer{}
+	pool := NewPool(store, PoolConfig{Workers: 2, Partitions: 4, MaxPending: 3},
+		metrics.NewRegistry(), log.New(out, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Most of the backlog is still queued in the store
+	pool.Pause()
+	addEvents(t, store, "backlog", 20)
+	waitFor(t, "the pool to fill up", func() bool { return pool.Pending() == 3 })
+
+	pool.Drain()
+	addEvents(t, store, "later", 5)
+	waitFor(t, "pool to drain", func() bool { return pool.State() == PoolPaused })
+	if got := len(publishedIDs(out.String())); got != 20 {
+		t.Errorf("Expected the 20 events of the backlog processed by the drain, got %d", got)
+	}
+	for _, id := range publishedIDs(out.String()) {
+		if strings.HasPrefix(id, "later") {
+			t.Errorf("Expected %s, arriving after the drain, to wait for a resume", id)
+		}
+	}
+
+	pool.Resume()
+	waitFor(t, "later events after the resume", func() bool { return len(publishedIDs(out.String())) == 25 })
+}
+
+func TestWorkerRecordsPanics(t *testing.T) {
+	pool := NewPool(models.NewEventStore(1), PoolConfig{Workers: 1, Partitions: 1, MaxPending: 1},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+	w := pool.Workers()[0]
+
+	// A nil event panics inside processEvent
+	err := w.safeProcess(nil)
+	if err == nil {
+		t.Fatal("Expected error from panicking event")
+	}
+	w.finish(err)
+
+	status := w.Status()
+	if status.LastError == "" || status.LastErrorAt == nil {
+		t.Errorf("Expected last error to be recorded, got %+v", status)
+	}
+}
@@ -0,0 +1,235 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// Errors returned by the dead letter queue
+var (
+	ErrDeadLetterNotFound = models.Error("dead letter not found")
+	// ErrUnknownPipeline is returned when redriving a dead letter whose
+	// pipeline has no pool
+	ErrUnknownPipeline = models.Error("dead letter pipeline unknown")
+)
+
+// DeadLetter is an event a pipeline failed to transform or publish
+type DeadLetter struct {
+	ID       uint64        `json:"id"`
+	Pipeline string        `json:"pipeline"`
+	Event    *models.Event `json:"event"`
+	Error    string        `json:"error"`
+	FailedAt time.Time     `json:"failed_at"`
+	// Attempts counts the failed processings, redrives included
+	Attempts int `json:"attempts"`
+}
+
+// DeadLetters keeps the events pipelines failed to process until they are
+// redriven or discarded, up to a capacity beyond which the oldest are
+// dropped. Filtered events are not failures and never become dead letters.
+type DeadLetters struct {
+	capacity int
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	seq     uint64
+	entries map[uint64]*DeadLetter
+	order   []uint64 // IDs oldest first, including removed ones until trimmed
+	// redriven remembers the attempts of events redriven and not yet done
+	redriven map[*models.Event]int
+
+	added    map[string]*metrics.Counter
+	dropped  *metrics.Counter
+	redrives *metrics.Counter
+	registry *metrics.Registry
+}
+
+// NewDeadLetters creates a dead letter queue keeping up to capacity events
+func NewDeadLetters(capacity int, c clock.Clock, registry *metrics.Registry) *DeadLetters {
+	d := &DeadLetters{
+		capacity: capacity,
+		clock:    clock.OrReal(c),
+		entries:  make(map[uint64]*DeadLetter),
+		redriven: make(map[*models.Event]int),
+		added:    make(map[string]*metrics.Counter),
+		dropped: registry.Counter("dead_letters_dropped_total",
+			"Dead letters dropped, oldest first, to stay within the capacity"),
+		redrives: registry.Counter("dead_letters_redriven_total",
+			"Dead letters handed back to their pipeline"),
+		registry: registry,
+	}
+	registry.GaugeFunc("dead_letters", "Events waiting in the dead letter queue", func() float64 {
+		return float64(d.Len())
+	})
+	return d
+}
+
+// Add records an event a pipeline failed to process
+func (d *DeadLetters) Add(pipeline string, event *models.Event, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.seq++
+	attempts := d.redriven[event] + 1
+	delete(d.redriven, event)
+	d.entries[d.seq] = &DeadLetter{
+		ID:       d.seq,
+		Pipeline: pipeline,
+		Event:    event,
+		Error:    err.Error(),
+		FailedAt: d.clock.Now().UTC(),
+		Attempts: attempts,
+	}
+	d.order = append(d.order, d.seq)
+
+	counter, ok := d.added[pipeline]
+	if !ok {
+		counter = d.registry.Counter("dead_letters_total",
+			"Events a pipeline failed to transform or publish", "pipeline", pipeline)
+		d.added[pipeline] = counter
+	}
+	counter.Inc()
+
+	for len(d.entries) > d.capacity {
+		oldest := d.order[0]
+		d.order = d.order[1:]
+		if _, ok := d.entries[oldest]; ok {
+			delete(d.entries, oldest)
+			d.dropped.Inc()
+		}
+	}
+	d.compact()
+}
+
+// Len returns the number of dead letters
+func (d *DeadLetters) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+// List returns the dead letters of a pipeline, of every pipeline when
+// empty, oldest first
+func (d *DeadLetters) List(pipeline string) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letters := make([]DeadLetter, 0, len(d.entries))
+	for _, id := range d.order {
+		if letter, ok := d.entries[id]; ok && (pipeline == "" || letter.Pipeline == pipeline) {
+			letters = append(letters, *letter)
+		}
+	}
+	return letters
+}
+
+// Get returns a dead letter by ID
+func (d *DeadLetters) Get(id uint64) (DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letter, ok := d.entries[id]
+	if !ok {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return *letter, nil
+}
+
+// Discard removes a dead letter without processing it
+func (d *DeadLetters) Discard(id uint64) (DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letter, ok := d.entries[id]
+	if !ok {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	delete(d.entries, id)
+	d.compact()
+	return *letter, nil
+}
+
+// Redrive hands a dead letter back to the pool of its pipeline and removes
+// it. It stays in the queue when the pool refuses it, with ErrPoolFull or
+// ErrPoolStopped.
+func (d *DeadLetters) Redrive(id uint64, pools map[string]*Pool) (DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letter, ok := d.entries[id]
+	if !ok {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	if err := d.redrive(letter, pools); err != nil {
+		return *letter, err
+	}
+	d.compact()
+	return *letter, nil
+}
+
+// RedriveAll hands the dead letters of a pipeline, of every pipeline when
+// empty, back to their pools, oldest first. It stops at the first pool
+// refusing one and returns how many were redriven.
+func (d *DeadLetters) RedriveAll(pipeline string, pools map[string]*Pool) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ids := append([]uint64(nil), d.order...)
+	redriven := 0
+	var err error
+	for _, id := range ids {
+		letter, ok := d.entries[id]
+		if !ok || (pipeline != "" && letter.Pipeline != pipeline) {
+			continue
+		}
+		if err = d.redrive(letter, pools); err != nil {
+			break
+		}
+		redriven++
+	}
+	d.compact()
+	return redriven, err
+}
+
+// redrive hands a dead letter to its pool and removes it. Callers must
+// hold d.mu.
+func (d *DeadLetters) redrive(letter *DeadLetter, pools map[string]*Pool) error {
+	pool, ok := pools[letter.Pipeline]
+	if !ok {
+		return ErrUnknownPipeline
+	}
+	if err := pool.Redrive(letter.Event); err != nil {
+		return err
+	}
+	// A worker failing the event again waits for d.mu, so sees the attempts
+	d.redriven[letter.Event] = letter.Attempts
+	delete(d.entries, letter.ID)
+	d.redrives.Inc()
+	return nil
+}
+
+// Done forgets the attempts of a redriven event processed successfully
+func (d *DeadLetters) Done(event *models.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.redriven, event)
+}
+
+// compact drops the IDs of removed dead letters from the order once they
+// make up most of it. Callers must hold d.mu.
+func (d *DeadLetters) compact() {
+	if len(d.order) <= 2*len(d.entries)+16 {
+		return
+	}
+	kept := d.order[:0]
+	for _, id := range d.order {
+		if _, ok := d.entries[id]; ok {
+			kept = append(kept, id)
+		}
+	}
+	d.order = kept
+}
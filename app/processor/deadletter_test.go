@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"testing"
+
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// flakyPublisher fails until healed
+type flakyPublisher struct {
+	healed    atomic.Bool
+	published chanPublisher
+}
+
+func (f *flakyPublisher) Publish(event *models.TransformedEvent) error {
+	if !f.healed.Load() {
+		return errors.New("sink unavailable")
+	}
+	return f.published.Publish(event)
+}
+
+func TestDeadLettersRedrive(t *testing.T) {
+	store := models.NewEventStore(10)
+	deadLetters := NewDeadLetters(10, nil, metrics.NewRegistry())
+	sink := &flakyPublisher{published: make(chanPublisher, 10)}
+	pool := NewPool(store, PoolConfig{Name: "orders", Workers: 1, Partitions: 1, MaxPending: 10, Publisher: sink, DeadLetters: deadLetters},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+	pools := map[string]*Pool{"orders": pool}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	addEvents(t, store, "failing", 3)
+	waitFor(t, "failures to be dead lettered", func() bool { return deadLetters.Len() == 3 })
+	letters := deadLetters.List("")
+	if first := letters[0]; first.Pipeline != "orders" || first.Event.ID != "failing-0" || first.Error != "sink unavailable" || first.Attempts != 1 {
+		t.Errorf("Unexpected dead letter %+v", first)
+	}
+	if got := deadLetters.List("other"); len(got) != 0 {
+		t.Errorf("Expected no dead letters for another pipeline, got %+v", got)
+	}
+
+	// Failing again records another attempt
+	if _, err := deadLetters.Redrive(letters[0].ID, pools); err != nil {
+		t.Fatalf("Failed to redrive: %v", err)
+	}
+	waitFor(t, "the redriven event to fail again", func() bool { return deadLetters.Len() == 3 })
+	if again := deadLetters.List("orders")[2]; again.Event.ID != "failing-0" || again.Attempts != 2 {
+		t.Errorf("Expected a second attempt of failing-0, got %+v", again)
+	}
+
+	if _, err := deadLetters.Discard(letters[1].ID); err != nil {
+		t.Errorf("Failed to discard: %v", err)
+	}
+	if _, err := deadLetters.Get(letters[1].ID); err != ErrDeadLetterNotFound {
+		t.Errorf("Expected %v for a discarded dead letter, got %v", ErrDeadLetterNotFound, err)
+	}
+	if _, err := deadLetters.Redrive(letters[1].ID, pools); err != ErrDeadLetterNotFound {
+		t.Errorf("Expected %v, got %v", ErrDeadLetterNotFound, err)
+	}
+
+	// Once the sink recovers, the redriven events are published
+	sink.healed.Store(true)
+	if n, err := deadLetters.RedriveAll("orders", pools); n != 2 || err != nil {
+		t.Fatalf("Expected 2 dead letters redriven, got %d: %v", n, err)
+	}
+	for i := 0; i < 2; i++ {
+		<-sink.published
+	}
+	if got := deadLetters.Len(); got != 0 {
+		t.Errorf("Expected an empty dead letter queue, got %d", got)
+	}
+}
+
+func TestDeadLettersCapacity(t *testing.T) {
+	deadLetters := NewDeadLetters(2, nil, metrics.NewRegistry())
+	for _, id := range []string{"a", "b", "c"} {
+		deadLetters.Add("default", &models.Event{ID: id}, errors.New("failed"))
+	}
+	letters := deadLetters.List("")
+	if len(letters) != 2 || letters[0].Event.ID != "b" || letters[1].Event.ID != "c" {
+		t.Errorf("Expected the 2 latest dead letters, got %+v", letters)
+	}
+	if got := deadLetters.dropped.Value(); got != 1 {
+		t.Errorf("Expected 1 dropped dead letter, got %d", got)
+	}
+	if _, err := deadLetters.Redrive(letters[0].ID, nil); err != ErrUnknownPipeline {
+		t.Errorf("Expected %v without a pool, got %v", ErrUnknownPipeline, err)
+	}
+}
@@ -0,0 +1,544 @@
+package processor
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/transform"
+)
+
+// Source feeds a pool the events of each priority lane. The event store is
+// a source, as is each pipeline of a Router.
+type Source interface {
+	Lane(p models.Priority) <-chan *models.Event
+}
+
+// backlogSource is a Source counting the events queued in each lane, as
+// the event store and the router's pipelines do, so Drain can process them
+type backlogSource interface {
+	LaneLen(p models.Priority) int
+}
+
+// PoolConfig controls the size and shape of a Pool
+type PoolConfig struct {
+	// Name labels the pool's metrics with its pipeline when set
+	Name string
+	// Workers is the initial number of workers
+	Workers int
+	// MinWorkers and MaxWorkers bound autoscaling, both default to Workers
+	MinWorkers int
+	MaxWorkers int
+	Partitions int
+	// MaxPending bounds the events held by the pool in each priority lane
+	MaxPending int
+	// LaneWeights sets the share of the workers each priority lane gets
+	// while busy, DefaultLaneWeights for lanes missing or set to zero
+	LaneWeights map[models.Priority]int
+	Autoscale   AutoscaleConfig
+	// Transform changes events before they are published, uppercasing
+	// the payload when nil
+	Transform transform.Transformer
+	// Publisher receives processed events, logging them when nil
+	Publisher Publisher
+	// Clock times processing and autoscaling, the system clock when nil
+	Clock clock.Clock
+	// DeadLetters receives the events the pool fails to transform or
+	// publish, under the pool's Name, when set
+	DeadLetters *DeadLetters
+}
+
+// Errors returned by the pool controls
+var (
+	// ErrInvalidPoolSize is returned when pinning the pool outside its bounds
+	ErrInvalidPoolSize = models.Error("pool size out of range")
+	// ErrPoolFull is returned by Redrive when the event's lane is full
+	ErrPoolFull = models.Error("pool lane full")
+	// ErrPoolStopped is returned by Redrive once the pool has stopped
+	ErrPoolStopped = models.Error("pool stopped")
+)
+
+// DefaultLaneWeights gives the high lane twice the turns of the normal lane
+// and four times those of the low lane
+var DefaultLaneWeights = map[models.Priority]int{
+	models.PriorityHigh:   4,
+	models.PriorityNormal: 2,
+	models.PriorityLow:    1,
+}
+
+// partitionID identifies a partition within a tenant and priority lane
+type partitionID struct {
+	tenant string
+	lane   models.Priority
+	index  int
+}
+
+// partition is a sequential queue of events sharing a tenant, lane and key
+// hash
+type partition struct {
+	tenant string
+	lane   models.Priority
+	index  int
+	queue  []*models.Event
+	busy   bool
+}
+
+// Pool distributes events across key-hashed partitions. Events in the same
+// partition are processed one at a time in arrival order, while different
+// partitions are processed in parallel by the workers. Every tenant has its
+// own set of partitions in each priority lane. Workers serve the lanes by
+// weight and the tenants within a lane in turn, so events of one key are
+// only ordered within a lane.
+type Pool struct {
+	source Source
+	cfg    PoolConfig
+	logger *log.Logger
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	workers    []*Worker
+	partitions map[partitionID]*partition // created on demand, removed when idle
+	ready      *laneQueue                 // partitions with pending events and no active worker
+	processed  []*metrics.Counter         // per partition index, across tenants
+	filtered   *metrics.Counter           // events dropped by a filter
+	failed     *metrics.Counter           // events failing a transformer
+	registry   *metrics.Registry
+	pending    int
+	lanes      map[models.Priority]int // pending events per lane
+	maxPending int
+	inFlight   int           // events claimed by workers and not yet done
+	latency    time.Duration // moving average of the processing time
+	state      PoolState     // running, paused or draining
+	inputDone  bool          // the dispatcher stopped, workers exit once drained
+	closed     bool          // hard stop, workers exit immediately
+
+	// waiting counts the events per lane read from the source and waiting
+	// for room, drainBacklog those still to take from it while draining
+	waiting      map[models.Priority]int
+	drainBacklog map[models.Priority]int
+
+	// Worker lifecycle, set once Start is called
+	ctx     context.Context
+	wg      sync.WaitGroup
+	started bool
+
+	scaler *autoscaler
+}
+
+// NewPool creates a partitioned worker pool reading from source, usually
+// the event store
+func NewPool(source Source, cfg PoolConfig, registry *metrics.Registry, logger *log.Logger) *Pool {
+	if cfg.MinWorkers <= 0 {
+		cfg.MinWorkers = cfg.Workers
+	}
+	if cfg.MaxWorkers < cfg.MinWorkers {
+		cfg.MaxWorkers = cfg.MinWorkers
+	}
+	if cfg.Transform == nil {
+		cfg.Transform = transform.Uppercase
+	}
+	if cfg.Publisher == nil {
+		cfg.Publisher = NewLogPublisher(logger)
+	}
+	weights := make(map[models.Priority]int, len(models.Priorities))
+	for _, lane := range models.Priorities {
+		weights[lane] = cfg.LaneWeights[lane]
+		if weights[lane] <= 0 {
+			weights[lane] = DefaultLaneWeights[lane]
+		}
+	}
+	cfg.LaneWeights = weights
+	cfg.Clock = clock.OrReal(cfg.Clock)
+
+	p := &Pool{
+		source:     source,
+		cfg:        cfg,
+		logger:     logger,
+		partitions: make(map[partitionID]*partition),
+		ready:      newLaneQueue(cfg.LaneWeights),
+		processed:  make([]*metrics.Counter, cfg.Partitions),
+		registry:   registry,
+		lanes:      make(map[models.Priority]int, len(models.Priorities)),
+		maxPending: cfg.MaxPending,
+		waiting:    make(map[models.Priority]int, len(models.Priorities)),
+		state:      PoolRunning,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	p.scaler = newAutoscaler(p, cfg.Autoscale, registry)
+
+	for i := range p.processed {
+		p.processed[i] = registry.Counter("processor_partition_events_processed_total",
+			"Events processed per partition", p.labels("partition", strconv.Itoa(i))...)
+	}
+	p.filtered = registry.Counter("processor_events_filtered_total",
+		"Events dropped by a filter of the pipeline", p.labels()...)
+	p.failed = registry.Counter("processor_transform_errors_total",
+		"Events not published because a transformer failed", p.labels()...)
+	p.Resize(cfg.Workers)
+
+	registry.GaugeFunc("processor_partitions", "Number of partitions in the worker pool",
+		func() float64 { return float64(p.cfg.Partitions) }, p.labels()...)
+	registry.GaugeFunc("processor_workers", "Number of workers in the pool",
+		func() float64 { return float64(p.Size()) }, p.labels()...)
+	registry.GaugeFunc("processor_pending_events", "Events waiting in the pool partitions",
+		func() float64 { return float64(p.Pending()) }, p.labels()...)
+	for _, lane := range models.Priorities {
+		lane := lane
+		registry.GaugeFunc("processor_lane_pending_events", "Events waiting in the pool partitions per priority lane",
+			func() float64 { return float64(p.LanePending(lane)) }, p.labels("lane", string(lane))...)
+		registry.GaugeFunc("processor_lane_weight", "Share of the workers a busy priority lane gets",
+			func() float64 { return float64(p.cfg.LaneWeights[lane]) }, p.labels("lane", string(lane))...)
+	}
+	registry.GaugeFunc("processor_latency_seconds", "Moving average of the event processing time",
+		func() float64 { return p.Latency().Seconds() }, p.labels()...)
+	for _, state := range []PoolState{PoolRunning, PoolPaused, PoolDraining} {
+		state := state
+		registry.GaugeFunc("processor_pool_state", "Current pool state, 1 for the active state",
+			func() float64 {
+				if p.State() == state {
+					return 1
+				}
+				return 0
+			}, p.labels("state", string(state))...)
+	}
+
+	return p
+}
+
+// labels returns the metric labels given, with the pipeline of a named pool
+func (p *Pool) labels(pairs ...string) []string {
+	if p.cfg.Name != "" {
+		pairs = append(pairs, "pipeline", p.cfg.Name)
+	}
+	return pairs
+}
+
+// Start runs a dispatcher per priority lane, the workers and the
+// autoscaler until ctx is canceled or the event store lanes are closed
+func (p *Pool) Start(ctx context.Context) {
+	p.mu.Lock()
+	p.ctx = ctx
+	p.started = true
+	for _, w := range p.workers {
+		p.launch(w)
+	}
+	p.logger.Printf("Starting pool with %d workers across %d partitions", len(p.workers), p.cfg.Partitions)
+	p.mu.Unlock()
+
+	// Wake blocked workers once the context is canceled
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.close()
+		case <-finished:
+		}
+	}()
+	go p.scaler.run(ctx, finished)
+
+	var dispatchers sync.WaitGroup
+	for _, lane := range models.Priorities {
+		dispatchers.Add(1)
+		go func(lane models.Priority) {
+			defer dispatchers.Done()
+			p.dispatch(ctx, lane)
+		}(lane)
+	}
+	dispatchers.Wait()
+	p.finishInput()
+	p.wg.Wait()
+}
+
+// Resize changes the number of workers. Extra workers finish their current
+// event before exiting.
+func (p *Pool) Resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	active := p.activeWorkers()
+	for len(active) < size {
+		w := newWorker(p, p.logger)
+		p.workers = append(p.workers, w)
+		active = append(active, w)
+		if p.started {
+			p.launch(w)
+		}
+	}
+	for _, w := range active[size:] {
+		w.stopping = true
+	}
+	p.cond.Broadcast()
+}
+
+// Size returns the number of workers that are not stopping
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.activeWorkers())
+}
+
+// Workers returns the workers owned by the pool
+func (p *Pool) Workers() []*Worker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	workers := make([]*Worker, len(p.workers))
+	copy(workers, p.workers)
+	return workers
+}
+
+// RunningWorkers returns the number of workers whose loop is active
+func (p *Pool) RunningWorkers() int {
+	running := 0
+	for _, w := range p.Workers() {
+		if w.Running() {
+			running++
+		}
+	}
+	return running
+}
+
+// Latency returns the moving average of the processing time per event
+func (p *Pool) Latency() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.latency
+}
+
+// activeWorkers returns the workers not asked to stop. Callers must hold p.mu.
+func (p *Pool) activeWorkers() []*Worker {
+	active := make([]*Worker, 0, len(p.workers))
+	for _, w := range p.workers {
+		if !w.stopping {
+			active = append(active, w)
+		}
+	}
+	return active
+}
+
+// launch runs a worker and removes it once its loop exits. Callers must hold p.mu.
+func (p *Pool) launch(w *Worker) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		w.Start(p.ctx)
+		p.remove(w)
+	}()
+}
+
+// remove drops an exited worker from the pool
+func (p *Pool) remove(w *Worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, candidate := range p.workers {
+		if candidate == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pending returns the number of events queued in the partitions
+func (p *Pool) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pending
+}
+
+// LanePending returns the number of events queued in the partitions of a
+// priority lane
+func (p *Pool) LanePending(lane models.Priority) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lanes[lane]
+}
+
+// PartitionFor returns the partition index an event is assigned to
+func (p *Pool) PartitionFor(event *models.Event) int {
+	h := fnv.New32a()
+	h.Write([]byte(event.Key()))
+	return int(h.Sum32() % uint32(p.cfg.Partitions))
+}
+
+// dispatch moves the events of a priority lane from the store into their
+// partitions. Each lane has its own dispatcher, so a full lane does not
+// hold back the others.
+func (p *Pool) dispatch(ctx context.Context, lane models.Priority) {
+	eventCh := p.source.Lane(lane)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-eventCh:
+			if !ok {
+				p.logger.Printf("Event lane %s closed, pool dispatcher shutting down", lane)
+				return
+			}
+			if !p.enqueue(event) {
+				return
+			}
+		}
+	}
+}
+
+// enqueue appends an event to its partition, waiting while its lane is
+// full. It returns false if the pool was closed while waiting.
+func (p *Pool) enqueue(event *models.Event) bool {
+	id := partitionID{tenant: event.Tenant, lane: event.Lane(), index: p.PartitionFor(event)}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Intake is held while draining once the backlog of the lane is taken,
+	// so events arriving after Drain wait for a resume
+	p.waiting[id.lane]++
+	for (p.lanes[id.lane] >= p.maxPending || p.state == PoolDraining && p.drainBacklog[id.lane] == 0) && !p.closed {
+		p.cond.Wait()
+	}
+	p.waiting[id.lane]--
+	if p.closed {
+		return false
+	}
+	if p.state == PoolDraining {
+		p.drainBacklog[id.lane]--
+	}
+	p.push(id, event)
+	return true
+}
+
+// Redrive queues an event for processing again, such as a dead letter,
+// without waiting. It returns ErrPoolFull when the event's lane is full and
+// ErrPoolStopped once the pool no longer takes events.
+func (p *Pool) Redrive(event *models.Event) error {
+	id := partitionID{tenant: event.Tenant, lane: event.Lane(), index: p.PartitionFor(event)}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || p.inputDone {
+		return ErrPoolStopped
+	}
+	if p.lanes[id.lane] >= p.maxPending {
+		return ErrPoolFull
+	}
+	p.push(id, event)
+	return nil
+}
+
+// push appends an event to its partition. Callers must hold p.mu.
+func (p *Pool) push(id partitionID, event *models.Event) {
+	part, ok := p.partitions[id]
+	if !ok {
+		part = &partition{tenant: id.tenant, lane: id.lane, index: id.index}
+		p.partitions[id] = part
+	}
+	part.queue = append(part.queue, event)
+	p.pending++
+	p.lanes[id.lane]++
+	if !part.busy && len(part.queue) == 1 {
+		p.ready.push(part)
+		p.cond.Broadcast()
+	}
+}
+
+// next blocks until a partition has work and claims its oldest event for w.
+// It returns false once the pool is closed, w is asked to stop or the pool
+// is drained after input stopped.
+func (p *Pool) next(w *Worker) (*models.Event, *partition, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.closed || w.stopping {
+			return nil, nil, false
+		}
+		// Once input ends a paused pool resumes, processing the events it
+		// accepted before its workers exit
+		if p.state == PoolPaused && !p.inputDone {
+			w.setState(WorkerPaused)
+		} else if p.ready.len() > 0 {
+			break
+		} else if p.inputDone {
+			return nil, nil, false
+		} else {
+			w.setState(WorkerIdle)
+		}
+		p.cond.Wait()
+	}
+
+	part := p.ready.pop()
+	event := part.queue[0]
+	part.queue[0] = nil
+	part.queue = part.queue[1:]
+	part.busy = true
+	p.pending--
+	p.lanes[part.lane]--
+	p.inFlight++
+	p.cond.Broadcast()
+	return event, part, true
+}
+
+// latencySmoothing is the weight of the latest sample in the latency average
+const latencySmoothing = 0.2
+
+// done releases a partition claimed by next and records the processing time
+func (p *Pool) done(part *partition, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.latency == 0 {
+		p.latency = elapsed
+	} else {
+		p.latency += time.Duration(latencySmoothing * float64(elapsed-p.latency))
+	}
+
+	part.busy = false
+	p.processed[part.index].Inc()
+	p.registry.Counter("processor_tenant_events_processed_total",
+		"Events processed per tenant", p.labels("tenant", part.tenant)...).Inc()
+	p.registry.Counter("processor_lane_events_processed_total",
+		"Events processed per priority lane", p.labels("lane", string(part.lane))...).Inc()
+	p.inFlight--
+	if len(part.queue) > 0 {
+		p.ready.push(part)
+		p.cond.Broadcast()
+	} else {
+		delete(p.partitions, partitionID{tenant: part.tenant, lane: part.lane, index: part.index})
+	}
+	p.finishDrain()
+}
+
+// deadLetter hands an event that failed to the dead letter queue
+func (p *Pool) deadLetter(event *models.Event, err error) {
+	if p.cfg.DeadLetters == nil {
+		return
+	}
+	if err != nil {
+		p.cfg.DeadLetters.Add(p.cfg.Name, event, err)
+	} else {
+		p.cfg.DeadLetters.Done(event)
+	}
+}
+
+// finishInput lets the workers drain the partitions and then exit, even
+// when the pool is paused
+func (p *Pool) finishInput() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inputDone = true
+	p.cond.Broadcast()
+}
+
+// close stops the pool and wakes every waiter
+func (p *Pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+}
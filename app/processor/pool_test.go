@@ -0,0 +1,315 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/transform"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// publishedIDs extracts the event IDs from the publish log lines in order
+func publishedIDs(output string) []string {
+	var ids []string
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "[PUBLISHED]") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f == "event" && i+1 < len(fields) {
+				ids = append(ids, strings.TrimSuffix(fields[i+1], ":"))
+			}
+		}
+	}
+	return ids
+}
+
+func TestPoolPreservesPerKeyOrder(t *testing.T) {
+	store := models.NewEventStore(1000)
+	out := &syncBuffer{}
+	logger := log.New(out, "", 0)
+	pool := NewPool(store, PoolConfig{Workers: 4, Partitions: 8, MaxPending: 50}, metrics.NewRegistry(), logger)
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	eventsPerKey := 40
+	for i := 0; i < eventsPerKey; i++ {
+		for _, key := range keys {
+			event := &models.Event{
+				ID:           fmt.Sprintf("%s-%d", key, i),
+				PartitionKey: key,
+				Payload:      "payload",
+			}
+			if err := store.Add(event); err != nil {
+				t.Fatalf("Failed to add event: %v", err)
+			}
+		}
+	}
+	store.Close()
+
+	// Start returns once the closed store has been fully drained
+	pool.Start(context.Background())
+
+	ids := publishedIDs(out.String())
+	if len(ids) != len(keys)*eventsPerKey {
+		t.Fatalf("Expected %d published events, got %d", len(keys)*eventsPerKey, len(ids))
+	}
+
+	next := make(map[string]int)
+	for _, id := range ids {
+		var key string
+		var seq int
+		if _, err := fmt.Sscanf(strings.Replace(id, "-", " ", 1), "%s %d", &key, &seq); err != nil {
+			t.Fatalf("Unexpected event ID %q: %v", id, err)
+		}
+		if seq != next[key] {
+			t.Errorf("Key %s processed out of order: got %d, want %d", key, seq, next[key])
+		}
+		next[key] = seq + 1
+	}
+}
+
+func TestPoolPartitionFor(t *testing.T) {
+	pool := NewPool(models.NewEventStore(1), PoolConfig{Workers: 1, Partitions: 4, MaxPending: 1},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+
+	// Events without an explicit key fall back to their ID
+	byKey := pool.PartitionFor(&models.Event{ID: "other", PartitionKey: "order-1"})
+	byID := pool.PartitionFor(&models.Event{ID: "order-1"})
+	if byKey != byID {
+		t.Errorf("Expected matching partitions, got %d and %d", byKey, byID)
+	}
+	if byKey < 0 || byKey >= 4 {
+		t.Errorf("Partition %d out of range", byKey)
+	}
+}
+
+// chanPublisher sends published events to a channel
+type chanPublisher chan *models.TransformedEvent
+
+func (c chanPublisher) Publish(event *models.TransformedEvent) error {
+	c <- event
+	return nil
+}
+
+func TestPoolUsesClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	store := models.NewEventStore(10)
+	published := make(chanPublisher, 1)
+	pool := NewPool(store, PoolConfig{Workers: 1, Partitions: 1, MaxPending: 10, Publisher: published, Clock: fake},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	fake.Advance(time.Hour)
+	if err := store.Add(&models.Event{ID: "event", Timestamp: 1}); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	event := <-published
+	if !event.ProcessedAt.Equal(fake.Now()) {
+		t.Errorf("Expected the event processed at %v, got %v", fake.Now(), event.ProcessedAt)
+	}
+}
+
+func TestPoolStopsOnCancel(t *testing.T) {
+	store := models.NewEventStore(10)
+	pool := NewPool(store, PoolConfig{Workers: 2, Partitions: 2, MaxPending: 10},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+
+	cancel()
+	<-done
+	if pool.RunningWorkers() != 0 {
+		t.Errorf("Expected no running workers, got %d", pool.RunningWorkers())
+	}
+}
+
+func TestStreamPublisherFraming(t *testing.T) {
+	event := &models.TransformedEvent{ID: "e1", Payload: "HELLO", ProcessorID: "w1"}
+
+	var text bytes.Buffer
+	if err := NewStreamPublisher(&text, codec.JSON{}).Publish(event); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if !strings.HasSuffix(text.String(), "}\n") {
+		t.Errorf("Expected newline delimited JSON, got %q", text.String())
+	}
+
+	var binaryOut bytes.Buffer
+	if err := NewStreamPublisher(&binaryOut, codec.Protobuf{}).Publish(event); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	size, err := binary.ReadUvarint(&binaryOut)
+	if err != nil || int(size) != binaryOut.Len() {
+		t.Fatalf("Expected length prefix %d to match body %d (%v)", size, binaryOut.Len(), err)
+	}
+	var got models.TransformedEvent
+	if err := (codec.Protobuf{}).Unmarshal(binaryOut.Bytes(), &got); err != nil || got.ID != "e1" {
+		t.Errorf("Unexpected decoded event %+v (%v)", got, err)
+	}
+}
+
+// brokenWriter fails every write until healed
+type brokenWriter struct{ healed bool }
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	if !w.healed {
+		return 0, errors.New("broken pipe")
+	}
+	return len(p), nil
+}
+
+func TestPublisherCheck(t *testing.T) {
+	event := &models.TransformedEvent{ID: "e1", Payload: "HELLO", ProcessorID: "w1"}
+	w := &brokenWriter{}
+	stream := NewStreamPublisher(w, codec.JSON{})
+	logged := NewLogPublisher(log.New(w, "", 0))
+	// Publishers that are not Checkers are assumed healthy
+	sinks := Fanout{stream, logged, make(chanPublisher, 2)}
+
+	if err := Check(sinks); err != nil {
+		t.Fatalf("Expected sinks healthy before any write, got %v", err)
+	}
+	sinks.Publish(event)
+	for _, sink := range []Publisher{stream, logged} {
+		if err := Check(sink); err == nil {
+			t.Errorf("Expected %T to fail after a failed write", sink)
+		}
+	}
+	if err := Check(NewBroadcaster(sinks)); err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Errorf("Expected the broadcaster to report its sinks' errors, got %v", err)
+	}
+
+	w.healed = true
+	sinks.Publish(event)
+	if err := Check(sinks); err != nil {
+		t.Errorf("Expected sinks healthy after a successful write, got %v", err)
+	}
+}
+
+func TestPoolServesHighPriorityFirst(t *testing.T) {
+	store := models.NewEventStore(20)
+	published := make(chanPublisher, 20)
+	pool := NewPool(store, PoolConfig{Workers: 1, Partitions: 1, MaxPending: 20, Publisher: published},
+		metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+	pool.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// A backfill queues ahead of two urgent events
+	for i := 0; i < 8; i++ {
+		if err := store.Add(&models.Event{ID: fmt.Sprintf("backfill-%d", i), Priority: models.PriorityLow}); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Add(&models.Event{ID: fmt.Sprintf("urgent-%d", i), Priority: models.PriorityHigh}); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+	waitFor(t, "the lanes to fill", func() bool {
+		return pool.LanePending(models.PriorityLow) == 8 && pool.LanePending(models.PriorityHigh) == 2
+	})
+
+	pool.Resume()
+	for i := 0; i < 10; i++ {
+		event := <-published
+		if urgent := strings.HasPrefix(event.ID, "urgent"); urgent != (i < 2) {
+			t.Fatalf("Expected the urgent events first, got %s at %d", event.ID, i)
+		}
+	}
+}
+
+func TestPoolFiltersEvents(t *testing.T) {
+	store := models.NewEventStore(10)
+	published := make(chanPublisher, 2)
+	keep, err := transform.Filter(`attributes.region == "eu"`, expr.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to compile the filter: %v", err)
+	}
+	failing, _ := transform.Filter(`json(payload).ok`, expr.Limits{})
+	pool := NewPool(store, PoolConfig{Workers: 1, Partitions: 1, MaxPending: 10, Publisher: published,
+		Transform: transform.Chain{keep, failing}}, metrics.NewRegistry(), log.New(&syncBuffer{}, "", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for _, event := range []*models.Event{
+		{ID: "us", Payload: `{"ok": true}`, Attributes: map[string]string{"region": "us"}},
+		{ID: "broken", Payload: "{", Attributes: map[string]string{"region": "eu"}},
+		{ID: "eu", Payload: `{"ok": true}`, Attributes: map[string]string{"region": "eu"}},
+	} {
+		if err := store.Add(event); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+	if event := <-published; event.ID != "eu" || event.Payload != `{"ok": true}` {
+		t.Errorf("Expected only eu published unchanged, got %+v", event)
+	}
+	waitFor(t, "the events to be counted", func() bool { return pool.filtered.Value() == 1 && pool.failed.Value() == 1 })
+	if len(published) != 0 {
+		t.Errorf("Expected no other event published, got %d", len(published))
+	}
+}
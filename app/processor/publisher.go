@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/models"
+)
+
+// Publisher delivers transformed events downstream
+type Publisher interface {
+	Publish(event *models.TransformedEvent) error
+}
+
+// Checker is implemented by publishers that can tell whether they deliver,
+// for the readiness probe
+type Checker interface {
+	Check() error
+}
+
+// Check reports whether p delivers. Publishers that are not Checkers are
+// assumed healthy.
+func Check(p Publisher) error {
+	if c, ok := p.(Checker); ok {
+		return c.Check()
+	}
+	return nil
+}
+
+// Fanout publishes each event to every publisher in turn, returning their
+// errors joined
+type Fanout []Publisher
+
+// Publish implements Publisher
+func (f Fanout) Publish(event *models.TransformedEvent) error {
+	var errs []error
+	for _, p := range f {
+		if err := p.Publish(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check implements Checker, joining the errors of every publisher
+func (f Fanout) Check() error {
+	var errs []error
+	for _, p := range f {
+		if err := Check(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogPublisher logs each event, the default publisher
+type LogPublisher struct {
+	logger *log.Logger
+
+	mu sync.Mutex
+	// err is the error of the last write to the log
+	err error
+}
+
+// NewLogPublisher creates a publisher writing to logger
+func NewLogPublisher(logger *log.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+// Publish implements Publisher
+func (p *LogPublisher) Publish(event *models.TransformedEvent) error {
+	err := p.logger.Output(2, fmt.Sprintf("[PUBLISHED] Worker %s processed event %s: %s",
+		event.ProcessorID,
+		event.ID,
+		event.Payload))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	return err
+}
+
+// Check implements Checker, failing while the last write to the log failed
+func (p *LogPublisher) Check() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// StreamPublisher writes each event to a stream encoded with a codec. Text
+// codecs are newline delimited; binary codecs are prefixed with their
+// length as a uvarint.
+type StreamPublisher struct {
+	mu    sync.Mutex
+	w     io.Writer
+	codec codec.Codec
+	// err is the error of the last write to w
+	err error
+}
+
+// NewStreamPublisher creates a publisher writing to w
+func NewStreamPublisher(w io.Writer, c codec.Codec) *StreamPublisher {
+	return &StreamPublisher{w: w, codec: c}
+}
+
+// Publish implements Publisher
+func (p *StreamPublisher) Publish(event *models.TransformedEvent) error {
+	data, err := p.codec.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var frame []byte
+	if p.codec.Binary() {
+		frame = binary.AppendUvarint(make([]byte, 0, len(data)+binary.MaxVarintLen64), uint64(len(data)))
+		frame = append(frame, data...)
+	} else {
+		frame = append(data, '\n')
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(frame)
+	p.err = err
+	return err
+}
+
+// Check implements Checker, failing while the last write to the stream
+// failed
+func (p *StreamPublisher) Check() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,279 @@
+package processor
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/routing"
+)
+
+// ErrPipelineFull is returned by Admit for an event whose pipeline has no
+// room left in its lane
+var ErrPipelineFull = models.Error("pipeline queue full")
+
+// Router reads the lanes of a source and hands each event to the pipeline
+// its routing table picks. Each pipeline has a queue per lane, emptied by
+// its own dispatcher into the pipeline's pool, so a pipeline whose pool is
+// full, paused or slow only holds up its own events. Events keep their
+// order within a lane and pipeline.
+type Router struct {
+	source    Source
+	table     *routing.Table
+	logger    *log.Logger
+	pipelines map[string]*pipelineSource
+
+	routed     map[string]*metrics.Counter
+	refused    map[string]*metrics.Counter
+	unrouted   *metrics.Counter
+	dropped    *metrics.Counter
+	exprErrors *metrics.Counter
+}
+
+// pipelineSource holds the lanes of one pipeline
+type pipelineSource struct {
+	lanes    map[models.Priority]*pipelineLane
+	capacity int
+}
+
+// Lane implements Source
+func (s *pipelineSource) Lane(p models.Priority) <-chan *models.Event {
+	if l, ok := s.lanes[p]; ok {
+		return l.out
+	}
+	return nil
+}
+
+// LaneLen returns the number of events queued in a lane of the pipeline
+func (s *pipelineSource) LaneLen(p models.Priority) int {
+	if l, ok := s.lanes[p]; ok {
+		return l.len()
+	}
+	return 0
+}
+
+// QueueLen returns the number of events queued across the lanes
+func (s *pipelineSource) QueueLen() int {
+	n := 0
+	for _, l := range s.lanes {
+		n += l.len()
+	}
+	return n
+}
+
+// pipelineLane queues the events of one lane of a pipeline until its
+// dispatcher hands them to the pool
+type pipelineLane struct {
+	mu     sync.Mutex
+	queue  []*models.Event
+	closed bool // no more events will be pushed
+	wake   chan struct{}
+	out    chan *models.Event
+}
+
+func newPipelineLane() *pipelineLane {
+	return &pipelineLane{
+		wake: make(chan struct{}, 1),
+		// Unbuffered, so an event counts in the queue until the pool takes it
+		out: make(chan *models.Event),
+	}
+}
+
+func (l *pipelineLane) push(event *models.Event) {
+	l.mu.Lock()
+	l.queue = append(l.queue, event)
+	l.mu.Unlock()
+	l.signal()
+}
+
+func (l *pipelineLane) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue)
+}
+
+// close lets the dispatcher close the lane once it is empty
+func (l *pipelineLane) close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.signal()
+}
+
+func (l *pipelineLane) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands the queued events to the pool in order until the lane is
+// closed and empty or ctx is canceled
+func (l *pipelineLane) dispatch(ctx context.Context) {
+	defer close(l.out)
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			closed := l.closed
+			l.mu.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case <-l.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		event := l.queue[0]
+		l.mu.Unlock()
+
+		select {
+		case l.out <- event:
+		case <-ctx.Done():
+			return
+		}
+
+		l.mu.Lock()
+		l.queue[0] = nil
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+	}
+}
+
+// NewRouter creates a router from source to the pipelines named in
+// queueSizes, each queueing up to its size of events per lane
+func NewRouter(source Source, table *routing.Table, queueSizes map[string]int, registry *metrics.Registry, logger *log.Logger) *Router {
+	r := &Router{
+		source:    source,
+		table:     table,
+		logger:    logger,
+		pipelines: make(map[string]*pipelineSource, len(queueSizes)),
+		routed:    make(map[string]*metrics.Counter, len(queueSizes)),
+		refused:   make(map[string]*metrics.Counter, len(queueSizes)),
+		unrouted: registry.Counter("router_unrouted_events_total",
+			"Events matching no routing rule, taken by the default route when set"),
+		dropped: registry.Counter("router_dropped_events_total",
+			"Events not processed because no route led to a pipeline"),
+		exprErrors: registry.Counter("router_expression_errors_total",
+			"Events for which a route expression failed, skipping that route"),
+	}
+	for name, size := range queueSizes {
+		s := &pipelineSource{lanes: make(map[models.Priority]*pipelineLane, len(models.Priorities)), capacity: size}
+		for _, p := range models.Priorities {
+			s.lanes[p] = newPipelineLane()
+		}
+		r.pipelines[name] = s
+		r.routed[name] = registry.Counter("router_events_routed_total",
+			"Events handed to each pipeline", "pipeline", name)
+		r.refused[name] = registry.Counter("router_refused_events_total",
+			"Events refused at ingestion because their pipeline queue was full", "pipeline", name)
+		registry.GaugeFunc("router_pipeline_queue_depth", "Events queued for each pipeline",
+			func() float64 { return float64(s.QueueLen()) }, "pipeline", name)
+		registry.GaugeFunc("router_pipeline_queue_capacity", "Events each lane of a pipeline queues before refusing more",
+			func() float64 { return float64(s.capacity) }, "pipeline", name)
+	}
+	return r
+}
+
+// Pipeline returns the source of a pipeline's events, nil for a pipeline
+// the router does not know
+func (r *Router) Pipeline(name string) Source {
+	if s, ok := r.pipelines[name]; ok {
+		return s
+	}
+	return nil
+}
+
+// Depth returns the number of events queued for a pipeline
+func (r *Router) Depth(name string) int {
+	if s, ok := r.pipelines[name]; ok {
+		return s.QueueLen()
+	}
+	return 0
+}
+
+// Admit returns the pipeline an event routes to and ErrPipelineFull when
+// its lane of that pipeline is full. Ingestion calls it before storing
+// events, so a pipeline falling behind only refuses its own events. Events
+// stored without it, such as scheduled events as they fall due, are queued
+// beyond the capacity.
+func (r *Router) Admit(event *models.Event) (string, error) {
+	name, _, _ := r.table.Route(event)
+	s, ok := r.pipelines[name]
+	if !ok {
+		return name, nil
+	}
+	if s.LaneLen(event.Lane()) >= s.capacity {
+		r.refused[name].Inc()
+		return name, ErrPipelineFull
+	}
+	return name, nil
+}
+
+// Run routes events until the source lanes are closed or ctx is canceled.
+// The pipelines then hand their queued events to their pools and close
+// their lanes, unless ctx is canceled.
+func (r *Router) Run(ctx context.Context) {
+	var dispatchers sync.WaitGroup
+	for _, s := range r.pipelines {
+		for _, l := range s.lanes {
+			dispatchers.Add(1)
+			go func(l *pipelineLane) {
+				defer dispatchers.Done()
+				l.dispatch(ctx)
+			}(l)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, lane := range models.Priorities {
+		wg.Add(1)
+		go func(lane models.Priority) {
+			defer wg.Done()
+			r.route(ctx, lane)
+		}(lane)
+	}
+	wg.Wait()
+
+	for _, s := range r.pipelines {
+		for _, l := range s.lanes {
+			l.close()
+		}
+	}
+	dispatchers.Wait()
+}
+
+// route queues the events of one lane in their pipelines
+func (r *Router) route(ctx context.Context, lane models.Priority) {
+	in := r.source.Lane(lane)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-in:
+			if !ok {
+				return
+			}
+			name, matched, err := r.table.Route(event)
+			if err != nil {
+				r.exprErrors.Inc()
+				r.logger.Printf("Routing event %s: %v", event.ID, err)
+			}
+			if !matched {
+				r.unrouted.Inc()
+			}
+			out, ok := r.pipelines[name]
+			if !ok {
+				r.dropped.Inc()
+				r.logger.Printf("No route for event %s, dropping it", event.ID)
+				continue
+			}
+			out.lanes[lane].push(event)
+			r.routed[name].Inc()
+		}
+	}
+}
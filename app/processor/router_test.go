@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/routing"
+)
+
+func startRouter(t *testing.T, store *models.EventStore, fallback string, pipelines ...string) *Router {
+	t.Helper()
+	queueSizes := make(map[string]int, len(pipelines))
+	for _, name := range pipelines {
+		queueSizes[name] = 2
+	}
+	return startRouterWithQueues(t, store, fallback, queueSizes)
+}
+
+func startRouterWithQueues(t *testing.T, store *models.EventStore, fallback string, queueSizes map[string]int) *Router {
+	t.Helper()
+	orders, err := routing.Compile(routing.Conditions{Type: "order.created"}, expr.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to compile conditions: %v", err)
+	}
+	large, err := routing.Compile(routing.Conditions{Expr: `json(payload).total > 100`}, expr.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to compile conditions: %v", err)
+	}
+	table := routing.NewTable([]routing.Rule{{Pipeline: "orders", Match: orders}, {Pipeline: "orders", Match: large}}, fallback)
+	router := NewRouter(store, table, queueSizes, metrics.NewRegistry(), log.New(io.Discard, "", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		router.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return router
+}
+
+// receive reads the next event of a pipeline lane
+func receive(t *testing.T, source Source, lane models.Priority) *models.Event {
+	t.Helper()
+	select {
+	case event := <-source.Lane(lane):
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for an event in lane %s", lane)
+		return nil
+	}
+}
+
+func TestRouterRoutesToPipelines(t *testing.T) {
+	store := models.NewEventStore(10)
+	router := startRouter(t, store, "default", "default", "orders")
+	if router.Pipeline("unknown") != nil {
+		t.Error("Expected no source for an unknown pipeline")
+	}
+
+	for _, event := range []*models.Event{
+		{ID: "order", Type: "order.created"},
+		{ID: "other", Type: "user.created", Payload: `{"total": 5}`},
+		{ID: "urgent", Type: "order.created", Priority: models.PriorityHigh},
+		{ID: "text", Payload: "not json"},
+	} {
+		if err := store.Add(event); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+
+	if event := receive(t, router.Pipeline("orders"), models.PriorityNormal); event.ID != "order" {
+		t.Errorf("Expected order in the orders pipeline, got %s", event.ID)
+	}
+	if event := receive(t, router.Pipeline("orders"), models.PriorityHigh); event.ID != "urgent" {
+		t.Errorf("Expected urgent in the orders high lane, got %s", event.ID)
+	}
+	if event := receive(t, router.Pipeline("default"), models.PriorityNormal); event.ID != "other" {
+		t.Errorf("Expected other in the default pipeline, got %s", event.ID)
+	}
+	if event := receive(t, router.Pipeline("default"), models.PriorityNormal); event.ID != "text" {
+		t.Errorf("Expected text in the default pipeline, got %s", event.ID)
+	}
+	if got := router.exprErrors.Value(); got != 1 {
+		t.Errorf("Expected 1 expression error for the text payload, got %d", got)
+	}
+	// Counted once handed over, so just after the pipeline received it
+	waitFor(t, "routed events to be counted", func() bool { return router.routed["orders"].Value() == 2 })
+	if got := router.unrouted.Value(); got != 2 {
+		t.Errorf("Expected 2 unrouted events, got %d", got)
+	}
+}
+
+func TestRouterDropsUnroutedWithoutDefault(t *testing.T) {
+	store := models.NewEventStore(10)
+	router := startRouter(t, store, "", "orders")
+
+	addEvents(t, store, "other", 2)
+	if err := store.Add(&models.Event{ID: "order", Type: "order.created"}); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	if event := receive(t, router.Pipeline("orders"), models.PriorityNormal); event.ID != "order" {
+		t.Errorf("Expected order in the orders pipeline, got %s", event.ID)
+	}
+	if got := router.dropped.Value(); got != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", got)
+	}
+}
+
+func TestRouterIsolatesPipelines(t *testing.T) {
+	store := models.NewEventStore(10)
+	router := startRouter(t, store, "default", "default", "orders")
+
+	// Nothing reads the orders pipeline, as when its pool is paused
+	for i := 0; i < 5; i++ {
+		if err := store.Add(&models.Event{ID: fmt.Sprintf("order-%d", i), Type: "order.created"}); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+	if err := store.Add(&models.Event{ID: "other"}); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	if event := receive(t, router.Pipeline("default"), models.PriorityNormal); event.ID != "other" {
+		t.Errorf("Expected other in the default pipeline, got %s", event.ID)
+	}
+	waitFor(t, "orders to be queued", func() bool { return router.Depth("orders") == 5 })
+
+	// The full pipeline refuses its own events and admits the others
+	if name, err := router.Admit(&models.Event{ID: "order-5", Type: "order.created"}); err != ErrPipelineFull || name != "orders" {
+		t.Errorf("Expected %v for orders, got %s %v", ErrPipelineFull, name, err)
+	}
+	if _, err := router.Admit(&models.Event{ID: "urgent", Type: "order.created", Priority: models.PriorityHigh}); err != nil {
+		t.Errorf("Expected room in the high lane, got %v", err)
+	}
+	if name, err := router.Admit(&models.Event{ID: "other-2"}); err != nil || name != "default" {
+		t.Errorf("Expected the default pipeline to admit, got %s %v", name, err)
+	}
+	if got := router.refused["orders"].Value(); got != 1 {
+		t.Errorf("Expected 1 refused event, got %d", got)
+	}
+
+	// Queued events are handed over in order once the pool reads them
+	for i := 0; i < 5; i++ {
+		if event := receive(t, router.Pipeline("orders"), models.PriorityNormal); event.ID != fmt.Sprintf("order-%d", i) {
+			t.Errorf("Expected order-%d, got %s", i, event.ID)
+		}
+	}
+}
+
+func TestRouterDeliversQueuedEventsAfterInputEnds(t *testing.T) {
+	store := models.NewEventStore(10)
+	router := startRouter(t, store, "default", "default")
+	addEvents(t, store, "e", 3)
+	waitFor(t, "events to be queued", func() bool { return router.Depth("default") == 3 })
+	store.Close()
+
+	var ids []string
+	for event := range router.Pipeline("default").Lane(models.PriorityNormal) {
+		ids = append(ids, event.ID)
+	}
+	if len(ids) != 3 {
+		t.Errorf("Expected the 3 queued events before the lane closed, got %v", ids)
+	}
+}
+
+func TestFanoutPublishesToAll(t *testing.T) {
+	first, second := make(chanPublisher, 1), make(chanPublisher, 1)
+	event := &models.TransformedEvent{ID: "a"}
+	if err := (Fanout{first, failingPublisher{}, second}).Publish(event); err == nil {
+		t.Error("Expected the failing sink's error")
+	}
+	for i, sink := range []chanPublisher{first, second} {
+		if got := <-sink; got != event {
+			t.Errorf("Sink %d: expected the event, got %+v", i, got)
+		}
+	}
+	if err := (Fanout{first}).Publish(event); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
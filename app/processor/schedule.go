@@ -0,0 +1,125 @@
+package processor
+
+import "coding_challenge/internal/models"
+
+// readyQueue holds the partitions that have pending events and no active
+// worker. Partitions are queued per tenant and tenants are served round
+// robin, so a tenant with a large backlog cannot starve the others.
+type readyQueue struct {
+	queues map[string][]*partition
+	order  []string // tenants with ready partitions, next to serve first
+	size   int
+}
+
+func newReadyQueue() *readyQueue {
+	return &readyQueue{queues: make(map[string][]*partition)}
+}
+
+// push queues a partition behind the other ready partitions of its tenant
+func (q *readyQueue) push(part *partition) {
+	if len(q.queues[part.tenant]) == 0 {
+		q.order = append(q.order, part.tenant)
+	}
+	q.queues[part.tenant] = append(q.queues[part.tenant], part)
+	q.size++
+}
+
+// pop returns the next partition of the next tenant in turn
+func (q *readyQueue) pop() *partition {
+	if q.size == 0 {
+		return nil
+	}
+
+	tenant := q.order[0]
+	q.order = q.order[1:]
+
+	queue := q.queues[tenant]
+	part := queue[0]
+	queue[0] = nil
+	if len(queue) == 1 {
+		delete(q.queues, tenant)
+	} else {
+		q.queues[tenant] = queue[1:]
+		q.order = append(q.order, tenant)
+	}
+	q.size--
+	return part
+}
+
+// len returns the number of ready partitions
+func (q *readyQueue) len() int {
+	return q.size
+}
+
+// laneQueue holds the ready partitions of each priority lane and picks the
+// lane to serve by smooth weighted round robin. While several lanes have
+// work each gets turns in proportion to its weight, evenly spread, so a
+// backfill in the low lane cannot starve the high lane and a busy high
+// lane still leaves turns to the others.
+type laneQueue struct {
+	lanes []*lane // highest priority first, winning ties
+	size  int
+}
+
+// lane is the ready queue of one priority and its scheduling state
+type lane struct {
+	priority models.Priority
+	weight   int
+	// credit grows by weight on every pick while the lane has work and
+	// drops by the total weight when the lane is served
+	credit int
+	ready  *readyQueue
+}
+
+func newLaneQueue(weights map[models.Priority]int) *laneQueue {
+	q := &laneQueue{}
+	for _, priority := range models.Priorities {
+		q.lanes = append(q.lanes, &lane{priority: priority, weight: weights[priority], ready: newReadyQueue()})
+	}
+	return q
+}
+
+// push queues a partition in its lane
+func (q *laneQueue) push(part *partition) {
+	for _, l := range q.lanes {
+		if l.priority == part.lane {
+			l.ready.push(part)
+			q.size++
+			return
+		}
+	}
+}
+
+// pop returns the next partition of the lane with the most credit
+func (q *laneQueue) pop() *partition {
+	if q.size == 0 {
+		return nil
+	}
+
+	var best *lane
+	total := 0
+	for _, l := range q.lanes {
+		if l.ready.len() == 0 {
+			continue
+		}
+		l.credit += l.weight
+		total += l.weight
+		if best == nil || l.credit > best.credit {
+			best = l
+		}
+	}
+	best.credit -= total
+
+	part := best.ready.pop()
+	if best.ready.len() == 0 {
+		// An idle lane does not bank turns for later
+		best.credit = 0
+	}
+	q.size--
+	return part
+}
+
+// len returns the number of ready partitions across lanes
+func (q *laneQueue) len() int {
+	return q.size
+}
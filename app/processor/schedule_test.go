@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"coding_challenge/internal/models"
+)
+
+func TestReadyQueueRoundRobinsTenants(t *testing.T) {
+	q := newReadyQueue()
+
+	// A tenant with a large backlog queues first
+	for i := 0; i < 3; i++ {
+		q.push(&partition{tenant: "bulk", index: i})
+	}
+	q.push(&partition{tenant: "small", index: 0})
+
+	var order []string
+	for q.len() > 0 {
+		order = append(order, q.pop().tenant)
+	}
+
+	want := []string{"bulk", "small", "bulk", "bulk"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected order %v, got %v", want, order)
+		}
+	}
+	if q.pop() != nil {
+		t.Error("Expected empty queue to return nil")
+	}
+}
+
+func TestLaneQueueWeightsLanes(t *testing.T) {
+	q := newLaneQueue(DefaultLaneWeights)
+
+	// Every lane has a backlog, the low lane queued first
+	for _, lane := range []models.Priority{models.PriorityLow, models.PriorityNormal, models.PriorityHigh} {
+		for i := 0; i < 4; i++ {
+			q.push(&partition{tenant: "t", lane: lane, index: i})
+		}
+	}
+
+	var order []string
+	for i := 0; i < 7; i++ {
+		order = append(order, string(q.pop().lane))
+	}
+	got := strings.Join(order, ",")
+	if want := "high,normal,high,low,high,normal,high"; got != want {
+		t.Errorf("Expected turns %s, got %s", want, got)
+	}
+
+	// Once the high lane is empty the others share the workers
+	for q.len() > 0 {
+		if part := q.pop(); part.lane == models.PriorityHigh {
+			t.Fatal("Expected the high lane to be empty")
+		}
+	}
+	if q.pop() != nil {
+		t.Error("Expected empty queue to return nil")
+	}
+}
@@ -2,71 +2,193 @@ package processor
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
 	"coding_challenge/internal/models"
+	"coding_challenge/internal/transform"
 )
 
+// WorkerState describes what a worker is currently doing
+type WorkerState string
+
+const (
+	WorkerIdle       WorkerState = "idle"
+	WorkerProcessing WorkerState = "processing"
+	WorkerPaused     WorkerState = "paused"
+	WorkerStopped    WorkerState = "stopped"
+)
+
+// WorkerStatus is a snapshot of a worker for inspection
+type WorkerStatus struct {
+	ID           string      `json:"id"`
+	State        WorkerState `json:"state"`
+	CurrentEvent string      `json:"current_event,omitempty"`
+	Processed    uint64      `json:"processed"`
+	LastError    string      `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time  `json:"last_error_at,omitempty"`
+}
+
 // Worker represents a background processor for events
 type Worker struct {
-	id         string
-	eventStore *models.EventStore
-	logger     *log.Logger
+	id      string
+	pool    *Pool
+	logger  *log.Logger
+	running atomic.Bool
+	// stopping is guarded by the pool mutex
+	stopping bool
+
+	mu           sync.Mutex
+	state        WorkerState
+	currentEvent string
+	processed    uint64
+	lastError    error
+	lastErrorAt  time.Time
 }
 
-// NewWorker creates a new background worker
-func NewWorker(eventStore *models.EventStore, logger *log.Logger) *Worker {
+// newWorker creates a background worker pulling events from the pool
+func newWorker(pool *Pool, logger *log.Logger) *Worker {
 	return &Worker{
-		id:         uuid.New().String()[:8], // short worker ID
-		eventStore: eventStore,
-		logger:     logger,
+		id:     uuid.New().String()[:8], // short worker ID
+		pool:   pool,
+		logger: logger,
+		state:  WorkerIdle,
 	}
 }
 
+// ID returns the short worker identifier
+func (w *Worker) ID() string {
+	return w.id
+}
+
 // Start begins the worker processing loop
 func (w *Worker) Start(ctx context.Context) {
 	w.logger.Printf("Starting worker %s", w.id)
-
-	eventCh := w.eventStore.EventChannel()
+	w.running.Store(true)
+	defer w.running.Store(false)
+	defer w.setState(WorkerStopped)
 
 	for {
-		select {
-		case <-ctx.Done():
+		event, part, ok := w.pool.next(w)
+		if !ok {
 			w.logger.Printf("Worker %s shutting down...", w.id)
 			return
-		case event, ok := <-eventCh:
-			if !ok {
-				w.logger.Printf("Event channel closed, worker %s shutting down", w.id)
-				return
-			}
-			w.processEvent(event)
 		}
+		w.begin(event)
+		start := w.pool.cfg.Clock.Now()
+		err := w.safeProcess(event)
+		w.pool.deadLetter(event, err)
+		w.pool.done(part, w.pool.cfg.Clock.Now().Sub(start))
+		w.finish(err)
+	}
+}
+
+// Running reports whether the worker loop is active
+func (w *Worker) Running() bool {
+	return w.running.Load()
+}
+
+// Status returns a snapshot of the worker
+func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := WorkerStatus{
+		ID:           w.id,
+		State:        w.state,
+		CurrentEvent: w.currentEvent,
+		Processed:    w.processed,
+	}
+	if w.lastError != nil {
+		lastErrorAt := w.lastErrorAt
+		status.LastError = w.lastError.Error()
+		status.LastErrorAt = &lastErrorAt
 	}
+	return status
+}
+
+// setState records what the worker is doing
+func (w *Worker) setState(state WorkerState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+}
+
+// begin marks the worker as processing event
+func (w *Worker) begin(event *models.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = WorkerProcessing
+	w.currentEvent = event.ID
+}
+
+// finish records the outcome of the current event
+func (w *Worker) finish(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = WorkerIdle
+	w.currentEvent = ""
+	w.processed++
+	if err != nil {
+		w.lastError = err
+		w.lastErrorAt = w.pool.cfg.Clock.Now()
+	}
+}
+
+// safeProcess processes an event, turning a panic into an error so one bad
+// event does not take the worker down
+func (w *Worker) safeProcess(event *models.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic processing event: %v", r)
+			w.logger.Printf("Worker %s: %v", w.id, err)
+		}
+	}()
+	return w.processEvent(event)
 }
 
 // processEvent transforms and publishes an event
-func (w *Worker) processEvent(event *models.Event) {
-	// Transform the event (uppercase the payload)
+func (w *Worker) processEvent(event *models.Event) error {
 	transformedEvent := &models.TransformedEvent{
 		ID:           event.ID,
+		Tenant:       event.Tenant,
 		OriginalTime: event.Timestamp,
-		ProcessedAt:  time.Now(),
-		Payload:      strings.ToUpper(event.Payload), // Simple transformation
+		ProcessedAt:  w.pool.cfg.Clock.Now(),
+		Payload:      event.Payload,
 		ProcessorID:  w.id,
+		Type:         event.Type,
+	}
+	// Transformers may change the attributes, the stored event keeps its own
+	if len(event.Attributes) > 0 {
+		transformedEvent.Attributes = make(map[string]string, len(event.Attributes))
+		for key, value := range event.Attributes {
+			transformedEvent.Attributes[key] = value
+		}
+	}
+	if err := w.pool.cfg.Transform.Transform(transformedEvent); err != nil {
+		if errors.Is(err, transform.ErrFiltered) {
+			w.pool.filtered.Inc()
+			return nil
+		}
+		w.pool.failed.Inc()
+		w.logger.Printf("Worker %s failed to transform event %s: %v", w.id, event.ID, err)
+		return err
 	}
 
-	// "Publish" the transformed event (in this case, just log it)
-	w.publishEvent(transformedEvent)
+	return w.publishEvent(transformedEvent)
 }
 
-// publishEvent outputs the transformed event
-func (w *Worker) publishEvent(event *models.TransformedEvent) {
-	w.logger.Printf("[PUBLISHED] Worker %s processed event %s: %s",
-		w.id,
-		event.ID,
-		event.Payload)
+// publishEvent hands the transformed event to the pool's publisher
+func (w *Worker) publishEvent(event *models.TransformedEvent) error {
+	if err := w.pool.cfg.Publisher.Publish(event); err != nil {
+		w.logger.Printf("Worker %s failed to publish event %s: %v", w.id, event.ID, err)
+		return err
+	}
+	return nil
 }
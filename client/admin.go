@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HealthResult is the health of one component
+type HealthResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// HealthReport is the answer of a health probe
+type HealthReport struct {
+	// Status is "ok", "degraded" or "down"
+	Status string `json:"status"`
+	// State is "starting", "ready" or "draining"
+	State      string                  `json:"state"`
+	Components map[string]HealthResult `json:"components"`
+}
+
+// Probe selects a health endpoint
+type Probe string
+
+// Health probes
+const (
+	ProbeHealth    Probe = "health"
+	ProbeLiveness  Probe = "livez"
+	ProbeReadiness Probe = "readyz"
+)
+
+// Health runs a probe. A failing probe is not an error, its report has
+// status "down".
+func (c *Client) Health(ctx context.Context, probe Probe) (*HealthReport, error) {
+	httpReq, err := c.newRequest(ctx, request{method: http.MethodGet, path: "/" + string(probe)})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, readError(resp)
+	}
+	var report HealthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("event processor: decoding response: %w", err)
+	}
+	return &report, nil
+}
+
+// Metrics returns the Prometheus metrics exposition
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   "/metrics",
+		header: http.Header{"Accept": {"text/plain"}},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// ScalingDecision is a resize of the worker pool
+type ScalingDecision struct {
+	Time    time.Time     `json:"time"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Reason  string        `json:"reason"`
+	Pending int           `json:"pending"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// PoolStatus describes the worker pool
+type PoolStatus struct {
+	// State is "running", "paused" or "draining"
+	State      string            `json:"state"`
+	Size       int               `json:"size"`
+	MinWorkers int               `json:"min_workers"`
+	MaxWorkers int               `json:"max_workers"`
+	Pinned     bool              `json:"pinned"`
+	Pending    int               `json:"pending"`
+	Latency    time.Duration     `json:"latency_ns"`
+	Decisions  []ScalingDecision `json:"decisions"`
+}
+
+// WorkerStatus describes one worker
+type WorkerStatus struct {
+	ID           string     `json:"id"`
+	State        string     `json:"state"`
+	CurrentEvent string     `json:"current_event,omitempty"`
+	Processed    uint64     `json:"processed"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+}
+
+// poolRequest calls an admin route returning the pool status
+func (c *Client) poolRequest(ctx context.Context, method, path string, body []byte) (*PoolStatus, error) {
+	var status PoolStatus
+	if _, err := c.do(ctx, request{method: method, path: path, body: body}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Pool returns the worker pool status
+func (c *Client) Pool(ctx context.Context) (*PoolStatus, error) {
+	return c.poolRequest(ctx, http.MethodGet, c.adminPath("/pool"), nil)
+}
+
+// PinPoolSize fixes the number of workers, disabling autoscaling
+func (c *Client) PinPoolSize(ctx context.Context, size int) (*PoolStatus, error) {
+	body, _ := json.Marshal(map[string]int{"size": size})
+	return c.poolRequest(ctx, http.MethodPut, c.adminPath("/pool/size"), body)
+}
+
+// UnpinPoolSize resumes autoscaling
+func (c *Client) UnpinPoolSize(ctx context.Context) (*PoolStatus, error) {
+	return c.poolRequest(ctx, http.MethodDelete, c.adminPath("/pool/size"), nil)
+}
+
+// PausePool stops processing while ingestion continues
+func (c *Client) PausePool(ctx context.Context) (*PoolStatus, error) {
+	return c.poolRequest(ctx, http.MethodPost, c.adminPath("/pool/pause"), nil)
+}
+
+// ResumePool resumes processing
+func (c *Client) ResumePool(ctx context.Context) (*PoolStatus, error) {
+	return c.poolRequest(ctx, http.MethodPost, c.adminPath("/pool/resume"), nil)
+}
+
+// DrainPool processes the events held by the pool and queued for it, then
+// pauses it
+func (c *Client) DrainPool(ctx context.Context) (*PoolStatus, error) {
+	return c.poolRequest(ctx, http.MethodPost, c.adminPath("/pool/drain"), nil)
+}
+
+// Pipelines returns the pool status of every pipeline, by name
+func (c *Client) Pipelines(ctx context.Context) (map[string]*PoolStatus, error) {
+	var statuses map[string]*PoolStatus
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/pipelines"}, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// Workers returns the status of every worker
+func (c *Client) Workers(ctx context.Context) ([]WorkerStatus, error) {
+	var workers []WorkerStatus
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: c.adminPath("/workers")}, &workers); err != nil {
+		return nil, err
+	}
+	return workers, nil
+}
+
+// DeadLetter is an event a pipeline failed to transform or publish
+type DeadLetter struct {
+	ID       uint64    `json:"id"`
+	Pipeline string    `json:"pipeline"`
+	Event    Event     `json:"event"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	// Attempts counts the failed processings, redrives included
+	Attempts int `json:"attempts"`
+}
+
+// RedriveResult counts the dead letters redriven and those left
+type RedriveResult struct {
+	Redriven  int `json:"redriven"`
+	Remaining int `json:"remaining"`
+}
+
+// deadLetterPath returns the path of a dead letter route
+func deadLetterPath(id uint64, suffix string) string {
+	return "/admin/dlq/" + strconv.FormatUint(id, 10) + suffix
+}
+
+// pipelineQuery selects the dead letters of a pipeline, every pipeline's
+// when empty
+func pipelineQuery(pipeline string) url.Values {
+	if pipeline == "" {
+		return nil
+	}
+	return url.Values{"pipeline": {pipeline}}
+}
+
+// deadLetterRequest calls a dead letter route returning one dead letter
+func (c *Client) deadLetterRequest(ctx context.Context, method, path string) (*DeadLetter, error) {
+	var letter DeadLetter
+	if _, err := c.do(ctx, request{method: method, path: path}, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// DeadLetters returns the dead letters of a pipeline, or of every pipeline
+// when empty, oldest first
+func (c *Client) DeadLetters(ctx context.Context, pipeline string) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/dlq", query: pipelineQuery(pipeline)}, &letters); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// DeadLetter returns a dead letter. A missing one is an *APIError with
+// status 404.
+func (c *Client) DeadLetter(ctx context.Context, id uint64) (*DeadLetter, error) {
+	return c.deadLetterRequest(ctx, http.MethodGet, deadLetterPath(id, ""))
+}
+
+// RedriveDeadLetter hands a dead letter back to its pipeline. A full
+// pipeline is an *APIError with status 429 and the dead letter stays
+// queued.
+func (c *Client) RedriveDeadLetter(ctx context.Context, id uint64) (*DeadLetter, error) {
+	return c.deadLetterRequest(ctx, http.MethodPost, deadLetterPath(id, "/redrive"))
+}
+
+// RedriveDeadLetters hands the dead letters of a pipeline, or of every
+// pipeline when empty, back to their pipelines, oldest first
+func (c *Client) RedriveDeadLetters(ctx context.Context, pipeline string) (*RedriveResult, error) {
+	var result RedriveResult
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/admin/dlq/redrive", query: pipelineQuery(pipeline)}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DiscardDeadLetter removes a dead letter without processing it
+func (c *Client) DiscardDeadLetter(ctx context.Context, id uint64) (*DeadLetter, error) {
+	return c.deadLetterRequest(ctx, http.MethodDelete, deadLetterPath(id, ""))
+}
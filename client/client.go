@@ -0,0 +1,350 @@
+// Package client is the Go SDK of the event processor API. It publishes,
+// reads and follows events, retrying throttled and unavailable requests
+// with backoff. Publishes carry an idempotency key, so retrying them never
+// stores an event twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coding_challenge/internal/clock"
+)
+
+const (
+	// DefaultUserAgent identifies the SDK unless WithUserAgent is given
+	DefaultUserAgent = "event-processor-go-client/1"
+
+	apiKeyHeader      = "X-API-Key"
+	idempotencyHeader = "Idempotency-Key"
+	// maxErrorBody bounds how much of an error response is read
+	maxErrorBody = 64 << 10
+)
+
+// RetryPolicy controls retries of requests rejected with 429 or 503, or
+// failed by the network
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, 1 disables retries
+	MaxAttempts int
+	// Backoff grows exponentially from MinBackoff up to MaxBackoff, with
+	// full jitter. A longer Retry-After from the server takes precedence.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetry is given
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// backoff returns a random delay before the given retry, counted from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.MinBackoff
+	for i := 1; i < retry && ceiling < p.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxBackoff {
+		ceiling = p.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Clock tells the time and creates the timers of retry backoffs, stream
+// reconnects and producer lingers, so tests can drive them without sleeping
+type Clock = clock.Clock
+
+// Timer is a timer created by a Clock
+type Timer = clock.Timer
+
+// Ticker is a ticker created by a Clock
+type Ticker = clock.Ticker
+
+// Client calls the event processor API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	apiKey     string
+	token      string
+	tenant     string
+	pipeline   string
+	userAgent  string
+	retry      RetryPolicy
+	// clock times retry backoffs, stream reconnects and producer lingers
+	clock clock.Clock
+}
+
+// Option customises a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for every request. Its Timeout
+// also bounds streams, prefer contexts for deadlines.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithClock times retry backoffs, stream reconnects and producer lingers on
+// c instead of the system clock
+func WithClock(c Clock) Option {
+	return func(cl *Client) {
+		cl.clock = clock.OrReal(c)
+	}
+}
+
+// WithTransport sets the transport of the HTTP client, for proxies, TLS
+// settings or instrumentation
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
+}
+
+// WithAPIKey authenticates with an API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken authenticates with a JWT
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithTenant addresses the /tenants/{tenant} event routes
+func WithTenant(tenant string) Option {
+	return func(c *Client) {
+		c.tenant = tenant
+	}
+}
+
+// WithPipeline addresses the /admin/pipelines/{pipeline} pool and worker
+// routes instead of those of the default pipeline
+func WithPipeline(pipeline string) Option {
+	return func(c *Client) {
+		c.pipeline = pipeline
+	}
+}
+
+// WithRetry sets the retry policy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithUserAgent sets the User-Agent header
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New creates a client for the API at baseURL, such as
+// "http://localhost:8081"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be an absolute http or https URL", baseURL)
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{},
+		userAgent:  DefaultUserAgent,
+		retry:      DefaultRetryPolicy,
+		clock:      clock.Real,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+// APIError is an error response of the API
+type APIError struct {
+	StatusCode int
+	// Code is the machine readable error code, such as "duplicate_event"
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+	// RetryAfter is the delay asked for by 429 and 503 responses
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("event processor: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("event processor: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Retryable reports whether the request may succeed if sent again
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// readError builds an APIError from a failed response
+func readError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	json.Unmarshal(data, apiErr)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// request is an API call, kept so it can be sent again
+type request struct {
+	method string
+	// path is escaped and relative to the base URL
+	path   string
+	query  url.Values
+	body   []byte
+	header http.Header
+}
+
+// eventsPath returns the path of an event route, scoped to the tenant
+func (c *Client) eventsPath(suffix string) string {
+	if c.tenant != "" {
+		return "/tenants/" + url.PathEscape(c.tenant) + "/events" + suffix
+	}
+	return "/events" + suffix
+}
+
+// adminPath returns the path of a pool or worker route, scoped to the
+// pipeline
+func (c *Client) adminPath(suffix string) string {
+	if c.pipeline != "" {
+		return "/admin/pipelines/" + url.PathEscape(c.pipeline) + suffix
+	}
+	return "/admin" + suffix
+}
+
+// newRequest builds the HTTP request of an attempt
+func (c *Client) newRequest(ctx context.Context, req request) (*http.Request, error) {
+	// req.path is escaped, so IDs may contain slashes
+	u := *c.baseURL
+	u.RawPath = c.baseURL.EscapedPath() + req.path
+	path, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	u.RawQuery = req.query.Encode()
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if c.apiKey != "" {
+		httpReq.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return httpReq, nil
+}
+
+// send performs req, retrying per the retry policy, and returns the first
+// successful response. Callers must close its body.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		httpReq, err := c.newRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(httpReq)
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if attempt >= c.retry.MaxAttempts {
+				return nil, err
+			}
+			wait = c.retry.backoff(attempt)
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return resp, nil
+		default:
+			apiErr := readError(resp)
+			resp.Body.Close()
+			if !apiErr.Retryable() || attempt >= c.retry.MaxAttempts {
+				return nil, apiErr
+			}
+			wait = c.retry.backoff(attempt)
+			if apiErr.RetryAfter > wait {
+				wait = apiErr.RetryAfter
+			}
+		}
+
+		timer := c.clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// do sends req and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, req request, out interface{}) (http.Header, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("event processor: decoding response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// newIdempotencyKey returns a random key for a publish
+func newIdempotencyKey() string {
+	return uuid.NewString()
+}
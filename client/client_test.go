@@ -0,0 +1,412 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"coding_challenge/app/api"
+	"coding_challenge/internal/clock"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// fastRetry keeps retry tests quick
+var fastRetry = RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+// newTestAPI serves the real API over HTTP
+func newTestAPI(t *testing.T) (*Client, *models.EventStore) {
+	t.Helper()
+	eventStore := models.NewEventStore(100)
+	server := api.NewServer(":0", eventStore, log.New(io.Discard, "", 0),
+		api.WithIdempotency(api.NewIdempotency(time.Minute, 100, metrics.NewRegistry())))
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Stop(ctx)
+		ts.Close()
+	})
+
+	c, err := New(ts.URL, WithRetry(fastRetry))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return c, eventStore
+}
+
+func TestPublishGetAndList(t *testing.T) {
+	c, _ := newTestAPI(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.Publish(ctx, Event{ID: fmt.Sprintf("event-%d", i), Payload: "payload"}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	batch, err := c.PublishBatch(ctx, []Event{{ID: "event-5"}, {ID: "event-0"}})
+	if err != nil {
+		t.Fatalf("Failed to publish batch: %v", err)
+	}
+	if batch.Accepted != 1 || batch.Rejected != 1 || batch.Results[1].Code != "duplicate_event" {
+		t.Errorf("Expected one accepted and one duplicate, got %+v", batch)
+	}
+
+	event, err := c.Get(ctx, "event-3")
+	if err != nil || event.Payload != "payload" {
+		t.Fatalf("Expected event-3, got %+v (%v)", event, err)
+	}
+	var apiErr *APIError
+	if _, err := c.Get(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+
+	page, err := c.List(ctx, ListOptions{Limit: 4})
+	if err != nil || len(page.Events) != 4 || page.NextCursor == "" {
+		t.Fatalf("Expected a full first page with a cursor, got %+v (%v)", page, err)
+	}
+
+	it := c.Events(ctx, 4)
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Event().ID)
+	}
+	if it.Err() != nil || len(ids) != 6 || ids[0] != "event-0" || ids[5] != "event-5" {
+		t.Errorf("Expected 6 events in order, got %v (%v)", ids, it.Err())
+	}
+}
+
+func TestScheduledEvents(t *testing.T) {
+	c, eventStore := newTestAPI(t)
+	ctx := context.Background()
+
+	for _, event := range []Event{{ID: "later", Delay: 7200}, {ID: "sooner", Delay: 3600}, {ID: "now"}} {
+		if _, err := c.Publish(ctx, event); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	scheduled, err := c.Scheduled(ctx)
+	if err != nil || len(scheduled) != 2 || scheduled[0].ID != "sooner" || scheduled[1].ID != "later" {
+		t.Fatalf("Expected the two delayed events soonest first, got %+v (%v)", scheduled, err)
+	}
+	if scheduled[0].DeliverAt == 0 || scheduled[0].Delay != 0 {
+		t.Errorf("Expected the delay stored as deliver_at, got %+v", scheduled[0])
+	}
+	if eventStore.QueueLen() != 1 {
+		t.Errorf("Expected only the immediate event queued, got %d", eventStore.QueueLen())
+	}
+
+	if event, err := c.CancelScheduled(ctx, "later"); err != nil || event.ID != "later" {
+		t.Fatalf("Expected the event canceled, got %+v (%v)", event, err)
+	}
+	var apiErr *APIError
+	if _, err := c.CancelScheduled(ctx, "now"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a 409 for a delivered event, got %v", err)
+	}
+	if _, err := c.Get(ctx, "later"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the canceled event gone, got %v", err)
+	}
+}
+
+func TestPublishIsIdempotent(t *testing.T) {
+	c, _ := newTestAPI(t)
+	ctx := context.Background()
+
+	first, err := c.Publish(ctx, Event{ID: "once"}, IdempotencyKey("key-1"))
+	if err != nil || first.Replayed {
+		t.Fatalf("Expected a fresh publish, got %+v (%v)", first, err)
+	}
+	again, err := c.Publish(ctx, Event{ID: "once"}, IdempotencyKey("key-1"))
+	if err != nil || !again.Replayed || again.ID != "once" {
+		t.Errorf("Expected the publish to be replayed, got %+v (%v)", again, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts int32
+	keys := make(map[string]bool)
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.Header.Get(idempotencyHeader)] = true
+		mu.Unlock()
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"code":"unavailable","message":"try later"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"retried"}`)
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL, WithRetry(fastRetry))
+	result, err := c.Publish(context.Background(), Event{ID: "retried"})
+	if err != nil || result.ID != "retried" {
+		t.Fatalf("Expected publish to succeed after retries, got %v", err)
+	}
+	if attempts != 3 || len(keys) != 1 {
+		t.Errorf("Expected 3 attempts sharing one idempotency key, got %d attempts and %d keys", attempts, len(keys))
+	}
+}
+
+func TestRetriesFollowClock(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"code":"rate_limited","message":"slow down"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"delayed"}`)
+	}))
+	defer ts.Close()
+
+	fake := clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	c, _ := New(ts.URL, WithRetry(fastRetry), WithClock(fake))
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Publish(context.Background(), Event{ID: "delayed"})
+		done <- err
+	}()
+
+	// The retry waits for the server's Retry-After on the clock
+	fake.BlockUntil(1)
+	fake.Advance(29 * time.Second)
+	if fake.Waiters() != 1 || atomic.LoadInt32(&attempts) != 1 {
+		t.Fatalf("Expected the retry to wait out Retry-After, got %d attempts", attempts)
+	}
+	fake.Advance(time.Second)
+	if err := <-done; err != nil || atomic.LoadInt32(&attempts) != 2 {
+		t.Errorf("Expected publish to succeed on the second attempt, got %v after %d", err, attempts)
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"code":"invalid_query","message":"bad"}`)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"code":"rate_limited","message":"slow down"}`)
+	}))
+	defer ts.Close()
+	c, _ := New(ts.URL, WithRetry(fastRetry))
+
+	var apiErr *APIError
+	_, err := c.Publish(context.Background(), Event{ID: "throttled"})
+	if !errors.As(err, &apiErr) || apiErr.Code != "rate_limited" || attempts != int32(fastRetry.MaxAttempts) {
+		t.Errorf("Expected rate_limited after %d attempts, got %v after %d", fastRetry.MaxAttempts, err, attempts)
+	}
+
+	// Client errors are not retried
+	atomic.StoreInt32(&attempts, 0)
+	if _, err := c.List(context.Background(), ListOptions{}); !errors.As(err, &apiErr) || attempts != 1 {
+		t.Errorf("Expected one attempt for a 400, got %d (%v)", attempts, err)
+	}
+
+	// The context bounds retries
+	slow, _ := New(ts.URL, WithRetry(RetryPolicy{MaxAttempts: 10, MinBackoff: time.Second, MaxBackoff: time.Second}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := slow.Publish(ctx, Event{ID: "throttled"}); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestOptions(t *testing.T) {
+	var seen *http.Request
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		seen = r
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"id":"a b"}`)),
+		}, nil
+	})
+	c, err := New("https://events.example.com/api/", WithTransport(transport), WithTenant("acme"),
+		WithAPIKey("secret"), WithUserAgent("test-agent"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if _, err := c.Get(context.Background(), "a b"); err != nil {
+		t.Fatalf("Failed to get event: %v", err)
+	}
+	if got := seen.URL.String(); got != "https://events.example.com/api/tenants/acme/events/a%20b" {
+		t.Errorf("Unexpected URL %s", got)
+	}
+	if seen.Header.Get(apiKeyHeader) != "secret" || seen.Header.Get("User-Agent") != "test-agent" {
+		t.Errorf("Expected API key and user agent headers, got %v", seen.Header)
+	}
+
+	if _, err := New("localhost:8081"); err == nil {
+		t.Error("Expected an error for a URL without scheme")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c, eventStore := newTestAPI(t)
+	ctx := context.Background()
+	_ = eventStore.Add(&models.Event{ID: "old"})
+
+	sub, err := c.Subscribe(ctx, SubscribeOptions{Cursor: "0"})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+	if _, err := c.Publish(ctx, Event{ID: "new"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	for _, want := range []string{"old", "new"} {
+		select {
+		case event := <-sub.Events():
+			if event.ID != want {
+				t.Errorf("Expected %q, got %q", want, event.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", want)
+		}
+	}
+	if sub.Cursor() != "2" {
+		t.Errorf("Expected cursor 2, got %q", sub.Cursor())
+	}
+}
+
+func TestConsumerGroups(t *testing.T) {
+	c, eventStore := newTestAPI(t)
+	ctx := context.Background()
+	for _, id := range []string{"first", "second"} {
+		_ = eventStore.Add(&models.Event{ID: id})
+	}
+
+	group, err := c.CreateGroup(ctx, "billing", GroupPosition{Cursor: 1})
+	if err != nil || group.Cursor != 1 || group.Lag != 1 {
+		t.Fatalf("Expected billing after the first event, got %+v: %v", group, err)
+	}
+	_, err = c.CreateGroup(ctx, "billing", GroupPosition{})
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a 409 for an existing group, got %v", err)
+	}
+
+	sub, err := c.Subscribe(ctx, SubscribeOptions{Group: "billing"})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	select {
+	case event := <-sub.Events():
+		if event.ID != "second" {
+			t.Errorf("Expected the group to resume at second, got %q", event.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for second")
+	}
+	sub.Close()
+
+	if group, err := c.SeekGroup(ctx, "billing", GroupPosition{}); err != nil || group.Cursor != 0 || group.Lag != 2 {
+		t.Errorf("Expected billing moved back to the start, got %+v: %v", group, err)
+	}
+	if groups, err := c.Groups(ctx); err != nil || len(groups) != 1 || groups[0].Name != "billing" {
+		t.Errorf("Expected billing, got %+v: %v", groups, err)
+	}
+	if _, err := c.DeleteGroup(ctx, "billing"); err != nil {
+		t.Errorf("Failed to delete: %v", err)
+	}
+	_, err = c.Group(ctx, "billing")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 after delete, got %v", err)
+	}
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	var connections int32
+	resumedFrom := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if atomic.AddInt32(&connections, 1) == 1 {
+			// Drop the connection after one event
+			io.WriteString(w, ": keepalive\n\nid: 7\ndata: {\"id\":\"first\"}\n\n")
+			return
+		}
+		resumedFrom <- r.Header.Get("Last-Event-ID")
+		io.WriteString(w, "id: 8\ndata: {\"id\":\"second\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL, WithRetry(fastRetry))
+	sub, err := c.Subscribe(context.Background(), SubscribeOptions{})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case event := <-sub.Events():
+			if event.ID != want {
+				t.Errorf("Expected %q, got %q", want, event.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", want)
+		}
+	}
+	if got := <-resumedFrom; got != "7" {
+		t.Errorf("Expected to resume after 7, got %q", got)
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Events(); ok || sub.Err() != nil {
+		t.Errorf("Expected a closed subscription without error, got %v", sub.Err())
+	}
+}
+
+func TestSubscribePublished(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenants/acme/events/published/stream" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": keepalive\n\ndata: {\"id\":\"a\",\"tenant\":\"acme\",\"payload\":\"X\",\"processor_id\":\"worker-1\"}\n\n")
+		io.WriteString(w, "event: lagged\ndata: {}\n\n")
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL, WithTenant("acme"))
+	sub, err := c.SubscribePublished(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+	if event := <-sub.Events(); event.ID != "a" || event.Payload != "X" || event.ProcessorID != "worker-1" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	// Published events cannot be replayed, so a dropped stream is not resumed
+	if _, ok := <-sub.Events(); ok || sub.Err() != ErrLagged {
+		t.Errorf("Expected the subscription to end with %v, got %v", ErrLagged, sub.Err())
+	}
+}
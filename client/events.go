@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Event is an event as stored by the API
+type Event struct {
+	ID string `json:"id"`
+	// Timestamp is in Unix seconds, the receive time when zero
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Payload   string `json:"payload,omitempty"`
+	// PartitionKey orders events sharing it, it defaults to the ID
+	PartitionKey string `json:"partition_key,omitempty"`
+	// Tenant is set by the API from the route or credentials
+	Tenant string `json:"tenant,omitempty"`
+	// DeliverAt holds the event back from processing until then, in Unix
+	// seconds. Delay does so for a number of seconds from receipt and is
+	// returned as DeliverAt.
+	DeliverAt int64 `json:"deliver_at,omitempty"`
+	Delay     int64 `json:"delay,omitempty"`
+	// Priority is the processing lane: high, normal or low, normal when empty
+	Priority string `json:"priority,omitempty"`
+	// Type and Attributes describe the event for routing to a pipeline
+	Type       string            `json:"type,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// PublishResult acknowledges a published event
+type PublishResult struct {
+	ID string `json:"id"`
+	// Replayed is set when the result was replayed for a retried request
+	Replayed bool `json:"-"`
+}
+
+// ItemResult is the outcome of one event of a batch
+type ItemResult struct {
+	ID      string `json:"id"`
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BatchResult lists the outcome of every event of a batch, in order
+type BatchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Results  []ItemResult `json:"results"`
+}
+
+// CallOption customises a single call
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	idempotencyKey string
+}
+
+// IdempotencyKey sets the key identifying a publish. Sending the same
+// request with the same key again, even from another process, returns the
+// first response instead of publishing twice. A random key is used when
+// none is given, which makes the SDK's own retries safe.
+func IdempotencyKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// publishHeader returns the idempotency header of a publish
+func publishHeader(opts []CallOption) http.Header {
+	o := callOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.idempotencyKey == "" {
+		o.idempotencyKey = newIdempotencyKey()
+	}
+	return http.Header{idempotencyHeader: {o.idempotencyKey}}
+}
+
+// Publish stores an event
+func (c *Client) Publish(ctx context.Context, event Event, opts ...CallOption) (*PublishResult, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var result PublishResult
+	header, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   c.eventsPath(""),
+		body:   body,
+		header: publishHeader(opts),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	result.Replayed = header.Get("Idempotent-Replayed") == "true"
+	return &result, nil
+}
+
+// PublishBatch stores events in one request. Each event succeeds or fails
+// on its own, the result must be checked for rejected events.
+func (c *Client) PublishBatch(ctx context.Context, events []Event, opts ...CallOption) (*BatchResult, error) {
+	body, err := json.Marshal(struct {
+		Events []Event `json:"events"`
+	}{events})
+	if err != nil {
+		return nil, err
+	}
+	var result BatchResult
+	if _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   c.eventsPath("/batch"),
+		body:   body,
+		header: publishHeader(opts),
+	}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Get returns an event by ID. A missing event is an *APIError with status
+// 404.
+func (c *Client) Get(ctx context.Context, id string) (*Event, error) {
+	var event Event
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.eventsPath("/" + url.PathEscape(id)),
+	}, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Scheduled returns the events waiting for their delivery time, soonest
+// first
+func (c *Client) Scheduled(ctx context.Context) ([]Event, error) {
+	var events []Event
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.eventsPath("/scheduled"),
+	}, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// CancelScheduled cancels an event waiting for its delivery time and
+// returns it. An event already delivered is an *APIError with status 409.
+func (c *Client) CancelScheduled(ctx context.Context, id string) (*Event, error) {
+	var event Event
+	if _, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   c.eventsPath("/scheduled/" + url.PathEscape(id)),
+	}, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// DefaultPageSize is used by List when ListOptions.Limit is zero
+const DefaultPageSize = 100
+
+// ListOptions selects a page of events
+type ListOptions struct {
+	// Limit is the page size, at most 1000
+	Limit int
+	// Cursor continues after the page that returned it, empty for the
+	// first page
+	Cursor string
+}
+
+// Page is a page of events in insertion order
+type Page struct {
+	Events []Event
+	// NextCursor fetches the next page, empty on the last page
+	NextCursor string
+}
+
+// List returns a page of events, oldest first
+func (c *Client) List(ctx context.Context, opts ListOptions) (*Page, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+
+	page := &Page{}
+	header, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   c.eventsPath(""),
+		query:  query,
+	}, &page.Events)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = header.Get("X-Next-Cursor")
+	return page, nil
+}
+
+// EventIterator walks every event page by page
+type EventIterator struct {
+	ctx    context.Context
+	client *Client
+	opts   ListOptions
+	page   []Event
+	event  Event
+	done   bool
+	err    error
+}
+
+// Events returns an iterator over all events, fetching pages of pageSize
+func (c *Client) Events(ctx context.Context, pageSize int) *EventIterator {
+	return &EventIterator{ctx: ctx, client: c, opts: ListOptions{Limit: pageSize}}
+}
+
+// Next advances to the next event, fetching a page when needed. It returns
+// false at the end or on error.
+func (it *EventIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		page, err := it.client.List(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page.Events
+		it.opts.Cursor = page.NextCursor
+		it.done = page.NextCursor == ""
+	}
+	it.event, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Event returns the current event
+func (it *EventIterator) Event() Event {
+	return it.event
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *EventIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ConsumerGroup is a named position in the event stream kept by the
+// server. Subscriptions with the group resume after its cursor and
+// advance it as events are received.
+type ConsumerGroup struct {
+	Name string `json:"name"`
+	// Cursor is the cursor of the last event delivered to the group
+	Cursor uint64 `json:"cursor"`
+	// Lag counts the events stored after the cursor
+	Lag       int       `json:"lag"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GroupPosition is where a consumer group is created or moved to
+type GroupPosition struct {
+	// Cursor positions the group after that event, 0 before every event
+	Cursor uint64 `json:"cursor,omitempty"`
+	// Latest positions the group after the latest event, skipping those
+	// stored so far
+	Latest bool `json:"latest,omitempty"`
+}
+
+// groupsPath returns the path of a consumer group route, scoped to the
+// tenant
+func (c *Client) groupsPath(suffix string) string {
+	if c.tenant != "" {
+		return "/tenants/" + url.PathEscape(c.tenant) + "/consumer-groups" + suffix
+	}
+	return "/consumer-groups" + suffix
+}
+
+// groupRequest calls a consumer group route returning one group
+func (c *Client) groupRequest(ctx context.Context, method, path string, body interface{}) (*ConsumerGroup, error) {
+	req := request{method: method, path: path}
+	if body != nil {
+		req.body, _ = json.Marshal(body)
+	}
+	var group ConsumerGroup
+	if _, err := c.do(ctx, req, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Groups returns the consumer groups, by name
+func (c *Client) Groups(ctx context.Context) ([]ConsumerGroup, error) {
+	var groups []ConsumerGroup
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: c.groupsPath("")}, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Group returns a consumer group and its lag. A missing group is an
+// *APIError with status 404.
+func (c *Client) Group(ctx context.Context, name string) (*ConsumerGroup, error) {
+	return c.groupRequest(ctx, http.MethodGet, c.groupsPath("/"+url.PathEscape(name)), nil)
+}
+
+// CreateGroup creates a consumer group at a position. An existing group
+// is an *APIError with status 409.
+func (c *Client) CreateGroup(ctx context.Context, name string, at GroupPosition) (*ConsumerGroup, error) {
+	body := struct {
+		Name string `json:"name"`
+		GroupPosition
+	}{name, at}
+	return c.groupRequest(ctx, http.MethodPost, c.groupsPath(""), body)
+}
+
+// SeekGroup moves a consumer group, to replay or skip events.
+// Subscriptions already following the group keep their position until
+// they reconnect.
+func (c *Client) SeekGroup(ctx context.Context, name string, to GroupPosition) (*ConsumerGroup, error) {
+	return c.groupRequest(ctx, http.MethodPut, c.groupsPath("/"+url.PathEscape(name)+"/cursor"), to)
+}
+
+// DeleteGroup removes a consumer group and returns it
+func (c *Client) DeleteGroup(ctx context.Context, name string) (*ConsumerGroup, error) {
+	return c.groupRequest(ctx, http.MethodDelete, c.groupsPath("/"+url.PathEscape(name)), nil)
+}
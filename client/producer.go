@@ -0,0 +1,287 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrProducerClosed is returned by Send after Close
+var ErrProducerClosed = errors.New("client: producer closed")
+
+// ProducerConfig tunes a Producer. Zero fields take the defaults.
+type ProducerConfig struct {
+	// BatchSize is the most events sent in one request, 100 by default. It
+	// must not exceed the server's limits.max_batch_events.
+	BatchSize int
+	// Linger is how long a partial batch waits for more events before it is
+	// sent, 10ms by default
+	Linger time.Duration
+	// MaxBufferedEvents bounds the events buffered or in flight, 10000 by
+	// default. Send blocks while the buffer is full.
+	MaxBufferedEvents int
+	// MaxInFlight bounds concurrent batch requests, 4 by default. Batches
+	// may complete out of order unless it is 1.
+	MaxInFlight int
+	// OnDelivery is called once per event with its outcome, from the
+	// producer's goroutines. It must not block for long, nor call Flush or
+	// Close.
+	OnDelivery func(DeliveryResult)
+}
+
+// DeliveryResult is the outcome of one event sent by a Producer
+type DeliveryResult struct {
+	Event Event
+	// Status is the HTTP status of the event within its batch, zero when
+	// the request failed
+	Status int
+	// Err is nil when the event was stored. Events rejected by the API
+	// have an *APIError, failed requests the error of the request.
+	Err error
+}
+
+// Producer publishes events asynchronously in batches. Send buffers an
+// event, and a batch is sent once BatchSize events are buffered or the
+// oldest has waited Linger. Requests are retried per the client's retry
+// policy with one idempotency key per batch. It is safe for concurrent use.
+type Producer struct {
+	client *Client
+	config ProducerConfig
+
+	// mu guards closed, Send holds it while handing over an event.
+	// closing wakes blocked Sends so Close can take it.
+	mu          sync.RWMutex
+	closed      bool
+	closing     chan struct{}
+	closingOnce sync.Once
+	input       chan Event
+	// slots holds a token per buffered or in-flight event
+	slots chan struct{}
+	// requests holds a token per batch request in flight
+	requests chan struct{}
+	flushes  chan struct{}
+
+	// pending counts buffered and in-flight events, idle is closed when
+	// it drops to zero
+	pendingMu sync.Mutex
+	pending   int
+	idle      chan struct{}
+
+	// ctx bounds batch requests, cancel aborts them when Close gives up
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewProducer starts a producer publishing through c
+func (c *Client) NewProducer(config ProducerConfig) *Producer {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.Linger <= 0 {
+		config.Linger = 10 * time.Millisecond
+	}
+	if config.MaxBufferedEvents <= 0 {
+		config.MaxBufferedEvents = 10000
+	}
+	if config.MaxBufferedEvents < config.BatchSize {
+		config.MaxBufferedEvents = config.BatchSize
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 4
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Producer{
+		client:   c,
+		config:   config,
+		closing:  make(chan struct{}),
+		input:    make(chan Event),
+		slots:    make(chan struct{}, config.MaxBufferedEvents),
+		requests: make(chan struct{}, config.MaxInFlight),
+		flushes:  make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Send buffers an event for publishing, blocking while the buffer is full.
+// Its outcome is reported to OnDelivery.
+func (p *Producer) Send(ctx context.Context, event Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.closing:
+		return ErrProducerClosed
+	}
+	p.addPending(1)
+	var err error
+	select {
+	case p.input <- event:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-p.closing:
+		err = ErrProducerClosed
+	}
+	<-p.slots
+	p.addPending(-1)
+	return err
+}
+
+// Flush sends buffered events without waiting for Linger, and waits until
+// no event is buffered or in flight
+func (p *Producer) Flush(ctx context.Context) error {
+	select {
+	case p.flushes <- struct{}{}:
+	default:
+		// A flush is already requested
+	}
+	return p.waitIdle(ctx)
+}
+
+// Close flushes buffered events and stops the producer. Requests still in
+// flight when ctx ends are cancelled, and their events reported as failed.
+func (p *Producer) Close(ctx context.Context) error {
+	p.closingOnce.Do(func() { close(p.closing) })
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.input)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-p.done
+		return ctx.Err()
+	}
+}
+
+// run batches events from input until Close
+func (p *Producer) run() {
+	defer close(p.done)
+	defer p.cancel()
+
+	var inFlight sync.WaitGroup
+	batch := make([]Event, 0, p.config.BatchSize)
+	linger := p.client.clock.NewTimer(p.config.Linger)
+	stopTimer(linger)
+
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		stopTimer(linger)
+		p.requests <- struct{}{}
+		inFlight.Add(1)
+		go func(batch []Event) {
+			defer inFlight.Done()
+			defer func() { <-p.requests }()
+			p.deliver(batch)
+		}(batch)
+		batch = make([]Event, 0, p.config.BatchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-p.input:
+			if !ok {
+				send()
+				inFlight.Wait()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) == 1 {
+				linger.Reset(p.config.Linger)
+			}
+			if len(batch) >= p.config.BatchSize {
+				send()
+			}
+		case <-linger.C():
+			send()
+		case <-p.flushes:
+			send()
+		}
+	}
+}
+
+// stopTimer stops a timer and drains the tick it fired if it was too late,
+// so a later Reset does not leave the stale tick to be received
+func stopTimer(timer Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+}
+
+// deliver publishes a batch and reports the outcome of each event
+func (p *Producer) deliver(batch []Event) {
+	result, err := p.client.PublishBatch(p.ctx, batch)
+	for i, event := range batch {
+		delivery := DeliveryResult{Event: event, Err: err}
+		if err == nil {
+			if i < len(result.Results) {
+				item := result.Results[i]
+				delivery.Status = item.Status
+				if item.Status < 200 || item.Status >= 300 {
+					delivery.Err = &APIError{StatusCode: item.Status, Code: item.Code, Message: item.Message}
+				}
+			} else {
+				delivery.Err = errors.New("event processor: batch result is missing an event")
+			}
+		}
+		if p.config.OnDelivery != nil {
+			p.config.OnDelivery(delivery)
+		}
+	}
+	for range batch {
+		<-p.slots
+	}
+	p.addPending(-len(batch))
+}
+
+// addPending adjusts the count of undelivered events
+func (p *Producer) addPending(delta int) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if p.pending == 0 && delta > 0 {
+		p.idle = make(chan struct{})
+	}
+	p.pending += delta
+	if p.pending == 0 && delta < 0 {
+		close(p.idle)
+	}
+}
+
+// waitIdle waits until no event is pending
+func (p *Producer) waitIdle(ctx context.Context) error {
+	p.pendingMu.Lock()
+	pending, idle := p.pending, p.idle
+	p.pendingMu.Unlock()
+	if pending == 0 {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/clock"
+)
+
+// deliveries collects the results of a producer
+type deliveries struct {
+	mu      sync.Mutex
+	results []DeliveryResult
+}
+
+func (d *deliveries) add(r DeliveryResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(d.results, r)
+}
+
+func (d *deliveries) all() []DeliveryResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeliveryResult(nil), d.results...)
+}
+
+func TestProducer(t *testing.T) {
+	c, eventStore := newTestAPI(t)
+	ctx := context.Background()
+	var got deliveries
+	p := c.NewProducer(ProducerConfig{BatchSize: 10, Linger: time.Hour, OnDelivery: got.add})
+
+	for i := 0; i < 25; i++ {
+		if err := p.Send(ctx, Event{ID: fmt.Sprintf("event-%d", i)}); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+	// A duplicate is reported on its own, the rest of its batch is stored
+	if err := p.Send(ctx, Event{ID: "event-0"}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	// Two full batches go out without waiting for the linger time
+	deadline := time.Now().Add(time.Second)
+	for len(got.all()) < 20 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := len(got.all()); n != 20 {
+		t.Fatalf("Expected 20 deliveries before a flush, got %d", n)
+	}
+
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	results := got.all()
+	if len(results) != 26 || len(eventStore.GetAll()) != 25 {
+		t.Fatalf("Expected 26 deliveries and 25 stored events, got %d and %d", len(results), len(eventStore.GetAll()))
+	}
+	var apiErr *APIError
+	for _, r := range results {
+		duplicate := r.Event.ID == "event-0" && r.Status == http.StatusConflict
+		switch {
+		case duplicate && (!errors.As(r.Err, &apiErr) || apiErr.Code != "duplicate_event"):
+			t.Errorf("Expected a duplicate_event error, got %v", r.Err)
+		case !duplicate && (r.Err != nil || r.Status != http.StatusCreated):
+			t.Errorf("Expected %s to be stored, got %d (%v)", r.Event.ID, r.Status, r.Err)
+		}
+	}
+
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if err := p.Send(ctx, Event{ID: "late"}); err != ErrProducerClosed {
+		t.Errorf("Expected %v, got %v", ErrProducerClosed, err)
+	}
+}
+
+func TestProducerLingerAndClose(t *testing.T) {
+	c, eventStore := newTestAPI(t)
+	ctx := context.Background()
+	var got deliveries
+
+	p := c.NewProducer(ProducerConfig{BatchSize: 100, Linger: 20 * time.Millisecond, OnDelivery: got.add})
+	_ = p.Send(ctx, Event{ID: "lingered"})
+	deadline := time.Now().Add(time.Second)
+	for len(got.all()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(got.all()) != 1 {
+		t.Fatal("Expected a partial batch to be sent after the linger time")
+	}
+
+	// Close flushes what is buffered
+	p = c.NewProducer(ProducerConfig{BatchSize: 100, Linger: time.Hour, OnDelivery: got.add})
+	for i := 0; i < 3; i++ {
+		_ = p.Send(ctx, Event{ID: fmt.Sprintf("closed-%d", i)})
+	}
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if len(got.all()) != 4 || len(eventStore.GetAll()) != 4 {
+		t.Errorf("Expected 4 deliveries and stored events, got %d and %d", len(got.all()), len(eventStore.GetAll()))
+	}
+}
+
+// firingClock is a fake clock whose timers fire just before they are
+// stopped, as a linger timer can when its deadline races a full batch
+type firingClock struct {
+	*clock.Fake
+}
+
+func (c firingClock) NewTimer(d time.Duration) Timer {
+	return firingTimer{c.Fake.NewTimer(d)}
+}
+
+type firingTimer struct {
+	Timer
+}
+
+func (t firingTimer) Stop() bool {
+	t.Reset(0)
+	return t.Timer.Stop()
+}
+
+func TestProducerIgnoresLingerFiredByStoppedTimer(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Events []Event `json:"events"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sizes = append(sizes, len(body.Events))
+		mu.Unlock()
+		results := make([]ItemResult, len(body.Events))
+		for i := range results {
+			results[i].Status = http.StatusCreated
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BatchResult{Accepted: len(results), Results: results})
+	}))
+	defer ts.Close()
+
+	fake := clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	c, _ := New(ts.URL, WithRetry(fastRetry), WithClock(firingClock{fake}))
+	ctx := context.Background()
+	var got deliveries
+	p := c.NewProducer(ProducerConfig{BatchSize: 3, Linger: time.Second, OnDelivery: got.add})
+	defer p.Close(ctx)
+
+	waitDeliveries := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for len(got.all()) < n && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if err := p.Send(ctx, Event{ID: fmt.Sprintf("event-%d", i)}); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if i == 2 {
+			waitDeliveries(3)
+		}
+	}
+	// The partial batch waits for the linger, not the tick of the full one
+	deadline := time.Now().Add(time.Second)
+	for fake.Waiters() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	fake.Advance(time.Second)
+	waitDeliveries(5)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(sizes) != "[3 2]" {
+		t.Errorf("Expected a full batch of 3 then a lingered batch of 2, got %v", sizes)
+	}
+}
+
+func TestProducerBoundsBuffer(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"accepted":2,"rejected":0,"results":[{"id":"a","status":201},{"id":"b","status":201}]}`)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	c, _ := New(ts.URL, WithRetry(fastRetry))
+	var got deliveries
+	p := c.NewProducer(ProducerConfig{BatchSize: 2, MaxBufferedEvents: 2, MaxInFlight: 1, OnDelivery: got.add})
+	ctx := context.Background()
+	_ = p.Send(ctx, Event{ID: "a"})
+	_ = p.Send(ctx, Event{ID: "b"})
+
+	// The buffer is full until the stalled request completes
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := p.Send(short, Event{ID: "c"}); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v while the buffer is full, got %v", context.DeadlineExceeded, err)
+	}
+
+	// Close gives up on the stalled request when its context ends
+	short, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(short); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	results := got.all()
+	if len(results) != 2 || results[0].Err == nil || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Expected 2 failed deliveries from one request, got %+v", results)
+	}
+}
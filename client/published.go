@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLagged ends a published event subscription the server dropped for
+// falling behind
+var ErrLagged = errors.New("client: published event stream fell behind")
+
+// PublishedEvent is an event as published by a worker
+type PublishedEvent struct {
+	ID           string    `json:"id"`
+	Tenant       string    `json:"tenant,omitempty"`
+	OriginalTime int64     `json:"original_time"`
+	ProcessedAt  time.Time `json:"processed_at"`
+	Payload      string    `json:"payload"`
+	ProcessorID  string    `json:"processor_id"`
+}
+
+// PublishedSubscription follows the events workers publish. Published
+// events are not stored, so unlike Subscription it does not reconnect: a
+// dropped connection ends it, with Err telling why, and the events
+// published meanwhile are missed.
+type PublishedSubscription struct {
+	events chan PublishedEvent
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// SubscribePublished follows the events published from now on. buffer is
+// the capacity of the events channel.
+func (c *Client) SubscribePublished(ctx context.Context, buffer int) (*PublishedSubscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   c.eventsPath("/published/stream"),
+		header: http.Header{"Accept": {"text/event-stream"}},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &PublishedSubscription{
+		events: make(chan PublishedEvent, buffer),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go sub.run(ctx, resp.Body)
+	return sub, nil
+}
+
+// run delivers the events of the stream until it ends
+func (sub *PublishedSubscription) run(ctx context.Context, body io.ReadCloser) {
+	defer close(sub.done)
+	defer close(sub.events)
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	var name string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() == nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				sub.fail(err)
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if name == "lagged" {
+				sub.fail(ErrLagged)
+				return
+			}
+			if len(data) == 0 {
+				continue
+			}
+			var event PublishedEvent
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				sub.fail(err)
+				return
+			}
+			name, data = "", data[:0]
+			select {
+			case sub.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment, sent as a heartbeat
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				name = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+}
+
+// fail records the error that ended the subscription
+func (sub *PublishedSubscription) fail(err error) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.err = err
+}
+
+// Events returns the channel of published events. It is closed when the
+// subscription ends, after which Err explains why.
+func (sub *PublishedSubscription) Events() <-chan PublishedEvent {
+	return sub.events
+}
+
+// Err returns the error that ended the subscription, nil when it was
+// closed or its context ended
+func (sub *PublishedSubscription) Err() error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.err
+}
+
+// Close ends the subscription and waits for its connection to close
+func (sub *PublishedSubscription) Close() {
+	sub.cancel()
+	<-sub.done
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// StreamEvent is an event received from a subscription
+type StreamEvent struct {
+	Event
+	// Cursor resumes a later subscription after this event
+	Cursor string
+}
+
+// SubscribeOptions controls a subscription
+type SubscribeOptions struct {
+	// Cursor replays the events stored after it before following new ones,
+	// empty to receive only new events
+	Cursor string
+	// Group resumes after the consumer group's cursor when Cursor is
+	// empty, and commits each event received to the group
+	Group string
+	// Buffer is the capacity of the events channel
+	Buffer int
+}
+
+// Subscription follows events as they are published. It reconnects after
+// network failures or when the server drops it for falling behind,
+// resuming after the last event received, so no event is missed.
+type Subscription struct {
+	events chan StreamEvent
+	cancel context.CancelFunc
+	done   chan struct{}
+	group  string
+
+	mu     sync.Mutex
+	err    error
+	cursor string
+}
+
+// Subscribe opens a stream of events. Connection and authentication
+// errors of the first attempt are returned directly; later failures are
+// retried per the retry policy and end the subscription when exhausted.
+func (c *Client) Subscribe(ctx context.Context, opts SubscribeOptions) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	body, err := c.openStream(ctx, opts.Cursor, opts.Group)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	buffer := opts.Buffer
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &Subscription{
+		events: make(chan StreamEvent, buffer),
+		cancel: cancel,
+		done:   make(chan struct{}),
+		group:  opts.Group,
+		cursor: opts.Cursor,
+	}
+	go sub.run(ctx, c, body)
+	return sub, nil
+}
+
+// openStream connects to the stream, resuming after cursor, or after the
+// group's cursor without one
+func (c *Client) openStream(ctx context.Context, cursor, group string) (io.ReadCloser, error) {
+	header := http.Header{"Accept": {"text/event-stream"}}
+	query := url.Values{}
+	if group != "" {
+		query.Set("group", group)
+	}
+	if cursor != "" {
+		header.Set("Last-Event-ID", cursor)
+		// Also a query parameter, for proxies that drop the header
+		query.Set("cursor", cursor)
+	}
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   c.eventsPath("/stream"),
+		query:  query,
+		header: header,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// run reads the stream, reconnecting until the context ends or the
+// retries are exhausted
+func (sub *Subscription) run(ctx context.Context, c *Client, body io.ReadCloser) {
+	defer close(sub.done)
+	defer close(sub.events)
+
+	for failures := 0; ; {
+		received, err := sub.read(ctx, body)
+		body.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			failures = 0
+		}
+
+		// The stream ended, reconnect after the last event seen
+		for body = nil; body == nil; {
+			failures++
+			if failures >= c.retry.MaxAttempts {
+				sub.fail(err)
+				return
+			}
+			timer := c.clock.NewTimer(c.retry.backoff(failures))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			body, err = c.openStream(ctx, sub.Cursor(), sub.group)
+			if ctx.Err() != nil {
+				return
+			}
+			if apiErr, ok := err.(*APIError); ok && !apiErr.Retryable() {
+				sub.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// read delivers the events of one connection. It reports whether any
+// event was received, and the error that ended the stream.
+func (sub *Subscription) read(ctx context.Context, body io.Reader) (bool, error) {
+	reader := bufio.NewReader(body)
+	received := false
+	var id string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return received, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var event StreamEvent
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event.Event); err != nil {
+				return received, err
+			}
+			event.Cursor = id
+			data = data[:0]
+			select {
+			case sub.events <- event:
+			case <-ctx.Done():
+				return received, ctx.Err()
+			}
+			received = true
+			sub.mu.Lock()
+			sub.cursor = id
+			sub.mu.Unlock()
+		case strings.HasPrefix(line, ":"):
+			// Comment, sent as a heartbeat
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				id = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+}
+
+// fail records the error that ended the subscription
+func (sub *Subscription) fail(err error) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.err = err
+}
+
+// Events returns the channel of received events. It is closed when the
+// subscription ends, after which Err explains why.
+func (sub *Subscription) Events() <-chan StreamEvent {
+	return sub.events
+}
+
+// Cursor returns the cursor of the last event received
+func (sub *Subscription) Cursor() string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.cursor
+}
+
+// Err returns the error that ended the subscription, nil when it was
+// closed or its context ended
+func (sub *Subscription) Err() error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.err
+}
+
+// Close ends the subscription and waits for its connection to close
+func (sub *Subscription) Close() {
+	sub.cancel()
+	<-sub.done
+}
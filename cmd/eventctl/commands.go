@@ -0,0 +1,737 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coding_challenge/client"
+)
+
+// maxLineBytes bounds one NDJSON line read by publish
+const maxLineBytes = 4 << 20
+
+// runPublish publishes one event from its arguments, or NDJSON events from
+// -file, in batches
+func runPublish(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("publish", "[payload ...]")
+	id := fs.String("id", "", "Event ID, random when empty")
+	partitionKey := fs.String("partition-key", "", "Partition key ordering related events")
+	idempotencyKey := fs.String("idempotency-key", "", "Idempotency key of the request, random when empty")
+	file := fs.String("file", "", `NDJSON file of events to publish, "-" for stdin`)
+	batch := fs.Int("batch", 100, "Events per request when publishing from -file, 1 publishes them one by one")
+	delay := fs.Duration("delay", 0, "Hold the event back from processing for this long, rounded up to seconds")
+	deliverAt := fs.String("deliver-at", "", "Hold the event back from processing until this RFC 3339 time")
+	priority := fs.String("priority", "", "Processing lane: high, normal or low, also for -file events without one")
+	eventType := fs.String("type", "", "Event type used for routing")
+	attributes := attributeFlag{}
+	fs.Var(attributes, "attribute", "Attribute as key=value used for routing, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var callOpts []client.CallOption
+	if *idempotencyKey != "" {
+		callOpts = append(callOpts, client.IdempotencyKey(*idempotencyKey))
+	}
+
+	if *file == "" {
+		event := client.Event{ID: *id, Payload: strings.Join(fs.Args(), " "), PartitionKey: *partitionKey, Priority: *priority, Type: *eventType}
+		if len(attributes) > 0 {
+			event.Attributes = attributes
+		}
+		if event.ID == "" {
+			event.ID = uuid.NewString()
+		}
+		event.Delay = int64((*delay + time.Second - 1) / time.Second)
+		if *deliverAt != "" {
+			at, err := time.Parse(time.RFC3339, *deliverAt)
+			if err != nil {
+				return fmt.Errorf("invalid -deliver-at: %v", err)
+			}
+			event.DeliverAt = at.Unix()
+		}
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		result, err := c.client.Publish(ctx, event, callOpts...)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return writeJSON(c.out, result)
+		}
+		fmt.Fprintln(c.out, result.ID)
+		return nil
+	}
+
+	var in io.Reader = c.in
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	if *batch < 1 {
+		*batch = 1
+	}
+	return c.publishStream(ctx, in, *batch, *priority, callOpts)
+}
+
+// attributeFlag collects repeated -attribute key=value flags
+type attributeFlag map[string]string
+
+func (f attributeFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f attributeFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	f[key] = value
+	return nil
+}
+
+// publishStream publishes the NDJSON events of in, batch at a time, with
+// priority unless they set their own
+func (c *cli) publishStream(ctx context.Context, in io.Reader, batch int, priority string, callOpts []client.CallOption) error {
+	summary := client.BatchResult{}
+	pending := make([]client.Event, 0, batch)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		var result *client.BatchResult
+		if len(pending) == 1 && batch == 1 {
+			// Single events keep the per-event error of the publish route
+			_, err := c.client.Publish(ctx, pending[0], callOpts...)
+			result = &client.BatchResult{Accepted: 1, Results: []client.ItemResult{{ID: pending[0].ID, Status: 201}}}
+			if apiErr, ok := err.(*client.APIError); ok && !apiErr.Retryable() {
+				result = &client.BatchResult{Rejected: 1, Results: []client.ItemResult{{
+					ID: pending[0].ID, Status: apiErr.StatusCode, Code: apiErr.Code, Message: apiErr.Message,
+				}}}
+			} else if err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if result, err = c.client.PublishBatch(ctx, pending, callOpts...); err != nil {
+				return err
+			}
+		}
+		summary.Accepted += result.Accepted
+		summary.Rejected += result.Rejected
+		for _, item := range result.Results {
+			if item.Code != "" {
+				summary.Results = append(summary.Results, item)
+			}
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), maxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var event client.Event
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if event.ID == "" {
+			event.ID = uuid.NewString()
+		}
+		if event.Priority == "" {
+			event.Priority = priority
+		}
+		pending = append(pending, event)
+		if len(pending) == batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if summary.Results == nil {
+		summary.Results = []client.ItemResult{}
+	}
+	if c.json {
+		if err := writeJSON(c.out, summary); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(c.out, "accepted %d, rejected %d\n", summary.Accepted, summary.Rejected)
+		if len(summary.Results) > 0 {
+			tw := newTable(c.out, "ID", "STATUS", "CODE", "MESSAGE")
+			for _, item := range summary.Results {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", item.ID, item.Status, item.Code, item.Message)
+			}
+			tw.Flush()
+		}
+	}
+	if summary.Rejected > 0 {
+		return fmt.Errorf("%d events rejected", summary.Rejected)
+	}
+	return nil
+}
+
+// runGet shows one event
+func runGet(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("get", "<id>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	event, err := c.client.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, event)
+	}
+	return c.writeEvents([]client.Event{*event})
+}
+
+// runList shows a page of events, or every event with -all
+func runList(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("list", "")
+	limit := fs.Int("limit", client.DefaultPageSize, "Events per page")
+	cursor := fs.String("cursor", "", "Cursor of the page to show, from a previous list")
+	all := fs.Bool("all", false, "List every event, fetching all pages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if *all {
+		events := []client.Event{}
+		it := c.client.Events(ctx, *limit)
+		for it.Next() {
+			events = append(events, it.Event())
+		}
+		if it.Err() != nil {
+			return it.Err()
+		}
+		return c.writeEvents(events)
+	}
+
+	page, err := c.client.List(ctx, client.ListOptions{Limit: *limit, Cursor: *cursor})
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, struct {
+			Events     []client.Event `json:"events"`
+			NextCursor string         `json:"next_cursor,omitempty"`
+		}{page.Events, page.NextCursor})
+	}
+	if err := c.writeEvents(page.Events); err != nil {
+		return err
+	}
+	if page.NextCursor != "" {
+		fmt.Fprintf(c.out, "\nmore: eventctl list -limit %d -cursor %s\n", *limit, page.NextCursor)
+	}
+	return nil
+}
+
+// runScheduled lists the events waiting for their delivery time, or
+// cancels one
+func runScheduled(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("scheduled", "[list | cancel <id>]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	switch fs.Arg(0) {
+	case "", "list":
+		events, err := c.client.Scheduled(ctx)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return writeJSON(c.out, events)
+		}
+		tw := newTable(c.out, "ID", "DELIVER AT", "PARTITION KEY", "PAYLOAD")
+		for _, e := range events {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.ID, formatTimestamp(e.DeliverAt), e.PartitionKey, truncate(e.Payload, 60))
+		}
+		return tw.Flush()
+	case "cancel":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return errUsage
+		}
+		event, err := c.client.CancelScheduled(ctx, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return writeJSON(c.out, event)
+		}
+		fmt.Fprintln(c.out, event.ID)
+		return nil
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
+
+// runTail shows the latest events and, with -f, follows the stream
+func runTail(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("tail", "")
+	n := fs.Int("n", 10, "Number of stored events to show first")
+	follow := fs.Bool("f", false, "Follow new events until interrupted")
+	group := fs.String("group", "", "Follow the events after this consumer group's cursor, committing them to it; implies -f, -n is ignored")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Subscribe before listing so nothing stored in between is missed
+	var sub *client.Subscription
+	if *follow || *group != "" {
+		var err error
+		if sub, err = c.client.Subscribe(ctx, client.SubscribeOptions{Group: *group, Buffer: 64}); err != nil {
+			return err
+		}
+		defer sub.Close()
+	}
+
+	shown := make(map[string]bool)
+	if *n > 0 && *group == "" {
+		listCtx, cancel := c.withTimeout(ctx)
+		latest := make([]client.Event, 0, *n)
+		it := c.client.Events(listCtx, 1000)
+		for it.Next() {
+			if len(latest) == *n {
+				latest = latest[1:]
+			}
+			latest = append(latest, it.Event())
+		}
+		cancel()
+		if it.Err() != nil {
+			return it.Err()
+		}
+		for _, event := range latest {
+			shown[event.ID] = true
+			c.writeEventLine(event)
+		}
+	}
+	if sub == nil {
+		return nil
+	}
+
+	for event := range sub.Events() {
+		if shown[event.ID] {
+			delete(shown, event.ID)
+			continue
+		}
+		c.writeEventLine(event.Event)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return sub.Err()
+}
+
+// runHealth runs a probe, failing when it is down
+func runHealth(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("health", "")
+	probe := fs.String("probe", "health", "Probe to run: health, livez or readyz")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch client.Probe(*probe) {
+	case client.ProbeHealth, client.ProbeLiveness, client.ProbeReadiness:
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	report, err := c.client.Health(ctx, client.Probe(*probe))
+	if err != nil {
+		return err
+	}
+	if c.json {
+		err = writeJSON(c.out, report)
+	} else {
+		fmt.Fprintf(c.out, "status: %s\nstate:  %s\n\n", report.Status, report.State)
+		tw := newTable(c.out, "COMPONENT", "STATUS", "MESSAGE")
+		for _, name := range sortedKeys(report.Components) {
+			result := report.Components[name]
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, result.Status, result.Message)
+		}
+		err = tw.Flush()
+	}
+	if err == nil && report.Status == "down" {
+		err = fmt.Errorf("%s probe is down", *probe)
+	}
+	return err
+}
+
+// runMetrics prints the metrics, optionally only those containing -grep
+func runMetrics(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("metrics", "")
+	grep := fs.String("grep", "", "Only show lines containing this text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	text, err := c.client.Metrics(ctx)
+	if err != nil {
+		return err
+	}
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" || !strings.Contains(line, *grep) {
+			continue
+		}
+		if !c.json {
+			fmt.Fprintln(c.out, line)
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.LastIndexByte(line, ' '); i > 0 {
+			if value, err := strconv.ParseFloat(line[i+1:], 64); err == nil {
+				samples[line[:i]] = value
+			}
+		}
+	}
+	if c.json {
+		return writeJSON(c.out, samples)
+	}
+	return nil
+}
+
+// runPool shows or changes the worker pool
+func runPool(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("pool", "[status | pin <size> | unpin | pause | resume | drain]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var status *client.PoolStatus
+	var err error
+	switch action := fs.Arg(0); action {
+	case "", "status":
+		status, err = c.client.Pool(ctx)
+	case "pin":
+		size, convErr := strconv.Atoi(fs.Arg(1))
+		if convErr != nil {
+			fs.Usage()
+			return errUsage
+		}
+		status, err = c.client.PinPoolSize(ctx, size)
+	case "unpin":
+		status, err = c.client.UnpinPoolSize(ctx)
+	case "pause":
+		status, err = c.client.PausePool(ctx)
+	case "resume":
+		status, err = c.client.ResumePool(ctx)
+	case "drain":
+		status, err = c.client.DrainPool(ctx)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, status)
+	}
+
+	fmt.Fprintf(c.out, "state:   %s\nsize:    %d (min %d, max %d, pinned %t)\npending: %d\nlatency: %s\n",
+		status.State, status.Size, status.MinWorkers, status.MaxWorkers, status.Pinned, status.Pending, status.Latency)
+	if len(status.Decisions) > 0 {
+		fmt.Fprintln(c.out)
+		tw := newTable(c.out, "TIME", "FROM", "TO", "REASON")
+		for _, d := range status.Decisions {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", d.Time.Format(time.RFC3339), d.From, d.To, d.Reason)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+// runWorkers shows every worker
+func runWorkers(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("workers", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	workers, err := c.client.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, workers)
+	}
+	tw := newTable(c.out, "ID", "STATE", "PROCESSED", "CURRENT EVENT", "LAST ERROR")
+	for _, w := range workers {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", w.ID, w.State, w.Processed, w.CurrentEvent, truncate(w.LastError, 60))
+	}
+	return tw.Flush()
+}
+
+// runPipelines shows the pool of every pipeline
+func runPipelines(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("pipelines", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	statuses, err := c.client.Pipelines(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, statuses)
+	}
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := newTable(c.out, "PIPELINE", "STATE", "SIZE", "PINNED", "PENDING", "LATENCY")
+	for _, name := range names {
+		s := statuses[name]
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%t\t%d\t%s\n", name, s.State, s.Size, s.Pinned, s.Pending, s.Latency)
+	}
+	return tw.Flush()
+}
+
+// runDLQ inspects, redrives and discards the dead letters, those of the
+// -pipeline pipeline when set
+func runDLQ(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("dlq", "[list | show <id> | redrive <id> | redrive all | discard <id>]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	action := fs.Arg(0)
+	switch action {
+	case "", "list":
+		letters, err := c.client.DeadLetters(ctx, c.pipeline)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return writeJSON(c.out, letters)
+		}
+		tw := newTable(c.out, "ID", "PIPELINE", "EVENT", "ATTEMPTS", "FAILED AT", "ERROR")
+		for _, l := range letters {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", l.ID, l.Pipeline, l.Event.ID, l.Attempts, l.FailedAt.Format(time.RFC3339), truncate(l.Error, 60))
+		}
+		return tw.Flush()
+	case "redrive":
+		if fs.Arg(1) != "all" {
+			break
+		}
+		result, err := c.client.RedriveDeadLetters(ctx, c.pipeline)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return writeJSON(c.out, result)
+		}
+		fmt.Fprintf(c.out, "redriven:  %d\nremaining: %d\n", result.Redriven, result.Remaining)
+		return nil
+	case "show", "discard":
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	id, convErr := strconv.ParseUint(fs.Arg(1), 10, 64)
+	if convErr != nil || fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+	var letter *client.DeadLetter
+	var err error
+	switch action {
+	case "show":
+		letter, err = c.client.DeadLetter(ctx, id)
+	case "redrive":
+		letter, err = c.client.RedriveDeadLetter(ctx, id)
+	case "discard":
+		letter, err = c.client.DiscardDeadLetter(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, letter)
+	}
+	fmt.Fprintf(c.out, "id:        %d\npipeline:  %s\nevent:     %s\nattempts:  %d\nfailed at: %s\nerror:     %s\n",
+		letter.ID, letter.Pipeline, letter.Event.ID, letter.Attempts, letter.FailedAt.Format(time.RFC3339), letter.Error)
+	return nil
+}
+
+// runGroups creates, moves and deletes consumer groups
+func runGroups(ctx context.Context, c *cli, args []string) error {
+	fs := c.flags("groups", "[list | show <name> | create <name> [earliest | latest | <cursor>] | seek <name> <earliest | latest | cursor> | delete <name>]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	action, name := fs.Arg(0), fs.Arg(1)
+	if action == "" || action == "list" {
+		groups, err := c.client.Groups(ctx)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return writeJSON(c.out, groups)
+		}
+		tw := newTable(c.out, "NAME", "CURSOR", "LAG", "UPDATED AT")
+		for _, g := range groups {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", g.Name, g.Cursor, g.Lag, g.UpdatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	}
+
+	var group *client.ConsumerGroup
+	var err error
+	switch {
+	case name == "":
+		fs.Usage()
+		return errUsage
+	case action == "show" && fs.NArg() == 2:
+		group, err = c.client.Group(ctx, name)
+	case action == "delete" && fs.NArg() == 2:
+		group, err = c.client.DeleteGroup(ctx, name)
+	case action == "create" && fs.NArg() <= 3:
+		position, ok := groupPosition(fs.Arg(2))
+		if !ok {
+			fs.Usage()
+			return errUsage
+		}
+		group, err = c.client.CreateGroup(ctx, name, position)
+	case action == "seek" && fs.NArg() == 3:
+		position, ok := groupPosition(fs.Arg(2))
+		if !ok {
+			fs.Usage()
+			return errUsage
+		}
+		group, err = c.client.SeekGroup(ctx, name, position)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return writeJSON(c.out, group)
+	}
+	fmt.Fprintf(c.out, "name:   %s\ncursor: %d\nlag:    %d\n", group.Name, group.Cursor, group.Lag)
+	return nil
+}
+
+// groupPosition parses earliest, latest or a cursor; empty is earliest
+func groupPosition(arg string) (client.GroupPosition, bool) {
+	switch arg {
+	case "", "earliest":
+		return client.GroupPosition{}, true
+	case "latest":
+		return client.GroupPosition{Latest: true}, true
+	}
+	cursor, err := strconv.ParseUint(arg, 10, 64)
+	return client.GroupPosition{Cursor: cursor}, err == nil
+}
+
+// writeEvents prints events as a table or a JSON array
+func (c *cli) writeEvents(events []client.Event) error {
+	if c.json {
+		return writeJSON(c.out, events)
+	}
+	tw := newTable(c.out, "ID", "TIMESTAMP", "PARTITION KEY", "PAYLOAD")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.ID, formatTimestamp(e.Timestamp), e.PartitionKey, truncate(e.Payload, 60))
+	}
+	return tw.Flush()
+}
+
+// writeEventLine prints one event of a stream, as NDJSON in JSON mode
+func (c *cli) writeEventLine(e client.Event) {
+	if c.json {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(c.out, "%s\n", data)
+		return
+	}
+	fmt.Fprintf(c.out, "%s  %s  %s\n", formatTimestamp(e.Timestamp), e.ID, truncate(e.Payload, 100))
+}
+
+func newTable(w io.Writer, columns ...string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	return tw
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatTimestamp(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
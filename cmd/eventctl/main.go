@@ -0,0 +1,226 @@
+// Command eventctl operates an event processor: it publishes and reads
+// events, follows the event stream, manages consumer groups and dead
+// letters, and checks health, metrics and the worker pool.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"coding_challenge/client"
+)
+
+const usage = `Usage: eventctl [flags] <command> [command flags] [args]
+
+Commands:
+  publish   Publish an event from arguments, or NDJSON events from a file or stdin
+  get       Show an event by ID
+  list      List events, one page or all of them
+  tail      Show the latest events, and follow new ones with -f
+  scheduled List events waiting for their delivery time, or cancel one
+  health    Run a health probe
+  metrics   Print Prometheus metrics
+  pool      Show or control the worker pool: status, pin N, unpin, pause, resume, drain
+  workers   Show every worker
+  pipelines Show the worker pool of every pipeline
+  dlq       Inspect dead letters: list, show ID, redrive ID, redrive all, discard ID
+  groups    Manage consumer groups: list, show, create, seek, delete
+
+Run "eventctl <command> -h" for the flags of a command.
+
+Flags:
+`
+
+// errUsage reports invalid arguments, exiting with status 2
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli holds what every command needs
+type cli struct {
+	client  *client.Client
+	in      io.Reader
+	out     io.Writer
+	errOut  io.Writer
+	json    bool
+	timeout time.Duration
+	// pipeline is -pipeline, filtering the dlq command
+	pipeline string
+}
+
+// command runs a subcommand with its arguments
+type command func(ctx context.Context, c *cli, args []string) error
+
+var commands = map[string]command{
+	"publish":   runPublish,
+	"get":       runGet,
+	"list":      runList,
+	"tail":      runTail,
+	"scheduled": runScheduled,
+	"health":    runHealth,
+	"metrics":   runMetrics,
+	"pool":      runPool,
+	"workers":   runWorkers,
+	"pipelines": runPipelines,
+	"dlq":       runDLQ,
+	"groups":    runGroups,
+}
+
+// run executes eventctl and returns its exit status
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("eventctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	server := fs.String("server", envOr("EVENTCTL_SERVER", "http://localhost:8081"), "API base URL ($EVENTCTL_SERVER)")
+	apiKey := fs.String("api-key", os.Getenv("EVENTCTL_API_KEY"), "API key ($EVENTCTL_API_KEY)")
+	token := fs.String("token", os.Getenv("EVENTCTL_TOKEN"), "Bearer JWT ($EVENTCTL_TOKEN)")
+	tenant := fs.String("tenant", os.Getenv("EVENTCTL_TENANT"), "Tenant namespace of event and consumer group commands ($EVENTCTL_TENANT)")
+	pipeline := fs.String("pipeline", os.Getenv("EVENTCTL_PIPELINE"), "Pipeline of the pool and workers commands, the default one when empty, and of the dlq command, every one when empty ($EVENTCTL_PIPELINE)")
+	output := fs.String("output", "table", "Output format: table or json")
+	timeout := fs.Duration("timeout", 30*time.Second, "Timeout of each request, streams excepted")
+	caCert := fs.String("ca-cert", "", "PEM file of the CA that signed the server certificate")
+	cert := fs.String("cert", "", "PEM client certificate for mutual TLS")
+	key := fs.String("key", "", "PEM key of -cert")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintln(stderr, "eventctl: -output must be table or json")
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return 2
+	}
+
+	opts := []client.Option{client.WithUserAgent("eventctl")}
+	if *apiKey != "" {
+		opts = append(opts, client.WithAPIKey(*apiKey))
+	}
+	if *token != "" {
+		opts = append(opts, client.WithBearerToken(*token))
+	}
+	if *tenant != "" {
+		opts = append(opts, client.WithTenant(*tenant))
+	}
+	if *pipeline != "" {
+		opts = append(opts, client.WithPipeline(*pipeline))
+	}
+	if *caCert != "" || *cert != "" {
+		transport, err := tlsTransport(*caCert, *cert, *key)
+		if err != nil {
+			fmt.Fprintf(stderr, "eventctl: %v\n", err)
+			return 1
+		}
+		opts = append(opts, client.WithTransport(transport))
+	}
+	apiClient, err := client.New(*server, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "eventctl: %v\n", err)
+		return 2
+	}
+
+	c := &cli{client: apiClient, in: stdin, out: stdout, errOut: stderr, json: *output == "json", timeout: *timeout, pipeline: *pipeline}
+	if err := cmd(ctx, c, fs.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		if errors.Is(err, context.Canceled) {
+			return 130
+		}
+		fmt.Fprintf(stderr, "eventctl: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// withTimeout bounds a request-response command
+func (c *cli) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// flags creates the flag set of a subcommand
+func (c *cli) flags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: eventctl %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// tlsTransport trusts caFile and presents certFile when set
+func tlsTransport(caFile, certFile, keyFile string) (http.RoundTripper, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return transport, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// sortedKeys returns the keys of a map in order, for stable tables
+func sortedKeys(m map[string]client.HealthResult) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// truncate shortens s to n runes for table cells
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
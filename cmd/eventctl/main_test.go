@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coding_challenge/app/api"
+	"coding_challenge/app/health"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// newTestServer serves the real API with the pools of a default and an
+// audit pipeline, a dead letter in each, health and metrics
+func newTestServer(t *testing.T) (string, *models.EventStore) {
+	t.Helper()
+	eventStore := models.NewEventStore(100)
+	logger := log.New(io.Discard, "", 0)
+	registry := metrics.NewRegistry()
+	pool := processor.NewPool(eventStore, processor.PoolConfig{
+		Workers: 2, MinWorkers: 1, MaxWorkers: 4, Partitions: 4, MaxPending: 10,
+	}, registry, logger)
+	audit := processor.NewPool(eventStore, processor.PoolConfig{
+		Workers: 1, MinWorkers: 1, MaxWorkers: 4, Partitions: 4, MaxPending: 10,
+	}, metrics.NewRegistry(), logger)
+	deadLetters := processor.NewDeadLetters(10, nil, metrics.NewRegistry())
+	deadLetters.Add("default", &models.Event{ID: "failed-order"}, errors.New("sink unavailable"))
+	deadLetters.Add("audit", &models.Event{ID: "failed-login"}, errors.New("sink unavailable"))
+	healthRegistry := health.NewRegistry()
+	healthRegistry.SetState(health.StateReady)
+	server := api.NewServer(":0", eventStore, logger,
+		api.WithPool(pool), api.WithPipelines(map[string]*processor.Pool{"default": pool, "audit": audit}), api.WithHealth(healthRegistry), api.WithMetrics(registry),
+		api.WithDeadLetters(deadLetters),
+		api.WithIdempotency(api.NewIdempotency(time.Minute, 100, metrics.NewRegistry())))
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Stop(ctx)
+		ts.Close()
+	})
+	return ts.URL, eventStore
+}
+
+// runCLI runs eventctl against url and returns its status and output
+func runCLI(t *testing.T, url, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-server", url}, args...)
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestPublishAndRead(t *testing.T) {
+	url, eventStore := newTestServer(t)
+
+	code, out, errOut := runCLI(t, url, "", "publish", "-id", "first", "hello", "world")
+	if code != 0 || strings.TrimSpace(out) != "first" {
+		t.Fatalf("Expected publish to print the ID, got %d %q %q", code, out, errOut)
+	}
+	if event, err := eventStore.Get("first"); err != nil || event.Payload != "hello world" {
+		t.Fatalf("Expected the event to be stored with its payload, got %+v (%v)", event, err)
+	}
+
+	ndjson := `{"id":"second","payload":"a"}` + "\n\n" + `{"id":"third","payload":"b"}` + "\n" + `{"id":"first"}` + "\n"
+	code, out, _ = runCLI(t, url, ndjson, "publish", "-file", "-", "-batch", "2")
+	if code != 1 || !strings.Contains(out, "accepted 2, rejected 1") || !strings.Contains(out, "duplicate_event") {
+		t.Errorf("Expected one duplicate to be reported, got %d %q", code, out)
+	}
+
+	code, out, _ = runCLI(t, url, "", "-output", "json", "get", "second")
+	var event map[string]interface{}
+	if code != 0 || json.Unmarshal([]byte(out), &event) != nil || event["payload"] != "a" {
+		t.Errorf("Expected the event as JSON, got %d %q", code, out)
+	}
+	if code, _, errOut = runCLI(t, url, "", "get", "missing"); code != 1 || !strings.Contains(errOut, "404") {
+		t.Errorf("Expected a 404 error, got %d %q", code, errOut)
+	}
+
+	code, out, _ = runCLI(t, url, "", "list", "-limit", "2")
+	if code != 0 || !strings.Contains(out, "PAYLOAD") || !strings.Contains(out, "hello world") ||
+		!strings.Contains(out, "-cursor 2") || strings.Contains(out, "third") {
+		t.Errorf("Expected the first page as a table with a cursor, got %q", out)
+	}
+	var events []map[string]interface{}
+	code, out, _ = runCLI(t, url, "", "-output", "json", "list", "-all", "-limit", "1")
+	if code != 0 || json.Unmarshal([]byte(out), &events) != nil || len(events) != 3 {
+		t.Errorf("Expected all 3 events as JSON, got %q", out)
+	}
+
+	code, out, _ = runCLI(t, url, "", "tail", "-n", "2")
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); code != 0 || len(lines) != 2 || !strings.Contains(lines[1], "third") {
+		t.Errorf("Expected the last 2 events, got %q", out)
+	}
+}
+
+func TestScheduled(t *testing.T) {
+	url, eventStore := newTestServer(t)
+
+	if code, _, errOut := runCLI(t, url, "", "publish", "-id", "later", "-delay", "90m", "x"); code != 0 {
+		t.Fatalf("Expected publish to succeed, got %d %q", code, errOut)
+	}
+	if code, _, errOut := runCLI(t, url, "", "publish", "-id", "planned", "-deliver-at", "2100-01-01T00:00:00Z", "y"); code != 0 {
+		t.Fatalf("Expected publish to succeed, got %d %q", code, errOut)
+	}
+	if code, _, _ := runCLI(t, url, "", "publish", "-id", "bad", "-deliver-at", "tomorrow"); code != 1 {
+		t.Errorf("Expected an invalid -deliver-at to fail, got %d", code)
+	}
+
+	code, out, _ := runCLI(t, url, "", "scheduled")
+	if code != 0 || !strings.Contains(out, "DELIVER AT") || !strings.Contains(out, "2100-01-01T00:00:00Z") ||
+		strings.Index(out, "later") > strings.Index(out, "planned") {
+		t.Errorf("Expected both events soonest first, got %q", out)
+	}
+	if code, out, _ = runCLI(t, url, "", "scheduled", "cancel", "later"); code != 0 || strings.TrimSpace(out) != "later" {
+		t.Errorf("Expected the event canceled, got %d %q", code, out)
+	}
+	if eventStore.ScheduledLen() != 1 {
+		t.Errorf("Expected 1 event left scheduled, got %d", eventStore.ScheduledLen())
+	}
+	if code, _, _ = runCLI(t, url, "", "scheduled", "cancel"); code != 2 {
+		t.Errorf("Expected a usage error, got %d", code)
+	}
+}
+
+// lineWriter hands every write to the test
+type lineWriter struct {
+	data chan string
+}
+
+func (b *lineWriter) Write(p []byte) (int, error) {
+	b.data <- string(p)
+	return len(p), nil
+}
+
+func TestTailFollows(t *testing.T) {
+	url, eventStore := newTestServer(t)
+	_ = eventStore.Add(&models.Event{ID: "stored"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &lineWriter{data: make(chan string, 10)}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-server", url, "-output", "json", "tail", "-f"}, nil, out, io.Discard)
+	}()
+
+	for _, want := range []string{"stored", "live"} {
+		select {
+		case line := <-out.data:
+			if !strings.Contains(line, `"id":"`+want+`"`) {
+				t.Errorf("Expected %q, got %q", want, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %q", want)
+		}
+		if want == "stored" {
+			_ = eventStore.Add(&models.Event{ID: "live"})
+		}
+	}
+
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("Expected tail to exit cleanly when interrupted, got %d", code)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	url, _ := newTestServer(t)
+
+	code, out, _ := runCLI(t, url, "", "health", "-probe", "readyz")
+	if code != 0 || !strings.Contains(out, "state:  ready") {
+		t.Errorf("Expected a ready report, got %d %q", code, out)
+	}
+
+	code, out, _ = runCLI(t, url, "", "-output", "json", "pool", "pin", "3")
+	var status map[string]interface{}
+	if code != 0 || json.Unmarshal([]byte(out), &status) != nil || status["pinned"] != true || status["size"] != 3.0 {
+		t.Errorf("Expected a pinned pool of 3, got %d %q", code, out)
+	}
+	code, out, _ = runCLI(t, url, "", "pool")
+	if code != 0 || !strings.Contains(out, "pinned true") {
+		t.Errorf("Expected the pool status, got %q", out)
+	}
+
+	code, out, _ = runCLI(t, url, "", "workers")
+	if code != 0 || !strings.HasPrefix(out, "ID") || strings.Count(out, "\n") != 4 {
+		t.Errorf("Expected a table of 3 workers, got %q", out)
+	}
+
+	code, out, _ = runCLI(t, url, "", "-pipeline", "audit", "pool", "pause")
+	if code != 0 || !strings.Contains(out, "state:   paused") || !strings.Contains(out, "size:    1") {
+		t.Errorf("Expected the audit pool paused, got %d %q", code, out)
+	}
+	code, out, _ = runCLI(t, url, "", "pipelines")
+	if code != 0 || !strings.Contains(out, "audit     paused") || !strings.Contains(out, "default   running") {
+		t.Errorf("Expected only the audit pipeline paused, got %q", out)
+	}
+	if code, _, _ = runCLI(t, url, "", "-pipeline", "missing", "workers"); code != 1 {
+		t.Errorf("Expected an unknown pipeline to fail, got %d", code)
+	}
+
+	code, out, _ = runCLI(t, url, "", "metrics", "-grep", "pool")
+	if code != 0 || out == "" || strings.Contains(out, "http_requests") {
+		t.Errorf("Expected only pool metrics, got %q", out)
+	}
+
+	if code, _, _ = runCLI(t, url, "", "pool", "pin", "many"); code != 2 {
+		t.Errorf("Expected a usage error, got %d", code)
+	}
+	if code, _, _ = runCLI(t, url, "", "bogus"); code != 2 {
+		t.Errorf("Expected an unknown command to be a usage error, got %d", code)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	url, _ := newTestServer(t)
+
+	code, out, _ := runCLI(t, url, "", "dlq")
+	if code != 0 || !strings.Contains(out, "ATTEMPTS") || !strings.Contains(out, "failed-order") || !strings.Contains(out, "failed-login") {
+		t.Errorf("Expected both dead letters, got %d %q", code, out)
+	}
+	code, out, _ = runCLI(t, url, "", "-pipeline", "audit", "dlq", "list")
+	if code != 0 || strings.Contains(out, "failed-order") || !strings.Contains(out, "failed-login") {
+		t.Errorf("Expected only the audit dead letter, got %q", out)
+	}
+	code, out, _ = runCLI(t, url, "", "dlq", "show", "1")
+	if code != 0 || !strings.Contains(out, "event:     failed-order") || !strings.Contains(out, "error:     sink unavailable") {
+		t.Errorf("Expected the dead letter, got %d %q", code, out)
+	}
+
+	if code, _, _ = runCLI(t, url, "", "dlq", "redrive", "1"); code != 0 {
+		t.Errorf("Expected the redrive to succeed, got %d", code)
+	}
+	if code, _, errOut := runCLI(t, url, "", "dlq", "discard", "1"); code != 1 || !strings.Contains(errOut, "404") {
+		t.Errorf("Expected a redriven dead letter to be gone, got %d %q", code, errOut)
+	}
+	var result map[string]int
+	code, out, _ = runCLI(t, url, "", "-output", "json", "dlq", "redrive", "all")
+	if code != 0 || json.Unmarshal([]byte(out), &result) != nil || result["redriven"] != 1 || result["remaining"] != 0 {
+		t.Errorf("Expected the last dead letter redriven, got %d %q", code, out)
+	}
+
+	if code, _, _ = runCLI(t, url, "", "dlq", "show", "first"); code != 2 {
+		t.Errorf("Expected a usage error, got %d", code)
+	}
+}
+
+func TestConsumerGroups(t *testing.T) {
+	url, eventStore := newTestServer(t)
+	for _, id := range []string{"first", "second"} {
+		_ = eventStore.Add(&models.Event{ID: id})
+	}
+
+	code, out, _ := runCLI(t, url, "", "groups", "create", "billing", "1")
+	if code != 0 || !strings.Contains(out, "cursor: 1") || !strings.Contains(out, "lag:    1") {
+		t.Errorf("Expected billing after the first event, got %d %q", code, out)
+	}
+	if code, _, errOut := runCLI(t, url, "", "groups", "create", "billing"); code != 1 || !strings.Contains(errOut, "409") {
+		t.Errorf("Expected an existing group to be rejected, got %d %q", code, errOut)
+	}
+	if code, _, _ = runCLI(t, url, "", "groups", "create", "audit", "latest"); code != 0 {
+		t.Errorf("Expected the group created, got %d", code)
+	}
+	code, out, _ = runCLI(t, url, "", "groups")
+	if code != 0 || !strings.Contains(out, "LAG") || strings.Index(out, "audit") > strings.Index(out, "billing") {
+		t.Errorf("Expected both groups by name, got %q", out)
+	}
+
+	// tail -group resumes after the group and commits what it shows
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := &lineWriter{data: make(chan string, 10)}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-server", url, "-output", "json", "tail", "-group", "billing"}, nil, lines, io.Discard)
+	}()
+	select {
+	case line := <-lines.data:
+		if !strings.Contains(line, `"id":"second"`) {
+			t.Errorf("Expected second, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for second")
+	}
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("Expected tail to exit cleanly when interrupted, got %d", code)
+	}
+	if group, err := eventStore.Group(models.DefaultTenant, "billing"); err != nil || group.Cursor != 2 {
+		t.Errorf("Expected billing committed to 2, got %+v (%v)", group, err)
+	}
+
+	code, out, _ = runCLI(t, url, "", "-output", "json", "groups", "seek", "billing", "earliest")
+	var group map[string]interface{}
+	if code != 0 || json.Unmarshal([]byte(out), &group) != nil || group["cursor"] != 0.0 || group["lag"] != 2.0 {
+		t.Errorf("Expected billing moved to the start, got %d %q", code, out)
+	}
+	if code, _, _ = runCLI(t, url, "", "groups", "delete", "billing"); code != 0 {
+		t.Errorf("Expected the group deleted, got %d", code)
+	}
+	if code, _, errOut := runCLI(t, url, "", "groups", "show", "billing"); code != 1 || !strings.Contains(errOut, "404") {
+		t.Errorf("Expected a deleted group to be missing, got %d %q", code, errOut)
+	}
+	if code, _, _ = runCLI(t, url, "", "groups", "seek", "audit"); code != 2 {
+		t.Errorf("Expected a usage error, got %d", code)
+	}
+}
+
+func TestPublishPriority(t *testing.T) {
+	url, eventStore := newTestServer(t)
+
+	if code, _, errOut := runCLI(t, url, "", "publish", "-id", "urgent", "-priority", "high", "x"); code != 0 {
+		t.Fatalf("Expected publish to succeed, got %d %q", code, errOut)
+	}
+	ndjson := `{"id":"backfill"}` + "\n" + `{"id":"kept","priority":"normal"}` + "\n"
+	if code, out, _ := runCLI(t, url, ndjson, "publish", "-file", "-", "-priority", "low"); code != 0 {
+		t.Fatalf("Expected publish to succeed, got %d %q", code, out)
+	}
+	for id, want := range map[string]models.Priority{"urgent": models.PriorityHigh, "backfill": models.PriorityLow, "kept": models.PriorityNormal} {
+		if event, err := eventStore.Get(id); err != nil || event.Priority != want {
+			t.Errorf("Expected %s stored with priority %s, got %+v (%v)", id, want, event, err)
+		}
+	}
+	if code, _, errOut := runCLI(t, url, "", "publish", "-priority", "urgent", "x"); code != 1 || !strings.Contains(errOut, "priority") {
+		t.Errorf("Expected an unknown priority to be rejected, got %d %q", code, errOut)
+	}
+}
+
+func TestPublishAttributes(t *testing.T) {
+	url, eventStore := newTestServer(t)
+
+	code, _, errOut := runCLI(t, url, "", "publish", "-id", "order", "-type", "order.created",
+		"-attribute", "region=eu", "-attribute", "source=web", "x")
+	if code != 0 {
+		t.Fatalf("Expected publish to succeed, got %d %q", code, errOut)
+	}
+	event, err := eventStore.Get("order")
+	if err != nil {
+		t.Fatalf("Expected the event to be stored: %v", err)
+	}
+	if event.Type != "order.created" || len(event.Attributes) != 2 || event.Attributes["region"] != "eu" || event.Attributes["source"] != "web" {
+		t.Errorf("Expected type and attributes to be stored, got %+v", event)
+	}
+	if code, _, errOut = runCLI(t, url, "", "publish", "-attribute", "region", "x"); code != 1 || !strings.Contains(errOut, "key=value") {
+		t.Errorf("Expected an attribute without a value to be rejected, got %d %q", code, errOut)
+	}
+}
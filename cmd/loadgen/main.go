@@ -0,0 +1,171 @@
+// Command loadgen load tests the event processor API and reports
+// throughput, latency percentiles and errors by status.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/loadgen"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes loadgen and returns its exit status
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	defaults := loadgen.DefaultScenario()
+	scenarioFile := fs.String("scenario", "", "JSON scenario file, flags given explicitly override it")
+	url := fs.String("url", defaults.URL, "API base URL")
+	apiKey := fs.String("api-key", os.Getenv("LOADGEN_API_KEY"), "API key ($LOADGEN_API_KEY)")
+	token := fs.String("token", os.Getenv("LOADGEN_TOKEN"), "Bearer JWT ($LOADGEN_TOKEN)")
+	tenant := fs.String("tenant", "", "Tenant namespace to publish to")
+	concurrency := fs.Int("concurrency", defaults.Concurrency, "Concurrent clients, in open loop the most requests in flight")
+	duration := fs.Duration("duration", time.Duration(defaults.Duration), "Test duration, 0 to only stop after -requests")
+	requests := fs.Int("requests", 0, "Stop after this many requests, 0 for no limit")
+	timeout := fs.Duration("timeout", time.Duration(defaults.Timeout), "Timeout of each request")
+	batch := fs.Int("batch", defaults.BatchSize, "Events per request, above 1 publishes through /events/batch")
+	payloadSizes := fs.String("payload-sizes", "64", `Payload size distribution in bytes, such as "64:70,1024:25,16384:5"`)
+	rate := fs.Float64("rate", 0, "Open loop: requests due per second whatever the response times")
+	profile := fs.String("profile", "", "Open-loop rate profile: constant, ramp, step or spike")
+	peakRate := fs.Float64("peak-rate", 0, "Rate reached by the ramp, step and spike profiles")
+	steps := fs.Int("steps", 0, "Steps of the step profile, 5 by default")
+	spikeAt := fs.Duration("spike-at", 0, "Start of the spike")
+	spikeDuration := fs.Duration("spike-duration", 0, "Length of the spike")
+	interval := fs.Duration("interval", 0, "Length of the report's timeline buckets, 1s by default")
+	endToEnd := fs.Bool("e2e", false, "Follow the published events to check every accepted event is published")
+	drainTimeout := fs.Duration("drain-timeout", 0, "End-to-end: longest wait for events still processing at the end, 10s by default")
+	output := fs.String("output", "text", "Report format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintln(stderr, "loadgen: -output must be text or json")
+		return 2
+	}
+
+	scenario := defaults
+	if *scenarioFile != "" {
+		var err error
+		if scenario, err = loadgen.LoadScenario(*scenarioFile); err != nil {
+			fmt.Fprintf(stderr, "loadgen: %v\n", err)
+			return 2
+		}
+	}
+	// Credentials from the environment apply unless the scenario has some
+	if scenario.APIKey == "" {
+		scenario.APIKey = *apiKey
+	}
+	if scenario.Token == "" {
+		scenario.Token = *token
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "url":
+			scenario.URL = *url
+		case "api-key":
+			scenario.APIKey = *apiKey
+		case "token":
+			scenario.Token = *token
+		case "tenant":
+			scenario.Tenant = *tenant
+		case "concurrency":
+			scenario.Concurrency = *concurrency
+		case "duration":
+			scenario.Duration = config.Duration(*duration)
+		case "requests":
+			scenario.Requests = *requests
+		case "timeout":
+			scenario.Timeout = config.Duration(*timeout)
+		case "batch":
+			scenario.BatchSize = *batch
+		case "payload-sizes":
+			scenario.PayloadSizes, flagErr = loadgen.ParsePayloadSizes(*payloadSizes)
+		case "rate":
+			scenario.Rate = *rate
+		case "profile":
+			scenario.Profile = *profile
+		case "peak-rate":
+			scenario.PeakRate = *peakRate
+		case "steps":
+			scenario.Steps = *steps
+		case "spike-at":
+			scenario.SpikeAt = config.Duration(*spikeAt)
+		case "spike-duration":
+			scenario.SpikeDuration = config.Duration(*spikeDuration)
+		case "interval":
+			scenario.Interval = config.Duration(*interval)
+		case "e2e":
+			scenario.EndToEnd = *endToEnd
+		case "drain-timeout":
+			scenario.DrainTimeout = config.Duration(*drainTimeout)
+		}
+	})
+	if flagErr == nil {
+		flagErr = scenario.Validate()
+	}
+	if flagErr != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", flagErr)
+		return 2
+	}
+
+	if scenario.Rate > 0 || scenario.PeakRate > 0 {
+		fmt.Fprintf(stderr, "loadgen: publishing to %s at %s, at most %d requests in flight, for %s\n",
+			scenario.URL, describeRate(scenario), scenario.Concurrency, describeLimit(scenario))
+	} else {
+		fmt.Fprintf(stderr, "loadgen: %d clients publishing to %s for %s\n",
+			scenario.Concurrency, scenario.URL, describeLimit(scenario))
+	}
+	report, err := loadgen.Run(ctx, scenario)
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 1
+	}
+	if *output == "json" {
+		err = report.WriteJSON(stdout)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// describeLimit says when the test stops
+func describeLimit(s loadgen.Scenario) string {
+	switch {
+	case s.Requests > 0 && s.Duration > 0:
+		return fmt.Sprintf("%d requests or %s", s.Requests, time.Duration(s.Duration))
+	case s.Requests > 0:
+		return fmt.Sprintf("%d requests", s.Requests)
+	default:
+		return time.Duration(s.Duration).String()
+	}
+}
+
+// describeRate summarises the rate profile
+func describeRate(s loadgen.Scenario) string {
+	switch s.Profile {
+	case loadgen.ProfileRamp, loadgen.ProfileStep:
+		return fmt.Sprintf("%g/s rising to %g/s (%s)", s.Rate, s.PeakRate, s.Profile)
+	case loadgen.ProfileSpike:
+		return fmt.Sprintf("%g/s with a spike to %g/s", s.Rate, s.PeakRate)
+	default:
+		return fmt.Sprintf("%g/s", s.Rate)
+	}
+}
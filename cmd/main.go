@@ -2,96 +2,50 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
-	"coding_challenge/app/api"
-	"coding_challenge/app/processor"
-	"coding_challenge/internal/models"
+	"coding_challenge/app"
+	"coding_challenge/internal/config"
 )
 
-const (
-	workerCount     = 3
-	eventBufferSize = 100
-	serverAddress   = ":8081"
-)
+// shutdownTimeout bounds the graceful shutdown
+const shutdownTimeout = 10 * time.Second
 
 func main() {
+	configPath := flag.String("config", os.Getenv("EVENT_PROCESSOR_CONFIG"), "Path to a JSON config file")
+	flag.Parse()
+
 	// Set up logger
 	logger := log.New(os.Stdout, "[EVENT-PROCESSOR] ", log.LstdFlags)
 	logger.Println("Starting event processor application...")
 
-	// Create a context that will be canceled on interrupt
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Set up signal handling for graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start components with waitgroup to track active components
-	var wg sync.WaitGroup
-
-	// Initialize event store
-	eventStore := models.NewEventStore(eventBufferSize)
-
-	// Start API server
-	apiServer := api.NewServer(serverAddress, eventStore, logger)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := apiServer.Start(); err != nil && err != http.ErrServerClosed {
-			logger.Printf("HTTP server error: %v", err)
-		}
-	}()
-
-	// Start worker(s)
-	for i := 0; i < workerCount; i++ {
-		worker := processor.NewWorker(eventStore, logger)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			worker.Start(ctx)
-		}()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logger.Fatalf("Failed to load config: %v", err)
 	}
-
-	// Wait for shutdown signal
-	sig := <-sigCh
-	logger.Printf("Received signal %v, initiating graceful shutdown...", sig)
-
-	// Cancel context to notify all components to shut down
-	cancel()
-
-	// Set a timeout for graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
-
-	// Shutdown the HTTP server
-	if err := apiServer.Stop(shutdownCtx); err != nil {
-		logger.Printf("Error during server shutdown: %v", err)
+	application, err := app.New(cfg, app.WithLogger(logger))
+	if err != nil {
+		logger.Fatalf("Failed to start: %v", err)
 	}
 
-	// Close the event store
-	eventStore.Close()
-
-	// Wait for all components to shut down or timeout
-	shutdownCh := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(shutdownCh)
-	}()
-
-	select {
-	case <-shutdownCh:
-		logger.Println("All components shut down successfully")
-	case <-shutdownCtx.Done():
-		logger.Println("Shutdown timed out, forcing exit")
+	// Run until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := application.Run(ctx); err != nil {
+		logger.Printf("Stopping after error: %v", err)
+	} else {
+		logger.Println("Received signal, initiating graceful shutdown...")
 	}
 
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := application.Shutdown(shutdownCtx); err != nil {
+		logger.Printf("Error during shutdown: %v", err)
+	}
 	logger.Println("Application stopped")
 }
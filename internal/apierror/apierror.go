@@ -0,0 +1,59 @@
+// Package apierror writes the JSON error envelope shared by every HTTP
+// endpoint
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Machine readable error codes
+const (
+	CodeInvalidBody              = "invalid_body"
+	CodeInvalidEvent             = "invalid_event"
+	CodeBodyTooLarge             = "body_too_large"
+	CodeBatchTooLarge            = "batch_too_large"
+	CodePayloadTooLarge          = "payload_too_large"
+	CodeDuplicateEvent           = "duplicate_event"
+	CodeNotScheduled             = "not_scheduled"
+	CodeNotFound                 = "not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeUnsupportedMediaType     = "unsupported_media_type"
+	CodeUnsupportedEncoding      = "unsupported_encoding"
+	CodeNotAcceptable            = "not_acceptable"
+	CodeUnavailable              = "unavailable"
+	CodeRateLimited              = "rate_limited"
+	CodeBackpressure             = "backpressure"
+	CodeStorageQuotaExceeded     = "storage_quota_exceeded"
+	CodeUnauthorized             = "unauthorized"
+	CodeForbidden                = "forbidden"
+	CodeInvalidTenant            = "invalid_tenant"
+	CodeInvalidPoolSize          = "invalid_pool_size"
+	CodeInvalidGroup             = "invalid_group"
+	CodeGroupExists              = "group_exists"
+	CodeInvalidQuery             = "invalid_query"
+	CodeInvalidIdempotencyKey    = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeInternal                 = "internal"
+)
+
+// Response is the body of every error response
+type Response struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Write sends an error response without details
+func Write(w http.ResponseWriter, status int, code, message string) {
+	WriteDetails(w, status, code, message, nil)
+}
+
+// WriteDetails sends an error response with details describing the failure
+func WriteDetails(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Code: code, Message: message, Details: details})
+}
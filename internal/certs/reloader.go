@@ -0,0 +1,173 @@
+// Package certs loads TLS certificates and reloads them when their files
+// change, so certificates can be rotated without a restart
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"coding_challenge/internal/models"
+)
+
+// ErrNoClientCAs is returned when the client CA file holds no certificates
+var ErrNoClientCAs = models.Error("no certificates found in client CA file")
+
+// Reloader serves the latest certificate, key and client CAs read from disk
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	logger       *log.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the certificate and key, and the client CAs when
+// clientCAFile is set
+func NewReloader(certFile, keyFile, clientCAFile string, logger *log.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		logger:       logger,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads every file again. On error the previous certificates stay in use.
+func (r *Reloader) Reload() error {
+	stamps := r.readStamps()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return ErrNoClientCAs
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.stamps = stamps
+	return nil
+}
+
+// Watch polls the files every interval and reloads them when one changes,
+// until ctx is canceled
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.logger.Printf("Failed to reload TLS certificates, keeping previous: %v", err)
+				continue
+			}
+			r.logger.Println("Reloaded TLS certificates")
+		}
+	}
+}
+
+// changed reports whether any file differs from the last successful load
+func (r *Reloader) changed() bool {
+	stamps := r.readStamps()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, stamp := range stamps {
+		if r.stamps[name] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// readStamps returns the modification time and size of every file
+func (r *Reloader) readStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp, 3)
+	for _, name := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil {
+			stamps[name] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// ClientCAs returns the current pool of client CAs, nil without mTLS
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// ServerConfig returns a TLS config serving the reloaded certificate. With
+// client CAs, client certificates are verified when presented, and required
+// when requireClientCert is set.
+func (r *Reloader) ServerConfig(requireClientCert, http2 bool) *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+	if http2 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+	if r.clientCAFile == "" {
+		return config
+	}
+
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	// Resolve the CAs per handshake so reloads apply to new connections
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := config.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = r.ClientCAs()
+		return c, nil
+	}
+	return config
+}
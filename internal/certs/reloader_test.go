@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned writes a self-signed certificate and key with the given
+// serial number into dir
+func writeSelfSigned(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// servedSerial returns the serial number of the certificate being served
+func servedSerial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Failed to get certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloaderPicksUpChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSigned(t, dir, 1)
+
+	reloader, err := NewReloader(certFile, keyFile, "", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+	if reloader.changed() {
+		t.Error("Expected no change right after loading")
+	}
+
+	writeSelfSigned(t, dir, 2)
+	// Make the change visible on filesystems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if !reloader.changed() {
+		t.Fatal("Expected rewritten files to be detected")
+	}
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if got := servedSerial(t, reloader); got != 2 {
+		t.Errorf("Expected serial 2 after reload, got %d", got)
+	}
+
+	// A broken file keeps the previous certificate in service
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	if err := reloader.Reload(); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+	if got := servedSerial(t, reloader); got != 2 {
+		t.Errorf("Expected serial 2 to stay in use, got %d", got)
+	}
+}
+
+func TestReloaderRejectsEmptyClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSigned(t, dir, 1)
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, []byte("no certificates here"), 0o600)
+
+	if _, err := NewReloader(certFile, keyFile, caFile, log.New(io.Discard, "", 0)); err != ErrNoClientCAs {
+		t.Errorf("Expected ErrNoClientCAs, got: %v", err)
+	}
+}
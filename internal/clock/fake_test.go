@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// received returns what c holds without waiting
+func received(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimers(t *testing.T) {
+	f := NewFake(epoch)
+	late, early := f.NewTimer(2*time.Second), f.NewTimer(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	if _, ok := received(early.C()); ok {
+		t.Fatal("Expected the timer not to fire before its deadline")
+	}
+	f.Advance(5 * time.Second)
+	if at, ok := received(early.C()); !ok || !at.Equal(epoch.Add(time.Second)) {
+		t.Errorf("Expected the timer to fire at its deadline, got %v %v", at, ok)
+	}
+	if at, ok := received(late.C()); !ok || !at.Equal(epoch.Add(2*time.Second)) {
+		t.Errorf("Expected the timer to fire at its deadline, got %v %v", at, ok)
+	}
+	if now := f.Now(); !now.Equal(epoch.Add(5999 * time.Millisecond)) {
+		t.Errorf("Expected the clock to end where advanced, got %v", now)
+	}
+
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Expected Stop to report only the first stop")
+	}
+	f.Advance(time.Minute)
+	if _, ok := received(stopped.C()); ok {
+		t.Error("Expected a stopped timer not to fire")
+	}
+	if stopped.Reset(time.Second) || f.Waiters() != 1 {
+		t.Errorf("Expected Reset to reactivate the timer, %d waiting", f.Waiters())
+	}
+}
+
+func TestFakeTickers(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+	var ticks []time.Duration
+	for i := 0; i < 3; i++ {
+		f.Advance(time.Second)
+		at, ok := received(ticker.C())
+		if !ok {
+			t.Fatalf("Expected tick %d", i)
+		}
+		ticks = append(ticks, at.Sub(epoch))
+	}
+	if ticks[0] != time.Second || ticks[2] != 3*time.Second {
+		t.Errorf("Expected a tick a second, got %v", ticks)
+	}
+	// Ticks a slow receiver missed are dropped
+	f.Advance(10 * time.Second)
+	if _, ok := received(ticker.C()); !ok {
+		t.Error("Expected a pending tick")
+	}
+	if _, ok := received(ticker.C()); ok {
+		t.Error("Expected missed ticks to be dropped")
+	}
+	ticker.Stop()
+	if f.Waiters() != 0 {
+		t.Errorf("Expected no waiters, got %d", f.Waiters())
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	fired := make(chan time.Time)
+	go func() {
+		timer := f.NewTimer(time.Minute)
+		fired <- <-timer.C()
+	}()
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	if at := <-fired; !at.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("Expected the goroutine's timer to fire, got %v", at)
+	}
+}
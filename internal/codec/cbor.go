@@ -0,0 +1,42 @@
+package codec
+
+import (
+	"errors"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	cborEncoder, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	cborDecoder, _ = cbor.DecOptions{
+		DupMapKey:         cbor.DupMapKeyEnforcedAPF,
+		ExtraReturnErrors: cbor.ExtraDecErrorUnknownField,
+	}.DecMode()
+)
+
+// CBOR encodes values as CBOR maps keyed by their JSON names
+type CBOR struct{}
+
+// Name implements Codec
+func (CBOR) Name() string { return "cbor" }
+
+// ContentType implements Codec
+func (CBOR) ContentType() string { return CBORType }
+
+// Binary implements Codec
+func (CBOR) Binary() bool { return true }
+
+// Marshal implements Codec
+func (CBOR) Marshal(v interface{}) ([]byte, error) {
+	return cborEncoder.Marshal(v)
+}
+
+// Unmarshal implements Codec
+func (CBOR) Unmarshal(data []byte, v interface{}) error {
+	err := cborDecoder.Unmarshal(data, v)
+	var extra *cbor.ExtraneousDataError
+	if errors.As(err, &extra) {
+		return ErrTrailingData
+	}
+	return err
+}
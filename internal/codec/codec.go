@@ -0,0 +1,155 @@
+// Package codec encodes API bodies and published events as JSON, Protobuf,
+// MessagePack or CBOR. One Registry is shared by the HTTP API and the
+// publishers so both speak the same formats.
+package codec
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"coding_challenge/internal/models"
+)
+
+// Media types of the built-in codecs
+const (
+	JSONType        = "application/json"
+	ProtobufType    = "application/x-protobuf"
+	MessagePackType = "application/msgpack"
+	CBORType        = "application/cbor"
+)
+
+// Codec errors
+var (
+	ErrUnsupportedType = models.Error("type has no encoding in this format")
+	ErrTrailingData    = models.Error("body must contain a single value")
+)
+
+// Codec converts values to and from one wire format
+type Codec interface {
+	// Name is the short name used in configuration, such as "json"
+	Name() string
+	ContentType() string
+	// Binary reports whether encoded values may contain arbitrary bytes
+	Binary() bool
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes exactly one value, rejecting trailing data
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Registry looks codecs up by media type or name. The first registered
+// codec is the default.
+type Registry struct {
+	codecs []Codec
+	types  map[string]Codec
+	names  map[string]Codec
+}
+
+// NewRegistry creates a registry holding codecs
+func NewRegistry(codecs ...Codec) *Registry {
+	r := &Registry{
+		types: make(map[string]Codec),
+		names: make(map[string]Codec),
+	}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+// Default returns a registry with JSON as the default, then Protobuf,
+// MessagePack and CBOR
+func Default() *Registry {
+	r := NewRegistry(JSON{}, Protobuf{}, MessagePack{}, CBOR{})
+	// Common aliases used by clients
+	r.types["application/protobuf"] = Protobuf{}
+	r.types["application/x-msgpack"] = MessagePack{}
+	r.types["application/vnd.msgpack"] = MessagePack{}
+	return r
+}
+
+// Register adds c, replacing any codec with the same name or media type
+func (r *Registry) Register(c Codec) {
+	r.codecs = append(r.codecs, c)
+	r.types[c.ContentType()] = c
+	r.names[c.Name()] = c
+}
+
+// Default returns the codec used when the client expresses no preference
+func (r *Registry) Default() Codec {
+	return r.codecs[0]
+}
+
+// ByName returns the codec with the given configuration name
+func (r *Registry) ByName(name string) (Codec, bool) {
+	c, ok := r.names[name]
+	return c, ok
+}
+
+// ContentTypes lists the media types of the registered codecs
+func (r *Registry) ContentTypes() []string {
+	types := make([]string, len(r.codecs))
+	for i, c := range r.codecs {
+		types[i] = c.ContentType()
+	}
+	return types
+}
+
+// ForContentType returns the codec for a Content-Type header. An empty
+// header selects the default codec.
+func (r *Registry) ForContentType(header string) (Codec, bool) {
+	if header == "" {
+		return r.Default(), true
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, false
+	}
+	c, ok := r.types[mediaType]
+	return c, ok
+}
+
+// Negotiate picks the codec best matching an Accept header, honouring
+// q-values and wildcards. An empty header selects the default codec.
+func (r *Registry) Negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return r.Default(), true
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+		order     int
+	}
+	var candidates []candidate
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{mediaType, q, i})
+		}
+	}
+	// Highest q first, earlier entries win ties
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, cand := range candidates {
+		if cand.mediaType == "*/*" || cand.mediaType == "application/*" {
+			return r.Default(), true
+		}
+		if c, ok := r.types[cand.mediaType]; ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,137 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/models"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	registry := Default()
+	batch := &models.Batch{Events: []models.Event{
+		{ID: "a", Timestamp: 1625097600, Payload: "héllo", PartitionKey: "k", Tenant: "team-a", DeliverAt: 1625097660},
+		{ID: "b", Payload: "", Delay: 30, Priority: models.PriorityHigh, Type: "order.created",
+			Attributes: map[string]string{"region": "eu", "source": "web"}},
+	}}
+	result := &models.BatchResult{Accepted: 1, Rejected: 1, Results: []models.ItemResult{
+		{ID: "a", Status: 201},
+		{ID: "b", Status: 409, Code: "duplicate_event", Message: "duplicate"},
+	}}
+	transformed := &models.TransformedEvent{
+		ID: "a", Tenant: "team-a", OriginalTime: 1625097600,
+		ProcessedAt: time.Unix(1700000000, 123456789).UTC(), Payload: "HÉLLO", ProcessorID: "w1",
+		Type: "order.created", Attributes: map[string]string{"region": "eu"},
+	}
+
+	for _, name := range []string{"json", "protobuf", "msgpack", "cbor"} {
+		c, ok := registry.ByName(name)
+		if !ok {
+			t.Fatalf("Codec %s not registered", name)
+		}
+		t.Run(name, func(t *testing.T) {
+			data, err := c.Marshal(batch)
+			if err != nil {
+				t.Fatalf("Failed to marshal batch: %v", err)
+			}
+			var gotBatch models.Batch
+			if err := c.Unmarshal(data, &gotBatch); err != nil {
+				t.Fatalf("Failed to unmarshal batch: %v", err)
+			}
+			if !reflect.DeepEqual(&gotBatch, batch) {
+				t.Errorf("Batch mismatch: got %+v, want %+v", gotBatch, batch)
+			}
+
+			data, err = c.Marshal(result)
+			if err != nil {
+				t.Fatalf("Failed to marshal result: %v", err)
+			}
+			var gotResult models.BatchResult
+			if err := c.Unmarshal(data, &gotResult); err != nil {
+				t.Fatalf("Failed to unmarshal result: %v", err)
+			}
+			if !reflect.DeepEqual(&gotResult, result) {
+				t.Errorf("Result mismatch: got %+v, want %+v", gotResult, result)
+			}
+
+			data, err = c.Marshal(transformed)
+			if err != nil {
+				t.Fatalf("Failed to marshal transformed event: %v", err)
+			}
+			var gotTransformed models.TransformedEvent
+			if err := c.Unmarshal(data, &gotTransformed); err != nil {
+				t.Fatalf("Failed to unmarshal transformed event: %v", err)
+			}
+			if !gotTransformed.ProcessedAt.Equal(transformed.ProcessedAt) {
+				t.Errorf("ProcessedAt mismatch: got %v, want %v", gotTransformed.ProcessedAt, transformed.ProcessedAt)
+			}
+			gotTransformed.ProcessedAt = transformed.ProcessedAt
+			if !reflect.DeepEqual(&gotTransformed, transformed) {
+				t.Errorf("Transformed event mismatch: got %+v, want %+v", gotTransformed, *transformed)
+			}
+		})
+	}
+}
+
+func TestCodecsRejectTrailingData(t *testing.T) {
+	event := &models.Event{ID: "a", Payload: "x"}
+	for _, c := range []Codec{JSON{}, MessagePack{}, CBOR{}} {
+		data, _ := c.Marshal(event)
+		var got models.Event
+		if err := c.Unmarshal(append(data, data...), &got); err != ErrTrailingData {
+			t.Errorf("%s: expected ErrTrailingData, got %v", c.Name(), err)
+		}
+	}
+}
+
+func TestCodecsRejectUnknownFields(t *testing.T) {
+	extra := map[string]interface{}{"id": "a", "payload": "x", "extra": true}
+	for _, c := range []Codec{JSON{}, MessagePack{}, CBOR{}} {
+		data, err := c.Marshal(extra)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal: %v", c.Name(), err)
+		}
+		var got models.Event
+		if err := c.Unmarshal(data, &got); err == nil {
+			t.Errorf("%s: expected error for unknown field", c.Name())
+		}
+	}
+}
+
+func TestProtobufUnsupportedType(t *testing.T) {
+	if _, err := (Protobuf{}).Marshal(map[string]string{}); err != ErrUnsupportedType {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	registry := Default()
+	testCases := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", JSONType, true},
+		{"*/*", JSONType, true},
+		{"application/cbor", CBORType, true},
+		{"application/x-msgpack", MessagePackType, true},
+		{"application/json;q=0.5, application/x-protobuf", ProtobufType, true},
+		{"text/html, application/*;q=0.1", JSONType, true},
+		{"text/html", "", false},
+		{"application/cbor;q=0", "", false},
+	}
+	for _, tc := range testCases {
+		c, ok := registry.Negotiate(tc.accept)
+		if ok != tc.ok || (ok && c.ContentType() != tc.want) {
+			t.Errorf("Negotiate(%q) = %v, %v; want %s, %v", tc.accept, c, ok, tc.want, tc.ok)
+		}
+	}
+
+	if c, ok := registry.ForContentType("application/msgpack; charset=binary"); !ok || c.Name() != "msgpack" {
+		t.Errorf("Expected msgpack for content type with parameters, got %v, %v", c, ok)
+	}
+	if _, ok := registry.ForContentType("text/plain"); ok {
+		t.Error("Expected text/plain to be unsupported")
+	}
+}
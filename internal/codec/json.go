@@ -0,0 +1,38 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// JSON encodes values with encoding/json and decodes them strictly,
+// rejecting unknown fields
+type JSON struct{}
+
+// Name implements Codec
+func (JSON) Name() string { return "json" }
+
+// ContentType implements Codec
+func (JSON) ContentType() string { return JSONType }
+
+// Binary implements Codec
+func (JSON) Binary() bool { return false }
+
+// Marshal implements Codec
+func (JSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec
+func (JSON) Unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack encodes values as MessagePack maps keyed by their JSON names
+type MessagePack struct{}
+
+// Name implements Codec
+func (MessagePack) Name() string { return "msgpack" }
+
+// ContentType implements Codec
+func (MessagePack) ContentType() string { return MessagePackType }
+
+// Binary implements Codec
+func (MessagePack) Binary() bool { return true }
+
+// Marshal implements Codec
+func (MessagePack) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements Codec
+func (MessagePack) Unmarshal(data []byte, v interface{}) error {
+	reader := bytes.NewReader(data)
+	decoder := msgpack.NewDecoder(reader)
+	decoder.SetCustomStructTag("json")
+	decoder.DisallowUnknownFields(true)
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if reader.Len() > 0 {
+		return ErrTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package codec
+
+import (
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"coding_challenge/internal/models"
+)
+
+// ErrWireType is returned when a field is encoded with an unexpected type
+var ErrWireType = models.Error("protobuf field has the wrong wire type")
+
+// Protobuf encodes the event types with the schema in events.proto. Other
+// types return ErrUnsupportedType. Unknown fields are skipped, as protobuf
+// requires for forward compatibility.
+type Protobuf struct{}
+
+// Name implements Codec
+func (Protobuf) Name() string { return "protobuf" }
+
+// ContentType implements Codec
+func (Protobuf) ContentType() string { return ProtobufType }
+
+// Binary implements Codec
+func (Protobuf) Binary() bool { return true }
+
+// Marshal implements Codec
+func (Protobuf) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *models.Event:
+		return appendEvent(nil, v), nil
+	case models.Event:
+		return appendEvent(nil, &v), nil
+	case []*models.Event:
+		var b []byte
+		for _, e := range v {
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendBytes(b, appendEvent(nil, e))
+		}
+		return b, nil
+	case []models.Event:
+		return marshalEvents(v), nil
+	case *models.Batch:
+		return marshalEvents(v.Events), nil
+	case *models.PublishResult:
+		return appendString(nil, 1, v.ID), nil
+	case *models.BatchResult:
+		return appendBatchResult(v), nil
+	case *models.TransformedEvent:
+		return appendTransformedEvent(v), nil
+	}
+	return nil, ErrUnsupportedType
+}
+
+// Unmarshal implements Codec
+func (Protobuf) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *models.Event:
+		return unmarshalEvent(data, v)
+	case *[]models.Event:
+		return unmarshalEvents(data, v)
+	case *models.Batch:
+		return unmarshalEvents(data, &v.Events)
+	case *models.PublishResult:
+		return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+			if num == 1 {
+				return readString(typ, b, &v.ID)
+			}
+			return 0, nil
+		})
+	case *models.BatchResult:
+		return unmarshalBatchResult(data, v)
+	case *models.TransformedEvent:
+		return unmarshalTransformedEvent(data, v)
+	}
+	return ErrUnsupportedType
+}
+
+func appendEvent(b []byte, e *models.Event) []byte {
+	b = appendString(b, 1, e.ID)
+	b = appendInt(b, 2, e.Timestamp)
+	b = appendString(b, 3, e.Payload)
+	b = appendString(b, 4, e.PartitionKey)
+	b = appendString(b, 5, e.Tenant)
+	b = appendInt(b, 6, e.DeliverAt)
+	b = appendInt(b, 7, e.Delay)
+	b = appendString(b, 8, string(e.Priority))
+	b = appendString(b, 9, e.Type)
+	return appendAttributes(b, 10, e.Attributes)
+}
+
+func marshalEvents(events []models.Event) []byte {
+	var b []byte
+	for i := range events {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendEvent(nil, &events[i]))
+	}
+	return b
+}
+
+func appendBatchResult(r *models.BatchResult) []byte {
+	b := appendInt(nil, 1, int64(r.Accepted))
+	b = appendInt(b, 2, int64(r.Rejected))
+	for _, item := range r.Results {
+		var m []byte
+		m = appendString(m, 1, item.ID)
+		m = appendInt(m, 2, int64(item.Status))
+		m = appendString(m, 3, item.Code)
+		m = appendString(m, 4, item.Message)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	return b
+}
+
+func appendTransformedEvent(e *models.TransformedEvent) []byte {
+	b := appendString(nil, 1, e.ID)
+	b = appendString(b, 2, e.Tenant)
+	b = appendInt(b, 3, e.OriginalTime)
+	if !e.ProcessedAt.IsZero() {
+		b = appendInt(b, 4, e.ProcessedAt.UnixNano())
+	}
+	b = appendString(b, 5, e.Payload)
+	b = appendString(b, 6, e.ProcessorID)
+	b = appendString(b, 7, e.Type)
+	return appendAttributes(b, 8, e.Attributes)
+}
+
+func unmarshalEvent(data []byte, e *models.Event) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return readString(typ, b, &e.ID)
+		case 2:
+			return readInt(typ, b, &e.Timestamp)
+		case 3:
+			return readString(typ, b, &e.Payload)
+		case 4:
+			return readString(typ, b, &e.PartitionKey)
+		case 5:
+			return readString(typ, b, &e.Tenant)
+		case 6:
+			return readInt(typ, b, &e.DeliverAt)
+		case 7:
+			return readInt(typ, b, &e.Delay)
+		case 8:
+			var priority string
+			n, err := readString(typ, b, &priority)
+			e.Priority = models.Priority(priority)
+			return n, err
+		case 9:
+			return readString(typ, b, &e.Type)
+		case 10:
+			return readAttribute(typ, b, &e.Attributes)
+		}
+		return 0, nil
+	})
+}
+
+func unmarshalEvents(data []byte, events *[]models.Event) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 {
+			return 0, nil
+		}
+		var m []byte
+		n, err := readBytes(typ, b, &m)
+		if err != nil {
+			return 0, err
+		}
+		var e models.Event
+		if err := unmarshalEvent(m, &e); err != nil {
+			return 0, err
+		}
+		*events = append(*events, e)
+		return n, nil
+	})
+}
+
+func unmarshalBatchResult(data []byte, r *models.BatchResult) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		var v int64
+		switch num {
+		case 1:
+			n, err := readInt(typ, b, &v)
+			r.Accepted = int(v)
+			return n, err
+		case 2:
+			n, err := readInt(typ, b, &v)
+			r.Rejected = int(v)
+			return n, err
+		case 3:
+			var m []byte
+			n, err := readBytes(typ, b, &m)
+			if err != nil {
+				return 0, err
+			}
+			var item models.ItemResult
+			err = walk(m, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch num {
+				case 1:
+					return readString(typ, b, &item.ID)
+				case 2:
+					var status int64
+					n, err := readInt(typ, b, &status)
+					item.Status = int(status)
+					return n, err
+				case 3:
+					return readString(typ, b, &item.Code)
+				case 4:
+					return readString(typ, b, &item.Message)
+				}
+				return 0, nil
+			})
+			r.Results = append(r.Results, item)
+			return n, err
+		}
+		return 0, nil
+	})
+}
+
+func unmarshalTransformedEvent(data []byte, e *models.TransformedEvent) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return readString(typ, b, &e.ID)
+		case 2:
+			return readString(typ, b, &e.Tenant)
+		case 3:
+			return readInt(typ, b, &e.OriginalTime)
+		case 4:
+			var nanos int64
+			n, err := readInt(typ, b, &nanos)
+			e.ProcessedAt = time.Unix(0, nanos)
+			return n, err
+		case 5:
+			return readString(typ, b, &e.Payload)
+		case 6:
+			return readString(typ, b, &e.ProcessorID)
+		case 7:
+			return readString(typ, b, &e.Type)
+		case 8:
+			return readAttribute(typ, b, &e.Attributes)
+		}
+		return 0, nil
+	})
+}
+
+// appendString appends a string field, omitting the proto3 default
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendAttributes appends a map<string, string> field as one entry
+// message per attribute, sorted by name
+func appendAttributes(b []byte, num protowire.Number, attributes map[string]string) []byte {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := appendString(nil, 1, key)
+		entry = appendString(entry, 2, attributes[key])
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// readAttribute reads one map<string, string> entry into attributes
+func readAttribute(typ protowire.Type, b []byte, attributes *map[string]string) (int, error) {
+	var entry []byte
+	n, err := readBytes(typ, b, &entry)
+	if err != nil {
+		return 0, err
+	}
+	var key, value string
+	err = walk(entry, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return readString(typ, b, &key)
+		case 2:
+			return readString(typ, b, &value)
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if *attributes == nil {
+		*attributes = make(map[string]string)
+	}
+	(*attributes)[key] = value
+	return n, nil
+}
+
+// appendInt appends an int64 field, omitting the proto3 default
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// walk calls field for every field of a message. field returns the bytes
+// it consumed, or zero to skip the field.
+func walk(data []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		n, err := field(num, typ, data)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if n = protowire.ConsumeFieldValue(num, typ, data); n < 0 {
+				return protowire.ParseError(n)
+			}
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func readString(typ protowire.Type, b []byte, dst *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, ErrWireType
+	}
+	v, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*dst = v
+	return n, nil
+}
+
+func readBytes(typ protowire.Type, b []byte, dst *[]byte) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, ErrWireType
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*dst = v
+	return n, nil
+}
+
+func readInt(typ protowire.Type, b []byte, dst *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, ErrWireType
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*dst = int64(v)
+	return n, nil
+}
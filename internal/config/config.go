@@ -0,0 +1,565 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"coding_challenge/internal/codec"
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/models"
+	"coding_challenge/internal/routing"
+	"coding_challenge/internal/transform"
+)
+
+// DefaultPipeline always exists: it runs on the pool settings and, unless
+// configured otherwise, uppercases payloads and publishes to DefaultSink
+const DefaultPipeline = "default"
+
+// DefaultSink is the output set by publish
+const DefaultSink = "default"
+
+// namePattern matches the names of pipelines and sinks
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Config holds the runtime settings of the event processor
+type Config struct {
+	ServerAddress   string                    `json:"server_address"`
+	EventBufferSize int                       `json:"event_buffer_size"`
+	Lanes           map[string]LaneConfig     `json:"lanes"`
+	Pool            PoolConfig                `json:"pool"`
+	Auth            AuthConfig                `json:"auth"`
+	Tenancy         TenancyConfig             `json:"tenancy"`
+	Ingest          IngestConfig              `json:"ingest"`
+	TLS             TLSConfig                 `json:"tls"`
+	Limits          LimitsConfig              `json:"limits"`
+	Publish         PublishConfig             `json:"publish"`
+	Sinks           map[string]PublishConfig  `json:"sinks"`
+	Pipelines       map[string]PipelineConfig `json:"pipelines"`
+	Routing         RoutingConfig             `json:"routing"`
+	Expressions     ExpressionsConfig         `json:"expressions"`
+	Compression     CompressionConfig         `json:"compression"`
+	Idempotency     IdempotencyConfig         `json:"idempotency"`
+	DeadLetter      DeadLetterConfig          `json:"dead_letter"`
+}
+
+// LaneConfig tunes the priority lane of the same name, high, normal or low.
+// Zero values keep the defaults.
+type LaneConfig struct {
+	// Weight is the lane's share of the workers while other lanes are busy
+	Weight int `json:"weight"`
+	// Capacity bounds the events queued in the lane, event_buffer_size
+	// when zero
+	Capacity int `json:"capacity"`
+}
+
+// IdempotencyConfig controls how long Idempotency-Key responses are kept
+// for replay
+type IdempotencyConfig struct {
+	TTL Duration `json:"ttl"`
+	// MaxKeys bounds the remembered keys, zero disables idempotency keys
+	MaxKeys int `json:"max_keys"`
+}
+
+// DeadLetterConfig keeps the events pipelines fail to process for
+// inspection and redrive
+type DeadLetterConfig struct {
+	// MaxEntries bounds the dead letters kept, dropping the oldest beyond
+	// it. Zero disables the dead letter queue.
+	MaxEntries int `json:"max_entries"`
+}
+
+// CompressionConfig controls gzip and zstd compression of responses
+type CompressionConfig struct {
+	Enabled bool `json:"enabled"`
+	// MinBytes leaves smaller responses uncompressed
+	MinBytes int `json:"min_bytes"`
+}
+
+// PipelineConfig is a chain of transformers with its own worker pool,
+// publishing to sinks. Zero values keep the defaults.
+type PipelineConfig struct {
+	// Transforms apply in order. When unset the payload is uppercased, an
+	// empty list publishes events unchanged.
+	Transforms []TransformConfig `json:"transforms"`
+	// Sinks name the sinks receiving the events, the default sink when empty
+	Sinks []string `json:"sinks"`
+	// Workers sizes the pipeline's pool, pool.workers when zero. The other
+	// pool settings are shared.
+	Workers int `json:"workers"`
+	// QueueSize bounds the events routed to the pipeline and waiting for
+	// its pool in each lane, routing.queue_size when zero
+	QueueSize int `json:"queue_size"`
+}
+
+// TransformConfig is a transformer of a pipeline: uppercase, lowercase,
+// trim, filter or map
+type TransformConfig struct {
+	Type string `json:"type"`
+	// Expr is the condition of a filter, events for which it is false are
+	// dropped
+	Expr string `json:"expr"`
+	// Fields maps the fields a map transformer sets to expressions
+	Fields map[string]string `json:"fields"`
+}
+
+// New creates the transformer, compiling its expressions with limits
+func (t TransformConfig) New(limits expr.Limits) (transform.Transformer, error) {
+	switch t.Type {
+	case "filter":
+		if t.Expr == "" {
+			return nil, Error("filter requires expr")
+		}
+		return transform.Filter(t.Expr, limits)
+	case "map":
+		return transform.Map(t.Fields, limits)
+	}
+	builtin, ok := transform.ByName(t.Type)
+	if !ok {
+		return nil, Error("unknown transform: " + t.Type)
+	}
+	if t.Expr != "" || len(t.Fields) > 0 {
+		return nil, Error(t.Type + " takes no expr or fields")
+	}
+	return builtin, nil
+}
+
+// ExpressionsConfig bounds each evaluation of the expressions of routes,
+// filters and maps
+type ExpressionsConfig struct {
+	// MaxSteps bounds the operations of an evaluation
+	MaxSteps int      `json:"max_steps"`
+	Timeout  Duration `json:"timeout"`
+}
+
+// Limits returns the limits of expression evaluations
+func (e ExpressionsConfig) Limits() expr.Limits {
+	return expr.Limits{MaxSteps: e.MaxSteps, Timeout: time.Duration(e.Timeout)}
+}
+
+// RoutingConfig sends events to pipelines by their content
+type RoutingConfig struct {
+	// Routes are tried in order, the first matching one picks the pipeline
+	Routes []RouteConfig `json:"routes"`
+	// Default is the pipeline of events no route matches, empty to drop
+	// them unprocessed
+	Default string `json:"default"`
+	// QueueSize bounds the events waiting for each pipeline's pool per
+	// lane. Ingestion refuses events for a pipeline whose queue is full.
+	QueueSize int `json:"queue_size"`
+}
+
+// RouteConfig sends the events matching its conditions to a pipeline
+type RouteConfig struct {
+	Pipeline string             `json:"pipeline"`
+	Match    routing.Conditions `json:"match"`
+}
+
+// PublishConfig selects where processed events are published
+type PublishConfig struct {
+	// Output is "log" for the application log or "stdout" for a stream of
+	// encoded events
+	Output string `json:"output"`
+	// Format names the codec of the stdout stream: json, protobuf, msgpack or cbor
+	Format string `json:"format"`
+}
+
+// LimitsConfig bounds the size of request bodies and event payloads
+type LimitsConfig struct {
+	MaxBodyBytes    int64 `json:"max_body_bytes"`
+	MaxPayloadBytes int   `json:"max_payload_bytes"`
+	MaxBatchEvents  int   `json:"max_batch_events"`
+}
+
+// TLSConfig enables HTTPS when a certificate and key are set
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile enables verification of client certificates
+	ClientCAFile      string `json:"client_ca_file"`
+	RequireClientCert bool   `json:"require_client_cert"`
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval Duration `json:"reload_interval"`
+	DisableHTTP2   bool     `json:"disable_http2"`
+}
+
+// Enabled reports whether the server should use TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// IngestConfig protects the publish endpoint from clients that outpace
+// the workers
+type IngestConfig struct {
+	// ClientRateLimit applies to each API key, token subject or client IP,
+	// a zero rate disables it
+	ClientRateLimit RateLimitConfig    `json:"client_rate_limit"`
+	Backpressure    BackpressureConfig `json:"backpressure"`
+}
+
+// RateLimitConfig is a token bucket rate and burst
+type RateLimitConfig struct {
+	EventsPerSecond float64 `json:"events_per_second"`
+	Burst           int     `json:"burst"`
+}
+
+// BackpressureConfig sets the load at which publishing is refused, zero
+// thresholds are disabled
+type BackpressureConfig struct {
+	MaxQueueDepth int      `json:"max_queue_depth"`
+	MaxLag        Duration `json:"max_lag"`
+	ResumeRatio   float64  `json:"resume_ratio"`
+	MaxRetryAfter Duration `json:"max_retry_after"`
+}
+
+// TenancyConfig sets the quotas of each tenant namespace
+type TenancyConfig struct {
+	// DefaultQuota applies to tenants not listed in Tenants
+	DefaultQuota QuotaConfig            `json:"default_quota"`
+	Tenants      map[string]QuotaConfig `json:"tenants"`
+	// PurgeInterval is how often events past their retention are removed
+	PurgeInterval Duration `json:"purge_interval"`
+}
+
+// QuotaConfig limits a tenant, zero values are unlimited
+type QuotaConfig struct {
+	EventsPerSecond float64  `json:"events_per_second"`
+	Burst           int      `json:"burst"`
+	MaxStoredBytes  int64    `json:"max_stored_bytes"`
+	Retention       Duration `json:"retention"`
+}
+
+// PoolConfig controls the partitioned worker pool
+type PoolConfig struct {
+	Workers    int `json:"workers"`
+	MinWorkers int `json:"min_workers"`
+	MaxWorkers int `json:"max_workers"`
+	Partitions int `json:"partitions"`
+	// MaxPending bounds the events held by the pool in each priority lane
+	MaxPending int             `json:"max_pending"`
+	Autoscale  AutoscaleConfig `json:"autoscale"`
+}
+
+// AutoscaleConfig controls how the pool size follows the load
+type AutoscaleConfig struct {
+	Interval               Duration `json:"interval"`
+	Cooldown               Duration `json:"cooldown"`
+	TargetPendingPerWorker int      `json:"target_pending_per_worker"`
+	TargetLatency          Duration `json:"target_latency"`
+}
+
+// AuthConfig controls authentication of the HTTP API
+type AuthConfig struct {
+	Enabled bool           `json:"enabled"`
+	APIKeys []APIKeyConfig `json:"api_keys"`
+	JWT     JWTConfig      `json:"jwt"`
+	// ClientCerts map verified client certificate subjects to principals
+	ClientCerts []ClientCertConfig `json:"client_certs"`
+}
+
+// ClientCertConfig grants scopes to a client certificate subject, matched
+// against its common name or full distinguished name
+type ClientCertConfig struct {
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+	Tenant  string   `json:"tenant"`
+}
+
+// APIKeyConfig is a static API key stored as the hex SHA-256 of its value
+type APIKeyConfig struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+	// Tenant binds the key to a tenant namespace
+	Tenant string `json:"tenant"`
+}
+
+// JWTConfig controls bearer token validation
+type JWTConfig struct {
+	HMACSecret string   `json:"hmac_secret"`
+	JWKSFile   string   `json:"jwks_file"`
+	Issuer     string   `json:"issuer"`
+	Audience   string   `json:"audience"`
+	Leeway     Duration `json:"leeway"`
+	// RequireExp rejects tokens without an exp claim, true by default
+	RequireExp bool `json:"require_exp"`
+	// MaxLifetime rejects tokens expiring further ahead, unlimited when 0
+	MaxLifetime Duration `json:"max_lifetime"`
+}
+
+// Duration is a time.Duration read from strings such as "250ms" or "1m"
+type Duration time.Duration
+
+// UnmarshalJSON parses a Go duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON renders the duration as a Go duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Default returns the configuration used when no file is provided
+func Default() Config {
+	return Config{
+		ServerAddress:   ":8081",
+		EventBufferSize: 100,
+		Pool: PoolConfig{
+			Workers:    3,
+			MinWorkers: 1,
+			MaxWorkers: 16,
+			Partitions: 16,
+			MaxPending: 1000,
+			Autoscale: AutoscaleConfig{
+				Interval:               Duration(time.Second),
+				Cooldown:               Duration(5 * time.Second),
+				TargetPendingPerWorker: 50,
+				TargetLatency:          Duration(100 * time.Millisecond),
+			},
+		},
+		Tenancy: TenancyConfig{
+			PurgeInterval: Duration(time.Minute),
+		},
+		TLS: TLSConfig{
+			ReloadInterval: Duration(10 * time.Second),
+		},
+		Auth: AuthConfig{
+			JWT: JWTConfig{RequireExp: true},
+		},
+		Limits: LimitsConfig{
+			MaxBodyBytes:    1 << 20,
+			MaxPayloadBytes: 256 << 10,
+			MaxBatchEvents:  500,
+		},
+		Publish: PublishConfig{
+			Output: "log",
+			Format: "json",
+		},
+		Routing: RoutingConfig{
+			Default:   DefaultPipeline,
+			QueueSize: 1000,
+		},
+		Expressions: ExpressionsConfig{
+			MaxSteps: expr.DefaultLimits.MaxSteps,
+			Timeout:  Duration(expr.DefaultLimits.Timeout),
+		},
+		Compression: CompressionConfig{
+			Enabled:  true,
+			MinBytes: 1024,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     Duration(24 * time.Hour),
+			MaxKeys: 10000,
+		},
+		DeadLetter: DeadLetterConfig{
+			MaxEntries: 10000,
+		},
+		Ingest: IngestConfig{
+			Backpressure: BackpressureConfig{
+				MaxQueueDepth: 800,
+				MaxLag:        Duration(5 * time.Second),
+				ResumeRatio:   0.8,
+				MaxRetryAfter: Duration(30 * time.Second),
+			},
+		},
+	}
+}
+
+// Load reads a JSON config file on top of the defaults. An empty path
+// returns the defaults unchanged.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the settings are usable
+func (c Config) Validate() error {
+	if c.ServerAddress == "" {
+		return Error("server_address is required")
+	}
+	if c.EventBufferSize <= 0 {
+		return Error("event_buffer_size must be positive")
+	}
+	for name, lane := range c.Lanes {
+		if name == "" || !models.ValidPriority(models.Priority(name)) {
+			return Error("lanes has an unknown lane: " + name)
+		}
+		if lane.Weight < 0 || lane.Capacity < 0 {
+			return Error("lanes." + name + " weight and capacity must not be negative")
+		}
+	}
+	if c.Pool.Workers <= 0 {
+		return Error("pool.workers must be positive")
+	}
+	if c.Pool.MinWorkers <= 0 || c.Pool.MinWorkers > c.Pool.Workers || c.Pool.MaxWorkers < c.Pool.Workers {
+		return Error("pool workers must satisfy 0 < min_workers <= workers <= max_workers")
+	}
+	if c.Pool.Partitions <= 0 {
+		return Error("pool.partitions must be positive")
+	}
+	if c.Pool.MaxPending <= 0 {
+		return Error("pool.max_pending must be positive")
+	}
+	if c.Tenancy.PurgeInterval <= 0 {
+		return Error("tenancy.purge_interval must be positive")
+	}
+	for name := range c.Tenancy.Tenants {
+		if !models.ValidTenant(name) {
+			return Error("tenancy.tenants has an invalid tenant name: " + name)
+		}
+	}
+	if c.Limits.MaxBodyBytes <= 0 || c.Limits.MaxPayloadBytes <= 0 {
+		return Error("limits.max_body_bytes and limits.max_payload_bytes must be positive")
+	}
+	if c.Compression.MinBytes < 0 {
+		return Error("compression.min_bytes must not be negative")
+	}
+	if c.DeadLetter.MaxEntries < 0 {
+		return Error("dead_letter.max_entries must not be negative")
+	}
+	if c.Idempotency.MaxKeys < 0 || (c.Idempotency.MaxKeys > 0 && c.Idempotency.TTL <= 0) {
+		return Error("idempotency.max_keys must not be negative and idempotency.ttl must be positive")
+	}
+	if c.Limits.MaxBatchEvents <= 0 {
+		return Error("limits.max_batch_events must be positive")
+	}
+	if err := c.Publish.validate("publish"); err != nil {
+		return err
+	}
+	if c.Expressions.MaxSteps <= 0 || c.Expressions.Timeout <= 0 {
+		return Error("expressions.max_steps and expressions.timeout must be positive")
+	}
+	if err := c.validatePipelines(); err != nil {
+		return err
+	}
+	if int64(c.Limits.MaxPayloadBytes) > c.Limits.MaxBodyBytes {
+		return Error("limits.max_payload_bytes must not exceed limits.max_body_bytes")
+	}
+	if c.Ingest.ClientRateLimit.EventsPerSecond < 0 {
+		return Error("ingest.client_rate_limit.events_per_second must not be negative")
+	}
+	if c.Ingest.Backpressure.MaxQueueDepth < 0 || c.Ingest.Backpressure.MaxLag < 0 {
+		return Error("ingest.backpressure thresholds must not be negative")
+	}
+	if r := c.Ingest.Backpressure.ResumeRatio; r <= 0 || r > 1 {
+		return Error("ingest.backpressure.resume_ratio must be in (0, 1]")
+	}
+	if c.Auth.Enabled && len(c.Auth.APIKeys) == 0 && c.Auth.JWT.HMACSecret == "" && c.Auth.JWT.JWKSFile == "" && len(c.Auth.ClientCerts) == 0 {
+		return Error("auth is enabled but no api_keys, jwt.hmac_secret, jwt.jwks_file or client_certs is configured")
+	}
+	if c.TLS.Enabled() && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		return Error("tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		return Error("tls.client_ca_file requires tls.cert_file and tls.key_file")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		return Error("tls.require_client_cert requires tls.client_ca_file")
+	}
+	if c.Auth.JWT.MaxLifetime < 0 {
+		return Error("auth.jwt.max_lifetime must not be negative")
+	}
+	if len(c.Auth.ClientCerts) > 0 && c.TLS.ClientCAFile == "" {
+		return Error("auth.client_certs requires tls.client_ca_file")
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		return Error("tls.reload_interval must be positive")
+	}
+	return nil
+}
+
+// validate checks the output of a sink, named field in errors
+func (p PublishConfig) validate(field string) error {
+	if p.Output != "log" && p.Output != "stdout" {
+		return Error(field + ".output must be log or stdout")
+	}
+	if _, ok := codec.Default().ByName(p.Format); !ok {
+		return Error(field + ".format must be json, protobuf, msgpack or cbor")
+	}
+	return nil
+}
+
+// HasPipeline reports whether a pipeline is configured or is the default
+func (c Config) HasPipeline(name string) bool {
+	_, ok := c.Pipelines[name]
+	return ok || name == DefaultPipeline
+}
+
+// validatePipelines checks the sinks, the pipelines and the routes leading
+// to them
+func (c Config) validatePipelines() error {
+	for name, sink := range c.Sinks {
+		if name == DefaultSink {
+			return Error("sinks." + DefaultSink + " is set by publish")
+		}
+		if !namePattern.MatchString(name) {
+			return Error("sinks has an invalid sink name: " + name)
+		}
+		if err := sink.validate("sinks." + name); err != nil {
+			return err
+		}
+	}
+	for name, pipeline := range c.Pipelines {
+		if !namePattern.MatchString(name) {
+			return Error("pipelines has an invalid pipeline name: " + name)
+		}
+		if pipeline.Workers < 0 || pipeline.QueueSize < 0 {
+			return Error("pipelines." + name + " workers and queue_size must not be negative")
+		}
+		for i, t := range pipeline.Transforms {
+			if _, err := t.New(c.Expressions.Limits()); err != nil {
+				return Error(fmt.Sprintf("pipelines.%s.transforms[%d]: %v", name, i, err))
+			}
+		}
+		for _, sink := range pipeline.Sinks {
+			if _, ok := c.Sinks[sink]; !ok && sink != DefaultSink {
+				return Error("pipelines." + name + " has an unknown sink: " + sink)
+			}
+		}
+	}
+	if c.Routing.QueueSize <= 0 {
+		return Error("routing.queue_size must be positive")
+	}
+	for i, route := range c.Routing.Routes {
+		if !c.HasPipeline(route.Pipeline) {
+			return Error(fmt.Sprintf("routing.routes[%d] has an unknown pipeline: %s", i, route.Pipeline))
+		}
+		if _, err := routing.Compile(route.Match, c.Expressions.Limits()); err != nil {
+			return Error(fmt.Sprintf("routing.routes[%d]: %v", i, err))
+		}
+	}
+	if c.Routing.Default != "" && !c.HasPipeline(c.Routing.Default) {
+		return Error("routing.default has an unknown pipeline: " + c.Routing.Default)
+	}
+	return nil
+}
+
+// Error is a simple string-based error type
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
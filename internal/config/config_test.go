@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Failed to load defaults: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Expected defaults, got %+v", cfg)
+	}
+}
+
+func TestLoadOverridesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"pool":{"partitions":4},"auth":{"jwt":{"issuer":"idp"}}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Pool.Partitions != 4 {
+		t.Errorf("Expected 4 partitions, got %d", cfg.Pool.Partitions)
+	}
+	if cfg.Pool.Workers != Default().Pool.Workers {
+		t.Errorf("Expected default workers, got %d", cfg.Pool.Workers)
+	}
+	if !cfg.Auth.JWT.RequireExp {
+		t.Error("Expected tokens to need an exp claim by default")
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"pool":{"partitions":0}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("Expected error for zero partitions")
+	}
+}
+
+func TestLoadLanes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"lanes":{"low":{"weight":1,"capacity":10}}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Lanes["low"].Capacity != 10 {
+		t.Errorf("Expected low lane capacity 10, got %+v", cfg.Lanes)
+	}
+
+	for _, body := range []string{`{"lanes":{"urgent":{}}}`, `{"lanes":{"high":{"weight":-1}}}`} {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expected %s to be rejected", body)
+		}
+	}
+}
+
+func TestLoadPipelines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	valid := `{
+		"sinks": {"audit": {"output": "stdout", "format": "json"}},
+		"pipelines": {"audit": {"transforms": [{"type": "trim"}], "sinks": ["audit", "default"], "workers": 2}},
+		"routing": {"routes": [{"pipeline": "audit", "match": {"type": "audit", "payload_regex": "^user"}}]}
+	}`
+	if err := os.WriteFile(path, []byte(valid), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Routing.Default != DefaultPipeline || len(cfg.Routing.Routes) != 1 || cfg.Pipelines["audit"].Workers != 2 {
+		t.Errorf("Unexpected routing %+v", cfg.Routing)
+	}
+
+	for _, body := range []string{
+		`{"sinks": {"default": {"output": "log", "format": "json"}}}`,
+		`{"sinks": {"audit": {"output": "file", "format": "json"}}}`,
+		`{"pipelines": {"audit": {"sinks": ["missing"]}}}`,
+		`{"pipelines": {"audit": {"transforms": [{"type": "reverse"}]}}}`,
+		`{"pipelines": {"bad name": {}}}`,
+		`{"routing": {"routes": [{"pipeline": "missing"}]}}`,
+		`{"routing": {"routes": [{"pipeline": "default", "match": {"payload_regex": "("}}]}}`,
+		`{"routing": {"routes": [{"pipeline": "default", "match": {"json_path": "$..a"}}]}}`,
+		`{"routing": {"default": "missing"}}`,
+		`{"routing": {"routes": [{"pipeline": "default", "match": {"expr": "type = 'a'"}}]}}`,
+		`{"pipelines": {"audit": {"transforms": [{"type": "filter"}]}}}`,
+		`{"pipelines": {"audit": {"transforms": [{"type": "filter", "expr": "payload"}]}}}`,
+		`{"pipelines": {"audit": {"transforms": [{"type": "map", "fields": {"id": "payload"}}]}}}`,
+		`{"pipelines": {"audit": {"transforms": [{"type": "trim", "expr": "true"}]}}}`,
+		`{"expressions": {"max_steps": 0}}`,
+		`{"routing": {"queue_size": 0}}`,
+		`{"pipelines": {"audit": {"queue_size": -1}}}`,
+		`{"dead_letter": {"max_entries": -1}}`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expected %s to be rejected", body)
+		}
+	}
+}
+
+func TestLoadExpressions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	valid := `{
+		"expressions": {"max_steps": 500, "timeout": "5ms"},
+		"pipelines": {"eu": {"transforms": [
+			{"type": "filter", "expr": "attributes.env != 'test'"},
+			{"type": "map", "fields": {"payload": "upper(payload)", "attributes.pipeline": "'eu'"}}
+		]}},
+		"routing": {"routes": [{"pipeline": "eu", "match": {"expr": "attributes.region in ['de', 'fr']"}}]}
+	}`
+	if err := os.WriteFile(path, []byte(valid), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if limits := cfg.Expressions.Limits(); limits.MaxSteps != 500 || limits.Timeout != 5*time.Millisecond {
+		t.Errorf("Unexpected expression limits %+v", limits)
+	}
+
+	// Errors name the transform and the column of the expression
+	invalid := `{"pipelines": {"eu": {"transforms": [{"type": "trim"}, {"type": "filter", "expr": "atributes.env == 'x'"}]}}}`
+	if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	want := `pipelines.eu.transforms[1]: column 1: unknown variable "atributes"`
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,245 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Type is the type of a value, as far as it is known before evaluation
+type Type int
+
+const (
+	// TypeAny is a value whose type is only known once evaluated, such
+	// as a field of a map
+	TypeAny Type = iota
+	TypeNull
+	TypeBool
+	TypeInt
+	TypeFloat
+	TypeString
+	TypeList
+	TypeMap
+)
+
+var typeNames = [...]string{"any", "null", "bool", "int", "float", "string", "list", "map"}
+
+func (t Type) String() string {
+	return typeNames[t]
+}
+
+// numeric reports whether values of type t may be numbers
+func (t Type) numeric() bool {
+	return t == TypeAny || t == TypeInt || t == TypeFloat
+}
+
+// accepts reports whether a value of type got may be used where one of
+// type t is expected
+func (t Type) accepts(got Type) bool {
+	return t == TypeAny || got == TypeAny || t == got || (t == TypeFloat && got == TypeInt)
+}
+
+// checker infers the types of a syntax tree, rejecting the operations that
+// would fail on every evaluation
+type checker struct {
+	src string
+	env Env
+}
+
+func (c *checker) errorf(n node, format string, args ...interface{}) *Error {
+	return errorAt(c.src, n.offset(), fmt.Sprintf(format, args...))
+}
+
+// check returns the type of the values of n
+func (c *checker) check(n node) (Type, error) {
+	switch n := n.(type) {
+	case *literal:
+		return TypeOf(n.value), nil
+	case *variable:
+		t, ok := c.env.vars[n.name]
+		if !ok {
+			return 0, c.errorf(n, "unknown variable %q", n.name)
+		}
+		return t, nil
+	case *unary:
+		x, err := c.check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		if n.op == "!" {
+			if !TypeBool.accepts(x) {
+				return 0, c.errorf(n, "operator ! needs a bool, not %s", x)
+			}
+			return TypeBool, nil
+		}
+		if !x.numeric() {
+			return 0, c.errorf(n, "operator - needs a number, not %s", x)
+		}
+		return x, nil
+	case *binary:
+		return c.binary(n)
+	case *conditional:
+		cond, err := c.check(n.cond)
+		if err != nil {
+			return 0, err
+		}
+		if !TypeBool.accepts(cond) {
+			return 0, c.errorf(n, "condition of ?: must be a bool, not %s", cond)
+		}
+		then, err := c.check(n.then)
+		if err != nil {
+			return 0, err
+		}
+		els, err := c.check(n.els)
+		if err != nil {
+			return 0, err
+		}
+		if then != els {
+			return TypeAny, nil
+		}
+		return then, nil
+	case *member:
+		x, err := c.check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		if x != TypeAny && x != TypeMap && x != TypeNull {
+			return 0, c.errorf(n, "cannot read field %s of %s", n.name, x)
+		}
+		return TypeAny, nil
+	case *index:
+		return c.index(n)
+	case *call:
+		for i, arg := range n.args {
+			t, err := c.check(arg)
+			if err != nil {
+				return 0, err
+			}
+			if !n.fn.params[i].accepts(t) {
+				return 0, c.errorf(arg, "argument %d of %s must be %s, not %s", i+1, n.fn.name, n.fn.params[i], t)
+			}
+		}
+		return n.fn.result, nil
+	case *list:
+		for _, item := range n.items {
+			if _, err := c.check(item); err != nil {
+				return 0, err
+			}
+		}
+		return TypeList, nil
+	}
+	return 0, c.errorf(n, "unsupported expression")
+}
+
+// binary checks the operands of a binary operator
+func (c *checker) binary(n *binary) (Type, error) {
+	x, err := c.check(n.x)
+	if err != nil {
+		return 0, err
+	}
+	y, err := c.check(n.y)
+	if err != nil {
+		return 0, err
+	}
+	mismatch := func() (Type, error) {
+		return 0, c.errorf(n, "operator %s does not apply to %s and %s", n.op, x, y)
+	}
+
+	switch n.op {
+	case "||", "&&":
+		if !TypeBool.accepts(x) || !TypeBool.accepts(y) {
+			return mismatch()
+		}
+		return TypeBool, nil
+	case "==", "!=":
+		// Values of different types are never equal, which is most likely
+		// a mistake such as comparing an attribute to a number
+		if x != TypeAny && y != TypeAny && x != TypeNull && y != TypeNull &&
+			!x.accepts(y) && !y.accepts(x) {
+			return 0, c.errorf(n, "comparing %s and %s is always %t", x, y, n.op == "!=")
+		}
+		return TypeBool, nil
+	case "<", "<=", ">", ">=":
+		if (x.numeric() && y.numeric()) || (TypeString.accepts(x) && TypeString.accepts(y)) {
+			return TypeBool, nil
+		}
+		return mismatch()
+	case "in":
+		switch y {
+		case TypeAny, TypeList, TypeMap:
+			return TypeBool, nil
+		case TypeString:
+			if TypeString.accepts(x) {
+				return TypeBool, nil
+			}
+		}
+		return mismatch()
+	case "matches":
+		if !TypeString.accepts(x) || !TypeString.accepts(y) {
+			return mismatch()
+		}
+		if pattern, ok := n.y.(*literal); ok {
+			re, err := regexp.Compile(pattern.value.(string))
+			if err != nil {
+				return 0, c.errorf(n.y, "invalid regular expression: %v", err)
+			}
+			n.re = re
+		}
+		return TypeBool, nil
+	case "+":
+		if x == TypeString || y == TypeString {
+			if !TypeString.accepts(x) || !TypeString.accepts(y) {
+				return mismatch()
+			}
+			return TypeString, nil
+		}
+		fallthrough
+	case "-", "*", "/":
+		if !x.numeric() || !y.numeric() {
+			return mismatch()
+		}
+		return numericResult(x, y), nil
+	case "%":
+		if !TypeInt.accepts(x) || !TypeInt.accepts(y) {
+			return mismatch()
+		}
+		return TypeInt, nil
+	}
+	return mismatch()
+}
+
+// numericResult is the type of arithmetic on numbers of types x and y
+func numericResult(x, y Type) Type {
+	switch {
+	case x == TypeAny || y == TypeAny:
+		return TypeAny
+	case x == TypeFloat || y == TypeFloat:
+		return TypeFloat
+	}
+	return TypeInt
+}
+
+// index checks an index into a list or a map
+func (c *checker) index(n *index) (Type, error) {
+	x, err := c.check(n.x)
+	if err != nil {
+		return 0, err
+	}
+	i, err := c.check(n.index)
+	if err != nil {
+		return 0, err
+	}
+	switch x {
+	case TypeList:
+		if !TypeInt.accepts(i) {
+			return 0, c.errorf(n, "list index must be an int, not %s", i)
+		}
+	case TypeMap:
+		if !TypeString.accepts(i) {
+			return 0, c.errorf(n, "map key must be a string, not %s", i)
+		}
+	case TypeAny, TypeNull:
+	default:
+		return 0, c.errorf(n, "cannot index %s", x)
+	}
+	return TypeAny, nil
+}
@@ -0,0 +1,461 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// bytesPerStep is the number of bytes a function building or scanning
+	// strings handles per step
+	bytesPerStep = 64
+	// clockEvery is the number of steps between checks of the deadline
+	clockEvery = 32
+)
+
+// evaluator evaluates one program against its variables
+type evaluator struct {
+	src      string
+	vars     Vars
+	limits   Limits
+	deadline time.Time
+	steps    int
+}
+
+func (e *evaluator) errorf(n node, format string, args ...interface{}) *Error {
+	return errorAt(e.src, n.offset(), fmt.Sprintf(format, args...))
+}
+
+// step charges n steps, failing once the limits are exceeded
+func (e *evaluator) step(n int) error {
+	before := e.steps
+	e.steps += n
+	if e.steps > e.limits.MaxSteps {
+		return ErrStepLimit
+	}
+	// The deadline is read from the wall clock: it bounds CPU time,
+	// whatever clock drives the rest of the application
+	if e.steps/clockEvery != before/clockEvery && time.Now().After(e.deadline) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// charge takes the steps of handling size bytes
+func (e *evaluator) charge(size int) error {
+	return e.step(size / bytesPerStep)
+}
+
+// eval evaluates n
+func (e *evaluator) eval(n node) (interface{}, error) {
+	if err := e.step(1); err != nil {
+		return nil, err
+	}
+	switch n := n.(type) {
+	case *literal:
+		return n.value, nil
+	case *variable:
+		return e.vars[n.name], nil
+	case *unary:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		switch x := x.(type) {
+		case bool:
+			if n.op == "!" {
+				return !x, nil
+			}
+		case int64:
+			if n.op == "-" {
+				return -x, nil
+			}
+		case float64:
+			if n.op == "-" {
+				return -x, nil
+			}
+		}
+		return nil, e.errorf(n, "operator %s does not apply to %s", n.op, TypeOf(x))
+	case *binary:
+		return e.binary(n)
+	case *conditional:
+		cond, err := e.eval(n.cond)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := cond.(bool)
+		if !ok {
+			return nil, e.errorf(n, "condition of ?: must be a bool, not %s", TypeOf(cond))
+		}
+		if b {
+			return e.eval(n.then)
+		}
+		return e.eval(n.els)
+	case *member:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		switch x := x.(type) {
+		case nil:
+			return nil, nil
+		case map[string]interface{}:
+			return x[n.name], nil
+		}
+		return nil, e.errorf(n, "cannot read field %s of %s", n.name, TypeOf(x))
+	case *index:
+		return e.index(n)
+	case *call:
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			v, err := e.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			if !n.fn.params[i].accepts(TypeOf(v)) {
+				return nil, e.errorf(arg, "argument %d of %s must be %s, not %s", i+1, n.fn.name, n.fn.params[i], TypeOf(v))
+			}
+			args[i] = v
+		}
+		v, err := n.fn.call(e, args)
+		if err != nil {
+			if _, ok := err.(limitError); ok {
+				return nil, err
+			}
+			return nil, e.errorf(n, "%s: %v", n.fn.name, err)
+		}
+		return v, nil
+	case *list:
+		items := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			v, err := e.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	}
+	return nil, e.errorf(n, "unsupported expression")
+}
+
+// binary evaluates a binary operator
+func (e *evaluator) binary(n *binary) (interface{}, error) {
+	x, err := e.eval(n.x)
+	if err != nil {
+		return nil, err
+	}
+	// The logical operators only evaluate their right operand when needed
+	if n.op == "&&" || n.op == "||" {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, e.errorf(n, "operator %s needs bools, not %s", n.op, TypeOf(x))
+		}
+		if b == (n.op == "||") {
+			return b, nil
+		}
+		y, err := e.eval(n.y)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok = y.(bool); !ok {
+			return nil, e.errorf(n, "operator %s needs bools, not %s", n.op, TypeOf(y))
+		}
+		return b, nil
+	}
+	y, err := e.eval(n.y)
+	if err != nil {
+		return nil, err
+	}
+	mismatch := func() error {
+		return e.errorf(n, "operator %s does not apply to %s and %s", n.op, TypeOf(x), TypeOf(y))
+	}
+
+	switch n.op {
+	case "==", "!=":
+		eq, err := e.equal(x, y)
+		if err != nil {
+			return nil, err
+		}
+		return eq == (n.op == "=="), nil
+	case "<", "<=", ">", ">=":
+		c, ok := compare(x, y)
+		if !ok {
+			return nil, mismatch()
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in":
+		return e.in(n, x, y)
+	case "matches":
+		s, ok1 := x.(string)
+		pattern, ok2 := y.(string)
+		if !ok1 || !ok2 {
+			return nil, mismatch()
+		}
+		re := n.re
+		if re == nil {
+			if err := e.charge(len(pattern) * bytesPerStep); err != nil {
+				return nil, err
+			}
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, e.errorf(n.y, "invalid regular expression: %v", err)
+			}
+		}
+		// Go regular expressions run in time linear in the input
+		if err := e.charge(len(s)); err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	case "+":
+		if xs, ok := x.(string); ok {
+			ys, ok := y.(string)
+			if !ok {
+				return nil, mismatch()
+			}
+			if err := e.charge(len(xs) + len(ys)); err != nil {
+				return nil, err
+			}
+			return xs + ys, nil
+		}
+	}
+	return e.arithmetic(n, x, y, mismatch)
+}
+
+// arithmetic evaluates the operators on numbers
+func (e *evaluator) arithmetic(n *binary, x, y interface{}, mismatch func() error) (interface{}, error) {
+	xi, xInt := x.(int64)
+	yi, yInt := y.(int64)
+	if xInt && yInt {
+		switch n.op {
+		case "+":
+			return xi + yi, nil
+		case "-":
+			return xi - yi, nil
+		case "*":
+			return xi * yi, nil
+		case "/", "%":
+			if yi == 0 {
+				return nil, e.errorf(n, "division by zero")
+			}
+			if xi == math.MinInt64 && yi == -1 {
+				return nil, e.errorf(n, "integer overflow")
+			}
+			if n.op == "/" {
+				return xi / yi, nil
+			}
+			return xi % yi, nil
+		}
+	}
+	xf, ok1 := toFloat(x)
+	yf, ok2 := toFloat(y)
+	if !ok1 || !ok2 || n.op == "%" {
+		return nil, mismatch()
+	}
+	switch n.op {
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	case "/":
+		if yf == 0 {
+			return nil, e.errorf(n, "division by zero")
+		}
+		return xf / yf, nil
+	}
+	return nil, mismatch()
+}
+
+// in tests membership of a list, a key of a map or a substring
+func (e *evaluator) in(n *binary, x, y interface{}) (interface{}, error) {
+	switch y := y.(type) {
+	case []interface{}:
+		for _, item := range y {
+			eq, err := e.equal(x, item)
+			if err != nil || eq {
+				return eq, err
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := x.(string)
+		if !ok {
+			return nil, e.errorf(n, "map key must be a string, not %s", TypeOf(x))
+		}
+		_, ok = y[key]
+		return ok, nil
+	case string:
+		sub, ok := x.(string)
+		if !ok {
+			return nil, e.errorf(n, "operator in on a string needs a string, not %s", TypeOf(x))
+		}
+		if err := e.charge(len(y)); err != nil {
+			return nil, err
+		}
+		return strings.Contains(y, sub), nil
+	}
+	return nil, e.errorf(n, "operator in does not apply to %s", TypeOf(y))
+}
+
+// index evaluates an index into a list or a map, null when out of range
+func (e *evaluator) index(n *index) (interface{}, error) {
+	x, err := e.eval(n.x)
+	if err != nil {
+		return nil, err
+	}
+	i, err := e.eval(n.index)
+	if err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		pos, ok := i.(int64)
+		if !ok {
+			return nil, e.errorf(n, "list index must be an int, not %s", TypeOf(i))
+		}
+		if pos < 0 || pos >= int64(len(x)) {
+			return nil, nil
+		}
+		return x[pos], nil
+	case map[string]interface{}:
+		key, ok := i.(string)
+		if !ok {
+			return nil, e.errorf(n, "map key must be a string, not %s", TypeOf(i))
+		}
+		return x[key], nil
+	}
+	return nil, e.errorf(n, "cannot index %s", TypeOf(x))
+}
+
+// equal compares two values, numbers by value whatever their type
+func (e *evaluator) equal(x, y interface{}) (bool, error) {
+	if err := e.step(1); err != nil {
+		return false, err
+	}
+	switch x := x.(type) {
+	case nil:
+		return y == nil, nil
+	case bool:
+		b, ok := y.(bool)
+		return ok && b == x, nil
+	case string:
+		s, ok := y.(string)
+		if ok {
+			return s == x, e.charge(len(s))
+		}
+		return false, nil
+	case int64, float64:
+		if xi, ok := x.(int64); ok {
+			if yi, ok := y.(int64); ok {
+				return xi == yi, nil
+			}
+		}
+		xf, _ := toFloat(x)
+		yf, ok := toFloat(y)
+		return ok && xf == yf, nil
+	case []interface{}:
+		l, ok := y.([]interface{})
+		if !ok || len(l) != len(x) {
+			return false, nil
+		}
+		for i := range x {
+			if eq, err := e.equal(x[i], l[i]); err != nil || !eq {
+				return false, err
+			}
+		}
+		return true, nil
+	case map[string]interface{}:
+		m, ok := y.(map[string]interface{})
+		if !ok || len(m) != len(x) {
+			return false, nil
+		}
+		for key, value := range x {
+			other, ok := m[key]
+			if !ok {
+				return false, nil
+			}
+			if eq, err := e.equal(value, other); err != nil || !eq {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// compare orders two numbers or two strings
+func compare(x, y interface{}) (int, bool) {
+	if xs, ok := x.(string); ok {
+		ys, ok := y.(string)
+		return strings.Compare(xs, ys), ok
+	}
+	if xi, ok := x.(int64); ok {
+		if yi, ok := y.(int64); ok {
+			switch {
+			case xi < yi:
+				return -1, true
+			case xi > yi:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	xf, ok1 := toFloat(x)
+	yf, ok2 := toFloat(y)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case xf < yf:
+		return -1, true
+	case xf > yf:
+		return 1, true
+	}
+	return 0, true
+}
+
+// toFloat converts a number to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// TypeOf returns the type of a value returned by an evaluation
+func TypeOf(v interface{}) Type {
+	switch v.(type) {
+	case nil:
+		return TypeNull
+	case bool:
+		return TypeBool
+	case int64:
+		return TypeInt
+	case float64:
+		return TypeFloat
+	case string:
+		return TypeString
+	case []interface{}:
+		return TypeList
+	case map[string]interface{}:
+		return TypeMap
+	}
+	return TypeAny
+}
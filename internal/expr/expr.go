@@ -0,0 +1,235 @@
+// Package expr is a small expression language for routing conditions,
+// filters and field mappings written in the config. Expressions are
+// sandboxed: they only read the variables of their environment, have no
+// loops or side effects, and each evaluation is bounded in steps and time.
+//
+// An expression combines literals ("text", 'text', 42, 1.5, true, false,
+// null, [1, 2]) and variables with the operators, from the lowest
+// precedence up:
+//
+//	c ? a : b
+//	||
+//	&&
+//	== != < <= > >= in matches
+//	+ -
+//	* / %
+//	! - (unary)
+//	.field [index] f(args)
+//
+// "in" tests membership of a list, a key of a map or a substring, and
+// "matches" a regular expression. Fields and indexes that do not exist
+// yield null rather than an error, so json(payload).user.role is null when
+// the payload has no user.
+package expr
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"coding_challenge/internal/models"
+)
+
+const (
+	// maxSourceLen bounds the length of an expression's source
+	maxSourceLen = 4096
+	// maxDepth bounds the nesting of an expression
+	maxDepth = 64
+)
+
+// Limits bound one evaluation of an expression. Zero fields take the
+// defaults of DefaultLimits.
+type Limits struct {
+	// MaxSteps bounds the operations of an evaluation. Every operator,
+	// variable and call is a step, and functions building or scanning
+	// strings take a step per 64 bytes.
+	MaxSteps int
+	// Timeout bounds the wall time of an evaluation
+	Timeout time.Duration
+}
+
+// DefaultLimits are the limits of an evaluation unless set otherwise
+var DefaultLimits = Limits{MaxSteps: 10000, Timeout: 10 * time.Millisecond}
+
+// withDefaults fills the unset limits from DefaultLimits
+func (l Limits) withDefaults() Limits {
+	if l.MaxSteps <= 0 {
+		l.MaxSteps = DefaultLimits.MaxSteps
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = DefaultLimits.Timeout
+	}
+	return l
+}
+
+// Error is an error in an expression, while compiling or evaluating it
+type Error struct {
+	// Column is the 1-based position in characters where the error is
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// errorAt returns an Error at the byte offset pos of src
+func errorAt(src string, pos int, msg string) *Error {
+	return &Error{Column: utf8.RuneCountInString(src[:pos]) + 1, Msg: msg}
+}
+
+// limitError is an evaluation stopped by its Limits
+type limitError string
+
+func (e limitError) Error() string {
+	return string(e)
+}
+
+// Errors of evaluations exceeding their limits
+const (
+	ErrStepLimit = limitError("expression exceeded its step limit")
+	ErrTimeout   = limitError("expression exceeded its time limit")
+)
+
+// Vars holds the values of the variables of an evaluation
+type Vars map[string]interface{}
+
+// Env declares the variables expressions may use, with their types
+type Env struct {
+	vars map[string]Type
+}
+
+// EventEnv is the environment of expressions on a received Event, such as
+// routing conditions
+var EventEnv = Env{vars: map[string]Type{
+	"id":            TypeString,
+	"tenant":        TypeString,
+	"type":          TypeString,
+	"payload":       TypeString,
+	"attributes":    TypeMap,
+	"timestamp":     TypeInt,
+	"partition_key": TypeString,
+	"priority":      TypeString,
+	"deliver_at":    TypeInt,
+}}
+
+// TransformedEnv is the environment of expressions on a TransformedEvent,
+// such as filters and field mappings
+var TransformedEnv = Env{vars: map[string]Type{
+	"id":           TypeString,
+	"tenant":       TypeString,
+	"type":         TypeString,
+	"payload":      TypeString,
+	"attributes":   TypeMap,
+	"timestamp":    TypeInt,
+	"processed_at": TypeInt,
+	"processor_id": TypeString,
+}}
+
+// EventVars returns the variables of EventEnv for an event
+func EventVars(e *models.Event) Vars {
+	return Vars{
+		"id":            e.ID,
+		"tenant":        e.Tenant,
+		"type":          e.Type,
+		"payload":       e.Payload,
+		"attributes":    attributes(e.Attributes),
+		"timestamp":     e.Timestamp,
+		"partition_key": e.PartitionKey,
+		"priority":      string(e.Lane()),
+		"deliver_at":    e.DeliverAt,
+	}
+}
+
+// TransformedVars returns the variables of TransformedEnv for an event.
+// The timestamp is its original time and processed_at is in Unix seconds.
+func TransformedVars(e *models.TransformedEvent) Vars {
+	return Vars{
+		"id":           e.ID,
+		"tenant":       e.Tenant,
+		"type":         e.Type,
+		"payload":      e.Payload,
+		"attributes":   attributes(e.Attributes),
+		"timestamp":    e.OriginalTime,
+		"processed_at": e.ProcessedAt.Unix(),
+		"processor_id": e.ProcessorID,
+	}
+}
+
+// attributes converts event attributes to a map value
+func attributes(m map[string]string) map[string]interface{} {
+	values := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		values[key] = value
+	}
+	return values
+}
+
+// Program is a compiled expression, safe for concurrent use
+type Program struct {
+	src    string
+	root   node
+	typ    Type
+	limits Limits
+}
+
+// Compile parses and checks an expression using the variables of the
+// environment. Evaluations of the program are bounded by limits.
+func (e Env) Compile(src string, limits Limits) (*Program, error) {
+	if len(src) > maxSourceLen {
+		return nil, &Error{Column: 1, Msg: fmt.Sprintf("expression longer than %d bytes", maxSourceLen)}
+	}
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := (&checker{src: src, env: e}).check(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{src: src, root: root, typ: typ, limits: limits.withDefaults()}, nil
+}
+
+// CompileCondition compiles an expression that must return a bool
+func (e Env) CompileCondition(src string, limits Limits) (*Program, error) {
+	p, err := e.Compile(src, limits)
+	if err != nil {
+		return nil, err
+	}
+	if p.typ != TypeAny && p.typ != TypeBool {
+		return nil, &Error{Column: 1, Msg: "expression must return a bool, not " + p.typ.String()}
+	}
+	return p, nil
+}
+
+// String returns the source of the program
+func (p *Program) String() string {
+	return p.src
+}
+
+// Type returns the type of the values of the program, TypeAny when it is
+// only known once evaluated
+func (p *Program) Type() Type {
+	return p.typ
+}
+
+// Eval evaluates the program with the values of its variables. The result
+// is nil, a bool, an int64, a float64, a string, a []interface{} or a
+// map[string]interface{}.
+func (p *Program) Eval(vars Vars) (interface{}, error) {
+	e := &evaluator{src: p.src, vars: vars, limits: p.limits, deadline: time.Now().Add(p.limits.Timeout)}
+	return e.eval(p.root)
+}
+
+// EvalBool evaluates a program that must return a bool
+func (p *Program) EvalBool(vars Vars) (bool, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, &Error{Column: 1, Msg: "expression returned " + TypeOf(v).String() + ", not a bool"}
+	}
+	return b, nil
+}
@@ -0,0 +1,213 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/models"
+)
+
+func testVars() Vars {
+	return EventVars(&models.Event{
+		ID: "order-1", Tenant: "acme", Type: "order.created", Timestamp: 1625097600,
+		Payload:    `{"user": {"name": "Ann", "roles": ["admin", "dev"]}, "total": 12.5, "items": 3}`,
+		Attributes: map[string]string{"region": "eu", "source": "web"},
+	})
+}
+
+func FuzzCompile(f *testing.F) {
+	f.Add(`type == "order.created" && attributes.region in ["eu", "us"]`)
+	f.Add(`json(payload).user.roles[0] matches "^adm"`)
+	f.Add(`default(attributes.x, "y") + string(timestamp * 2 / 3 % 5)`)
+	f.Add(`len(split(upper(payload), ",")) > 1 ? toJSON([1, 2.5, null]) : "x"`)
+	f.Add(`-(1 - -2.5) <= float("3") || !true`)
+	f.Add(`((((`)
+	f.Add(`"\u00e9\n" + '\''`)
+
+	vars := testVars()
+	f.Fuzz(func(t *testing.T, src string) {
+		p, err := EventEnv.Compile(src, Limits{MaxSteps: 1000})
+		if err != nil {
+			if _, ok := err.(*Error); !ok {
+				t.Fatalf("Expected an *Error, got %T %v", err, err)
+			}
+			return
+		}
+		v, err := p.Eval(vars)
+		if err != nil {
+			if _, ok := err.(*Error); !ok && err != ErrStepLimit && err != ErrTimeout {
+				t.Fatalf("Expected an *Error or a limit error, got %T %v", err, err)
+			}
+			return
+		}
+		// The checked type of a program is the type of its values
+		if got := TypeOf(v); got == TypeAny || (p.Type() != TypeAny && p.Type() != got) {
+			t.Fatalf("%s: checked as %s, evaluated to %s %#v", src, p.Type(), got, v)
+		}
+	})
+}
+
+func TestEval(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`type == "order.created" && attributes.region == 'eu'`, true},
+		{`attributes["source"] in ["web", "app"]`, true},
+		{`"region" in attributes && !("country" in attributes)`, true},
+		{`attributes.country`, nil},
+		{`default(attributes.country, "unknown")`, "unknown"},
+		{`startsWith(id, "order-") && id matches "^order-[0-9]+$"`, true},
+		{`json(payload).user.roles[0] == "admin"`, true},
+		{`json(payload).user.roles[5]`, nil},
+		{`json(payload).missing.field`, nil},
+		{`json(payload).items * 2 + 1`, int64(7)},
+		{`json(payload).total > 10 ? "big" : "small"`, "big"},
+		{`json(payload).items / 2`, int64(1)},
+		{`json(payload).items / 2.0`, 1.5},
+		{`7 % 3 == 1 && -timestamp < 0`, true},
+		{`upper(attributes.region) + "-" + lower("X")`, "EU-x"},
+		{`len("héllo") + len([1, 2]) + len(attributes)`, int64(9)},
+		{`split("a,b", ",")`, []interface{}{"a", "b"}},
+		{`join(split("a b c", " "), "-")`, "a-b-c"},
+		{`replace(trim("  a.b  "), ".", "::")`, "a::b"},
+		{`string(3) + string(1.5) + string(true) + string(null)`, "31.5true"},
+		{`int("42") + int(2.9) + float("0.5")`, 44.5},
+		{`toJSON(json('{"b": 1}') == null ? 1 : [1, "x", json('{"b": 1}')])`, `[1,"x",{"b":1}]`},
+		{`"ell" in "hello" && contains("hello", "ll") && endsWith("hello", "lo")`, true},
+		{`1 == 1.0 && [1, "a"] == [1, "a"] && null == null`, true},
+		{`"b" > "a" && 2 >= 1.5`, true},
+		{`false && json("") == 1`, false},
+		{`true || json("") == 1`, true},
+	}
+	vars := testVars()
+	for _, tc := range testCases {
+		p, err := EventEnv.Compile(tc.src, Limits{})
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tc.src, err)
+			continue
+		}
+		got, err := p.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%s): %v", tc.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{
+		{``, "column 1: empty expression"},
+		{`type ==`, "column 8: unexpected end of expression"},
+		{`atributes.region == "eu"`, `column 1: unknown variable "atributes"`},
+		{`type == "a" && processor_id == "w"`, `column 16: unknown variable "processor_id"`},
+		{`lenght(id)`, `column 1: unknown function "lenght"`},
+		{`lower(id, "x")`, "column 1: lower takes 1 arguments, got 2"},
+		{`lower(timestamp)`, "column 7: argument 1 of lower must be string, not int"},
+		{`timestamp == "1"`, "column 11: comparing int and string is always false"},
+		{`id + 1`, "column 4: operator + does not apply to string and int"},
+		{`id matches "("`, "column 12: invalid regular expression"},
+		{`type == "a" &&`, "column 15: unexpected end of expression"},
+		{`"open`, "column 1: unterminated string"},
+		{`id # 1`, `column 4: unexpected character '#'`},
+		{`payload.user`, "column 8: cannot read field user of string"},
+		{`(((((((((((((((((((((((((((((((((((((((((((((((((((((((((((((((((((1)))))))))))))))))))))))))))))))))))))))))))))))))))))))))))))))))))`, "nested more than 64 deep"},
+		{strings.Repeat("1+", 3000) + "1", "longer than 4096 bytes"},
+	}
+	for _, tc := range testCases {
+		_, err := EventEnv.Compile(tc.src, Limits{})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Compile(%.40s) = %v, want %q", tc.src, err, tc.want)
+		}
+	}
+
+	if _, err := EventEnv.CompileCondition(`upper(type)`, Limits{}); err == nil || !strings.Contains(err.Error(), "must return a bool, not string") {
+		t.Errorf("Expected a condition returning a string to be rejected, got %v", err)
+	}
+	if _, err := TransformedEnv.Compile(`processor_id + string(processed_at)`, Limits{}); err != nil {
+		t.Errorf("Expected the transformed event variables, got %v", err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{
+		{`json(payload).user.name + 1`, "column 25: operator + does not apply to string and int"},
+		{`json(payload).items / 0`, "column 21: division by zero"},
+		{`json(id)`, "column 1: json: invalid JSON"},
+		{`lower(attributes.country)`, "column 17: argument 1 of lower must be string, not null"},
+		{`int("x")`, `column 1: int: "x" is not an integer`},
+		{`json(payload).user ? 1 : 2`, "column 20: condition of ?: must be a bool, not map"},
+	}
+	vars := testVars()
+	for _, tc := range testCases {
+		p, err := EventEnv.Compile(tc.src, Limits{})
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tc.src, err)
+			continue
+		}
+		if _, err := p.Eval(vars); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Eval(%s) = %v, want %q", tc.src, err, tc.want)
+		}
+	}
+
+	p, _ := EventEnv.Compile(`attributes.region`, Limits{})
+	if _, err := p.EvalBool(vars); err == nil || !strings.Contains(err.Error(), "returned string, not a bool") {
+		t.Errorf("Expected EvalBool to reject a string, got %v", err)
+	}
+}
+
+func TestEvalLimits(t *testing.T) {
+	vars := testVars()
+	vars["payload"] = strings.Repeat("x", 1<<20)
+
+	p, err := EventEnv.Compile(`len(payload + payload) > 0`, Limits{MaxSteps: 1000})
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if _, err := p.Eval(vars); err != ErrStepLimit {
+		t.Errorf("Expected %v for a large concatenation, got %v", ErrStepLimit, err)
+	}
+
+	// Doubling the payload repeatedly is stopped before it grows large
+	src := "len(" + strings.Repeat("replace(", 20) + "payload" + strings.Repeat(`, "x", "xx")`, 20) + ") > 0"
+	if p, err = EventEnv.Compile(src, Limits{}); err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if _, err := p.Eval(vars); err != ErrStepLimit {
+		t.Errorf("Expected %v for repeated replaces, got %v", ErrStepLimit, err)
+	}
+
+	p, err = EventEnv.Compile(`payload matches "x+y" || payload matches "x*z" || payload matches "(x|y)+w"`,
+		Limits{MaxSteps: 1 << 30, Timeout: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if _, err := p.Eval(vars); err != ErrTimeout {
+		t.Errorf("Expected %v, got %v", ErrTimeout, err)
+	}
+}
+
+func TestTransformedVars(t *testing.T) {
+	vars := TransformedVars(&models.TransformedEvent{
+		ID: "a", OriginalTime: 10, ProcessedAt: time.Unix(20, 0), ProcessorID: "w1",
+		Attributes: map[string]string{"k": "v"},
+	})
+	p, err := TransformedEnv.CompileCondition(`processed_at - timestamp == 10 && processor_id == "w1" && attributes.k == "v"`, Limits{})
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if ok, err := p.EvalBool(vars); err != nil || !ok {
+		t.Errorf("Expected true, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,285 @@
+package expr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// function is a built-in function expressions may call
+type function struct {
+	name   string
+	params []Type
+	result Type
+	call   func(e *evaluator, args []interface{}) (interface{}, error)
+}
+
+// functions are the built-in functions by name
+var functions = map[string]*function{}
+
+func init() {
+	for _, fn := range []*function{
+		{"len", []Type{TypeAny}, TypeInt, length},
+		{"lower", []Type{TypeString}, TypeString, stringFunc(strings.ToLower)},
+		{"upper", []Type{TypeString}, TypeString, stringFunc(strings.ToUpper)},
+		{"trim", []Type{TypeString}, TypeString, stringFunc(strings.TrimSpace)},
+		{"contains", []Type{TypeString, TypeString}, TypeBool, predicate(strings.Contains)},
+		{"startsWith", []Type{TypeString, TypeString}, TypeBool, predicate(strings.HasPrefix)},
+		{"endsWith", []Type{TypeString, TypeString}, TypeBool, predicate(strings.HasSuffix)},
+		{"replace", []Type{TypeString, TypeString, TypeString}, TypeString, replace},
+		{"split", []Type{TypeString, TypeString}, TypeList, split},
+		{"join", []Type{TypeList, TypeString}, TypeString, join},
+		{"string", []Type{TypeAny}, TypeString, toString},
+		{"int", []Type{TypeAny}, TypeInt, toInt},
+		{"float", []Type{TypeAny}, TypeFloat, toFloatFunc},
+		{"json", []Type{TypeString}, TypeAny, decodeJSON},
+		{"toJSON", []Type{TypeAny}, TypeString, encodeJSON},
+		{"default", []Type{TypeAny, TypeAny}, TypeAny, func(e *evaluator, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return args[1], nil
+			}
+			return args[0], nil
+		}},
+	} {
+		functions[fn.name] = fn
+	}
+}
+
+// length returns the characters of a string or the items of a list or map
+func length(e *evaluator, args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), e.charge(len(v))
+	case []interface{}:
+		return int64(len(v)), nil
+	case map[string]interface{}:
+		return int64(len(v)), nil
+	}
+	return nil, fmt.Errorf("no length for %s", TypeOf(args[0]))
+}
+
+// stringFunc adapts a function of a string
+func stringFunc(f func(string) string) func(*evaluator, []interface{}) (interface{}, error) {
+	return func(e *evaluator, args []interface{}) (interface{}, error) {
+		s := args[0].(string)
+		if err := e.charge(len(s)); err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}
+}
+
+// predicate adapts a test of a string against another
+func predicate(f func(string, string) bool) func(*evaluator, []interface{}) (interface{}, error) {
+	return func(e *evaluator, args []interface{}) (interface{}, error) {
+		s := args[0].(string)
+		if err := e.charge(len(s)); err != nil {
+			return nil, err
+		}
+		return f(s, args[1].(string)), nil
+	}
+}
+
+func replace(e *evaluator, args []interface{}) (interface{}, error) {
+	s, old, new := args[0].(string), args[1].(string), args[2].(string)
+	// Charge for the result before building it
+	n := strings.Count(s, old)
+	if err := e.charge(len(s) + n*len(new)); err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(s, old, new), nil
+}
+
+func split(e *evaluator, args []interface{}) (interface{}, error) {
+	s := args[0].(string)
+	if err := e.charge(len(s)); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(s, args[1].(string))
+	if err := e.step(len(parts)); err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, len(parts))
+	for i, part := range parts {
+		items[i] = part
+	}
+	return items, nil
+}
+
+func join(e *evaluator, args []interface{}) (interface{}, error) {
+	items, sep := args[0].([]interface{}), args[1].(string)
+	parts := make([]string, len(items))
+	size := len(sep) * len(items)
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("item %d is %s, not a string", i, TypeOf(item))
+		}
+		parts[i] = s
+		size += len(s)
+	}
+	if err := e.charge(size); err != nil {
+		return nil, err
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// toString formats a value: numbers and bools as literals, null as the
+// empty string, and lists and maps as JSON
+func toString(e *evaluator, args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return encodeJSON(e, args)
+}
+
+func toInt(e *evaluator, args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return nil, fmt.Errorf("%g is out of range", v)
+		}
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", v)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to int", TypeOf(args[0]))
+}
+
+func toFloatFunc(e *evaluator, args []interface{}) (interface{}, error) {
+	if f, ok := toFloat(args[0]); ok {
+		return f, nil
+	}
+	if s, ok := args[0].(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to float", TypeOf(args[0]))
+}
+
+// decodeJSON decodes a JSON document, its numbers as ints when they are
+// integers and floats otherwise
+func decodeJSON(e *evaluator, args []interface{}) (interface{}, error) {
+	s := args[0].(string)
+	if err := e.charge(len(s)); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid JSON: data after the document")
+	}
+	return fromJSON(doc), nil
+}
+
+// fromJSON converts the numbers of a decoded JSON document
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJSON(item)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromJSON(item)
+		}
+	}
+	return v
+}
+
+// encodeJSON encodes a value as JSON, with the keys of maps sorted
+func encodeJSON(e *evaluator, args []interface{}) (interface{}, error) {
+	var b bytes.Buffer
+	if err := writeJSON(e, &b, args[0]); err != nil {
+		return nil, err
+	}
+	return b.String(), nil
+}
+
+func writeJSON(e *evaluator, b *bytes.Buffer, v interface{}) error {
+	if err := e.step(1); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSON(e, b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+		return nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSON(e, b, key); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := writeJSON(e, b, v[key]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+		return nil
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("%g has no JSON encoding", v)
+		}
+	case string:
+		if err := e.charge(len(v)); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.Write(data)
+	return nil
+}
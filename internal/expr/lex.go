@@ -0,0 +1,159 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind classifies a token of the source
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenOperator
+)
+
+// token is a lexeme with the byte offset it starts at
+type token struct {
+	kind tokenKind
+	text string
+	// value is the decoded literal of number and string tokens
+	value interface{}
+	pos   int
+}
+
+// operators lists the operator tokens, longest first so that "<=" is not
+// read as "<" and "="
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "%", "<", ">", "!", "?", ":", ".", ",", "(", ")", "[", "]",
+}
+
+// lex splits src into tokens, ending with a tokenEOF
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			return nil, errorAt(src, i, "invalid UTF-8")
+		case unicode.IsSpace(r):
+			i += size
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		case r >= '0' && r <= '9':
+			t, err := lexNumber(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i += len(t.text)
+		case r == '"' || r == '\'':
+			t, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i += len(t.text)
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorAt(src, i, fmt.Sprintf("unexpected character %q", r))
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// lexNumber reads an integer or a decimal number starting at i
+func lexNumber(src string, i int) (token, error) {
+	start, float := i, false
+	for i < len(src) && isDigit(src[i]) {
+		i++
+	}
+	if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+		float = true
+		for i++; i < len(src) && isDigit(src[i]); i++ {
+		}
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			float = true
+			for i = j; i < len(src) && isDigit(src[i]); i++ {
+			}
+		}
+	}
+	text := src[start:i]
+	if float {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, errorAt(src, start, "invalid number "+text)
+		}
+		return token{kind: tokenFloat, text: text, value: f, pos: start}, nil
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return token{}, errorAt(src, start, "integer out of range "+text)
+	}
+	return token{kind: tokenInt, text: text, value: n, pos: start}, nil
+}
+
+// lexString reads a string quoted with the quote at i, with the escapes of
+// Go strings
+func lexString(src string, i int) (token, error) {
+	quote := src[i]
+	var b strings.Builder
+	for j := i + 1; j < len(src); {
+		switch c := src[j]; c {
+		case quote:
+			return token{kind: tokenString, text: src[i : j+1], value: b.String(), pos: i}, nil
+		case '\\':
+			if j+1 >= len(src) {
+				return token{}, errorAt(src, j, "unterminated string")
+			}
+			r, _, tail, err := strconv.UnquoteChar(src[j:], quote)
+			if err != nil {
+				return token{}, errorAt(src, j, "invalid escape in string")
+			}
+			b.WriteRune(r)
+			j = len(src) - len(tail)
+		case '\n':
+			return token{}, errorAt(src, j, "newline in string")
+		default:
+			b.WriteByte(c)
+			j++
+		}
+	}
+	return token{}, errorAt(src, i, "unterminated string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,330 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// node is a node of the syntax tree, at a byte offset of the source
+type node interface {
+	offset() int
+}
+
+type (
+	literal struct {
+		pos   int
+		value interface{}
+	}
+	variable struct {
+		pos  int
+		name string
+	}
+	unary struct {
+		pos int
+		op  string
+		x   node
+	}
+	binary struct {
+		pos  int
+		op   string
+		x, y node
+		// re is the compiled pattern of "matches" with a literal pattern
+		re *regexp.Regexp
+	}
+	conditional struct {
+		pos             int
+		cond, then, els node
+	}
+	member struct {
+		pos  int
+		x    node
+		name string
+	}
+	index struct {
+		pos      int
+		x, index node
+	}
+	call struct {
+		pos  int
+		fn   *function
+		args []node
+	}
+	list struct {
+		pos   int
+		items []node
+	}
+)
+
+func (n *literal) offset() int     { return n.pos }
+func (n *variable) offset() int    { return n.pos }
+func (n *unary) offset() int       { return n.pos }
+func (n *binary) offset() int      { return n.pos }
+func (n *conditional) offset() int { return n.pos }
+func (n *member) offset() int      { return n.pos }
+func (n *index) offset() int       { return n.pos }
+func (n *call) offset() int        { return n.pos }
+func (n *list) offset() int        { return n.pos }
+
+// keywords are the identifiers that are not variables
+var keywords = map[string]bool{"true": true, "false": true, "null": true, "in": true, "matches": true}
+
+// parser is a recursive descent parser over the tokens of src
+type parser struct {
+	src    string
+	tokens []token
+	next   int
+	depth  int
+}
+
+// parse parses the source of an expression
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorf(p.peek(), "empty expression")
+	}
+	n, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token when it is one of the operators or
+// keywords ops
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && t.kind != tokenIdent {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.advance(), true
+		}
+	}
+	return t, false
+}
+
+// expect consumes the operator op or fails
+func (p *parser) expect(op string) error {
+	if t, ok := p.accept(op); !ok {
+		return p.errorf(t, "expected %q, found %s", op, describe(t))
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) *Error {
+	return errorAt(p.src, t.pos, fmt.Sprintf(format, args...))
+}
+
+// describe names a token in error messages
+func describe(t token) string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// expression parses a conditional, the lowest precedence
+func (p *parser) expression() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, p.errorf(p.peek(), "expression nested more than %d deep", maxDepth)
+	}
+
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept("?")
+	if !ok {
+		return cond, nil
+	}
+	then, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &conditional{pos: t.pos, cond: cond, then: then, els: els}, nil
+}
+
+// precedence lists the binary operators from the lowest precedence up
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in", "matches"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// binary parses the left-associative operators of a precedence level and
+// those above
+func (p *parser) binary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	x, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(precedence[level]...)
+		if !ok {
+			return x, nil
+		}
+		y, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: t.pos, op: t.text, x: x, y: y}
+	}
+}
+
+// unary parses the prefix operators
+func (p *parser) unary() (node, error) {
+	t, ok := p.accept("!", "-")
+	if !ok {
+		return p.postfix()
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, p.errorf(t, "expression nested more than %d deep", maxDepth)
+	}
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &unary{pos: t.pos, op: t.text, x: x}, nil
+}
+
+// postfix parses field accesses and indexes
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(".", "[")
+		if !ok {
+			return x, nil
+		}
+		if t.text == "." {
+			name := p.advance()
+			if name.kind != tokenIdent {
+				return nil, p.errorf(name, "expected a field name, found %s", describe(name))
+			}
+			x = &member{pos: t.pos, x: x, name: name.text}
+			continue
+		}
+		i, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		x = &index{pos: t.pos, x: x, index: i}
+	}
+}
+
+// primary parses literals, variables, calls, lists and parentheses
+func (p *parser) primary() (node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenInt, tokenFloat, tokenString:
+		return &literal{pos: t.pos, value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literal{pos: t.pos, value: t.text == "true"}, nil
+		case "null":
+			return &literal{pos: t.pos}, nil
+		}
+		if keywords[t.text] {
+			return nil, p.errorf(t, "unexpected %s", describe(t))
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(t)
+		}
+		return &variable{pos: t.pos, name: t.text}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			l := &list{pos: t.pos}
+			if _, ok := p.accept("]"); ok {
+				return l, nil
+			}
+			for {
+				item, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				l.items = append(l.items, item)
+				if _, ok := p.accept(","); !ok {
+					return l, p.expect("]")
+				}
+			}
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", describe(t))
+}
+
+// call parses the arguments of a call to the function named by t
+func (p *parser) call(t token) (node, error) {
+	fn, ok := functions[t.text]
+	if !ok {
+		return nil, p.errorf(t, "unknown function %q", t.text)
+	}
+	c := &call{pos: t.pos, fn: fn}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.args) != len(fn.params) {
+		return nil, p.errorf(t, "%s takes %d arguments, got %d", fn.name, len(fn.params), len(c.args))
+	}
+	return c, nil
+}
@@ -0,0 +1,186 @@
+package loadgen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"coding_challenge/client"
+)
+
+const (
+	// defaultDrainTimeout bounds the wait for events still being processed
+	// when the load ends
+	defaultDrainTimeout = 10 * time.Second
+	// publishedBuffer absorbs bursts of published events while the tracker
+	// is busy
+	publishedBuffer = 4096
+	// drainPoll is how often the drain checks for missing events
+	drainPoll = 10 * time.Millisecond
+)
+
+// EndToEnd verifies that accepted events get published, from the stream of
+// published events followed during the test
+type EndToEnd struct {
+	// Acknowledged events were answered 201 Created
+	Acknowledged int64 `json:"acknowledged"`
+	Published    int64 `json:"published"`
+	// Lost events were acknowledged but not published by the end of the
+	// drain
+	Lost int64 `json:"lost"`
+	// Duplicates were published more than once
+	Duplicates int64 `json:"duplicates"`
+	// Unacknowledged events were published though their request failed or
+	// timed out
+	Unacknowledged int64 `json:"unacknowledged"`
+	// Untracked events were published but not sent by this test
+	Untracked int64 `json:"untracked"`
+	// Latency counts from sending an event to receiving it published
+	Latency      Latency `json:"latency_ms"`
+	DrainSeconds float64 `json:"drain_seconds"`
+	// StreamError ended the stream early, events published afterwards
+	// count as lost
+	StreamError string `json:"stream_error,omitempty"`
+}
+
+// tracked is the fate of one event sent
+type tracked struct {
+	sent      time.Time
+	acked     bool
+	published bool
+}
+
+// tracker correlates the events sent with the events published, by ID
+type tracker struct {
+	sub *client.PublishedSubscription
+
+	mu         sync.Mutex
+	events     map[string]*tracked
+	latency    *Histogram
+	published  int64
+	duplicates int64
+	untracked  int64
+	// missing counts acknowledged events not yet published
+	missing int64
+	done    chan struct{}
+}
+
+// newTracker follows the published events, before any is sent so none
+// is missed
+func newTracker(ctx context.Context, c *client.Client) (*tracker, error) {
+	sub, err := c.SubscribePublished(ctx, publishedBuffer)
+	if err != nil {
+		return nil, err
+	}
+	t := &tracker{sub: sub, events: make(map[string]*tracked), latency: NewHistogram(), done: make(chan struct{})}
+	go t.run()
+	return t, nil
+}
+
+func (t *tracker) run() {
+	defer close(t.done)
+	for event := range t.sub.Events() {
+		t.observe(event.ID, time.Now())
+	}
+}
+
+// register records events about to be sent
+func (t *tracker) register(events []client.Event, sent time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, event := range events {
+		t.events[event.ID] = &tracked{sent: sent}
+	}
+}
+
+// acknowledge records that an event was answered 201 Created
+func (t *tracker) acknowledge(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.events[id]; ok && !e.acked {
+		e.acked = true
+		if !e.published {
+			t.missing++
+		}
+	}
+}
+
+// observe records a published event
+func (t *tracker) observe(id string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.events[id]
+	switch {
+	case !ok:
+		t.untracked++
+	case e.published:
+		t.duplicates++
+	default:
+		e.published = true
+		t.published++
+		t.latency.Record(at.Sub(e.sent))
+		if e.acked {
+			t.missing--
+		}
+	}
+}
+
+// drain waits until every acknowledged event is published, the stream
+// ends or timeout passes, then stops following the stream
+func (t *tracker) drain(ctx context.Context, timeout time.Duration) time.Duration {
+	started := time.Now()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(drainPoll)
+	defer poll.Stop()
+	for t.pending() > 0 {
+		select {
+		case <-poll.C:
+		case <-deadline.C:
+			return t.stop(started)
+		case <-t.done:
+			return t.stop(started)
+		case <-ctx.Done():
+			return t.stop(started)
+		}
+	}
+	return t.stop(started)
+}
+
+func (t *tracker) stop(started time.Time) time.Duration {
+	elapsed := time.Since(started)
+	t.sub.Close()
+	<-t.done
+	return elapsed
+}
+
+func (t *tracker) pending() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.missing
+}
+
+// report summarises the fate of every event sent
+func (t *tracker) report(drained time.Duration) *EndToEnd {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e2e := &EndToEnd{
+		Published:    t.published,
+		Duplicates:   t.duplicates,
+		Untracked:    t.untracked,
+		Lost:         t.missing,
+		Latency:      summarise(t.latency),
+		DrainSeconds: drained.Seconds(),
+	}
+	for _, e := range t.events {
+		if e.acked {
+			e2e.Acknowledged++
+		} else if e.published {
+			e2e.Unacknowledged++
+		}
+	}
+	if err := t.sub.Err(); err != nil {
+		e2e.StreamError = err.Error()
+	}
+	return e2e
+}
@@ -0,0 +1,112 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"coding_challenge/app/api"
+	"coding_challenge/app/processor"
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/metrics"
+	"coding_challenge/internal/models"
+)
+
+// faultyPublisher loses and duplicates events on their way to next
+type faultyPublisher struct {
+	next processor.Publisher
+
+	mu    sync.Mutex
+	count int
+}
+
+func (p *faultyPublisher) Publish(event *models.TransformedEvent) error {
+	p.mu.Lock()
+	p.count++
+	n := p.count
+	p.mu.Unlock()
+	switch n {
+	case 3:
+		// Lost on the way
+		return nil
+	case 5:
+		if err := p.next.Publish(event); err != nil {
+			return err
+		}
+	}
+	return p.next.Publish(event)
+}
+
+// newProcessingAPI serves the API with a pool publishing to its published
+// event stream through wrap
+func newProcessingAPI(t *testing.T, wrap func(processor.Publisher) processor.Publisher) string {
+	t.Helper()
+	eventStore := models.NewEventStore(1000)
+	logger := log.New(io.Discard, "", 0)
+	broadcaster := processor.NewBroadcaster(processor.NewLogPublisher(logger))
+	pool := processor.NewPool(eventStore, processor.PoolConfig{
+		Workers: 2, Partitions: 4, MaxPending: 100, Publisher: wrap(broadcaster),
+	}, metrics.NewRegistry(), logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.Start(ctx)
+	}()
+	server := api.NewServer(":0", eventStore, logger, api.WithPool(pool), api.WithPublished(broadcaster))
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+		defer stopCancel()
+		server.Stop(stopCtx)
+		ts.Close()
+		cancel()
+		<-done
+	})
+	return ts.URL
+}
+
+func TestRunEndToEnd(t *testing.T) {
+	s := DefaultScenario()
+	s.URL = newProcessingAPI(t, func(p processor.Publisher) processor.Publisher { return p })
+	s.Concurrency, s.Requests, s.BatchSize = 4, 20, 2
+	s.EndToEnd = true
+
+	report, err := Run(context.Background(), s)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	e := report.EndToEnd
+	if e == nil || e.Acknowledged != 40 || e.Published != 40 || e.Lost != 0 || e.Duplicates != 0 || e.StreamError != "" {
+		t.Fatalf("Expected all 40 events published once, got %+v", e)
+	}
+	if e.Latency.Count != 40 || e.Latency.P50 <= 0 {
+		t.Errorf("Unexpected end-to-end latency %+v", e.Latency)
+	}
+}
+
+func TestRunEndToEndDetectsLossAndDuplicates(t *testing.T) {
+	s := DefaultScenario()
+	s.URL = newProcessingAPI(t, func(p processor.Publisher) processor.Publisher {
+		return &faultyPublisher{next: p}
+	})
+	s.Concurrency, s.Requests = 2, 10
+	s.EndToEnd = true
+	s.DrainTimeout = config.Duration(200 * time.Millisecond)
+
+	report, err := Run(context.Background(), s)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	e := report.EndToEnd
+	if e.Acknowledged != 10 || e.Published != 9 || e.Lost != 1 || e.Duplicates != 1 {
+		t.Errorf("Expected one lost and one duplicated event, got %+v", e)
+	}
+	if e.DrainSeconds < 0.2 {
+		t.Errorf("Expected the drain to wait for the lost event, got %.3fs", e.DrainSeconds)
+	}
+}
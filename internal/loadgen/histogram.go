@@ -0,0 +1,147 @@
+package loadgen
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// subBucketHalfMagnitude gives 1024 linear sub-buckets per power of
+	// two, enough for three significant digits
+	subBucketHalfMagnitude = 10
+	subBucketCount         = 2 << subBucketHalfMagnitude
+	subBucketHalfCount     = subBucketCount / 2
+	subBucketMask          = subBucketCount - 1
+
+	// maxTrackable is the largest latency recorded, in microseconds.
+	// Longer ones are recorded as it.
+	maxTrackable = int64(time.Hour / time.Microsecond)
+)
+
+// Histogram is an HDR histogram of latencies with microsecond resolution
+// and three significant digits. Its size is fixed whatever it records, so
+// every request can be recorded. It is not safe for concurrent use, record
+// into one per goroutine and Merge them.
+type Histogram struct {
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+	sum    float64
+}
+
+// NewHistogram creates an empty histogram
+func NewHistogram() *Histogram {
+	buckets := 1
+	for smallest := int64(subBucketCount); smallest <= maxTrackable; smallest <<= 1 {
+		buckets++
+	}
+	return &Histogram{
+		counts: make([]int64, (buckets+1)*subBucketHalfCount),
+		min:    math.MaxInt64,
+	}
+}
+
+// Record adds a latency
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > maxTrackable {
+		v = maxTrackable
+	}
+	h.counts[countsIndex(v)]++
+	h.total++
+	h.sum += float64(v)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds the values of other
+func (h *Histogram) Merge(other *Histogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Count returns the number of recorded values
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Min returns the smallest recorded value
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest recorded value
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the average of the recorded values
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.total)) * time.Microsecond
+}
+
+// Percentile returns the value below which p percent of the values fall,
+// rounded up to the resolution of its bucket
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			v := highestEquivalent(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// countsIndex returns the bucket of v
+func countsIndex(v int64) int {
+	bucket := 64 - bits.LeadingZeros64(uint64(v)|subBucketMask) - (subBucketHalfMagnitude + 1)
+	subBucket := int(v >> uint(bucket))
+	return (bucket+1)<<subBucketHalfMagnitude + subBucket - subBucketHalfCount
+}
+
+// highestEquivalent returns the largest value counted in bucket i
+func highestEquivalent(i int) int64 {
+	bucket := i>>subBucketHalfMagnitude - 1
+	subBucket := int64(i&(subBucketHalfCount-1) + subBucketHalfCount)
+	if bucket < 0 {
+		bucket = 0
+		subBucket -= subBucketHalfCount
+	}
+	return subBucket<<uint(bucket) + 1<<uint(bucket) - 1
+}
@@ -0,0 +1,71 @@
+package loadgen
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := NewHistogram()
+	if h.Percentile(99) != 0 || h.Min() != 0 || h.Mean() != 0 {
+		t.Error("Expected an empty histogram to report zeros")
+	}
+
+	// 1ms to 10s in 1ms steps
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	tests := []struct {
+		percentile float64
+		want       time.Duration
+	}{
+		{50, 5 * time.Second},
+		{90, 9 * time.Second},
+		{99, 9900 * time.Millisecond},
+		{99.9, 9990 * time.Millisecond},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		got := h.Percentile(tt.percentile)
+		if relative := math.Abs(float64(got-tt.want)) / float64(tt.want); relative > 0.001 {
+			t.Errorf("p%v: expected %v within 0.1%%, got %v", tt.percentile, tt.want, got)
+		}
+	}
+	if h.Min() != time.Millisecond || h.Max() != 10*time.Second || h.Count() != 10000 {
+		t.Errorf("Unexpected min %v, max %v or count %d", h.Min(), h.Max(), h.Count())
+	}
+	if mean := h.Mean(); mean < 5000*time.Millisecond || mean > 5001*time.Millisecond {
+		t.Errorf("Expected a mean of 5.0005s, got %v", mean)
+	}
+}
+
+func TestHistogramExactBelowResolution(t *testing.T) {
+	h := NewHistogram()
+	for _, us := range []int64{0, 1, 7, 2047} {
+		h.Record(time.Duration(us) * time.Microsecond)
+	}
+	if got := h.Percentile(75); got != 7*time.Microsecond {
+		t.Errorf("Expected small values to be exact, got %v", got)
+	}
+	// Values past the range are clamped, not lost
+	h.Record(48 * time.Hour)
+	if h.Max() != time.Hour || h.Count() != 5 {
+		t.Errorf("Expected the maximum to be clamped to an hour, got %v", h.Max())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b := NewHistogram(), NewHistogram()
+	for i := 1; i <= 100; i++ {
+		a.Record(time.Duration(i) * time.Millisecond)
+		b.Record(time.Duration(i+100) * time.Millisecond)
+	}
+	a.Merge(b)
+	if a.Count() != 200 || a.Min() != time.Millisecond || a.Max() != 200*time.Millisecond {
+		t.Errorf("Unexpected merged count %d, min %v or max %v", a.Count(), a.Min(), a.Max())
+	}
+	if p50 := a.Percentile(50); p50 < 99*time.Millisecond || p50 > 101*time.Millisecond {
+		t.Errorf("Expected a merged p50 of 100ms, got %v", p50)
+	}
+}
@@ -0,0 +1,110 @@
+package loadgen
+
+import (
+	"math"
+	"time"
+)
+
+// Profiles shaping the arrival rate of an open-loop test
+const (
+	// ProfileConstant sends Rate requests per second
+	ProfileConstant = "constant"
+	// ProfileRamp grows the rate linearly from Rate to PeakRate
+	ProfileRamp = "ramp"
+	// ProfileStep climbs from Rate to PeakRate in Steps equal steps
+	ProfileStep = "step"
+	// ProfileSpike sends PeakRate from SpikeAt for SpikeDuration, and Rate
+	// otherwise
+	ProfileSpike = "spike"
+)
+
+const (
+	// defaultSteps is the number of steps of the step profile
+	defaultSteps = 5
+	// rateStep is the resolution at which the profile is integrated
+	rateStep = 10 * time.Millisecond
+)
+
+// openLoop reports whether requests follow an arrival rate rather than
+// responses
+func (s Scenario) openLoop() bool {
+	return s.Rate > 0 || s.PeakRate > 0
+}
+
+// rateAt returns the target arrival rate, in requests per second, at an
+// offset into the test
+func (s Scenario) rateAt(elapsed time.Duration) float64 {
+	duration := time.Duration(s.Duration)
+	progress := float64(elapsed) / float64(duration)
+	switch s.Profile {
+	case ProfileRamp:
+		return s.Rate + (s.PeakRate-s.Rate)*progress
+	case ProfileStep:
+		steps := s.Steps
+		if steps <= 0 {
+			steps = defaultSteps
+		}
+		if steps == 1 {
+			return s.Rate
+		}
+		step := math.Min(math.Floor(progress*float64(steps)), float64(steps-1))
+		return s.Rate + (s.PeakRate-s.Rate)*step/float64(steps-1)
+	case ProfileSpike:
+		if elapsed >= time.Duration(s.SpikeAt) && elapsed < time.Duration(s.SpikeAt+s.SpikeDuration) {
+			return s.PeakRate
+		}
+		return s.Rate
+	default:
+		return s.Rate
+	}
+}
+
+// nextArrival returns when the request after one due at elapsed is due,
+// once the profile has accumulated one more arrival. It returns false past
+// the end of the test.
+func (s Scenario) nextArrival(elapsed time.Duration) (time.Duration, bool) {
+	duration := time.Duration(s.Duration)
+	for arrivals := 0.0; elapsed < duration; elapsed += rateStep {
+		rate := s.rateAt(elapsed)
+		if rate > 0 {
+			if need := time.Duration((1 - arrivals) / rate * float64(time.Second)); need <= rateStep {
+				return elapsed + need, elapsed+need < duration
+			}
+		}
+		arrivals += rate * rateStep.Seconds()
+	}
+	return elapsed, false
+}
+
+// validateProfile checks the open-loop fields
+func (s Scenario) validateProfile() error {
+	if s.Rate < 0 || s.PeakRate < 0 {
+		return Error("rate and peak_rate must not be negative")
+	}
+	if !s.openLoop() {
+		if s.Profile != "" && s.Profile != ProfileConstant {
+			return Error("profile needs a rate or peak_rate")
+		}
+		return nil
+	}
+	if s.Duration <= 0 {
+		return Error("an open-loop test needs a duration")
+	}
+	switch s.Profile {
+	case "", ProfileConstant:
+		if s.Rate <= 0 {
+			return Error("the constant profile needs a rate")
+		}
+	case ProfileRamp, ProfileStep:
+		if s.PeakRate <= 0 {
+			return Error("the " + s.Profile + " profile needs a peak_rate")
+		}
+	case ProfileSpike:
+		if s.PeakRate <= 0 || s.SpikeDuration <= 0 {
+			return Error("the spike profile needs a peak_rate and a spike_duration")
+		}
+	default:
+		return Error("profile must be constant, ramp, step or spike")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/config"
+)
+
+func TestRateProfiles(t *testing.T) {
+	base := Scenario{Duration: config.Duration(10 * time.Second), Rate: 100, PeakRate: 500}
+	tests := []struct {
+		profile string
+		at      time.Duration
+		want    float64
+	}{
+		{ProfileConstant, 7 * time.Second, 100},
+		{ProfileRamp, 0, 100},
+		{ProfileRamp, 5 * time.Second, 300},
+		{ProfileStep, 1 * time.Second, 100},
+		{ProfileStep, 5 * time.Second, 300},
+		{ProfileStep, 9999 * time.Millisecond, 500},
+		{ProfileSpike, 2 * time.Second, 100},
+		{ProfileSpike, 4 * time.Second, 500},
+		{ProfileSpike, 5 * time.Second, 100},
+	}
+	for _, tt := range tests {
+		s := base
+		s.Profile = tt.profile
+		s.SpikeAt, s.SpikeDuration = config.Duration(3*time.Second), config.Duration(2*time.Second)
+		if got := s.rateAt(tt.at); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s at %v: expected %v, got %v", tt.profile, tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestArrivalsFollowTheProfile(t *testing.T) {
+	count := func(s Scenario) int {
+		n := 0
+		for elapsed, ok := s.nextArrival(0); ok; elapsed, ok = s.nextArrival(elapsed) {
+			n++
+		}
+		return n
+	}
+	s := Scenario{Duration: config.Duration(2 * time.Second), Rate: 250}
+	if n := count(s); n < 498 || n > 500 {
+		t.Errorf("Expected 500 arrivals at 250/s for 2s, got %d", n)
+	}
+	// A ramp from zero averages half its peak
+	s = Scenario{Duration: config.Duration(2 * time.Second), Profile: ProfileRamp, PeakRate: 100}
+	if n := count(s); n < 97 || n > 100 {
+		t.Errorf("Expected 100 arrivals ramping to 100/s over 2s, got %d", n)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	valid := DefaultScenario()
+	valid.Profile, valid.Rate, valid.PeakRate = ProfileRamp, 10, 100
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected a valid ramp, got %v", err)
+	}
+	invalid := []func(*Scenario){
+		func(s *Scenario) { s.PeakRate = 0 },
+		func(s *Scenario) { s.Profile = "sine" },
+		func(s *Scenario) { s.Profile = ProfileSpike },
+		func(s *Scenario) { s.Duration = 0; s.Requests = 10 },
+		func(s *Scenario) { s.Rate, s.PeakRate = 0, 0 },
+	}
+	for i, mutate := range invalid {
+		s := valid
+		mutate(&s)
+		if s.Validate() == nil {
+			t.Errorf("Case %d: expected an invalid scenario, got %+v", i, s)
+		}
+	}
+}
+
+func TestRunOpenLoop(t *testing.T) {
+	// Each request takes 20ms, so one client handles 50 per second
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"x"}`)
+	}))
+	defer ts.Close()
+
+	s := DefaultScenario()
+	s.URL = ts.URL
+	s.Duration = config.Duration(500 * time.Millisecond)
+	s.Interval = config.Duration(100 * time.Millisecond)
+
+	// Below capacity latency is the service time
+	s.Concurrency, s.Rate = 4, 40
+	report, err := Run(context.Background(), s)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if report.Requests < 18 || report.Requests > 20 || report.UnsentRequests != 0 {
+		t.Errorf("Expected 20 requests at 40/s for 500ms, got %d and %d unsent", report.Requests, report.UnsentRequests)
+	}
+	if report.ServiceTime == nil || report.Latency.P50 > report.ServiceTime.P50+10 {
+		t.Errorf("Expected latency close to service time, got %+v and %+v", report.Latency, report.ServiceTime)
+	}
+	if len(report.Intervals) != 5 || report.Intervals[2].TargetRate != 40 {
+		t.Errorf("Expected 5 intervals at 40/s, got %+v", report.Intervals)
+	}
+
+	// Past capacity requests queue, and the wait counts in their latency
+	s.Concurrency, s.Rate = 1, 200
+	if report, err = Run(context.Background(), s); err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if report.UnsentRequests == 0 || report.Requests+report.UnsentRequests < 90 {
+		t.Errorf("Expected about 100 due requests, most unsent, got %d sent and %d unsent",
+			report.Requests, report.UnsentRequests)
+	}
+	if report.Latency.P99 < 2*report.ServiceTime.P99 {
+		t.Errorf("Expected queueing to dominate latency, got p99 %.2fms for a service time of %.2fms",
+			report.Latency.P99, report.ServiceTime.P99)
+	}
+}
@@ -0,0 +1,165 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Latency summarises a latency histogram, in milliseconds
+type Latency struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p99_9"`
+	Max   float64 `json:"max"`
+}
+
+func summarise(h *Histogram) Latency {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return Latency{
+		Count: h.Count(),
+		Min:   ms(h.Min()),
+		Mean:  ms(h.Mean()),
+		P50:   ms(h.Percentile(50)),
+		P90:   ms(h.Percentile(90)),
+		P99:   ms(h.Percentile(99)),
+		P999:  ms(h.Percentile(99.9)),
+		Max:   ms(h.Max()),
+	}
+}
+
+// Report is the outcome of a load test
+type Report struct {
+	// Scenario is the scenario run, without credentials
+	Scenario       Scenario  `json:"scenario"`
+	Started        time.Time `json:"started"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+
+	Requests          int64   `json:"requests"`
+	FailedRequests    int64   `json:"failed_requests"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// UnsentRequests were due in an open-loop test but never sent, every
+	// client being busy until the end: the target rate was not reached
+	UnsentRequests int64 `json:"unsent_requests,omitempty"`
+	// AcceptedEvents and RejectedEvents count events, several per request
+	// in batch mode
+	AcceptedEvents  int64   `json:"accepted_events"`
+	RejectedEvents  int64   `json:"rejected_events"`
+	EventsPerSecond float64 `json:"events_per_second"`
+
+	// Latency counts from when requests were due. In open loop that
+	// includes waiting for a client, ServiceTime does not.
+	Latency     Latency  `json:"latency_ms"`
+	ServiceTime *Latency `json:"service_time_ms,omitempty"`
+	// Statuses counts requests by HTTP status, "timeout" or "error"
+	Statuses  map[string]int64 `json:"statuses"`
+	Intervals []Interval       `json:"intervals"`
+	// EndToEnd is set when the published events were followed
+	EndToEnd *EndToEnd `json:"end_to_end,omitempty"`
+}
+
+func newReport(s Scenario, started time.Time, elapsed time.Duration, t *tally, tl *timeline) *Report {
+	s.APIKey, s.Token = "", ""
+	seconds := elapsed.Seconds()
+	var service *Latency
+	if s.openLoop() {
+		summary := summarise(t.service)
+		service = &summary
+	}
+	return &Report{
+		Scenario:          s,
+		Started:           started,
+		ElapsedSeconds:    seconds,
+		Requests:          t.requests,
+		FailedRequests:    t.failed,
+		RequestsPerSecond: float64(t.requests) / seconds,
+		AcceptedEvents:    t.accepted,
+		RejectedEvents:    t.rejected,
+		EventsPerSecond:   float64(t.accepted) / seconds,
+		Latency:           summarise(t.latency),
+		ServiceTime:       service,
+		Statuses:          t.statuses,
+		Intervals:         tl.intervals(),
+	}
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report for people
+func (r *Report) WriteText(w io.Writer) error {
+	failedPercent := 0.0
+	if r.Requests > 0 {
+		failedPercent = float64(r.FailedRequests) * 100 / float64(r.Requests)
+	}
+	fmt.Fprintf(w, "Duration:  %.2fs\n", r.ElapsedSeconds)
+	fmt.Fprintf(w, "Requests:  %d (%.1f/s), %d failed (%.2f%%)\n",
+		r.Requests, r.RequestsPerSecond, r.FailedRequests, failedPercent)
+	if r.UnsentRequests > 0 {
+		fmt.Fprintf(w, "Unsent:    %d due requests, every client was busy\n", r.UnsentRequests)
+	}
+	fmt.Fprintf(w, "Events:    %d accepted (%.1f/s), %d rejected\n",
+		r.AcceptedEvents, r.EventsPerSecond, r.RejectedEvents)
+	fmt.Fprintf(w, "\nLatency (ms):\n")
+	fmt.Fprintf(w, "  min %.2f  mean %.2f  max %.2f\n", r.Latency.Min, r.Latency.Mean, r.Latency.Max)
+	fmt.Fprintf(w, "  p50 %.2f  p90 %.2f  p99 %.2f  p99.9 %.2f\n",
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.P999)
+	if r.ServiceTime != nil {
+		fmt.Fprintf(w, "Service time (ms), from when requests were sent:\n")
+		fmt.Fprintf(w, "  p50 %.2f  p90 %.2f  p99 %.2f  p99.9 %.2f\n",
+			r.ServiceTime.P50, r.ServiceTime.P90, r.ServiceTime.P99, r.ServiceTime.P999)
+	}
+
+	fmt.Fprintf(w, "\nStatuses:\n")
+	statuses := make([]string, 0, len(r.Statuses))
+	for status := range r.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "  %-8s %d\n", status, r.Statuses[status])
+	}
+
+	if e := r.EndToEnd; e != nil {
+		fmt.Fprintf(w, "\nEnd to end, after a %.2fs drain:\n", e.DrainSeconds)
+		fmt.Fprintf(w, "  %d acknowledged, %d published, %d lost, %d duplicates\n",
+			e.Acknowledged, e.Published, e.Lost, e.Duplicates)
+		if e.Unacknowledged > 0 || e.Untracked > 0 {
+			fmt.Fprintf(w, "  %d published without acknowledgement, %d not sent by this test\n", e.Unacknowledged, e.Untracked)
+		}
+		if e.StreamError != "" {
+			fmt.Fprintf(w, "  stream ended early: %s\n", e.StreamError)
+		}
+		fmt.Fprintf(w, "  latency (ms) p50 %.2f  p90 %.2f  p99 %.2f  max %.2f\n",
+			e.Latency.P50, e.Latency.P90, e.Latency.P99, e.Latency.Max)
+	}
+
+	if len(r.Intervals) > 1 {
+		fmt.Fprintf(w, "\nTimeline:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "start (s)\ttarget/s\tsent/s\tfailed\tp50 (ms)\tp99 (ms)\t")
+		for _, interval := range r.Intervals {
+			target := "-"
+			if interval.TargetRate > 0 {
+				target = fmt.Sprintf("%.1f", interval.TargetRate)
+			}
+			fmt.Fprintf(tw, "%g\t%s\t%.1f\t%d\t%.2f\t%.2f\t\n", interval.StartSeconds, target,
+				interval.RequestsPerSecond, interval.Failed, interval.P50, interval.P99)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coding_challenge/client"
+)
+
+// Statuses of requests that got no HTTP response
+const (
+	StatusTimeout = "timeout"
+	StatusError   = "error"
+)
+
+// result is the outcome of one request
+type result struct {
+	// due is when the request should have been sent, latency counts from
+	// it and service from when it was
+	due      time.Time
+	latency  time.Duration
+	service  time.Duration
+	status   string
+	ok       bool
+	accepted int
+	rejected int
+}
+
+// tally accumulates the results of one client
+type tally struct {
+	latency  *Histogram
+	service  *Histogram
+	statuses map[string]int64
+	requests int64
+	failed   int64
+	accepted int64
+	rejected int64
+}
+
+func newTally() *tally {
+	return &tally{latency: NewHistogram(), service: NewHistogram(), statuses: make(map[string]int64)}
+}
+
+func (t *tally) add(r result) {
+	t.latency.Record(r.latency)
+	t.service.Record(r.service)
+	t.statuses[r.status]++
+	t.requests++
+	if !r.ok {
+		t.failed++
+	}
+	t.accepted += int64(r.accepted)
+	t.rejected += int64(r.rejected)
+}
+
+func (t *tally) merge(other *tally) {
+	t.latency.Merge(other.latency)
+	t.service.Merge(other.service)
+	for status, n := range other.statuses {
+		t.statuses[status] += n
+	}
+	t.requests += other.requests
+	t.failed += other.failed
+	t.accepted += other.accepted
+	t.rejected += other.rejected
+}
+
+// payloads picks payloads from the size distribution. Payloads are
+// generated once per size.
+type payloads struct {
+	values     []string
+	cumulative []int
+}
+
+func newPayloads(sizes []PayloadSize) *payloads {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	p := &payloads{}
+	total := 0
+	for _, size := range sizes {
+		b := make([]byte, size.Bytes)
+		for i := range b {
+			b[i] = alphabet[rand.Intn(len(alphabet))]
+		}
+		total += size.Weight
+		p.values = append(p.values, string(b))
+		p.cumulative = append(p.cumulative, total)
+	}
+	return p
+}
+
+func (p *payloads) pick(r *rand.Rand) string {
+	n := r.Intn(p.cumulative[len(p.cumulative)-1])
+	for i, c := range p.cumulative {
+		if n < c {
+			return p.values[i]
+		}
+	}
+	return p.values[len(p.values)-1]
+}
+
+// runner sends the requests of a scenario
+type runner struct {
+	scenario Scenario
+	client   *client.Client
+	payloads *payloads
+	timeline *timeline
+	// tracker follows published events in end-to-end tests
+	tracker *tracker
+	// unsent counts requests of an open-loop test that were due but not
+	// sent by the end, every client being busy
+	unsent int64
+}
+
+func newRunner(s Scenario) (*runner, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = s.Concurrency
+	opts := []client.Option{
+		client.WithTransport(transport),
+		// Retries would hide the errors being measured
+		client.WithRetry(client.RetryPolicy{MaxAttempts: 1}),
+		client.WithUserAgent("loadgen"),
+	}
+	if s.APIKey != "" {
+		opts = append(opts, client.WithAPIKey(s.APIKey))
+	}
+	if s.Token != "" {
+		opts = append(opts, client.WithBearerToken(s.Token))
+	}
+	if s.Tenant != "" {
+		opts = append(opts, client.WithTenant(s.Tenant))
+	}
+	c, err := client.New(s.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &runner{scenario: s, client: c, payloads: newPayloads(s.PayloadSizes)}, nil
+}
+
+// Run runs a scenario until its duration or request count is reached, or
+// ctx ends
+func Run(ctx context.Context, s Scenario) (*Report, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	r, err := newRunner(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.EndToEnd {
+		if r.tracker, err = newTracker(ctx, r.client); err != nil {
+			return nil, fmt.Errorf("following published events: %w", err)
+		}
+	}
+
+	stop := ctx
+	if s.Duration > 0 {
+		var cancel context.CancelFunc
+		stop, cancel = context.WithTimeout(ctx, time.Duration(s.Duration))
+		defer cancel()
+	}
+
+	started := time.Now()
+	r.timeline = newTimeline(s, started)
+	tallies := make([]*tally, s.Concurrency)
+	var wg sync.WaitGroup
+	var due chan time.Time
+	if s.openLoop() {
+		due = make(chan time.Time, s.Concurrency)
+		go r.schedule(ctx, stop, started, due)
+	}
+	remaining := int64(s.Requests)
+	for i := range tallies {
+		tallies[i] = newTally()
+		wg.Add(1)
+		go func(t *tally, seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			// Requests in flight complete when the test ends, only an
+			// interrupt cancels them
+			if due != nil {
+				for at := range due {
+					t.add(r.send(ctx, rng, at))
+				}
+				return
+			}
+			for stop.Err() == nil {
+				if s.Requests > 0 && atomic.AddInt64(&remaining, -1) < 0 {
+					return
+				}
+				t.add(r.send(ctx, rng, time.Now()))
+			}
+		}(tallies[i], time.Now().UnixNano()+int64(i))
+	}
+	wg.Wait()
+
+	total := newTally()
+	for _, t := range tallies {
+		total.merge(t)
+	}
+	report := newReport(s, started, time.Since(started), total, r.timeline)
+	report.UnsentRequests = r.unsent
+	if r.tracker != nil {
+		timeout := time.Duration(s.DrainTimeout)
+		if timeout <= 0 {
+			timeout = defaultDrainTimeout
+		}
+		report.EndToEnd = r.tracker.report(r.tracker.drain(ctx, timeout))
+	}
+	return report, nil
+}
+
+// schedule sends the due time of every request of an open-loop test,
+// following the rate profile. Due times follow the schedule even when the
+// clients fall behind, so queueing shows in the latency.
+func (r *runner) schedule(ctx, stop context.Context, started time.Time, due chan<- time.Time) {
+	defer close(due)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var elapsed time.Duration
+	for sent := 0; r.scenario.Requests <= 0 || sent < r.scenario.Requests; sent++ {
+		var ok bool
+		if elapsed, ok = r.scenario.nextArrival(elapsed); !ok {
+			return
+		}
+		next := started.Add(elapsed)
+		if wait := time.Until(next); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+		// Only give up on a due request when no client takes it by the end
+		select {
+		case due <- next:
+			continue
+		default:
+		}
+		select {
+		case due <- next:
+		case <-stop.Done():
+			r.unsent = r.countDue(elapsed, time.Since(started), r.scenario.Requests-sent)
+			return
+		}
+	}
+}
+
+// countDue counts the arrivals from the one at elapsed up to now, at most
+// limit when positive
+func (r *runner) countDue(elapsed, now time.Duration, limit int) int64 {
+	var n int64
+	for ok := true; ok && elapsed <= now && (limit <= 0 || n < int64(limit)); {
+		n++
+		elapsed, ok = r.scenario.nextArrival(elapsed)
+	}
+	return n
+}
+
+// send publishes one event, or one batch, due at the given time and
+// measures it
+func (r *runner) send(ctx context.Context, rng *rand.Rand, due time.Time) result {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.scenario.Timeout))
+	defer cancel()
+
+	events := make([]client.Event, r.scenario.BatchSize)
+	for i := range events {
+		events[i] = client.Event{
+			ID:        uuid.NewString(),
+			Timestamp: time.Now().Unix(),
+			Payload:   r.payloads.pick(rng),
+		}
+	}
+
+	start := time.Now()
+	if r.tracker != nil {
+		// Registered first, the event may be published before the response
+		r.tracker.register(events, start)
+	}
+	var res result
+	if len(events) == 1 {
+		_, err := r.client.Publish(ctx, events[0])
+		res = result{status: statusOf(err, http.StatusCreated), ok: err == nil}
+		if err == nil {
+			res.accepted = 1
+			if r.tracker != nil {
+				r.tracker.acknowledge(events[0].ID)
+			}
+		}
+	} else {
+		batch, err := r.client.PublishBatch(ctx, events)
+		res = result{status: statusOf(err, http.StatusOK), ok: err == nil}
+		if err == nil {
+			res.accepted, res.rejected = batch.Accepted, batch.Rejected
+			for _, item := range batch.Results {
+				if item.Status == http.StatusCreated && r.tracker != nil {
+					r.tracker.acknowledge(item.ID)
+				}
+			}
+		}
+	}
+	end := time.Now()
+	res.due, res.latency, res.service = due, end.Sub(due), end.Sub(start)
+	r.timeline.add(res)
+	return res
+}
+
+// statusOf names the outcome of a request for the error breakdown
+func statusOf(err error, success int) string {
+	var apiErr *client.APIError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return strconv.Itoa(success)
+	case errors.As(err, &apiErr):
+		return strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return StatusTimeout
+	default:
+		return StatusError
+	}
+}
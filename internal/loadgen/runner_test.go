@@ -0,0 +1,146 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"coding_challenge/app/api"
+	"coding_challenge/internal/config"
+	"coding_challenge/internal/models"
+)
+
+// newTestAPI serves the real API over HTTP
+func newTestAPI(t *testing.T, queue int) (string, *models.EventStore) {
+	t.Helper()
+	eventStore := models.NewEventStore(queue)
+	server := api.NewServer(":0", eventStore, log.New(io.Discard, "", 0))
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Stop(ctx)
+		ts.Close()
+	})
+	return ts.URL, eventStore
+}
+
+func TestRun(t *testing.T) {
+	url, eventStore := newTestAPI(t, 1000)
+	s := DefaultScenario()
+	s.URL = url
+	s.Concurrency = 4
+	s.Requests = 40
+	s.PayloadSizes = []PayloadSize{{Bytes: 10, Weight: 3}, {Bytes: 100, Weight: 1}}
+
+	report, err := Run(context.Background(), s)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if report.Requests != 40 || report.AcceptedEvents != 40 || report.Statuses["201"] != 40 {
+		t.Errorf("Expected 40 created events, got %+v", report)
+	}
+	if report.Latency.Count != 40 || report.Latency.P50 <= 0 || report.Latency.P999 < report.Latency.P50 {
+		t.Errorf("Unexpected latency summary %+v", report.Latency)
+	}
+	if n := len(eventStore.GetAll()); n != 40 {
+		t.Errorf("Expected 40 stored events, got %d", n)
+	}
+
+	// Batch mode
+	s.BatchSize = 5
+	s.Requests = 4
+	if report, err = Run(context.Background(), s); err != nil {
+		t.Fatalf("Failed to run batches: %v", err)
+	}
+	if report.Requests != 4 || report.AcceptedEvents != 20 || report.Statuses["200"] != 4 {
+		t.Errorf("Expected 4 batches of 5 events, got %+v", report)
+	}
+}
+
+func TestRunBreaksDownErrors(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) % 3 {
+		case 0:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":"x"}`)
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer ts.Close()
+
+	s := DefaultScenario()
+	s.URL = ts.URL
+	s.Concurrency = 1
+	s.Requests = 6
+	s.Timeout = config.Duration(10 * time.Millisecond)
+	report, err := Run(context.Background(), s)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	want := map[string]int64{"201": 2, "429": 2, StatusTimeout: 2}
+	for status, n := range want {
+		if report.Statuses[status] != n {
+			t.Errorf("Expected %d %q, got %v", n, status, report.Statuses)
+		}
+	}
+	if report.FailedRequests != 4 {
+		t.Errorf("Expected 4 failed requests, got %d", report.FailedRequests)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil || !strings.Contains(out.String(), "p99.9") {
+		t.Errorf("Expected a text report with percentiles, got %q", out.String())
+	}
+}
+
+func TestScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	data := `{"url": "http://example.com", "concurrency": 3, "duration": "1m", "api_key": "secret",
+		"payload_sizes": [{"bytes": 10, "weight": 1}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("Failed to load scenario: %v", err)
+	}
+	if s.Concurrency != 3 || s.Duration != config.Duration(time.Minute) || s.BatchSize != 1 || s.Validate() != nil {
+		t.Errorf("Expected the file over the defaults, got %+v", s)
+	}
+
+	// Reports leave credentials out
+	var out bytes.Buffer
+	_ = newReport(s, time.Now(), time.Second, newTally(), newTimeline(s, time.Now())).WriteJSON(&out)
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || strings.Contains(out.String(), "secret") {
+		t.Errorf("Expected a JSON report without the API key, got %s", out.String())
+	}
+
+	sizes, err := ParsePayloadSizes("64:70, 1024:25,16384")
+	if err != nil || len(sizes) != 3 || sizes[1] != (PayloadSize{1024, 25}) || sizes[2].Weight != 1 {
+		t.Errorf("Unexpected payload sizes %v (%v)", sizes, err)
+	}
+	if _, err := ParsePayloadSizes("big"); err == nil {
+		t.Error("Expected an error for an invalid size")
+	}
+	s.PayloadSizes = []PayloadSize{{Bytes: 10}}
+	if s.Validate() == nil {
+		t.Error("Expected a zero weight to be invalid")
+	}
+}
@@ -0,0 +1,154 @@
+// Package loadgen generates load against the event processor API and
+// reports throughput, latency percentiles and errors.
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"coding_challenge/internal/config"
+)
+
+// Error is a scenario validation error
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// PayloadSize is one size of the payload distribution, picked with a
+// probability proportional to its weight
+type PayloadSize struct {
+	Bytes  int `json:"bytes"`
+	Weight int `json:"weight"`
+}
+
+// Scenario describes a load test
+type Scenario struct {
+	Name string `json:"name,omitempty"`
+	// URL is the base URL of the API
+	URL    string `json:"url"`
+	APIKey string `json:"api_key,omitempty"`
+	Token  string `json:"token,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+
+	// Concurrency is the number of clients, each sending its next request
+	// when the previous one completes. In open loop it bounds the requests
+	// in flight instead.
+	Concurrency int `json:"concurrency"`
+	// Duration bounds the test, Requests too when positive
+	Duration config.Duration `json:"duration"`
+	Requests int             `json:"requests,omitempty"`
+	// Timeout bounds each request
+	Timeout config.Duration `json:"timeout"`
+
+	// BatchSize above 1 publishes through /events/batch
+	BatchSize    int           `json:"batch_size"`
+	PayloadSizes []PayloadSize `json:"payload_sizes"`
+
+	// Rate or PeakRate switch to open loop: requests are due at a rate in
+	// requests per second whatever the response times, and latency is
+	// measured from when each was due, so a slow server cannot hide its
+	// queueing
+	Rate float64 `json:"rate,omitempty"`
+	// Profile shapes the rate over Duration: constant, ramp, step or spike
+	Profile       string          `json:"profile,omitempty"`
+	PeakRate      float64         `json:"peak_rate,omitempty"`
+	Steps         int             `json:"steps,omitempty"`
+	SpikeAt       config.Duration `json:"spike_at,omitempty"`
+	SpikeDuration config.Duration `json:"spike_duration,omitempty"`
+
+	// EndToEnd follows the published event stream to check that every
+	// accepted event is published, and measure how long it takes.
+	// DrainTimeout bounds the wait for the last ones, 10s by default.
+	EndToEnd     bool            `json:"end_to_end,omitempty"`
+	DrainTimeout config.Duration `json:"drain_timeout,omitempty"`
+
+	// Interval is the length of the report's timeline buckets. It defaults
+	// to a second, longer for long tests so there are at most 120.
+	Interval config.Duration `json:"interval,omitempty"`
+}
+
+// DefaultScenario returns the scenario used when no file is given
+func DefaultScenario() Scenario {
+	return Scenario{
+		URL:          "http://localhost:8081",
+		Concurrency:  10,
+		Duration:     config.Duration(10 * time.Second),
+		Timeout:      config.Duration(5 * time.Second),
+		BatchSize:    1,
+		PayloadSizes: []PayloadSize{{Bytes: 64, Weight: 1}},
+	}
+}
+
+// LoadScenario reads a JSON scenario over the defaults
+func LoadScenario(path string) (Scenario, error) {
+	s := DefaultScenario()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Validate checks the scenario
+func (s Scenario) Validate() error {
+	if s.URL == "" {
+		return Error("url is required")
+	}
+	if s.Concurrency <= 0 {
+		return Error("concurrency must be positive")
+	}
+	if s.Duration <= 0 && s.Requests <= 0 {
+		return Error("duration or requests must be positive")
+	}
+	if s.Timeout <= 0 {
+		return Error("timeout must be positive")
+	}
+	if s.BatchSize <= 0 {
+		return Error("batch_size must be positive")
+	}
+	if len(s.PayloadSizes) == 0 {
+		return Error("payload_sizes must not be empty")
+	}
+	for _, size := range s.PayloadSizes {
+		if size.Bytes < 0 || size.Weight <= 0 {
+			return Error("payload_sizes need non-negative bytes and positive weights")
+		}
+	}
+	if s.DrainTimeout < 0 {
+		return Error("drain_timeout must not be negative")
+	}
+	if s.Interval < 0 {
+		return Error("interval must not be negative")
+	}
+	return s.validateProfile()
+}
+
+// ParsePayloadSizes parses a distribution such as "64:70,1024:25,16384:5",
+// a size without weight has weight 1
+func ParsePayloadSizes(s string) ([]PayloadSize, error) {
+	var sizes []PayloadSize
+	for _, part := range strings.Split(s, ",") {
+		bytesPart, weightPart, hasWeight := strings.Cut(strings.TrimSpace(part), ":")
+		size := PayloadSize{Weight: 1}
+		var err error
+		if size.Bytes, err = strconv.Atoi(bytesPart); err != nil {
+			return nil, fmt.Errorf("payload size %q: %w", part, err)
+		}
+		if hasWeight {
+			if size.Weight, err = strconv.Atoi(weightPart); err != nil {
+				return nil, fmt.Errorf("payload weight %q: %w", part, err)
+			}
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,97 @@
+package loadgen
+
+import (
+	"sync"
+	"time"
+)
+
+// maxIntervals bounds the timeline of long tests when no interval is given
+const maxIntervals = 120
+
+// Interval summarises the requests due during one bucket of the test, to
+// see where latency and errors climb as the rate does
+type Interval struct {
+	StartSeconds float64 `json:"start_seconds"`
+	// TargetRate is the arrival rate of the profile at the start of the
+	// interval, zero in closed loop
+	TargetRate float64 `json:"target_rate,omitempty"`
+	Requests   int64   `json:"requests"`
+	Failed     int64   `json:"failed"`
+	// RequestsPerSecond is the rate at which requests were sent
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	P50               float64 `json:"p50_ms"`
+	P99               float64 `json:"p99_ms"`
+}
+
+type bucket struct {
+	latency  *Histogram
+	requests int64
+	failed   int64
+}
+
+// timeline buckets results by the interval they were due in
+type timeline struct {
+	scenario Scenario
+	started  time.Time
+	interval time.Duration
+
+	mu      sync.Mutex
+	buckets []*bucket
+}
+
+func newTimeline(s Scenario, started time.Time) *timeline {
+	interval := time.Duration(s.Interval)
+	if interval <= 0 {
+		interval = time.Second
+		if longest := time.Duration(s.Duration) / maxIntervals; longest > interval {
+			interval = longest.Round(time.Second)
+		}
+	}
+	return &timeline{scenario: s, started: started, interval: interval}
+}
+
+func (t *timeline) add(r result) {
+	i := int(r.due.Sub(t.started) / t.interval)
+	if i < 0 {
+		i = 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.buckets) <= i {
+		t.buckets = append(t.buckets, nil)
+	}
+	b := t.buckets[i]
+	if b == nil {
+		b = &bucket{latency: NewHistogram()}
+		t.buckets[i] = b
+	}
+	b.latency.Record(r.latency)
+	b.requests++
+	if !r.ok {
+		b.failed++
+	}
+}
+
+// intervals summarises every bucket
+func (t *timeline) intervals() []Interval {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	intervals := make([]Interval, len(t.buckets))
+	for i, b := range t.buckets {
+		start := time.Duration(i) * t.interval
+		intervals[i].StartSeconds = start.Seconds()
+		if t.scenario.openLoop() {
+			intervals[i].TargetRate = t.scenario.rateAt(start)
+		}
+		if b == nil {
+			continue
+		}
+		summary := summarise(b.latency)
+		intervals[i].Requests = b.requests
+		intervals[i].Failed = b.failed
+		intervals[i].RequestsPerSecond = float64(b.requests) / t.interval.Seconds()
+		intervals[i].P50 = summary.P50
+		intervals[i].P99 = summary.P99
+	}
+	return intervals
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increases the counter by n
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set replaces the gauge value
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add changes the gauge value by delta
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+type family struct {
+	name   string
+	help   string
+	kind   string
+	series map[string]func() float64
+}
+
+// Registry holds named metrics and renders them in the Prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	counters map[string]*Counter
+	gauges   map[string]*Gauge
+}
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+		counters: make(map[string]*Counter),
+		gauges:   make(map[string]*Gauge),
+	}
+}
+
+// Counter returns the counter for name and the label key/value pairs,
+// creating it on first use
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey(name, labels)
+	if c, ok := r.counters[key]; ok {
+		return c
+	}
+	c := &Counter{}
+	r.counters[key] = c
+	r.family(name, help, "counter").series[formatLabels(labels)] = func() float64 {
+		return float64(c.Value())
+	}
+	return c
+}
+
+// Gauge returns the gauge for name and the label key/value pairs,
+// creating it on first use
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey(name, labels)
+	if g, ok := r.gauges[key]; ok {
+		return g
+	}
+	g := &Gauge{}
+	r.gauges[key] = g
+	r.family(name, help, "gauge").series[formatLabels(labels)] = g.Value
+	return g
+}
+
+// GaugeFunc registers a gauge whose value is computed at scrape time
+func (r *Registry) GaugeFunc(name, help string, fn func() float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "gauge").series[formatLabels(labels)] = fn
+}
+
+// family returns the metric family, creating it if needed. Callers must hold r.mu.
+func (r *Registry) family(name, help, kind string) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind, series: make(map[string]func() float64)}
+		r.families[name] = f
+	}
+	return f
+}
+
+// WriteText renders every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type sample struct {
+		labels string
+		fn     func() float64
+	}
+	type snapshot struct {
+		f       *family
+		samples []sample
+	}
+	snapshots := make([]snapshot, 0, len(names))
+	for _, name := range names {
+		f := r.families[name]
+		s := snapshot{f: f}
+		for labels, fn := range f.series {
+			s.samples = append(s.samples, sample{labels: labels, fn: fn})
+		}
+		sort.Slice(s.samples, func(i, j int) bool { return s.samples[i].labels < s.samples[j].labels })
+		snapshots = append(snapshots, s)
+	}
+	r.mu.Unlock()
+
+	// Evaluate gauge funcs outside the lock so they may use the registry
+	for _, s := range snapshots {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.f.name, s.f.help, s.f.name, s.f.kind); err != nil {
+			return err
+		}
+		for _, sm := range s.samples {
+			if _, err := fmt.Fprintf(w, "%s%s %v\n", s.f.name, sm.labels, sm.fn()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry for Prometheus scraping
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WriteText(w)
+	})
+}
+
+func seriesKey(name string, labels []string) string {
+	return name + formatLabels(labels)
+}
+
+// formatLabels renders key/value pairs as {k="v",...}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", labels[i], labels[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("events_total", "Events seen", "lane", "high").Add(3)
+	registry.Counter("events_total", "Events seen", "lane", "high").Inc()
+	registry.Gauge("queue_depth", "Queue depth").Set(7)
+	registry.GaugeFunc("workers", "Workers", func() float64 { return 2 })
+
+	var buf bytes.Buffer
+	if err := registry.WriteText(&buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	for _, want := range []string{
+		"# TYPE events_total counter",
+		`events_total{lane="high"} 4`,
+		"queue_depth 7",
+		"workers 2",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestGaugeAdd(t *testing.T) {
+	var g Gauge
+	g.Add(1.5)
+	g.Add(-0.5)
+	if g.Value() != 1 {
+		t.Errorf("Expected 1, got %v", g.Value())
+	}
+}
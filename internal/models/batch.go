@@ -0,0 +1,27 @@
+package models
+
+// PublishResult acknowledges a stored event
+type PublishResult struct {
+	ID string `json:"id"`
+}
+
+// Batch is a group of events published in one request
+type Batch struct {
+	Events []Event `json:"events"`
+}
+
+// BatchResult reports the outcome of every event of a batch, in order
+type BatchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Results  []ItemResult `json:"results"`
+}
+
+// ItemResult is the outcome of one event of a batch. Status is the HTTP
+// status the event would have received on its own.
+type ItemResult struct {
+	ID      string `json:"id"`
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
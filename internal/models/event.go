@@ -1,7 +1,9 @@
 package models
 
 import (
+	"math"
 	"time"
+	"unicode/utf8"
 )
 
 // Event represents an incoming event to be processed
@@ -9,33 +11,111 @@ type Event struct {
 	ID        string `json:"id"`
 	Timestamp int64  `json:"timestamp"`
 	Payload   string `json:"payload"`
+	// PartitionKey groups events that must be processed in order
+	PartitionKey string `json:"partition_key,omitempty"`
+	// Tenant is the namespace owning the event, set by the API
+	Tenant string `json:"tenant,omitempty"`
+	// DeliverAt holds the event back from processing until then, in Unix
+	// seconds. Delay sets it relative to submission, in seconds;
+	// validation turns it into DeliverAt.
+	DeliverAt int64 `json:"deliver_at,omitempty"`
+	Delay     int64 `json:"delay,omitempty"`
+	// Priority is the lane the event is processed from, normal when empty
+	Priority Priority `json:"priority,omitempty"`
+	// Type and Attributes describe the event for routing, the payload
+	// being opaque
+	Type       string            `json:"type,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
-// ValidateEvent checks if an event has all required fields
+// Key returns the ordering key of the event, falling back to its ID
+func (e *Event) Key() string {
+	if e.PartitionKey != "" {
+		return e.PartitionKey
+	}
+	return e.ID
+}
+
+// ValidateEvent checks if an event has all required fields, setting a
+// missing timestamp to the current time and resolving a delay into a
+// delivery time
 func ValidateEvent(e *Event) error {
+	return ValidateEventAt(e, time.Now())
+}
+
+// ValidateEventAt is ValidateEvent with now as the current time
+func ValidateEventAt(e *Event, now time.Time) error {
 	if e.ID == "" {
 		return ErrMissingID
 	}
+	if !utf8.ValidString(e.Payload) {
+		return ErrInvalidPayload
+	}
+	if !utf8.ValidString(e.Type) {
+		return ErrInvalidType
+	}
+	for key, value := range e.Attributes {
+		if key == "" || !utf8.ValidString(key) || !utf8.ValidString(value) {
+			return ErrInvalidAttributes
+		}
+	}
+	if e.DeliverAt < 0 || e.Delay < 0 || e.Delay > math.MaxInt64-now.Unix() {
+		return ErrInvalidSchedule
+	}
+	if e.DeliverAt != 0 && e.Delay != 0 {
+		return ErrConflictingSchedule
+	}
+	if !ValidPriority(e.Priority) {
+		return ErrInvalidPriority
+	}
 	if e.Timestamp == 0 {
-		e.Timestamp = time.Now().Unix()
+		e.Timestamp = now.Unix()
+	}
+	if e.Delay != 0 {
+		e.DeliverAt, e.Delay = now.Unix()+e.Delay, 0
 	}
 	return nil
 }
 
+// DueAt returns when the event may be processed, zero when at once
+func (e *Event) DueAt() time.Time {
+	if e.DeliverAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(e.DeliverAt, 0)
+}
+
 // TransformedEvent represents a processed event
 type TransformedEvent struct {
 	ID           string    `json:"id"`
+	Tenant       string    `json:"tenant,omitempty"`
 	OriginalTime int64     `json:"original_time"`
 	ProcessedAt  time.Time `json:"processed_at"`
 	Payload      string    `json:"payload"`
 	ProcessorID  string    `json:"processor_id"`
+	// Type and Attributes are copied from the event
+	Type       string            `json:"type,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // Common errors
 var (
-	ErrMissingID        = Error("missing event ID")
-	ErrEventNotFound    = Error("event not found")
-	ErrDuplicateEventID = Error("duplicate event ID")
+	ErrMissingID         = Error("missing event ID")
+	ErrInvalidPayload    = Error("event payload is not valid UTF-8")
+	ErrInvalidType       = Error("event type is not valid UTF-8")
+	ErrInvalidAttributes = Error("event attributes need non-empty UTF-8 names and UTF-8 values")
+	ErrEventNotFound     = Error("event not found")
+	ErrDuplicateEventID  = Error("duplicate event ID")
+	ErrStoreClosed       = Error("event store closed")
+	ErrQueueFull         = Error("event queue full")
+
+	ErrInvalidSchedule     = Error("event deliver_at or delay out of range")
+	ErrConflictingSchedule = Error("event sets both deliver_at and delay")
+	ErrNotScheduled        = Error("event is not waiting for delivery")
+	ErrInvalidPriority     = Error("event priority must be high, normal or low")
+
+	ErrRateQuotaExceeded    = Error("tenant event rate quota exceeded")
+	ErrStorageQuotaExceeded = Error("tenant storage quota exceeded")
 )
 
 // Error is a simple string-based error type
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// FuzzValidateEvent checks that an event is valid exactly when it has an ID
+// and a UTF-8 payload, and that validation only fills a missing timestamp
+func FuzzValidateEvent(f *testing.F) {
+	f.Add("id", "payload", int64(1625097600))
+	f.Add("", "payload", int64(0))
+	f.Add("id", "\xff\xfe", int64(-1))
+	f.Add("", "\xc3", int64(0))
+	f.Add("\x00", "", int64(1<<62))
+
+	f.Fuzz(func(t *testing.T, id, payload string, timestamp int64) {
+		event := &Event{ID: id, Payload: payload, Timestamp: timestamp}
+		err := ValidateEvent(event)
+
+		switch {
+		case id == "":
+			if err != ErrMissingID {
+				t.Fatalf("Expected %v, got %v", ErrMissingID, err)
+			}
+		case !utf8.ValidString(payload):
+			if err != ErrInvalidPayload {
+				t.Fatalf("Expected %v, got %v", ErrInvalidPayload, err)
+			}
+		case err != nil:
+			t.Fatalf("Expected a valid event, got %v", err)
+		case timestamp != 0 && event.Timestamp != timestamp:
+			t.Fatalf("Expected the timestamp kept, got %d for %d", event.Timestamp, timestamp)
+		case event.Timestamp == 0:
+			t.Fatal("Expected a missing timestamp to be set")
+		}
+		if event.ID != id || event.Payload != payload {
+			t.Fatalf("Expected the event unchanged, got %+v", event)
+		}
+	})
+}
+
+func TestValidateEventAt(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	event := &Event{ID: "id"}
+	if err := ValidateEventAt(event, now); err != nil {
+		t.Fatalf("Expected a valid event, got %v", err)
+	}
+	if event.Timestamp != now.Unix() {
+		t.Errorf("Expected the missing timestamp set to %d, got %d", now.Unix(), event.Timestamp)
+	}
+
+	event = &Event{ID: "id", Timestamp: 42}
+	if err := ValidateEventAt(event, now); err != nil || event.Timestamp != 42 {
+		t.Errorf("Expected the timestamp kept, got %d, %v", event.Timestamp, err)
+	}
+}
+
+func TestValidateEventPriority(t *testing.T) {
+	for _, priority := range []Priority{"", PriorityHigh, PriorityNormal, PriorityLow} {
+		if err := ValidateEvent(&Event{ID: "id", Priority: priority}); err != nil {
+			t.Errorf("Expected priority %q to be valid, got %v", priority, err)
+		}
+	}
+	if err := ValidateEvent(&Event{ID: "id", Priority: "urgent"}); err != ErrInvalidPriority {
+		t.Errorf("Expected %v, got %v", ErrInvalidPriority, err)
+	}
+	if lane := (&Event{ID: "id"}).Lane(); lane != PriorityNormal {
+		t.Errorf("Expected an unset priority in the normal lane, got %s", lane)
+	}
+}
+
+func TestValidateEventAttributes(t *testing.T) {
+	valid := &Event{ID: "id", Type: "order.created", Attributes: map[string]string{"region": "eu", "empty": ""}}
+	if err := ValidateEvent(valid); err != nil {
+		t.Errorf("Expected type and attributes to be valid, got %v", err)
+	}
+	if err := ValidateEvent(&Event{ID: "id", Type: "\xff"}); err != ErrInvalidType {
+		t.Errorf("Expected %v, got %v", ErrInvalidType, err)
+	}
+	for _, attributes := range []map[string]string{{"": "eu"}, {"\xff": "eu"}, {"region": "\xff"}} {
+		if err := ValidateEvent(&Event{ID: "id", Attributes: attributes}); err != ErrInvalidAttributes {
+			t.Errorf("Expected %v for %q, got %v", ErrInvalidAttributes, attributes, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// CursorLatest positions a consumer group after the latest event stored
+const CursorLatest = ^uint64(0)
+
+// ConsumerGroup is a named position in a tenant's event stream, kept by
+// the server. Consumers streaming with the group resume after its cursor
+// and advance it as events are delivered to them.
+type ConsumerGroup struct {
+	Name string `json:"name"`
+	// Cursor is the sequence number of the last event delivered
+	Cursor uint64 `json:"cursor"`
+	// Lag counts the events stored after the cursor
+	Lag       int       `json:"lag"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// groupEntry is the state of a consumer group
+type groupEntry struct {
+	cursor    uint64
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// Consumer group errors
+var (
+	ErrGroupNotFound = Error("consumer group not found")
+	ErrGroupExists   = Error("consumer group already exists")
+	ErrInvalidGroup  = Error("consumer group names are 1 to 64 letters, digits, '_' or '-'")
+)
+
+// ValidGroup reports whether name can name a consumer group
+func ValidGroup(name string) bool {
+	return tenantPattern.MatchString(name)
+}
+
+// CreateGroup creates a consumer group of a tenant positioned after the
+// event with sequence number cursor, or after the latest with CursorLatest
+func (s *EventStore) CreateGroup(tenant, name string, cursor uint64) (ConsumerGroup, error) {
+	if !ValidGroup(name) {
+		return ConsumerGroup{}, ErrInvalidGroup
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.tenant(tenant)
+	if _, ok := t.groups[name]; ok {
+		return ConsumerGroup{}, ErrGroupExists
+	}
+	now := s.clock.Now().UTC()
+	g := &groupEntry{cursor: t.clampCursor(cursor), createdAt: now, updatedAt: now}
+	t.groups[name] = g
+	return t.group(name, g), nil
+}
+
+// Groups returns the consumer groups of a tenant, by name
+func (s *EventStore) Groups(tenant string) []ConsumerGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return []ConsumerGroup{}
+	}
+	groups := make([]ConsumerGroup, 0, len(t.groups))
+	for name, g := range t.groups {
+		groups = append(groups, t.group(name, g))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Group returns a consumer group of a tenant
+func (s *EventStore) Group(tenant, name string) (ConsumerGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return ConsumerGroup{}, ErrGroupNotFound
+	}
+	g, ok := t.groups[name]
+	if !ok {
+		return ConsumerGroup{}, ErrGroupNotFound
+	}
+	return t.group(name, g), nil
+}
+
+// SeekGroup moves a consumer group after the event with sequence number
+// cursor, or after the latest with CursorLatest. Consumers already
+// streaming keep their position until they reconnect.
+func (s *EventStore) SeekGroup(tenant, name string, cursor uint64) (ConsumerGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, g, err := s.groupEntry(tenant, name)
+	if err != nil {
+		return ConsumerGroup{}, err
+	}
+	g.cursor = t.clampCursor(cursor)
+	g.updatedAt = s.clock.Now().UTC()
+	return t.group(name, g), nil
+}
+
+// CommitGroup advances a consumer group to the event with sequence number
+// cursor once it was delivered. It never moves the group back.
+func (s *EventStore) CommitGroup(tenant, name string, cursor uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, g, err := s.groupEntry(tenant, name)
+	if err != nil {
+		return err
+	}
+	if cursor = t.clampCursor(cursor); cursor > g.cursor {
+		g.cursor = cursor
+		g.updatedAt = s.clock.Now().UTC()
+	}
+	return nil
+}
+
+// DeleteGroup removes a consumer group and returns it
+func (s *EventStore) DeleteGroup(tenant, name string) (ConsumerGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, g, err := s.groupEntry(tenant, name)
+	if err != nil {
+		return ConsumerGroup{}, err
+	}
+	delete(t.groups, name)
+	return t.group(name, g), nil
+}
+
+// groupEntry returns a consumer group and its tenant. Callers must hold
+// s.mu for writing.
+func (s *EventStore) groupEntry(tenant, name string) (*tenantData, *groupEntry, error) {
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return nil, nil, ErrGroupNotFound
+	}
+	g, ok := t.groups[name]
+	if !ok {
+		return nil, nil, ErrGroupNotFound
+	}
+	return t, g, nil
+}
+
+// clampCursor keeps a cursor within the events stored so far
+func (t *tenantData) clampCursor(cursor uint64) uint64 {
+	if cursor > t.seq {
+		return t.seq
+	}
+	return cursor
+}
+
+// group describes a consumer group, counting the events after its cursor
+func (t *tenantData) group(name string, g *groupEntry) ConsumerGroup {
+	start := sort.Search(len(t.order), func(i int) bool {
+		return t.order[i].seq > g.cursor
+	})
+	return ConsumerGroup{
+		Name:      name,
+		Cursor:    g.cursor,
+		Lag:       len(t.order) - start,
+		CreatedAt: g.createdAt,
+		UpdatedAt: g.updatedAt,
+	}
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConsumerGroups(t *testing.T) {
+	store := NewEventStore(10)
+	for i := 0; i < 3; i++ {
+		if err := store.Add(&Event{ID: fmt.Sprintf("e%d", i), Tenant: "acme"}); err != nil {
+			t.Fatalf("Failed to add event: %v", err)
+		}
+	}
+
+	billing, err := store.CreateGroup("acme", "billing", 0)
+	if err != nil || billing.Cursor != 0 || billing.Lag != 3 {
+		t.Fatalf("Expected a group at the start with 3 events of lag, got %+v: %v", billing, err)
+	}
+	if _, err := store.CreateGroup("acme", "billing", 0); err != ErrGroupExists {
+		t.Errorf("Expected %v, got %v", ErrGroupExists, err)
+	}
+	if _, err := store.CreateGroup("acme", "bad name", 0); err != ErrInvalidGroup {
+		t.Errorf("Expected %v, got %v", ErrInvalidGroup, err)
+	}
+	audit, err := store.CreateGroup("acme", "audit", CursorLatest)
+	if err != nil || audit.Cursor != 3 || audit.Lag != 0 {
+		t.Errorf("Expected a group after the latest event, got %+v: %v", audit, err)
+	}
+
+	// Commits only move forward, seeks move anywhere within the stream
+	if err := store.CommitGroup("acme", "billing", 2); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := store.CommitGroup("acme", "billing", 1); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if g, _ := store.Group("acme", "billing"); g.Cursor != 2 || g.Lag != 1 {
+		t.Errorf("Expected billing at 2 with 1 event of lag, got %+v", g)
+	}
+	if g, err := store.SeekGroup("acme", "audit", 1); err != nil || g.Cursor != 1 || g.Lag != 2 {
+		t.Errorf("Expected audit moved back to 1, got %+v: %v", g, err)
+	}
+	if g, _ := store.SeekGroup("acme", "audit", 99); g.Cursor != 3 {
+		t.Errorf("Expected a seek past the end to stop at the latest event, got %+v", g)
+	}
+
+	groups := store.Groups("acme")
+	if len(groups) != 2 || groups[0].Name != "audit" || groups[1].Name != "billing" {
+		t.Errorf("Expected audit and billing, got %+v", groups)
+	}
+	if got := store.Groups("other"); len(got) != 0 {
+		t.Errorf("Expected groups isolated per tenant, got %+v", got)
+	}
+	if _, err := store.Group("other", "billing"); err != ErrGroupNotFound {
+		t.Errorf("Expected %v in another tenant, got %v", ErrGroupNotFound, err)
+	}
+
+	if _, err := store.DeleteGroup("acme", "audit"); err != nil {
+		t.Errorf("Failed to delete: %v", err)
+	}
+	if _, err := store.SeekGroup("acme", "audit", 0); err != ErrGroupNotFound {
+		t.Errorf("Expected %v after delete, got %v", ErrGroupNotFound, err)
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+// Priority selects the lane an event waits in before processing
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Priorities lists the lanes from the highest priority down
+var Priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ValidPriority reports whether p names a lane. The empty priority is
+// valid and means PriorityNormal.
+func ValidPriority(p Priority) bool {
+	switch p {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// Lane returns the priority lane of the event, PriorityNormal when unset
+func (e *Event) Lane() Priority {
+	if e.Priority == "" {
+		return PriorityNormal
+	}
+	return e.Priority
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"time"
+
+	"coding_challenge/internal/clock"
+)
+
+// scheduleRetry is how long due events wait when their lane is full
+const scheduleRetry = 100 * time.Millisecond
+
+// scheduledEntry is an event held back until its delivery time
+type scheduledEntry struct {
+	event *Event
+	at    time.Time
+	// seq keeps events due at the same time in submission order
+	seq uint64
+	// stored is the sequence number of the event within its tenant
+	stored uint64
+	index  int
+}
+
+// scheduleHeap orders the scheduled events of every tenant, soonest first
+type scheduleHeap []*scheduledEntry
+
+func (h scheduleHeap) Len() int { return len(h) }
+
+func (h scheduleHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	entry := x.(*scheduledEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// schedule holds an event, the latest stored by its tenant, until at.
+// Callers must hold s.mu for writing.
+func (s *EventStore) schedule(t *tenantData, event *Event, at time.Time) {
+	s.scheduleSeq++
+	entry := &scheduledEntry{event: event, at: at, seq: s.scheduleSeq, stored: t.seq}
+	heap.Push(&s.scheduled, entry)
+	t.scheduled[event.ID] = entry
+	s.wakeScheduler()
+}
+
+// wakeScheduler makes RunScheduler recompute its next wake up
+func (s *EventStore) wakeScheduler() {
+	select {
+	case s.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// ScheduledInTenant returns the events of a tenant waiting for their
+// delivery time, soonest first
+func (s *EventStore) ScheduledInTenant(tenant string) []*Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return []*Event{}
+	}
+	entries := make([]*scheduledEntry, 0, len(t.scheduled))
+	for _, entry := range t.scheduled {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return scheduleHeap(entries).Less(i, j)
+	})
+	events := make([]*Event, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.event
+	}
+	return events
+}
+
+// CancelScheduled removes an event of a tenant that is waiting for its
+// delivery time, as if it had never been submitted. It returns
+// ErrNotScheduled for an event already delivered.
+func (s *EventStore) CancelScheduled(tenant, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return ErrEventNotFound
+	}
+	entry, ok := t.scheduled[id]
+	if !ok {
+		if _, exists := t.events[id]; exists {
+			return ErrNotScheduled
+		}
+		return ErrEventNotFound
+	}
+	heap.Remove(&s.scheduled, entry.index)
+	delete(t.scheduled, id)
+	t.bytes -= eventSize(entry.event)
+	delete(t.events, id)
+	// Forget its position too, or a resubmitted event with the same ID
+	// would be listed twice and purged by the canceled event's age
+	i := sort.Search(len(t.order), func(i int) bool {
+		return t.order[i].seq >= entry.stored
+	})
+	if i < len(t.order) && t.order[i].seq == entry.stored {
+		t.order = append(t.order[:i], t.order[i+1:]...)
+	}
+	s.wakeScheduler()
+	return nil
+}
+
+// ScheduledLen returns the number of events waiting for their delivery time
+func (s *EventStore) ScheduledLen() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.scheduled)
+}
+
+// ReleaseDue hands the events due by now to their lanes, soonest first.
+// Events whose lane is full stay scheduled without holding back the other
+// lanes. It returns how many were released.
+func (s *EventStore) ReleaseDue(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	released := 0
+	var blocked []*scheduledEntry
+	for !s.closed && len(s.scheduled) > 0 && !s.scheduled[0].at.After(now) {
+		entry := heap.Pop(&s.scheduled).(*scheduledEntry)
+		lane := s.lanes[entry.event.Lane()]
+		if len(lane) == cap(lane) {
+			blocked = append(blocked, entry)
+			continue
+		}
+		delete(s.tenants[entry.event.Tenant].scheduled, entry.event.ID)
+		lane <- entry.event
+		released++
+	}
+	for _, entry := range blocked {
+		heap.Push(&s.scheduled, entry)
+	}
+	return released
+}
+
+// nextRelease returns how long RunScheduler may sleep, false when nothing
+// is scheduled
+func (s *EventStore) nextRelease(now time.Time) (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.scheduled) == 0 {
+		return 0, false
+	}
+	if wait := s.scheduled[0].at.Sub(now); wait > 0 {
+		return wait, true
+	}
+	// Due but its lane is full
+	return scheduleRetry, true
+}
+
+// RunScheduler releases scheduled events as they fall due, on the store's
+// clock, until ctx ends or the store is closed. Events still scheduled
+// when the store closes are never processed.
+func (s *EventStore) RunScheduler(ctx context.Context) {
+	for {
+		s.ReleaseDue(s.clock.Now())
+		if s.Closed() {
+			return
+		}
+
+		var timer clock.Timer
+		var due <-chan time.Time
+		if wait, ok := s.nextRelease(s.clock.Now()); ok {
+			timer = s.clock.NewTimer(wait)
+			due = timer.C()
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.scheduleWake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
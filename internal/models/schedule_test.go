@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"coding_challenge/internal/clock"
+)
+
+// epoch is the time the scheduling tests start at
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestEventStoreHoldsScheduledEvents(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	store := NewEventStore(1)
+	store.SetClock(fake)
+	store.SetQuotas(nil, TenantQuota{Retention: time.Minute})
+
+	deliverAt := epoch.Add(time.Hour).Unix()
+	for _, id := range []string{"b", "a"} {
+		if err := store.Add(&Event{ID: id, DeliverAt: deliverAt}); err != nil {
+			t.Fatalf("Failed to add scheduled event: %v", err)
+		}
+	}
+	if err := store.Add(&Event{ID: "c", DeliverAt: deliverAt - 60}); err != nil {
+		t.Fatalf("Failed to add scheduled event: %v", err)
+	}
+	// Scheduled events do not take room in the queue
+	if err := store.Add(&Event{ID: "now", DeliverAt: epoch.Unix()}); err != nil {
+		t.Fatalf("Failed to add a due event: %v", err)
+	}
+	if store.QueueLen() != 1 || store.ScheduledLen() != 3 {
+		t.Fatalf("Expected 1 queued and 3 scheduled events, got %d and %d", store.QueueLen(), store.ScheduledLen())
+	}
+	if ids := eventIDs(store.ScheduledInTenant(DefaultTenant)); ids != "c,b,a" {
+		t.Errorf("Expected scheduled events soonest first, got %s", ids)
+	}
+
+	// Retention does not remove events before they are delivered
+	fake.Advance(2 * time.Hour)
+	if removed := store.Purge(fake.Now()); removed != 1 {
+		t.Errorf("Expected only the delivered event purged, got %d", removed)
+	}
+	<-store.Lane(PriorityNormal)
+
+	// Due events are released in order while the queue has room
+	if released := store.ReleaseDue(fake.Now()); released != 1 {
+		t.Fatalf("Expected 1 event released into the full queue, got %d", released)
+	}
+	if event := <-store.Lane(PriorityNormal); event.ID != "c" {
+		t.Errorf("Expected c first, got %s", event.ID)
+	}
+	store.ReleaseDue(fake.Now())
+	if event := <-store.Lane(PriorityNormal); event.ID != "b" {
+		t.Errorf("Expected b before a, got %s", event.ID)
+	}
+	if err := store.CancelScheduled(DefaultTenant, "b"); err != ErrNotScheduled {
+		t.Errorf("Expected %v for a delivered event, got %v", ErrNotScheduled, err)
+	}
+	if err := store.CancelScheduled(DefaultTenant, "a"); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+	if _, err := store.Get("a"); err != ErrEventNotFound {
+		t.Errorf("Expected the canceled event removed, got %v", err)
+	}
+	if err := store.CancelScheduled(DefaultTenant, "a"); err != ErrEventNotFound {
+		t.Errorf("Expected %v, got %v", ErrEventNotFound, err)
+	}
+	if store.ReleaseDue(fake.Now()) != 0 || store.ScheduledLen() != 0 {
+		t.Error("Expected nothing left to release")
+	}
+}
+
+func TestRunSchedulerFollowsClock(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	store := NewEventStore(10)
+	store.SetClock(fake)
+
+	done := make(chan struct{})
+	go func() {
+		store.RunScheduler(context.Background())
+		close(done)
+	}()
+
+	if err := store.Add(&Event{ID: "later", DeliverAt: epoch.Add(time.Minute).Unix()}); err != nil {
+		t.Fatalf("Failed to add scheduled event: %v", err)
+	}
+	// An earlier event wakes the scheduler
+	fake.BlockUntil(1)
+	if err := store.Add(&Event{ID: "sooner", DeliverAt: epoch.Add(time.Second).Unix()}); err != nil {
+		t.Fatalf("Failed to add scheduled event: %v", err)
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	if event := <-store.Lane(PriorityNormal); event.ID != "sooner" {
+		t.Errorf("Expected sooner first, got %s", event.ID)
+	}
+	fake.BlockUntil(1)
+	fake.Set(epoch.Add(time.Minute))
+	if event := <-store.Lane(PriorityNormal); event.ID != "later" {
+		t.Errorf("Expected later, got %s", event.ID)
+	}
+
+	store.Close()
+	<-done
+}
+
+// eventIDs joins the IDs of events with commas
+func eventIDs(events []*Event) string {
+	ids := ""
+	for i, event := range events {
+		if i > 0 {
+			ids += ","
+		}
+		ids += event.ID
+	}
+	return ids
+}
+
+func TestReleaseDueSkipsFullLanes(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	store := NewEventStore(1)
+	store.SetClock(fake)
+
+	deliverAt := epoch.Add(time.Minute).Unix()
+	for _, event := range []*Event{
+		{ID: "low-1", Priority: PriorityLow, DeliverAt: deliverAt},
+		{ID: "low-2", Priority: PriorityLow, DeliverAt: deliverAt},
+		{ID: "high", Priority: PriorityHigh, DeliverAt: deliverAt},
+	} {
+		if err := store.Add(event); err != nil {
+			t.Fatalf("Failed to add scheduled event: %v", err)
+		}
+	}
+
+	// low-2 waits for room in its lane without holding back high
+	fake.Advance(time.Minute)
+	if released := store.ReleaseDue(fake.Now()); released != 2 {
+		t.Fatalf("Expected 2 events released, got %d", released)
+	}
+	if ids := eventIDs(store.ScheduledInTenant(DefaultTenant)); ids != "low-2" {
+		t.Errorf("Expected low-2 still scheduled, got %s", ids)
+	}
+	if event := <-store.Lane(PriorityHigh); event.ID != "high" {
+		t.Errorf("Expected high released, got %s", event.ID)
+	}
+
+	<-store.Lane(PriorityLow)
+	if released := store.ReleaseDue(fake.Now()); released != 1 || store.ScheduledLen() != 0 {
+		t.Errorf("Expected low-2 released once its lane had room, got %d", released)
+	}
+}
+
+func TestCancelledEventCanBeResubmitted(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	store := NewEventStore(10)
+	store.SetClock(fake)
+	store.SetQuotas(nil, TenantQuota{Retention: time.Hour})
+
+	if err := store.Add(&Event{ID: "a", DeliverAt: epoch.Add(time.Hour).Unix()}); err != nil {
+		t.Fatalf("Failed to add scheduled event: %v", err)
+	}
+	fake.Advance(45 * time.Minute)
+	if err := store.CancelScheduled(DefaultTenant, "a"); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+	if err := store.Add(&Event{ID: "a", Payload: "again"}); err != nil {
+		t.Fatalf("Failed to resubmit: %v", err)
+	}
+
+	if records := store.ListInTenant(DefaultTenant, 0, 0); len(records) != 1 || records[0].Event.Payload != "again" {
+		t.Errorf("Expected only the resubmitted event listed, got %+v", records)
+	}
+	// Retention counts from the resubmission, not the canceled event
+	fake.Advance(30 * time.Minute)
+	if removed := store.Purge(fake.Now()); removed != 0 {
+		t.Errorf("Expected nothing purged, got %d", removed)
+	}
+	if _, err := store.Get("a"); err != nil {
+		t.Errorf("Expected the resubmitted event kept, got %v", err)
+	}
+}
@@ -1,80 +1,336 @@
 package models
 
 import (
+	"sort"
 	"sync"
+	"time"
+
+	"coding_challenge/internal/clock"
 )
 
-// EventStore provides thread-safe storage and retrieval of events
+// EventStore provides thread-safe storage and retrieval of events. Events
+// are isolated per tenant, so IDs only need to be unique within a tenant.
 type EventStore struct {
-	mu     sync.RWMutex
-	events map[string]*Event
-	// Channel for new events
-	eventCh chan *Event
+	mu      sync.RWMutex
+	tenants map[string]*tenantData
+	// Quotas applied to tenants as they are first seen
+	quotas       map[string]TenantQuota
+	defaultQuota TenantQuota
+	// Channels of events ready for processing, one per priority lane
+	lanes map[Priority]chan *Event
+	// Live subscribers by tenant
+	subscribers map[string]map[*Subscription]struct{}
+	// Events held back until their delivery time, across tenants
+	scheduled    scheduleHeap
+	scheduleSeq  uint64
+	scheduleWake chan struct{}
+	closed       bool
+	clock        clock.Clock
 }
 
-// NewEventStore creates a new event store with a buffer for event channel
+// NewEventStore creates a new event store whose priority lanes each buffer
+// bufferSize events
 func NewEventStore(bufferSize int) *EventStore {
+	return NewEventStoreWithLanes(bufferSize, nil)
+}
+
+// NewEventStoreWithLanes creates a new event store with the lane capacities
+// given, lanes missing or set to zero buffering bufferSize events
+func NewEventStoreWithLanes(bufferSize int, capacities map[Priority]int) *EventStore {
+	lanes := make(map[Priority]chan *Event, len(Priorities))
+	for _, p := range Priorities {
+		capacity := capacities[p]
+		if capacity <= 0 {
+			capacity = bufferSize
+		}
+		lanes[p] = make(chan *Event, capacity)
+	}
 	return &EventStore{
-		events:  make(map[string]*Event),
-		eventCh: make(chan *Event, bufferSize),
+		tenants:      make(map[string]*tenantData),
+		quotas:       make(map[string]TenantQuota),
+		lanes:        lanes,
+		subscribers:  make(map[string]map[*Subscription]struct{}),
+		scheduleWake: make(chan struct{}, 1),
+		clock:        clock.Real,
+	}
+}
+
+// SetClock sets the clock timing rate quotas, retention and scheduled
+// deliveries
+func (s *EventStore) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock.OrReal(c)
+}
+
+// SetQuotas configures per-tenant quotas and the quota used for tenants
+// not listed. It applies to tenants already seen as well.
+func (s *EventStore) SetQuotas(quotas map[string]TenantQuota, defaultQuota TenantQuota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quotas = quotas
+	s.defaultQuota = defaultQuota
+	for name, t := range s.tenants {
+		fresh := newTenantData(s.quotaFor(name))
+		t.quota, t.limiter = fresh.quota, fresh.limiter
+	}
+}
+
+// quotaFor returns the quota of a tenant. Callers must hold s.mu.
+func (s *EventStore) quotaFor(tenant string) TenantQuota {
+	if quota, ok := s.quotas[tenant]; ok {
+		return quota
+	}
+	return s.defaultQuota
+}
+
+// tenant returns the namespace of a tenant, creating it if needed. Callers
+// must hold s.mu for writing.
+func (s *EventStore) tenant(name string) *tenantData {
+	t, ok := s.tenants[name]
+	if !ok {
+		t = newTenantData(s.quotaFor(name))
+		s.tenants[name] = t
 	}
+	return t
 }
 
-// Add stores an event in the in-memory store
+// Add stores an event in the in-memory store, in the namespace of its
+// tenant (DefaultTenant when empty), and queues it in its priority lane.
+// An event with a delivery time still to come is held back from its lane
+// until RunScheduler releases it.
 func (s *EventStore) Add(event *Event) error {
 	if event == nil {
 		return ErrMissingID
 	}
+	if event.Tenant == "" {
+		event.Tenant = DefaultTenant
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.events[event.ID]; exists {
+	if s.closed {
+		return ErrStoreClosed
+	}
+	lane, ok := s.lanes[event.Lane()]
+	if !ok {
+		return ErrInvalidPriority
+	}
+
+	t := s.tenant(event.Tenant)
+	if _, exists := t.events[event.ID]; exists {
 		return ErrDuplicateEventID
 	}
 
-	s.events[event.ID] = event
-	// Send to channel (non-blocking)
-	select {
-	case s.eventCh <- event:
-		// Event sent successfully
-	default:
-		// Channel is full, just continue
+	size := eventSize(event)
+	if t.quota.MaxStoredBytes > 0 && t.bytes+size > t.quota.MaxStoredBytes {
+		return ErrStorageQuotaExceeded
+	}
+	now := s.clock.Now()
+	if t.limiter != nil && !t.limiter.Allow(now) {
+		return ErrRateQuotaExceeded
+	}
+	// Only Add and ReleaseDue send, under s.mu, so the send below cannot
+	// block. Refusing the event beats storing it without ever processing it.
+	scheduled := event.DueAt().After(now)
+	if !scheduled && len(lane) == cap(lane) {
+		return ErrQueueFull
+	}
+
+	t.seq++
+	t.events[event.ID] = event
+	t.order = append(t.order, storedEntry{id: event.ID, seq: t.seq, storedAt: now})
+	t.bytes += size
+	s.broadcast(event.Tenant, Record{Seq: t.seq, Event: event})
+	if scheduled {
+		s.schedule(t, event, event.DueAt())
+	} else {
+		lane <- event
 	}
 
 	return nil
 }
 
-// Get retrieves an event by ID
+// Get retrieves an event of the default tenant by ID
 func (s *EventStore) Get(id string) (*Event, error) {
+	return s.GetInTenant(DefaultTenant, id)
+}
+
+// GetInTenant retrieves an event by ID within a tenant
+func (s *EventStore) GetInTenant(tenant, id string) (*Event, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	event, exists := s.events[id]
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return nil, ErrEventNotFound
+	}
+	event, exists := t.events[id]
 	if !exists {
 		return nil, ErrEventNotFound
 	}
 	return event, nil
 }
 
-// GetAll returns all events
+// GetAll returns all events of the default tenant
 func (s *EventStore) GetAll() []*Event {
+	return s.GetAllInTenant(DefaultTenant)
+}
+
+// GetAllInTenant returns all events of a tenant
+func (s *EventStore) GetAllInTenant(tenant string) []*Event {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	events := make([]*Event, 0, len(s.events))
-	for _, event := range s.events {
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return []*Event{}
+	}
+	events := make([]*Event, 0, len(t.events))
+	for _, event := range t.events {
 		events = append(events, event)
 	}
 	return events
 }
 
-// EventChannel returns the channel that emits new events
-func (s *EventStore) EventChannel() <-chan *Event {
-	return s.eventCh
+// ListInTenant returns up to limit events of a tenant stored after the
+// sequence number after, oldest first. A limit of zero returns them all.
+func (s *EventStore) ListInTenant(tenant string, after uint64, limit int) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tenants[tenant]
+	if !ok {
+		return []Record{}
+	}
+	start := sort.Search(len(t.order), func(i int) bool {
+		return t.order[i].seq > after
+	})
+	records := make([]Record, 0)
+	for _, entry := range t.order[start:] {
+		if limit > 0 && len(records) == limit {
+			break
+		}
+		if event, ok := t.events[entry.id]; ok {
+			records = append(records, Record{Seq: entry.seq, Event: event})
+		}
+	}
+	return records
+}
+
+// RateRetryAfter returns how long a tenant must wait before its rate quota
+// admits another event
+func (s *EventStore) RateRetryAfter(tenant string) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if t, ok := s.tenants[tenant]; ok && t.limiter != nil {
+		return t.limiter.Delay(s.clock.Now(), 1)
+	}
+	return 0
+}
+
+// StoredBytes returns the bytes a tenant has stored against its quota
+func (s *EventStore) StoredBytes(tenant string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if t, ok := s.tenants[tenant]; ok {
+		return t.bytes
+	}
+	return 0
+}
+
+// Purge removes events older than their tenant's retention and returns
+// how many were removed
+func (s *EventStore) Purge(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for _, t := range s.tenants {
+		if t.quota.Retention <= 0 {
+			continue
+		}
+		cutoff := now.Add(-t.quota.Retention)
+		// Events waiting for delivery are kept until delivered
+		var kept []storedEntry
+		n := 0
+		for n < len(t.order) && t.order[n].storedAt.Before(cutoff) {
+			if _, waiting := t.scheduled[t.order[n].id]; waiting {
+				kept = append(kept, t.order[n])
+			} else if event, ok := t.events[t.order[n].id]; ok {
+				t.bytes -= eventSize(event)
+				delete(t.events, t.order[n].id)
+				removed++
+			}
+			n++
+		}
+		t.order = append(kept, t.order[n:]...)
+	}
+	return removed
+}
+
+// Lane returns the channel that emits the new events of a priority lane,
+// nil for an unknown priority
+func (s *EventStore) Lane(p Priority) <-chan *Event {
+	return s.lanes[p]
+}
+
+// QueueLen returns the number of events waiting to be consumed across lanes
+func (s *EventStore) QueueLen() int {
+	n := 0
+	for _, lane := range s.lanes {
+		n += len(lane)
+	}
+	return n
+}
+
+// QueueCap returns the capacity of the lane buffers together
+func (s *EventStore) QueueCap() int {
+	n := 0
+	for _, lane := range s.lanes {
+		n += cap(lane)
+	}
+	return n
+}
+
+// LaneLen returns the number of events waiting in a priority lane
+func (s *EventStore) LaneLen(p Priority) int {
+	return len(s.lanes[p])
+}
+
+// LaneCap returns the capacity of a priority lane
+func (s *EventStore) LaneCap(p Priority) int {
+	return cap(s.lanes[p])
+}
+
+// Closed reports whether the store has stopped accepting events
+func (s *EventStore) Closed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closed
 }
 
 // Close shuts down the event store and its channels
 func (s *EventStore) Close() {
-	close(s.eventCh)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, lane := range s.lanes {
+		close(lane)
+	}
+	s.wakeScheduler()
+	for _, subs := range s.subscribers {
+		for sub := range subs {
+			sub.close(false)
+		}
+	}
+	s.subscribers = make(map[string]map[*Subscription]struct{})
 }
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// storeModel is the reference the EventStore is checked against: events
+// in order per tenant, and the FIFO of events waiting to be processed
+type storeModel struct {
+	tenants  map[string][]*Event
+	queue    []*Event
+	capacity int
+	closed   bool
+}
+
+func (m *storeModel) find(tenant, id string) *Event {
+	for _, event := range m.tenants[tenant] {
+		if event.ID == id {
+			return event
+		}
+	}
+	return nil
+}
+
+func (m *storeModel) add(event *Event) error {
+	switch {
+	case m.closed:
+		return ErrStoreClosed
+	case m.find(event.Tenant, event.ID) != nil:
+		return ErrDuplicateEventID
+	case len(m.queue) == m.capacity:
+		return ErrQueueFull
+	}
+	m.tenants[event.Tenant] = append(m.tenants[event.Tenant], event)
+	m.queue = append(m.queue, event)
+	return nil
+}
+
+// TestEventStoreMatchesModel runs random sequences of operations against
+// the store and the model, checking after each that they agree: no event
+// is lost, reordered or handed out for processing twice
+func TestEventStoreMatchesModel(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("Seed %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+	tenants := []string{DefaultTenant, "acme", "globex"}
+
+	for run := 0; run < 200; run++ {
+		capacity := 1 + rng.Intn(8)
+		store := NewEventStore(capacity)
+		model := &storeModel{tenants: make(map[string][]*Event), capacity: capacity}
+		fail := func(format string, args ...interface{}) {
+			t.Helper()
+			t.Fatalf("Run %d: %s", run, fmt.Sprintf(format, args...))
+		}
+
+		for step := 0; step < 100; step++ {
+			tenant := tenants[rng.Intn(len(tenants))]
+			// A small ID space makes duplicates common
+			id := fmt.Sprintf("e%d", rng.Intn(20))
+
+			switch op := rng.Intn(20); {
+			case op < 8:
+				event := &Event{ID: id, Tenant: tenant, Payload: id}
+				if got, want := store.Add(event), model.add(event); got != want {
+					fail("Add(%s/%s) returned %v, the model %v", tenant, id, got, want)
+				}
+			case op < 12:
+				select {
+				case event, ok := <-store.Lane(PriorityNormal):
+					if !ok {
+						if !model.closed || len(model.queue) > 0 {
+							fail("Channel closed with %d queued", len(model.queue))
+						}
+						continue
+					}
+					if len(model.queue) == 0 {
+						fail("Received %s/%s with nothing queued", event.Tenant, event.ID)
+					}
+					if event != model.queue[0] {
+						fail("Received %s/%s, expected %s/%s", event.Tenant, event.ID, model.queue[0].Tenant, model.queue[0].ID)
+					}
+					model.queue = model.queue[1:]
+				default:
+					if len(model.queue) > 0 || model.closed {
+						fail("Received nothing with %d queued", len(model.queue))
+					}
+				}
+			case op < 14:
+				event, err := store.GetInTenant(tenant, id)
+				if want := model.find(tenant, id); event != want || (want == nil) != (err == ErrEventNotFound) {
+					fail("GetInTenant(%s, %s) returned %v, %v, the model %v", tenant, id, event, err, want)
+				}
+			case op < 16:
+				got := store.GetAllInTenant(tenant)
+				want := model.tenants[tenant]
+				ids := make(map[*Event]bool, len(got))
+				for _, event := range got {
+					ids[event] = true
+				}
+				if len(got) != len(want) || len(ids) != len(want) {
+					fail("GetAllInTenant(%s) returned %d events, the model %d", tenant, len(got), len(want))
+				}
+				for _, event := range want {
+					if !ids[event] {
+						fail("GetAllInTenant(%s) is missing %s", tenant, event.ID)
+					}
+				}
+			case op < 19:
+				want := model.tenants[tenant]
+				after, limit := rng.Intn(len(want)+2), rng.Intn(4)
+				records := store.ListInTenant(tenant, uint64(after), limit)
+				expected := want[minInt(after, len(want)):]
+				if limit > 0 && len(expected) > limit {
+					expected = expected[:limit]
+				}
+				if len(records) != len(expected) {
+					fail("ListInTenant(%s, %d, %d) returned %d records, the model %d", tenant, after, limit, len(records), len(expected))
+				}
+				for i, record := range records {
+					if record.Event != expected[i] || record.Seq != uint64(after+i+1) {
+						fail("ListInTenant(%s, %d, %d)[%d] is %d:%s, expected %d:%s",
+							tenant, after, limit, i, record.Seq, record.Event.ID, after+i+1, expected[i].ID)
+					}
+				}
+			default:
+				if rng.Intn(10) == 0 {
+					store.Close()
+					model.closed = true
+				}
+			}
+		}
+
+		// Whatever is still queued is handed out once, then the channel ends
+		store.Close()
+		for _, want := range model.queue {
+			if event, ok := <-store.Lane(PriorityNormal); !ok || event != want {
+				fail("Expected queued %s/%s after close, got %v", want.Tenant, want.ID, event)
+			}
+		}
+		if event, ok := <-store.Lane(PriorityNormal); ok {
+			fail("Expected the channel closed, received %s/%s", event.Tenant, event.ID)
+		}
+	}
+}
+
+// TestEventStoreConcurrentInvariants races producers adding overlapping
+// IDs, consumers of the normal lane and readers. Each ID is stored at
+// most once, and every stored event is consumed exactly once.
+func TestEventStoreConcurrentInvariants(t *testing.T) {
+	const (
+		producers = 8
+		consumers = 3
+		readers   = 2
+		ids       = 200
+	)
+	store := NewEventStore(16)
+	tenants := []string{DefaultTenant, "acme"}
+
+	var mu sync.Mutex
+	stored := make(map[string]int)
+	consumed := make(map[string]int)
+	key := func(e *Event) string { return e.Tenant + "/" + e.ID }
+
+	var consumerWG sync.WaitGroup
+	for i := 0; i < consumers; i++ {
+		consumerWG.Add(1)
+		go func() {
+			defer consumerWG.Done()
+			for event := range store.Lane(PriorityNormal) {
+				mu.Lock()
+				consumed[key(event)]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var readerWG sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		readerWG.Add(1)
+		go func(tenant string) {
+			defer readerWG.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, event := range store.GetAllInTenant(tenant) {
+					if got, err := store.GetInTenant(tenant, event.ID); err != nil || got != event {
+						t.Errorf("GetAllInTenant returned %s but GetInTenant %v, %v", event.ID, got, err)
+						return
+					}
+				}
+			}
+		}(tenants[i%len(tenants)])
+	}
+
+	var producerWG sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		producerWG.Add(1)
+		go func(seed int64) {
+			defer producerWG.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < ids; i++ {
+				event := &Event{ID: fmt.Sprintf("e%d", rng.Intn(ids)), Tenant: tenants[rng.Intn(len(tenants))]}
+				switch err := store.Add(event); err {
+				case nil:
+					mu.Lock()
+					stored[key(event)]++
+					mu.Unlock()
+				case ErrDuplicateEventID, ErrQueueFull:
+				default:
+					t.Errorf("Unexpected error adding %s: %v", key(event), err)
+				}
+			}
+		}(int64(p))
+	}
+	producerWG.Wait()
+	close(done)
+	readerWG.Wait()
+	store.Close()
+	consumerWG.Wait()
+
+	total := 0
+	for k, n := range stored {
+		if n != 1 {
+			t.Errorf("%s stored %d times", k, n)
+		}
+		if consumed[k] != 1 {
+			t.Errorf("%s consumed %d times", k, consumed[k])
+		}
+	}
+	for k := range consumed {
+		if stored[k] == 0 {
+			t.Errorf("%s consumed but never stored", k)
+		}
+	}
+	for _, tenant := range tenants {
+		total += len(store.GetAllInTenant(tenant))
+	}
+	if total != len(stored) {
+		t.Errorf("Expected %d events stored, GetAll returns %d", len(stored), total)
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
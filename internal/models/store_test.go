@@ -5,6 +5,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"coding_challenge/internal/clock"
 )
 
 func TestEventStoreAdd(t *testing.T) {
@@ -35,6 +37,19 @@ func TestEventStoreAdd(t *testing.T) {
 	}
 }
 
+func TestEventStoreAddAfterClose(t *testing.T) {
+	store := NewEventStore(10)
+	store.Close()
+
+	err := store.Add(&Event{ID: "test-id", Payload: "test payload"})
+	if err != ErrStoreClosed {
+		t.Errorf("Expected store closed error, got: %v", err)
+	}
+	if !store.Closed() {
+		t.Error("Expected store to report closed")
+	}
+}
+
 func TestEventStoreGet(t *testing.T) {
 	store := NewEventStore(10)
 
@@ -129,3 +144,216 @@ func TestEventStoreConcurrency(t *testing.T) {
 		t.Errorf("Expected %d events, got %d", expectedCount, len(allEvents))
 	}
 }
+
+func TestEventStoreTenantIsolation(t *testing.T) {
+	store := NewEventStore(10)
+
+	// The same ID may be used by different tenants
+	if err := store.Add(&Event{ID: "shared", Tenant: "team-a", Payload: "a"}); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	if err := store.Add(&Event{ID: "shared", Tenant: "team-b", Payload: "b"}); err != nil {
+		t.Fatalf("Failed to add event for second tenant: %v", err)
+	}
+	if err := store.Add(&Event{ID: "shared", Tenant: "team-a", Payload: "again"}); err != ErrDuplicateEventID {
+		t.Errorf("Expected duplicate ID error within tenant, got: %v", err)
+	}
+
+	event, err := store.GetInTenant("team-b", "shared")
+	if err != nil || event.Payload != "b" {
+		t.Errorf("Expected team-b event, got %+v, %v", event, err)
+	}
+	if _, err := store.Get("shared"); err != ErrEventNotFound {
+		t.Errorf("Expected default tenant not to see other tenants, got: %v", err)
+	}
+	if n := len(store.GetAllInTenant("team-a")); n != 1 {
+		t.Errorf("Expected 1 event for team-a, got %d", n)
+	}
+}
+
+func TestEventStoreQuotas(t *testing.T) {
+	store := NewEventStore(10)
+	store.SetQuotas(map[string]TenantQuota{
+		"limited": {EventsPerSecond: 1, Burst: 2},
+		"small":   {MaxStoredBytes: 10},
+	}, TenantQuota{})
+
+	for i := 0; i < 2; i++ {
+		if err := store.Add(&Event{ID: fmt.Sprintf("rate-%d", i), Tenant: "limited"}); err != nil {
+			t.Fatalf("Failed to add event within burst: %v", err)
+		}
+	}
+	if err := store.Add(&Event{ID: "rate-2", Tenant: "limited"}); err != ErrRateQuotaExceeded {
+		t.Errorf("Expected rate quota error, got: %v", err)
+	}
+	if wait := store.RateRetryAfter("limited"); wait <= 0 {
+		t.Errorf("Expected positive retry delay, got %v", wait)
+	}
+
+	if err := store.Add(&Event{ID: "a", Tenant: "small", Payload: "12345"}); err != nil {
+		t.Fatalf("Failed to add event within storage quota: %v", err)
+	}
+	if err := store.Add(&Event{ID: "b", Tenant: "small", Payload: "123456789"}); err != ErrStorageQuotaExceeded {
+		t.Errorf("Expected storage quota error, got: %v", err)
+	}
+	if got := store.StoredBytes("small"); got != 6 {
+		t.Errorf("Expected 6 stored bytes, got %d", got)
+	}
+
+	// Tenants without a specific quota use the unlimited default
+	for i := 0; i < 5; i++ {
+		if err := store.Add(&Event{ID: fmt.Sprintf("free-%d", i), Tenant: "free"}); err != nil {
+			t.Fatalf("Failed to add event to unlimited tenant: %v", err)
+		}
+	}
+}
+
+func TestEventStorePurge(t *testing.T) {
+	store := NewEventStore(10)
+	store.SetQuotas(map[string]TenantQuota{"short": {Retention: time.Minute}}, TenantQuota{})
+
+	_ = store.Add(&Event{ID: "old", Tenant: "short", Payload: "payload"})
+	_ = store.Add(&Event{ID: "kept", Payload: "payload"})
+
+	if removed := store.Purge(time.Now()); removed != 0 {
+		t.Errorf("Expected nothing purged yet, got %d", removed)
+	}
+	if removed := store.Purge(time.Now().Add(2 * time.Minute)); removed != 1 {
+		t.Errorf("Expected 1 event purged, got %d", removed)
+	}
+	if _, err := store.GetInTenant("short", "old"); err != ErrEventNotFound {
+		t.Errorf("Expected purged event to be gone, got: %v", err)
+	}
+	if store.StoredBytes("short") != 0 {
+		t.Errorf("Expected stored bytes to be released, got %d", store.StoredBytes("short"))
+	}
+	if _, err := store.Get("kept"); err != nil {
+		t.Errorf("Expected event without retention to be kept, got: %v", err)
+	}
+}
+
+func TestEventStoreClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	store := NewEventStore(10)
+	store.SetClock(fake)
+	store.SetQuotas(map[string]TenantQuota{
+		"limited": {EventsPerSecond: 1, Burst: 1},
+		"short":   {Retention: time.Minute},
+	}, TenantQuota{})
+
+	if err := store.Add(&Event{ID: "first", Tenant: "limited"}); err != nil {
+		t.Fatalf("Failed to add event within burst: %v", err)
+	}
+	if err := store.Add(&Event{ID: "second", Tenant: "limited"}); err != ErrRateQuotaExceeded {
+		t.Fatalf("Expected rate quota error, got: %v", err)
+	}
+	if wait := store.RateRetryAfter("limited"); wait != time.Second {
+		t.Errorf("Expected a 1s retry delay, got %v", wait)
+	}
+	fake.Advance(time.Second)
+	if err := store.Add(&Event{ID: "second", Tenant: "limited"}); err != nil {
+		t.Errorf("Expected the quota refilled, got: %v", err)
+	}
+
+	_ = store.Add(&Event{ID: "old", Tenant: "short"})
+	fake.Advance(30 * time.Second)
+	_ = store.Add(&Event{ID: "recent", Tenant: "short"})
+	fake.Advance(45 * time.Second)
+	if removed := store.Purge(fake.Now()); removed != 1 {
+		t.Fatalf("Expected 1 event purged, got %d", removed)
+	}
+	if _, err := store.GetInTenant("short", "recent"); err != nil {
+		t.Errorf("Expected the event within retention kept, got: %v", err)
+	}
+}
+
+func TestEventStoreListInTenant(t *testing.T) {
+	store := NewEventStore(10)
+	for _, id := range []string{"a", "b", "c"} {
+		_ = store.Add(&Event{ID: id, Payload: "payload"})
+	}
+	_ = store.Add(&Event{ID: "other", Tenant: "other"})
+
+	page := store.ListInTenant(DefaultTenant, 0, 2)
+	if len(page) != 2 || page[0].Event.ID != "a" || page[1].Event.ID != "b" {
+		t.Fatalf("Expected first page [a b], got %+v", page)
+	}
+	rest := store.ListInTenant(DefaultTenant, page[1].Seq, 2)
+	if len(rest) != 1 || rest[0].Event.ID != "c" {
+		t.Fatalf("Expected second page [c], got %+v", rest)
+	}
+	if last := store.ListInTenant(DefaultTenant, rest[0].Seq, 2); len(last) != 0 {
+		t.Errorf("Expected empty page after the last event, got %+v", last)
+	}
+	if missing := store.ListInTenant("missing", 0, 0); missing == nil || len(missing) != 0 {
+		t.Errorf("Expected empty non-nil page for unknown tenant, got %#v", missing)
+	}
+}
+
+func TestEventStoreSubscribe(t *testing.T) {
+	store := NewEventStore(10)
+	sub, err := store.Subscribe(DefaultTenant, 1)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	_ = store.Add(&Event{ID: "other", Tenant: "other"})
+	_ = store.Add(&Event{ID: "first"})
+	record := <-sub.C
+	if record.Event.ID != "first" || record.Seq != 1 {
+		t.Errorf("Expected first event with seq 1, got %+v", record)
+	}
+
+	// A full buffer drops the subscriber instead of blocking the store
+	_ = store.Add(&Event{ID: "second"})
+	_ = store.Add(&Event{ID: "third"})
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Fatal("Expected lagging subscription to be closed")
+	}
+	if !sub.Lagged() {
+		t.Error("Expected subscription to report lagging")
+	}
+	sub.Close()
+
+	sub, _ = store.Subscribe(DefaultTenant, 1)
+	store.Close()
+	if _, ok := <-sub.C; ok || sub.Lagged() {
+		t.Error("Expected closing the store to end subscriptions")
+	}
+	if _, err := store.Subscribe(DefaultTenant, 1); err != ErrStoreClosed {
+		t.Errorf("Expected %v after close, got %v", ErrStoreClosed, err)
+	}
+}
+
+func TestEventStoreLanes(t *testing.T) {
+	store := NewEventStoreWithLanes(10, map[Priority]int{PriorityLow: 1})
+	if store.LaneCap(PriorityLow) != 1 || store.LaneCap(PriorityHigh) != 10 || store.QueueCap() != 21 {
+		t.Fatalf("Expected lane capacities 10, 10 and 1, got %d in total", store.QueueCap())
+	}
+
+	if err := store.Add(&Event{ID: "backfill-1", Priority: PriorityLow}); err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	// A full lane refuses its events without holding up the other lanes
+	if err := store.Add(&Event{ID: "backfill-2", Priority: PriorityLow}); err != ErrQueueFull {
+		t.Errorf("Expected %v for a full lane, got %v", ErrQueueFull, err)
+	}
+	for _, event := range []*Event{{ID: "urgent", Priority: PriorityHigh}, {ID: "plain"}} {
+		if err := store.Add(event); err != nil {
+			t.Fatalf("Failed to add event %s: %v", event.ID, err)
+		}
+	}
+	if err := store.Add(&Event{ID: "bad", Priority: "urgent"}); err != ErrInvalidPriority {
+		t.Errorf("Expected %v, got %v", ErrInvalidPriority, err)
+	}
+
+	for lane, id := range map[Priority]string{PriorityHigh: "urgent", PriorityNormal: "plain", PriorityLow: "backfill-1"} {
+		if store.LaneLen(lane) != 1 {
+			t.Errorf("Expected 1 event in the %s lane, got %d", lane, store.LaneLen(lane))
+		}
+		if event := <-store.Lane(lane); event.ID != id {
+			t.Errorf("Expected %s in the %s lane, got %s", id, lane, event.ID)
+		}
+	}
+}
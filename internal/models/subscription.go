@@ -0,0 +1,89 @@
+package models
+
+// Record is a stored event with its sequence number. Sequence numbers
+// increase with every event a tenant stores and are never reused, so they
+// serve as cursors for pagination and stream resumption.
+type Record struct {
+	Seq   uint64
+	Event *Event
+}
+
+// Subscription receives the events of a tenant as they are stored
+type Subscription struct {
+	// C is closed when the subscription ends
+	C      <-chan Record
+	ch     chan Record
+	store  *EventStore
+	tenant string
+	lagged bool
+	done   bool
+}
+
+// Subscribe delivers the events stored in a tenant from now on. A
+// subscriber that falls more than buffer events behind is dropped and
+// reports Lagged, so it can resume from its last sequence number.
+func (s *EventStore) Subscribe(tenant string, buffer int) (*Subscription, error) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan Record, buffer)
+	sub := &Subscription{C: ch, ch: ch, store: s, tenant: tenant}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	subs, ok := s.subscribers[tenant]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		s.subscribers[tenant] = subs
+	}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// broadcast hands a new record to the subscribers of a tenant without
+// blocking. Callers must hold s.mu for writing.
+func (s *EventStore) broadcast(tenant string, record Record) {
+	for sub := range s.subscribers[tenant] {
+		select {
+		case sub.ch <- record:
+		default:
+			delete(s.subscribers[tenant], sub)
+			sub.close(true)
+		}
+	}
+}
+
+// Close stops the subscription and closes C
+func (sub *Subscription) Close() {
+	sub.store.mu.Lock()
+	defer sub.store.mu.Unlock()
+
+	if subs, ok := sub.store.subscribers[sub.tenant]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(sub.store.subscribers, sub.tenant)
+		}
+	}
+	sub.close(false)
+}
+
+// Lagged reports whether the subscription was dropped for falling behind
+func (sub *Subscription) Lagged() bool {
+	sub.store.mu.RLock()
+	defer sub.store.mu.RUnlock()
+	return sub.lagged
+}
+
+// close ends the subscription. Callers must hold the store's lock.
+func (sub *Subscription) close(lagged bool) {
+	if sub.done {
+		return
+	}
+	sub.done = true
+	sub.lagged = lagged
+	close(sub.ch)
+}
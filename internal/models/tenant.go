@@ -0,0 +1,70 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"coding_challenge/internal/ratelimit"
+)
+
+// DefaultTenant owns events submitted without a tenant
+const DefaultTenant = "default"
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidTenant reports whether name can be used as a tenant namespace
+func ValidTenant(name string) bool {
+	return tenantPattern.MatchString(name)
+}
+
+// TenantQuota limits what a tenant may ingest and keep. Zero values are
+// unlimited.
+type TenantQuota struct {
+	EventsPerSecond float64
+	Burst           int
+	MaxStoredBytes  int64
+	Retention       time.Duration
+}
+
+// storedEntry remembers when an event was stored for retention
+type storedEntry struct {
+	id       string
+	seq      uint64
+	storedAt time.Time
+}
+
+// tenantData is the isolated namespace of a single tenant
+type tenantData struct {
+	events  map[string]*Event
+	order   []storedEntry // insertion order, oldest first
+	seq     uint64        // sequence number of the latest event
+	bytes   int64
+	quota   TenantQuota
+	limiter *ratelimit.Bucket
+	// scheduled indexes the tenant's events waiting for delivery
+	scheduled map[string]*scheduledEntry
+	// groups are the tenant's consumer groups by name
+	groups map[string]*groupEntry
+}
+
+func newTenantData(quota TenantQuota) *tenantData {
+	t := &tenantData{
+		events:    make(map[string]*Event),
+		quota:     quota,
+		scheduled: make(map[string]*scheduledEntry),
+		groups:    make(map[string]*groupEntry),
+	}
+	if quota.EventsPerSecond > 0 {
+		t.limiter = ratelimit.NewBucket(quota.EventsPerSecond, quota.Burst)
+	}
+	return t
+}
+
+// eventSize is the number of bytes an event counts against the quota
+func eventSize(e *Event) int64 {
+	size := len(e.ID) + len(e.Payload) + len(e.Type)
+	for key, value := range e.Attributes {
+		size += len(key) + len(value)
+	}
+	return int64(size)
+}
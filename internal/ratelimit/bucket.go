@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at a constant rate up to its burst size
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket. A burst below one is raised to one so
+// that at least a single request can pass.
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Take removes n tokens if available. When it fails it returns how long to
+// wait until n tokens will be available.
+func (b *Bucket) Take(now time.Time, n float64) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, 0
+	}
+	return false, b.wait(n)
+}
+
+// Delay returns how long until n tokens are available, without taking them
+func (b *Bucket) Delay(now time.Time, n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens >= n {
+		return 0
+	}
+	return b.wait(n)
+}
+
+// wait is the time needed to earn the missing tokens. Callers must hold b.mu.
+func (b *Bucket) wait(n float64) time.Duration {
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Allow is Take for a single token
+func (b *Bucket) Allow(now time.Time) bool {
+	ok, _ := b.Take(now, 1)
+	return ok
+}
+
+// lastUsed returns the time of the last refill
+func (b *Bucket) lastUsed() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+// refill adds the tokens earned since the last call. Callers must hold b.mu.
+func (b *Bucket) refill(now time.Time) {
+	if b.last.IsZero() {
+		b.last = now
+		return
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTakeAndRefill(t *testing.T) {
+	bucket := NewBucket(10, 2)
+	now := time.Unix(1000, 0)
+
+	// The burst is available immediately
+	if !bucket.Allow(now) || !bucket.Allow(now) {
+		t.Fatal("Expected burst of 2 to be allowed")
+	}
+
+	ok, wait := bucket.Take(now, 1)
+	if ok {
+		t.Fatal("Expected empty bucket to refuse")
+	}
+	if wait != 100*time.Millisecond {
+		t.Errorf("Expected wait of 100ms, got %v", wait)
+	}
+
+	// One token is earned every 100ms
+	if !bucket.Allow(now.Add(100 * time.Millisecond)) {
+		t.Error("Expected refilled token to be allowed")
+	}
+
+	// Refill is capped at the burst size
+	later := now.Add(time.Hour)
+	if d := bucket.Delay(later, 2); d != 0 {
+		t.Errorf("Expected full bucket, got delay %v", d)
+	}
+	if d := bucket.Delay(later, 3); d <= 0 {
+		t.Errorf("Expected delay above burst, got %v", d)
+	}
+}
+
+func TestKeyedSeparatesAndForgetsKeys(t *testing.T) {
+	keyed := NewKeyed(1, 1, time.Minute)
+	now := time.Unix(1000, 0)
+
+	if ok, _ := keyed.Take("a", now, 1); !ok {
+		t.Fatal("Expected first take for a to pass")
+	}
+	if ok, _ := keyed.Take("a", now, 1); ok {
+		t.Error("Expected second take for a to be limited")
+	}
+	if ok, _ := keyed.Take("b", now, 1); !ok {
+		t.Error("Expected b to have its own bucket")
+	}
+	if keyed.Len() != 2 {
+		t.Errorf("Expected 2 tracked keys, got %d", keyed.Len())
+	}
+
+	// Idle keys are swept on a later call
+	keyed.Take("c", now.Add(2*time.Minute), 1)
+	if keyed.Len() != 1 {
+		t.Errorf("Expected idle keys to be forgotten, got %d", keyed.Len())
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Keyed holds a bucket per key, such as a client, and forgets keys that have
+// been idle long enough for their bucket to refill
+type Keyed struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	idle      time.Duration
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewKeyed creates buckets of the given rate and burst on first use of a key
+func NewKeyed(rate float64, burst int, idle time.Duration) *Keyed {
+	// Forgetting a key earlier than its refill time would hand out free tokens
+	if rate > 0 {
+		if refill := time.Duration(float64(burst) / rate * float64(time.Second)); refill > idle {
+			idle = refill
+		}
+	}
+	return &Keyed{
+		rate:    rate,
+		burst:   burst,
+		idle:    idle,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+// Take removes n tokens from the bucket of key, see Bucket.Take
+func (k *Keyed) Take(key string, now time.Time, n float64) (bool, time.Duration) {
+	k.mu.Lock()
+	if now.Sub(k.lastSweep) >= k.idle {
+		k.sweep(now)
+	}
+	bucket, ok := k.buckets[key]
+	if !ok {
+		bucket = NewBucket(k.rate, k.burst)
+		k.buckets[key] = bucket
+	}
+	k.mu.Unlock()
+
+	return bucket.Take(now, n)
+}
+
+// Len returns the number of keys currently tracked
+func (k *Keyed) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buckets)
+}
+
+// sweep drops idle buckets. Callers must hold k.mu.
+func (k *Keyed) sweep(now time.Time) {
+	for key, bucket := range k.buckets {
+		if now.Sub(bucket.lastUsed()) >= k.idle {
+			delete(k.buckets, key)
+		}
+	}
+	k.lastSweep = now
+}
@@ -0,0 +1,129 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSON path such as $.order.items[0].sku. It selects a
+// value in a JSON document by object keys and array indexes; wildcards,
+// slices and filters are not supported.
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// step is an object key or, when index is not negative, an array index
+type step struct {
+	key   string
+	index int
+}
+
+// ParsePath compiles a path of dot separated keys and bracketed indexes.
+// The leading $ is optional and keys holding dots or brackets are written
+// as ["key"].
+func ParsePath(expr string) (Path, error) {
+	p := Path{expr: expr}
+	rest := expr
+	if strings.HasPrefix(rest, "$") {
+		rest = rest[1:]
+	} else if rest != "" && rest[0] != '[' {
+		rest = "." + rest
+	}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return Path{}, fmt.Errorf("json path %q has an empty key", expr)
+			}
+			p.steps = append(p.steps, step{key: rest[:end], index: -1})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return Path{}, fmt.Errorf("json path %q has an unclosed bracket", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if strings.HasPrefix(inner, `"`) {
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return Path{}, fmt.Errorf("json path %q has an invalid key [%s]", expr, inner)
+				}
+				p.steps = append(p.steps, step{key: key, index: -1})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return Path{}, fmt.Errorf("json path %q has an invalid index [%s]", expr, inner)
+			}
+			p.steps = append(p.steps, step{index: index})
+		default:
+			return Path{}, fmt.Errorf("json path %q is malformed at %q", expr, rest)
+		}
+	}
+	if len(p.steps) == 0 {
+		return Path{}, fmt.Errorf("json path %q selects no field", expr)
+	}
+	return p, nil
+}
+
+// String returns the path as written
+func (p Path) String() string {
+	return p.expr
+}
+
+// Lookup returns the value at the path in a document decoded with
+// encoding/json, and false when the path does not exist
+func (p Path) Lookup(doc interface{}) (interface{}, bool) {
+	for _, s := range p.steps {
+		if s.index >= 0 {
+			array, ok := doc.([]interface{})
+			if !ok || s.index >= len(array) {
+				return nil, false
+			}
+			doc = array[s.index]
+			continue
+		}
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = object[s.key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// decodeJSON decodes a payload, keeping numbers as written so they compare
+// as text
+func decodeJSON(payload string) (interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// valueString renders a JSON value for comparison: strings unquoted,
+// numbers as written and anything else as compact JSON
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,143 @@
+// Package routing picks the pipeline of an event from declarative rules
+// matching its type, ID, attributes and payload, or an expression.
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/models"
+)
+
+// Conditions select events by content, as written in the config. Every
+// condition set must hold, so empty conditions match every event.
+type Conditions struct {
+	// Type must equal the event type
+	Type string `json:"type,omitempty"`
+	// IDPrefix must start the event ID
+	IDPrefix string `json:"id_prefix,omitempty"`
+	// Attributes must all be set on the event with these values
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// PayloadRegex must match somewhere in the payload
+	PayloadRegex string `json:"payload_regex,omitempty"`
+	// JSONPath must exist in the payload decoded as JSON and, when
+	// JSONValue is set, hold that value
+	JSONPath  string `json:"json_path,omitempty"`
+	JSONValue string `json:"json_value,omitempty"`
+	// Expr must evaluate to true, see package expr for the language
+	Expr string `json:"expr,omitempty"`
+}
+
+// Matcher is compiled Conditions
+type Matcher struct {
+	conditions Conditions
+	payload    *regexp.Regexp
+	path       *Path
+	expr       *expr.Program
+}
+
+// Compile checks conditions and prepares them for matching. Evaluations
+// of the expression are bounded by limits.
+func Compile(c Conditions, limits expr.Limits) (*Matcher, error) {
+	m := &Matcher{conditions: c}
+	if c.PayloadRegex != "" {
+		re, err := regexp.Compile(c.PayloadRegex)
+		if err != nil {
+			return nil, fmt.Errorf("payload_regex: %v", err)
+		}
+		m.payload = re
+	}
+	if c.JSONPath != "" {
+		path, err := ParsePath(c.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+		m.path = &path
+	} else if c.JSONValue != "" {
+		return nil, fmt.Errorf("json_value requires json_path")
+	}
+	if c.Expr != "" {
+		program, err := expr.EventEnv.CompileCondition(c.Expr, limits)
+		if err != nil {
+			return nil, fmt.Errorf("expr: %v", err)
+		}
+		m.expr = program
+	}
+	return m, nil
+}
+
+// Match reports whether the event meets every condition. The expression
+// is evaluated last, and an error evaluating it fails the match.
+func (m *Matcher) Match(e *models.Event) (bool, error) {
+	c := m.conditions
+	if c.Type != "" && e.Type != c.Type {
+		return false, nil
+	}
+	if !strings.HasPrefix(e.ID, c.IDPrefix) {
+		return false, nil
+	}
+	for key, want := range c.Attributes {
+		if got, ok := e.Attributes[key]; !ok || got != want {
+			return false, nil
+		}
+	}
+	if m.payload != nil && !m.payload.MatchString(e.Payload) {
+		return false, nil
+	}
+	if m.path != nil {
+		doc, ok := decodeJSON(e.Payload)
+		if !ok {
+			return false, nil
+		}
+		value, ok := m.path.Lookup(doc)
+		if !ok || (c.JSONValue != "" && valueString(value) != c.JSONValue) {
+			return false, nil
+		}
+	}
+	if m.expr != nil {
+		ok, err := m.expr.EvalBool(expr.EventVars(e))
+		if err != nil {
+			return false, fmt.Errorf("expr %q: %v", m.expr, err)
+		}
+		return ok, nil
+	}
+	return true, nil
+}
+
+// Rule sends the events its matcher accepts to a pipeline
+type Rule struct {
+	Pipeline string
+	Match    *Matcher
+}
+
+// Table routes each event by the first rule matching it
+type Table struct {
+	rules    []Rule
+	fallback string
+}
+
+// NewTable creates a table sending events no rule matches to fallback,
+// dropping them when fallback is empty
+func NewTable(rules []Rule, fallback string) *Table {
+	return &Table{rules: rules, fallback: fallback}
+}
+
+// Route returns the pipeline of an event and whether a rule matched it.
+// Unmatched events get the fallback pipeline, possibly empty. A rule
+// whose expression fails to evaluate does not match; the first such error
+// is returned along with the route taken.
+func (t *Table) Route(e *models.Event) (string, bool, error) {
+	var firstErr error
+	for _, rule := range t.rules {
+		ok, err := rule.Match.Match(e)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ok {
+			return rule.Pipeline, true, firstErr
+		}
+	}
+	return t.fallback, false, firstErr
+}
@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/models"
+)
+
+func TestParsePath(t *testing.T) {
+	doc, _ := decodeJSON(`{"order":{"items":[{"sku":"a-1","qty":2}],"a.b":true},"total":12.50}`)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$.order.items[0].sku", "a-1"},
+		{"order.items[0].qty", "2"},
+		{`$.order["a.b"]`, "true"},
+		{"$.total", "12.50"},
+		{"$.order.items", `[{"qty":2,"sku":"a-1"}]`},
+	}
+	for _, tc := range tests {
+		path, err := ParsePath(tc.path)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tc.path, err)
+		}
+		value, ok := path.Lookup(doc)
+		if !ok || valueString(value) != tc.want {
+			t.Errorf("Expected %s at %s, got %v (%v)", tc.want, tc.path, value, ok)
+		}
+	}
+
+	for _, missing := range []string{"$.order.items[1]", "$.order.items.sku", "$.nope"} {
+		path, _ := ParsePath(missing)
+		if _, ok := path.Lookup(doc); ok {
+			t.Errorf("Expected %s to be missing", missing)
+		}
+	}
+	for _, invalid := range []string{"", "$", "$..a", "$.a[", "$.a[-1]", "$.a[x]", "$a"} {
+		if _, err := ParsePath(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestTableRoutesByFirstMatch(t *testing.T) {
+	compile := func(c Conditions) *Matcher {
+		t.Helper()
+		m, err := Compile(c, expr.Limits{})
+		if err != nil {
+			t.Fatalf("Failed to compile %+v: %v", c, err)
+		}
+		return m
+	}
+	table := NewTable([]Rule{
+		{Pipeline: "audit", Match: compile(Conditions{Type: "audit", Attributes: map[string]string{"region": "eu"}})},
+		{Pipeline: "backfill", Match: compile(Conditions{IDPrefix: "bf-"})},
+		{Pipeline: "errors", Match: compile(Conditions{PayloadRegex: `(?i)\berror\b`})},
+		{Pipeline: "vip", Match: compile(Conditions{JSONPath: "$.customer.tier", JSONValue: "gold"})},
+		{Pipeline: "large", Match: compile(Conditions{Type: "order", Expr: `json(payload).total >= 100`})},
+	}, "default")
+
+	tests := []struct {
+		event    models.Event
+		pipeline string
+		matched  bool
+	}{
+		{models.Event{ID: "1", Type: "audit", Attributes: map[string]string{"region": "eu", "x": "y"}}, "audit", true},
+		{models.Event{ID: "2", Type: "audit", Attributes: map[string]string{"region": "us"}}, "default", false},
+		{models.Event{ID: "bf-3", Type: "audit"}, "backfill", true},
+		{models.Event{ID: "4", Payload: "disk ERROR on node"}, "errors", true},
+		{models.Event{ID: "5", Payload: `{"customer":{"tier":"gold"}}`}, "vip", true},
+		{models.Event{ID: "6", Payload: `{"customer":{"tier":"silver"}}`}, "default", false},
+		{models.Event{ID: "7", Payload: "not json"}, "default", false},
+		{models.Event{ID: "8", Type: "order", Payload: `{"total": 250}`}, "large", true},
+		{models.Event{ID: "9", Type: "order", Payload: `{"total": 25.5}`}, "default", false},
+	}
+	for _, tc := range tests {
+		pipeline, matched, err := table.Route(&tc.event)
+		if pipeline != tc.pipeline || matched != tc.matched || err != nil {
+			t.Errorf("Expected event %s routed to %s (%v), got %s (%v, %v)", tc.event.ID, tc.pipeline, tc.matched, pipeline, matched, err)
+		}
+	}
+
+	// A failing expression does not match and its error is reported
+	pipeline, matched, err := table.Route(&models.Event{ID: "10", Type: "order", Payload: "not json"})
+	if pipeline != "default" || matched || err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("Expected the default route with the expression error, got %s (%v, %v)", pipeline, matched, err)
+	}
+
+	if pipeline, matched, _ := NewTable(nil, "").Route(&models.Event{ID: "x"}); pipeline != "" || matched {
+		t.Errorf("Expected no pipeline without a fallback, got %q", pipeline)
+	}
+}
+
+func TestCompileRejectsInvalid(t *testing.T) {
+	for _, c := range []Conditions{
+		{PayloadRegex: "("},
+		{JSONPath: "$..x"},
+		{JSONValue: "gold"},
+		{Expr: "type =="},
+		{Expr: "upper(type)"},
+		{Expr: "unknown == 1"},
+	} {
+		if _, err := Compile(c, expr.Limits{}); err == nil {
+			t.Errorf("Expected %+v to be rejected", c)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/models"
+)
+
+// Error is a simple string-based error type
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// ErrFiltered is returned by a filter for the events it drops. It stops
+// the chain and is not a failure.
+const ErrFiltered = Error("event filtered out")
+
+// Filter returns a transformer dropping the events for which the condition
+// src is false, with ErrFiltered
+func Filter(src string, limits expr.Limits) (Transformer, error) {
+	program, err := expr.TransformedEnv.CompileCondition(src, limits)
+	if err != nil {
+		return nil, err
+	}
+	return Func(func(event *models.TransformedEvent) error {
+		keep, err := program.EvalBool(expr.TransformedVars(event))
+		if err != nil {
+			return fmt.Errorf("filter %q: %v", program, err)
+		}
+		if !keep {
+			return ErrFiltered
+		}
+		return nil
+	}), nil
+}
+
+// mapping sets a field of an event to the value of an expression
+type mapping struct {
+	field   string
+	program *expr.Program
+}
+
+// Map returns a transformer setting fields of the event to the values of
+// expressions. The fields are payload, type, attributes to replace them
+// all with a map, and attributes.<key> for one attribute, removed when
+// the expression is null. Every expression sees the event as it was
+// before the mapping.
+func Map(fields map[string]string, limits expr.Limits) (Transformer, error) {
+	if len(fields) == 0 {
+		return nil, Error("map has no fields")
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	// Sorted, so attributes is replaced before single attributes are set
+	sort.Strings(names)
+
+	mappings := make([]mapping, len(names))
+	for i, field := range names {
+		want, err := fieldType(field)
+		if err != nil {
+			return nil, err
+		}
+		program, err := expr.TransformedEnv.Compile(fields[field], limits)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field, err)
+		}
+		if got := program.Type(); got != expr.TypeAny && got != want && !(got == expr.TypeNull && want == expr.TypeString) {
+			return nil, fmt.Errorf("%s: expression returns %s, not %s", field, got, want)
+		}
+		mappings[i] = mapping{field: field, program: program}
+	}
+
+	return Func(func(event *models.TransformedEvent) error {
+		vars := expr.TransformedVars(event)
+		values := make([]interface{}, len(mappings))
+		for i, m := range mappings {
+			v, err := m.program.Eval(vars)
+			if err != nil {
+				return fmt.Errorf("map %s: %v", m.field, err)
+			}
+			values[i] = v
+		}
+		for i, m := range mappings {
+			if err := set(event, m.field, values[i]); err != nil {
+				return fmt.Errorf("map %s: %v", m.field, err)
+			}
+		}
+		return nil
+	}), nil
+}
+
+// fieldType returns the type of the values a field is set to
+func fieldType(field string) (expr.Type, error) {
+	switch field {
+	case "payload", "type":
+		return expr.TypeString, nil
+	case "attributes":
+		return expr.TypeMap, nil
+	}
+	if key := strings.TrimPrefix(field, "attributes."); key != field && key != "" {
+		return expr.TypeString, nil
+	}
+	return 0, Error("map cannot set " + field + ", only payload, type, attributes and attributes.<key>")
+}
+
+// set assigns the value of an expression to a field of an event
+func set(event *models.TransformedEvent, field string, v interface{}) error {
+	if field == "attributes" {
+		m, ok := v.(map[string]interface{})
+		if !ok && v != nil {
+			return fmt.Errorf("expression returned %s, not a map", expr.TypeOf(v))
+		}
+		attributes := make(map[string]string, len(m))
+		for key, value := range m {
+			s, ok := value.(string)
+			if !ok || key == "" {
+				return fmt.Errorf("attribute %q is not a string", key)
+			}
+			attributes[key] = s
+		}
+		event.Attributes = attributes
+		return nil
+	}
+
+	s, ok := v.(string)
+	if key := strings.TrimPrefix(field, "attributes."); key != field {
+		switch {
+		case v == nil:
+			delete(event.Attributes, key)
+		case !ok:
+			return fmt.Errorf("expression returned %s, not a string", expr.TypeOf(v))
+		default:
+			if event.Attributes == nil {
+				event.Attributes = make(map[string]string)
+			}
+			event.Attributes[key] = s
+		}
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("expression returned %s, not a string", expr.TypeOf(v))
+	}
+	if field == "payload" {
+		event.Payload = s
+	} else {
+		event.Type = s
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package transform holds the transformers a pipeline applies to events
+// between processing and publishing.
+package transform
+
+import (
+	"strings"
+
+	"coding_challenge/internal/models"
+)
+
+// Transformer changes a processed event before it is published
+type Transformer interface {
+	Transform(event *models.TransformedEvent) error
+}
+
+// Func adapts a function to a Transformer
+type Func func(event *models.TransformedEvent) error
+
+// Transform implements Transformer
+func (f Func) Transform(event *models.TransformedEvent) error {
+	return f(event)
+}
+
+// Chain applies its transformers in order, stopping at the first error. An
+// empty chain publishes events unchanged.
+type Chain []Transformer
+
+// Transform implements Transformer
+func (c Chain) Transform(event *models.TransformedEvent) error {
+	for _, t := range c {
+		if err := t.Transform(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Built-in transformers of the payload
+var (
+	Uppercase = Func(func(event *models.TransformedEvent) error {
+		event.Payload = strings.ToUpper(event.Payload)
+		return nil
+	})
+	Lowercase = Func(func(event *models.TransformedEvent) error {
+		event.Payload = strings.ToLower(event.Payload)
+		return nil
+	})
+	TrimSpace = Func(func(event *models.TransformedEvent) error {
+		event.Payload = strings.TrimSpace(event.Payload)
+		return nil
+	})
+)
+
+// builtins are the transformers available by name in the config
+var builtins = map[string]Transformer{
+	"uppercase": Uppercase,
+	"lowercase": Lowercase,
+	"trim":      TrimSpace,
+}
+
+// ByName returns a built-in transformer: uppercase, lowercase or trim
+func ByName(name string) (Transformer, bool) {
+	t, ok := builtins[name]
+	return t, ok
+}
@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"coding_challenge/internal/expr"
+	"coding_challenge/internal/models"
+)
+
+func TestChain(t *testing.T) {
+	trim, _ := ByName("trim")
+	upper, _ := ByName("uppercase")
+	event := &models.TransformedEvent{Payload: "  hello  "}
+	if err := (Chain{trim, upper}).Transform(event); err != nil || event.Payload != "HELLO" {
+		t.Errorf("Expected HELLO, got %q (%v)", event.Payload, err)
+	}
+
+	failed := errors.New("failed")
+	event = &models.TransformedEvent{Payload: "x"}
+	err := Chain{Func(func(*models.TransformedEvent) error { return failed }), Uppercase}.Transform(event)
+	if err != failed || event.Payload != "x" {
+		t.Errorf("Expected the chain to stop at the error, got %q (%v)", event.Payload, err)
+	}
+
+	if _, ok := ByName("reverse"); ok {
+		t.Error("Expected an unknown transformer to be missing")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filter, err := Filter(`type != "debug" && !(attributes.env in ["dev", "test"])`, expr.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to compile the filter: %v", err)
+	}
+	if err := filter.Transform(&models.TransformedEvent{Type: "order", Attributes: map[string]string{"env": "prod"}}); err != nil {
+		t.Errorf("Expected the event kept, got %v", err)
+	}
+	for _, event := range []*models.TransformedEvent{{Type: "debug"}, {Attributes: map[string]string{"env": "dev"}}} {
+		if err := filter.Transform(event); err != ErrFiltered {
+			t.Errorf("Expected %+v filtered out, got %v", event, err)
+		}
+	}
+
+	if _, err := Filter(`upper(payload)`, expr.Limits{}); err == nil {
+		t.Error("Expected a filter not returning a bool to be rejected")
+	}
+	filter, _ = Filter(`json(payload).keep`, expr.Limits{})
+	if err := filter.Transform(&models.TransformedEvent{Payload: `{"keep": 1}`}); err == nil || err == ErrFiltered ||
+		!strings.Contains(err.Error(), "returned int, not a bool") {
+		t.Errorf("Expected an evaluation error, got %v", err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	m, err := Map(map[string]string{
+		"payload":           `toJSON([upper(json(payload).name), attributes.region])`,
+		"type":              `type + ".v2"`,
+		"attributes.region": `default(attributes.region, "unknown")`,
+		"attributes.debug":  `null`,
+		"attributes.worker": `processor_id`,
+	}, expr.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to compile the map: %v", err)
+	}
+	event := &models.TransformedEvent{
+		Type: "user", Payload: `{"name": "ann"}`, ProcessorID: "w1",
+		Attributes: map[string]string{"debug": "1"},
+	}
+	if err := m.Transform(event); err != nil {
+		t.Fatalf("Failed to map: %v", err)
+	}
+	want := &models.TransformedEvent{
+		Type: "user.v2", Payload: `["ANN",null]`, ProcessorID: "w1",
+		Attributes: map[string]string{"region": "unknown", "worker": "w1"},
+	}
+	if !reflect.DeepEqual(event, want) {
+		t.Errorf("Expected %+v, got %+v", want, event)
+	}
+
+	replaced, _ := Map(map[string]string{"attributes": `json(payload)`}, expr.Limits{})
+	event = &models.TransformedEvent{Payload: `{"a": "1", "b": "2"}`, Attributes: map[string]string{"c": "3"}}
+	if err := replaced.Transform(event); err != nil || !reflect.DeepEqual(event.Attributes, map[string]string{"a": "1", "b": "2"}) {
+		t.Errorf("Expected the attributes replaced, got %v (%v)", event.Attributes, err)
+	}
+	event = &models.TransformedEvent{Payload: `{"a": 1}`}
+	if err := replaced.Transform(event); err == nil || !strings.Contains(err.Error(), `attribute "a" is not a string`) {
+		t.Errorf("Expected a non-string attribute to fail, got %v", err)
+	}
+
+	for _, fields := range []map[string]string{
+		nil,
+		{"id": `"x"`},
+		{"attributes.": `"x"`},
+		{"payload": `timestamp`},
+		{"attributes": `"x"`},
+		{"type": `unknown`},
+	} {
+		if _, err := Map(fields, expr.Limits{}); err == nil {
+			t.Errorf("Expected %v to be rejected", fields)
+		}
+	}
+}